@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// ErrCircuitOpen is returned instead of running the query while circuit breaker is open
+var ErrCircuitOpen = errors.New("pg: circuit breaker is open")
+
+// circuitRejectedKey is the Stash key marking query rejected by breaker, distinct type keeps it apart from keys of other hooks
+type circuitRejectedKey struct{}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker is a query hook failing queries fast after threshold connection failures in a row.
+// After cooldown a single trial query is let through: its success closes the circuit, its failure opens it again
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// WithCircuitBreaker makes the client fail queries with ErrCircuitOpen for cooldown after threshold connection
+// failures in a row (network errors and timeouts), so queries are not stacked up during the database outage.
+// SQL errors, e.g. constraint violations, don't affect the circuit. The primary and replicas have own circuits
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		for _, db := range w.dbs() {
+			db.AddQueryHook(newCircuitBreaker(threshold, cooldown))
+		}
+		return w
+	})
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *circuitBreaker) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ctx, b.reject(event)
+		}
+		b.state = circuitHalfOpen
+	case circuitHalfOpen:
+		return ctx, b.reject(event)
+	}
+	return ctx, nil
+}
+
+func (b *circuitBreaker) AfterQuery(_ context.Context, event *pg.QueryEvent) error {
+	// go-pg calls AfterQuery of the hook rejected the query as well
+	if _, rejected := event.Stash[circuitRejectedKey{}]; rejected {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isConnectionError(event.Err) {
+		b.state, b.failures = circuitClosed, 0
+		return nil
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = circuitOpen, time.Now()
+	}
+	return nil
+}
+
+func (b *circuitBreaker) reject(event *pg.QueryEvent) error {
+	if event.Stash == nil {
+		event.Stash = make(map[interface{}]interface{})
+	}
+	event.Stash[circuitRejectedKey{}] = true
+	return ErrCircuitOpen
+}
+
+// isConnectionError reports whether err is caused by unavailable database rather than by the query:
+// network errors, timeouts, dropped connections and server errors of connection exception and shutdown classes
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) {
+		code := pgErr.Field('C')
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "57P")
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
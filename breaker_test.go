@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Unreachable database", func(t *testing.T) {
+		// nothing listens on the port, so queries fail without waiting for timeout
+		client := NewDbClient(pg.Connect(&pg.Options{Addr: "127.0.0.1:1"}), WithCircuitBreaker(2, 50*time.Millisecond))
+		defer client.Close()
+
+		for i := 0; i < 2; i++ {
+			_, err := client.Exec("SELECT 1")
+			assert.Error(t, err)
+			assert.False(t, errors.Is(err, ErrCircuitOpen))
+		}
+		_, err := client.Exec("SELECT 1")
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+
+		time.Sleep(60 * time.Millisecond)
+		_, err = client.Exec("SELECT 1")
+		assert.False(t, errors.Is(err, ErrCircuitOpen))
+		_, err = client.Exec("SELECT 1")
+		assert.True(t, errors.Is(err, ErrCircuitOpen))
+	})
+
+	t.Run("Recovery", func(t *testing.T) {
+		b := newCircuitBreaker(1, 10*time.Millisecond)
+		ctx := context.Background()
+
+		_, err := b.BeforeQuery(ctx, &pg.QueryEvent{})
+		assert.NoError(t, err)
+		assert.NoError(t, b.AfterQuery(ctx, &pg.QueryEvent{Err: context.DeadlineExceeded}))
+
+		event := &pg.QueryEvent{}
+		_, err = b.BeforeQuery(ctx, event)
+		assert.Equal(t, ErrCircuitOpen, err)
+		assert.NoError(t, b.AfterQuery(ctx, event))
+		_, err = b.BeforeQuery(ctx, &pg.QueryEvent{})
+		assert.Equal(t, ErrCircuitOpen, err)
+
+		time.Sleep(20 * time.Millisecond)
+		_, err = b.BeforeQuery(ctx, &pg.QueryEvent{})
+		assert.NoError(t, err)
+		_, err = b.BeforeQuery(ctx, &pg.QueryEvent{})
+		assert.Equal(t, ErrCircuitOpen, err, "only one trial query is let through")
+		assert.NoError(t, b.AfterQuery(ctx, &pg.QueryEvent{}))
+
+		_, err = b.BeforeQuery(ctx, &pg.QueryEvent{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("SQL errors", func(t *testing.T) {
+		assert.False(t, isConnectionError(pg.ErrNoRows))
+		assert.False(t, isConnectionError(errors.New("pg: can't find column")))
+		assert.True(t, isConnectionError(context.DeadlineExceeded))
+	})
+}
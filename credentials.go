@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+const (
+	// credentialsTimeout limits fetching of credentials from provider
+	credentialsTimeout = 10 * time.Second
+	// credentialsRetryInterval is the pause between failed refreshes of credentials
+	credentialsRetryInterval = 5 * time.Second
+)
+
+// Credentials are user and password of new connections, zero Expires means the credentials don't expire
+type Credentials struct {
+	User     string
+	Password string
+	Expires  time.Time
+}
+
+// CredentialsProvider returns short-lived credentials, e.g. RDS IAM auth token or Vault dynamic credentials
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsProviderFunc is a function implementing CredentialsProvider
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials implements CredentialsProvider
+func (f CredentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// WithCredentials makes connections to the primary authenticate with credentials of provider. Credentials are fetched
+// by Connect and ConnectWithDSN before connecting (by NewDbClient on creation of the client) and are refreshed
+// in background refreshBefore they expire, failed refresh is retried every 5 seconds. Connections opened after
+// refresh use the new credentials, open connections are kept as Postgres doesn't authenticate them again.
+// Empty user of credentials keeps the configured one. ConnectWithDSN fails if credentials are not fetched before
+// connecting, failed fetches are logged with the logger of WithLogger or standard logger otherwise
+func WithCredentials(provider CredentialsProvider, refreshBefore time.Duration) Option {
+	// initial are credentials fetched before connecting or error of the fetch, they are taken by the created client
+	var initial *Credentials
+	var initialErr error
+	return Option{
+		configure: func(cfg *pg.Options) {
+			creds, err := fetchCredentials(provider)
+			if err != nil {
+				initialErr = err
+				return
+			}
+			creds.apply(cfg)
+			initial = &creds
+		},
+		apply: func(w *dbWrapper) *dbWrapper {
+			w.credentials = newCredentialsRefresher(w.conn, provider, refreshBefore, initial, initialErr)
+			initial, initialErr = nil, nil
+			return w
+		},
+	}
+}
+
+// apply sets the credentials to cfg
+func (c Credentials) apply(cfg *pg.Options) {
+	if c.User != "" {
+		cfg.User = c.User
+	}
+	cfg.Password = c.Password
+}
+
+// credentialsRefresher keeps handle of the primary with fresh credentials. Options of go-pg connection are read
+// without synchronization when connections are opened, so refreshed credentials are set to options of a new handle
+// sharing the pool and query hooks of the current one, instead of changing options of the handle in use
+type credentialsRefresher struct {
+	provider      CredentialsProvider
+	refreshBefore time.Duration
+
+	current atomic.Pointer[pg.DB]
+	expires time.Time
+	// err is the error of fetch of credentials the primary is connected with
+	err    error
+	logger Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newCredentialsRefresher creates refresher of credentials of base, initial credentials are the ones base is
+// connected with, they are fetched on creation if both initial and err of their fetch are nil
+func newCredentialsRefresher(base *pg.DB, provider CredentialsProvider, refreshBefore time.Duration,
+	initial *Credentials, err error) *credentialsRefresher {
+	r := &credentialsRefresher{
+		provider:      provider,
+		refreshBefore: refreshBefore,
+		stop:          make(chan struct{}),
+	}
+	r.current.Store(base)
+	switch {
+	case initial != nil:
+		r.expires = initial.Expires
+	case err == nil:
+		err = r.refresh()
+	}
+	if err != nil {
+		r.err = fmt.Errorf("failed to fetch credentials: %w", err)
+		r.expires = time.Now()
+	}
+	return r
+}
+
+// db returns handle of the primary with the current credentials
+func (r *credentialsRefresher) db() *pg.DB {
+	return r.current.Load()
+}
+
+// run refreshes credentials before they expire until the refresher is closed, it is started after all the options
+// are applied, so query hooks added by them are shared by the refreshed handles and failures are logged with
+// the configured logger
+func (r *credentialsRefresher) run(logger Logger) {
+	r.logger = logger
+	if r.err != nil {
+		r.logError(r.err)
+	}
+	for !r.expires.IsZero() {
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(time.Until(r.expires) - r.refreshBefore):
+		}
+
+		if err := r.refresh(); err != nil {
+			r.logError(fmt.Errorf("failed to refresh credentials: %w", err))
+			r.expires = time.Now().Add(r.refreshBefore + credentialsRetryInterval)
+		}
+	}
+}
+
+// logError logs failed fetch of credentials with the logger or standard logger
+func (r *credentialsRefresher) logError(err error) {
+	if r.logger == nil {
+		log.Println(err.Error())
+		return
+	}
+	r.logger.Error(err.Error())
+}
+
+// refresh fetches credentials and replaces the current handle
+func (r *credentialsRefresher) refresh() error {
+	creds, err := fetchCredentials(r.provider)
+	if err != nil {
+		return err
+	}
+
+	opts := r.db().Options()
+	db := r.db().WithTimeout(opts.ReadTimeout)
+	newOpts := db.Options()
+	newOpts.WriteTimeout = opts.WriteTimeout
+	creds.apply(newOpts)
+
+	r.current.Store(db)
+	r.expires = creds.Expires
+	return nil
+}
+
+func (r *credentialsRefresher) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+// fetchCredentials returns credentials of provider
+func fetchCredentials(provider CredentialsProvider) (Credentials, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialsTimeout)
+	defer cancel()
+	return provider.Credentials(ctx)
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWithCredentials(t *testing.T) {
+	var calls int32
+	provider := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		n := atomic.AddInt32(&calls, 1)
+		return Credentials{
+			User:     "iam",
+			Password: fmt.Sprintf("token%d", n),
+			Expires:  time.Now().Add(50 * time.Millisecond),
+		}, nil
+	})
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := Connect("test", &pg.Options{Addr: "localhost:1", User: "app", ReadTimeout: time.Second},
+		WithCredentials(provider, 40*time.Millisecond), WithLogger(ZapLogger(zap.New(core)), 0))
+	defer client.Close()
+
+	opts := client.Db().Options()
+	assert.Equal(t, "iam", opts.User)
+	assert.Equal(t, "token1", opts.Password)
+
+	require.Eventually(t, func() bool {
+		return client.Db().Options().Password != "token1"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "token1", opts.Password)
+	assert.Equal(t, time.Second, client.Db().Options().ReadTimeout)
+	assert.Zero(t, client.Db().Options().WriteTimeout)
+
+	logs.TakeAll()
+	_, _ = client.Exec("SELECT 1")
+	assert.Len(t, logs.TakeAll(), 1)
+}
+
+func TestNewDbClient_WithCredentials(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1", User: "app"})
+	provider := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{Password: "secret"}, nil
+	})
+	client := NewDbClient(conn, WithCredentials(provider, time.Minute))
+	defer client.Close()
+
+	assert.Equal(t, "app", client.Db().Options().User)
+	assert.Equal(t, "secret", client.Db().Options().Password)
+}
+
+func TestWithCredentials_Error(t *testing.T) {
+	fetchErr := errors.New("vault is sealed")
+	provider := CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{}, fetchErr
+	})
+
+	_, err := ConnectWithDSN("test", "postgres://app@localhost:1/db", WithCredentials(provider, time.Minute))
+	assert.ErrorIs(t, err, fetchErr)
+
+	core, logs := observer.New(zapcore.ErrorLevel)
+	client := Connect("test", &pg.Options{Addr: "localhost:1", User: "app"},
+		WithCredentials(provider, time.Minute), WithLogger(ZapLogger(zap.New(core)), 0))
+	defer client.Close()
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessageSnippet("vault is sealed").Len() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// ExportOpts configures ExportCSV
+type ExportOpts struct {
+	// Header makes the first line contain column names
+	Header bool
+	// Delimiter separates values, comma by default
+	Delimiter rune
+	// Columns are the exported columns, all columns of the model by default
+	Columns []string
+	// Apply changes the query, e.g. filters rows with opt.Apply of the DAO
+	Apply func(q *orm.Query) (*orm.Query, error)
+}
+
+// ImportOpts configures ImportCSV
+type ImportOpts struct {
+	// Header makes columns be read from the first line, values are mapped to fields of the model by column names
+	// or names of the fields
+	Header bool
+	// Delimiter separates values, comma by default
+	Delimiter rune
+	// Columns are the imported columns in order of values when there is no header, all columns of the model
+	// by default
+	Columns []string
+}
+
+// ExportCSV writes rows of the table of model selected by the query built with Model in CSV format to w
+// with `COPY (SELECT ...) TO STDOUT`, soft deleted rows are skipped as they are by Select. It returns the number
+// of exported rows
+func ExportCSV(ctx context.Context, client Client, w io.Writer, model interface{}, opts ExportOpts) (int, error) {
+	q := client.WithContext(ctx).Model(model)
+	if len(opts.Columns) > 0 {
+		q = q.Column(opts.Columns...)
+	}
+	if opts.Apply != nil {
+		q = q.Apply(opts.Apply)
+	}
+
+	res, err := client.WithContext(ctx).CopyTo(w, &copyToQuery{
+		sel:     orm.NewSelectQuery(q),
+		options: csvOptions(opts.Header, opts.Delimiter),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// ImportCSV loads rows in CSV format of r into the table of model with `COPY ... FROM STDIN`, values are mapped
+// to columns by the header or by Columns. Unknown columns of the header are rejected. Rows are loaded
+// within transaction of ctx, if any. It returns the number of imported rows
+func ImportCSV(ctx context.Context, client Client, r io.Reader, model interface{}, opts ImportOpts) (int, error) {
+	table, err := csvTable(model)
+	if err != nil {
+		return 0, err
+	}
+
+	columns := opts.Columns
+	br := bufio.NewReader(r)
+	if opts.Header {
+		if columns, err = readCSVHeader(br, opts.Delimiter); err != nil {
+			return 0, err
+		}
+	}
+	fields, err := csvFields(table, columns)
+	if err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (%s)", table.SQLName, strings.Join(fields, ", "),
+		csvOptions(false, opts.Delimiter))
+	res, err := client.WithContext(ctx).CopyFrom(br, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// copyToQuery wraps select query with COPY TO STDOUT, so the select is formatted by formatter of the client
+type copyToQuery struct {
+	sel     *orm.SelectQuery
+	options string
+}
+
+func (q *copyToQuery) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	b = append(b, "COPY ("...)
+	b, err := q.sel.AppendQuery(fmter, b)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, ") TO STDOUT WITH ("+q.options+")"...), nil
+}
+
+// csvOptions returns options of COPY in CSV format
+func csvOptions(header bool, delimiter rune) string {
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	return fmt.Sprintf("FORMAT csv, HEADER %t, DELIMITER %s", header,
+		types.AppendString(nil, string(delimiter), 1))
+}
+
+// csvTable returns table of model, a pointer to struct or to slice of structs
+func csvTable(model interface{}) (*orm.Table, error) {
+	typ := reflect.TypeOf(model)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("pg: CSV model must be a struct or slice of structs, got %T", model)
+	}
+	return orm.GetTable(typ), nil
+}
+
+// readCSVHeader reads column names of the first line of r
+func readCSVHeader(r *bufio.Reader, delimiter rune) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, fmt.Errorf("pg: read CSV header: %w", err)
+	}
+
+	cr := csv.NewReader(strings.NewReader(line))
+	if delimiter != 0 {
+		cr.Comma = delimiter
+	}
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("pg: read CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	return header, nil
+}
+
+// csvFields returns escaped columns of table matching columns by SQL or Go name, all columns of table if columns
+// are empty
+func csvFields(table *orm.Table, columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		fields := make([]string, 0, len(table.Fields))
+		for _, f := range table.Fields {
+			fields = append(fields, string(f.Column))
+		}
+		return fields, nil
+	}
+
+	fields := make([]string, 0, len(columns))
+	for _, column := range columns {
+		field := csvField(table, column)
+		if field == nil {
+			return nil, fmt.Errorf("pg: CSV column %q is not a column of %s", column, table.SQLName)
+		}
+		fields = append(fields, string(field.Column))
+	}
+	return fields, nil
+}
+
+// csvField returns field of table with SQL or Go name matching column case-insensitively
+func csvField(table *orm.Table, column string) *orm.Field {
+	for _, f := range table.Fields {
+		if strings.EqualFold(f.SQLName, column) || strings.EqualFold(f.GoName, column) {
+			return f
+		}
+	}
+	return nil
+}
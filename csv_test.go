@@ -0,0 +1,66 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type csvUser struct {
+	ID    int
+	Email string
+}
+
+func TestCopyToQuery(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "127.0.0.1:1"})
+	defer conn.Close()
+
+	q := NewDbClient(conn).Model((*csvUser)(nil)).Column("id").Where("id > ?", 1)
+	b, err := (&copyToQuery{sel: orm.NewSelectQuery(q), options: csvOptions(true, ';')}).AppendQuery(conn.Formatter(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, `COPY (SELECT "id" FROM "csv_users" AS "csv_user" WHERE (id > 1)) TO STDOUT `+
+		`WITH (FORMAT csv, HEADER true, DELIMITER ';')`, string(b))
+}
+
+func TestReadCSVHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("\ufeffEmail; id\na@b.c;1\n"))
+	header, err := readCSVHeader(r, ';')
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Email", "id"}, header)
+
+	// the rest is left for COPY
+	rest, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "a@b.c;1\n", string(rest))
+
+	table, err := csvTable(&[]csvUser{})
+	require.NoError(t, err)
+	fields, err := csvFields(table, header)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`"email"`, `"id"`}, fields)
+
+	fields, err = csvFields(table, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`"id"`, `"email"`}, fields)
+}
+
+func TestImportCSV_Errors(t *testing.T) {
+	client := Connect("test", &pg.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+
+	_, err := ImportCSV(context.Background(), client, strings.NewReader("id,name\n"), &csvUser{}, ImportOpts{Header: true})
+	assert.EqualError(t, err, `pg: CSV column "name" is not a column of "csv_users"`)
+
+	_, err = ImportCSV(context.Background(), client, strings.NewReader(""), new(int), ImportOpts{})
+	assert.Error(t, err)
+
+	_, err = ImportCSV(context.Background(), client, strings.NewReader(""), &csvUser{}, ImportOpts{Header: true})
+	assert.Error(t, err)
+}
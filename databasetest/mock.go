@@ -0,0 +1,472 @@
+// Package databasetest provides MockClient implementing database Client without live Postgres, so repositories
+// built on the DAO can be unit-tested with programmed query results
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// Expectation is a query expected by MockClient and its programmed result
+type Expectation struct {
+	substr   string
+	rows     *Rows
+	affected int
+	err      error
+	called   bool
+}
+
+// WillReturnRows sets rows returned by the query, RowsAffected of the result is the number of rows unless set
+// with WillAffect
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	if e.affected < 0 {
+		e.affected = len(rows.values)
+	}
+	return e
+}
+
+// WillReturnModel sets records returned by the query, model is a pointer to struct or slice of structs
+func (e *Expectation) WillReturnModel(model interface{}) *Expectation {
+	return e.WillReturnRows(ModelRows(model))
+}
+
+// WillAffect sets RowsAffected of the result
+func (e *Expectation) WillAffect(n int) *Expectation {
+	e.affected = n
+	return e
+}
+
+// WillReturnError sets error returned by the query
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// String returns description of the expectation
+func (e *Expectation) String() string {
+	return fmt.Sprintf("query containing %q", e.substr)
+}
+
+type mockState struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	queries      []string
+}
+
+// MockClient is Client matching executed queries against expectations in order of their registration. Queries
+// built with Model are formatted with the default formatter, so expectations match the SQL sent to Postgres.
+// Unexpected query fails with error. RunInTx calls fn without transaction, so Tx and Db return nil
+type MockClient struct {
+	state *mockState
+	ctx   context.Context
+}
+
+var _ db.Client = (*MockClient)(nil)
+var _ orm.DB = (*MockClient)(nil)
+
+// NewMockClient creates MockClient without expectations
+func NewMockClient() *MockClient {
+	return &MockClient{state: &mockState{}}
+}
+
+// Expect registers expectation of the query containing substr, empty substr matches any query
+func (m *MockClient) Expect(substr string) *Expectation {
+	e := &Expectation{substr: substr, affected: -1}
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.expectations = append(m.state.expectations, e)
+	return e
+}
+
+// ExpectationsWereMet returns error if any registered expectation was not matched
+func (m *MockClient) ExpectationsWereMet() error {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	for _, e := range m.state.expectations {
+		if !e.called {
+			return fmt.Errorf("databasetest: expected %s was not executed", e)
+		}
+	}
+	return nil
+}
+
+// Queries returns all executed queries
+func (m *MockClient) Queries() []string {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	return append([]string(nil), m.state.queries...)
+}
+
+// match records the query and returns the next expectation if the query contains its substring
+func (m *MockClient) match(query string) (*Expectation, error) {
+	m.state.mu.Lock()
+	defer m.state.mu.Unlock()
+	m.state.queries = append(m.state.queries, query)
+
+	for _, e := range m.state.expectations {
+		if e.called {
+			continue
+		}
+		if !strings.Contains(query, e.substr) {
+			return nil, fmt.Errorf("databasetest: query %q doesn't match expected %s", query, e)
+		}
+		e.called = true
+		return e, nil
+	}
+	return nil, fmt.Errorf("databasetest: unexpected query %q", query)
+}
+
+// run formats the query, matches it and scans programmed rows into model
+func (m *MockClient) run(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	q, err := formatQuery(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	e, err := m.match(q)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	res := &result{affected: e.affected}
+	if res.affected < 0 {
+		res.affected = 0
+	}
+	if e.rows == nil || len(e.rows.values) == 0 {
+		return res, nil
+	}
+	if model == nil {
+		res.returned = len(e.rows.values)
+		return res, nil
+	}
+
+	res.model, err = orm.NewModel(model)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.model.Init(); err != nil {
+		return nil, err
+	}
+	for _, row := range e.rows.values {
+		if err := e.rows.scan(res.model, row); err != nil {
+			return nil, err
+		}
+		res.returned++
+	}
+	return res, nil
+}
+
+// runOne acts like run, but the query must affect exactly one row
+func (m *MockClient) runOne(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	res, err := m.run(model, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	switch n := res.RowsAffected(); {
+	case n == 0:
+		return nil, pg.ErrNoRows
+	case n > 1:
+		return nil, pg.ErrMultiRows
+	}
+	return res, nil
+}
+
+// formatQuery returns SQL of the query as it is sent to Postgres
+func formatQuery(query interface{}, params ...interface{}) (string, error) {
+	fmter := orm.NewFormatter()
+	switch query := query.(type) {
+	case orm.QueryCommand:
+		b, err := query.AppendQuery(fmter.WithModel(query), nil)
+		return string(b), err
+	case orm.QueryAppender:
+		b, err := query.AppendQuery(fmter, nil)
+		return string(b), err
+	case string:
+		if len(params) > 0 {
+			if model, ok := params[len(params)-1].(orm.TableModel); ok {
+				return string(fmter.WithTableModel(model).FormatQuery(nil, query, params[:len(params)-1]...)), nil
+			}
+		}
+		return string(fmter.FormatQuery(nil, query, params...)), nil
+	}
+	return "", fmt.Errorf("databasetest: can't append %T", query)
+}
+
+// Db returns nil, as there is no connection
+func (m *MockClient) Db() *pg.DB {
+	return nil
+}
+
+// Tx returns nil, as RunInTx doesn't start transaction
+func (m *MockClient) Tx() *pg.Tx {
+	return nil
+}
+
+// RunInTx calls fn with ctx, queries of fn are matched against expectations as is
+func (m *MockClient) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m *MockClient) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// WithContext returns client bound to ctx sharing expectations with m
+func (m *MockClient) WithContext(ctx context.Context) db.Client {
+	return &MockClient{state: m.state, ctx: ctx}
+}
+
+func (m *MockClient) Close() error {
+	return nil
+}
+
+// Shutdown does nothing, as there are no queries in flight
+func (m *MockClient) Shutdown(context.Context) error {
+	return nil
+}
+
+// HealthReport returns healthy primary
+func (m *MockClient) HealthReport() db.HealthReport {
+	return db.HealthReport{Primary: db.NodeHealth{Addr: "mock", Healthy: true}}
+}
+
+// HealthCheck returns healthy primary
+func (m *MockClient) HealthCheck(context.Context, db.HealthOpts) db.HealthCheckReport {
+	return db.HealthCheckReport{Healthy: true, Primary: db.NodeCheck{Addr: "mock", Healthy: true}}
+}
+
+// Stats returns empty stats
+func (m *MockClient) Stats(context.Context) (db.Stats, error) {
+	return db.Stats{}, nil
+}
+
+// ActiveQueries returns no queries
+func (m *MockClient) ActiveQueries(context.Context) ([]db.ActiveQuery, error) {
+	return nil, nil
+}
+
+// SQLDB isn't supported by mock
+func (m *MockClient) SQLDB() (*sql.DB, error) {
+	return nil, errors.New("databasetest: SQLDB is not supported by mock")
+}
+
+func (m *MockClient) Model(model ...interface{}) *orm.Query {
+	return orm.NewQueryContext(m.Context(), m, model...)
+}
+
+func (m *MockClient) ModelContext(c context.Context, model ...interface{}) *orm.Query {
+	return orm.NewQueryContext(c, m, model...)
+}
+
+func (m *MockClient) Select(model interface{}) error {
+	return m.Model(model).WherePK().Select()
+}
+
+func (m *MockClient) Insert(model ...interface{}) error {
+	_, err := m.Model(model...).Insert()
+	return err
+}
+
+func (m *MockClient) Update(model interface{}) error {
+	_, err := m.Model(model).WherePK().Update()
+	return err
+}
+
+func (m *MockClient) Delete(model interface{}) error {
+	_, err := m.Model(model).WherePK().Delete()
+	return err
+}
+
+func (m *MockClient) ForceDelete(model interface{}) error {
+	_, err := m.Model(model).WherePK().ForceDelete()
+	return err
+}
+
+func (m *MockClient) Exec(query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.run(nil, query, params...)
+}
+
+func (m *MockClient) ExecContext(_ context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.run(nil, query, params...)
+}
+
+func (m *MockClient) ExecOne(query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.runOne(nil, query, params...)
+}
+
+func (m *MockClient) ExecOneContext(_ context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.runOne(nil, query, params...)
+}
+
+func (m *MockClient) Query(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.run(model, query, params...)
+}
+
+func (m *MockClient) QueryContext(_ context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.run(model, query, params...)
+}
+
+func (m *MockClient) QueryOne(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.runOne(model, query, params...)
+}
+
+func (m *MockClient) QueryOneContext(_ context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.runOne(model, query, params...)
+}
+
+// CopyFrom matches the query, data of r is discarded
+func (m *MockClient) CopyFrom(r io.Reader, query interface{}, params ...interface{}) (orm.Result, error) {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	return m.run(nil, query, params...)
+}
+
+// CopyTo matches the query, nothing is written into w
+func (m *MockClient) CopyTo(_ io.Writer, query interface{}, params ...interface{}) (orm.Result, error) {
+	return m.run(nil, query, params...)
+}
+
+func (m *MockClient) FormatQuery(b []byte, query string, params ...interface{}) []byte {
+	return orm.NewFormatter().FormatQuery(b, query, params...)
+}
+
+func (m *MockClient) Formatter() orm.QueryFormatter {
+	return orm.NewFormatter()
+}
+
+// result implements orm.Result
+type result struct {
+	model    orm.Model
+	affected int
+	returned int
+}
+
+func (r *result) Model() orm.Model {
+	return r.model
+}
+
+func (r *result) RowsAffected() int {
+	return r.affected
+}
+
+func (r *result) RowsReturned() int {
+	return r.returned
+}
+
+// Rows are rows returned by the query, values are passed to scanners in Postgres text format
+type Rows struct {
+	columns []string
+	values  [][][]byte
+}
+
+// NewRows creates empty rows of the columns
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow appends row of values in order of columns, nil value is NULL
+func (r *Rows) AddRow(values ...interface{}) *Rows {
+	row := make([][]byte, len(r.columns))
+	for i := range row {
+		if i < len(values) {
+			row[i] = textValue(reflect.ValueOf(values[i]), func(b []byte, v reflect.Value) []byte {
+				return types.Append(b, v.Interface(), 0)
+			})
+		}
+	}
+	r.values = append(r.values, row)
+	return r
+}
+
+// ModelRows returns rows of records of the model, model is a pointer to struct or slice of structs
+func ModelRows(model interface{}) *Rows {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	elems := []reflect.Value{v}
+	if v.Kind() == reflect.Slice {
+		elems = elems[:0]
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, reflect.Indirect(v.Index(i)))
+		}
+	}
+
+	typ := v.Type()
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	table := orm.GetTable(typ)
+
+	rows := &Rows{}
+	for _, f := range table.Fields {
+		rows.columns = append(rows.columns, f.SQLName)
+	}
+	for _, elem := range elems {
+		row := make([][]byte, len(table.Fields))
+		for i, f := range table.Fields {
+			f := f
+			row[i] = textValue(f.Value(elem), func(b []byte, _ reflect.Value) []byte {
+				return f.AppendValue(b, elem, 0)
+			})
+		}
+		rows.values = append(rows.values, row)
+	}
+	return rows
+}
+
+// textValue encodes v with appendFn, nil is returned for NULL. Booleans are encoded as Postgres does,
+// as go-pg appends them as TRUE/FALSE literals
+func textValue(v reflect.Value, appendFn func(b []byte, v reflect.Value) []byte) []byte {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte("t")
+		}
+		return []byte("f")
+	}
+	return appendFn([]byte{}, v)
+}
+
+// scan passes row to the next column scanner of model
+func (r *Rows) scan(model orm.Model, row [][]byte) error {
+	scanner := model.NextColumnScanner()
+	for i, value := range row {
+		col := types.ColumnInfo{Index: int16(i), Name: r.columns[i]}
+		n := len(value)
+		if value == nil {
+			n = -1
+		}
+		if err := scanner.ScanColumn(col, &bytesReader{b: value}, n); err != nil {
+			return err
+		}
+	}
+	return model.AddColumnScanner(scanner)
+}
@@ -0,0 +1,67 @@
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	"github.com/stretchr/testify/assert"
+)
+
+type agent struct {
+	tableName struct{}          `pg:"agent"`
+	ID        int64             `pg:"id"`
+	Name      string            `pg:"name,notnull,use_zero"`
+	IsBlocked bool              `pg:"is_blocked,notnull,use_zero"`
+	Tags      []string          `pg:"tags,array"`
+	Meta      map[string]string `pg:"meta,type:jsonb"`
+	Created   time.Time         `pg:"created,type:timestamp"`
+	Deleted   *time.Time        `pg:"deleted,type:timestamp"`
+}
+
+func TestMockClient(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockClient()
+	repo := dao.New(mock)
+
+	created := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := &agent{ID: 1, Name: "it's", IsBlocked: true, Tags: []string{"a", "b c"}, Meta: map[string]string{"k": "v"}, Created: created}
+	mock.Expect(`FROM "agent" AS "agent" WHERE ("id" = 1)`).WillReturnModel(want)
+	mock.Expect(`FROM "agent"`)
+	mock.Expect(`SELECT count(*)`).WillReturnRows(NewRows("count").AddRow(42))
+	mock.Expect(`INSERT INTO "agent"`).WillReturnRows(NewRows("id").AddRow(7))
+	mock.Expect(`DELETE FROM "agent"`).WillReturnError(errors.New("connection refused"))
+
+	got := &agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", 1))))
+	assert.True(t, want.Created.Equal(got.Created))
+	got.Created = want.Created
+	assert.Equal(t, want, got)
+
+	err := repo.FindOne(ctx, &agent{}, opt.List(opt.Eq("id", 2)))
+	assert.True(t, pkgerr.IsNotFound(err))
+
+	total, err := repo.GetTotal(ctx, &agent{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, total)
+
+	rec := &agent{Name: "new"}
+	assert.NoError(t, repo.Insert(ctx, rec))
+	assert.Equal(t, int64(7), rec.ID)
+
+	assert.Error(t, repo.HardDelete(ctx, rec))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, mock.Queries(), 5)
+
+	_, err = mock.Exec("SELECT 1")
+	assert.Error(t, err)
+
+	mock.Expect("DELETE")
+	assert.Error(t, mock.ExpectationsWereMet())
+	_, err = mock.WithContext(ctx).Exec("UPDATE agent SET name = ?", "x")
+	assert.Error(t, err)
+}
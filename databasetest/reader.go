@@ -0,0 +1,81 @@
+package databasetest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// bytesReader implements types.Reader over the value of the column
+type bytesReader struct {
+	b []byte
+	i int
+}
+
+func (r *bytesReader) Buffered() int {
+	return len(r.b) - r.i
+}
+
+func (r *bytesReader) Bytes() []byte {
+	return r.b[r.i:]
+}
+
+func (r *bytesReader) Read(b []byte) (int, error) {
+	if r.i >= len(r.b) {
+		return 0, io.EOF
+	}
+	n := copy(b, r.b[r.i:])
+	r.i += n
+	return n, nil
+}
+
+func (r *bytesReader) ReadByte() (byte, error) {
+	if r.i >= len(r.b) {
+		return 0, io.EOF
+	}
+	c := r.b[r.i]
+	r.i++
+	return c, nil
+}
+
+func (r *bytesReader) UnreadByte() error {
+	if r.i <= 0 {
+		return errors.New("databasetest: UnreadByte at beginning of value")
+	}
+	r.i--
+	return nil
+}
+
+func (r *bytesReader) ReadSlice(delim byte) ([]byte, error) {
+	if i := bytes.IndexByte(r.b[r.i:], delim); i >= 0 {
+		line := r.b[r.i : r.i+i+1]
+		r.i += i + 1
+		return line, nil
+	}
+	line := r.b[r.i:]
+	r.i = len(r.b)
+	return line, io.EOF
+}
+
+func (r *bytesReader) Discard(n int) (int, error) {
+	if n > r.Buffered() {
+		n = r.Buffered()
+		r.i = len(r.b)
+		return n, io.EOF
+	}
+	r.i += n
+	return n, nil
+}
+
+func (r *bytesReader) ReadFull() ([]byte, error) {
+	b := make([]byte, r.Buffered())
+	copy(b, r.b[r.i:])
+	r.i = len(r.b)
+	return b, nil
+}
+
+func (r *bytesReader) ReadFullTemp() ([]byte, error) {
+	b := r.b[r.i:]
+	r.i = len(r.b)
+	return b, nil
+}
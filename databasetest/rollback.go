@@ -0,0 +1,100 @@
+package databasetest
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// savepoint is the name of savepoint of transactions started within the test transaction
+const savepoint = "databasetest_tx"
+
+// savepointKey is the context key of the test transaction which savepoint is active
+type savepointKey struct{}
+
+// rollbackClient runs all queries within the test transaction
+type rollbackClient struct {
+	db.Client
+	tx *pg.Tx
+}
+
+// WithRollback begins transaction and returns client running all queries within it, the transaction is rolled back
+// when the test ends, so tests are isolated from each other without cleaning tables and can run in parallel.
+// The transaction is bound to any context passed to WithContext and RunInTx of the returned client, transactions
+// started by the code under test run within savepoints of it, so like in production their rollback undoes their own
+// changes only and nested transactions join the outer one. Close of the returned client doesn't close client.
+// The test fails if client has no go-pg handle (Db returns nil), e.g. client of pgxclient
+func WithRollback(t testing.TB, client db.Client) db.Client {
+	t.Helper()
+
+	if client.Db() == nil {
+		t.Fatalf("Failed to begin test transaction, client has no go-pg connection")
+	}
+	tx, err := client.Db().Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin test transaction, error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+
+	c := &rollbackClient{tx: tx}
+	c.Client = client.WithContext(c.bind(context.Background()))
+	return c
+}
+
+// bind returns ctx with the test transaction
+func (c *rollbackClient) bind(ctx context.Context) context.Context {
+	if db.FromContext(ctx) == c.tx {
+		return ctx
+	}
+	return context.WithValue(ctx, &db.TxKey, c.tx)
+}
+
+func (c *rollbackClient) WithContext(ctx context.Context) db.Client {
+	return &rollbackClient{Client: c.Client.WithContext(c.bind(ctx)), tx: c.tx}
+}
+
+// RunInTx executes fn within savepoint of the test transaction, which is rolled back to if fn returns an error,
+// panics or ctx is done. Otherwise the savepoint is released and callbacks of db.AfterCommit are called as if
+// the transaction is committed. If ctx already contains transaction of RunInTx, fn joins it
+func (c *rollbackClient) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx = c.bind(ctx)
+	if ctx.Value(savepointKey{}) == c.tx {
+		return fn(ctx)
+	}
+
+	if _, err := c.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = c.tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint)
+			panic(p)
+		}
+	}()
+
+	txCtx, committed := db.ContextWithAfterCommit(context.WithValue(ctx, savepointKey{}, c.tx))
+	if err := fn(txCtx); err != nil || ctx.Err() != nil {
+		// ctx may be done, so rollback runs without it
+		if _, rollbackErr := c.tx.Exec("ROLLBACK TO SAVEPOINT " + savepoint); rollbackErr != nil {
+			return rollbackErr
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if _, err := c.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+	committed()
+	return nil
+}
+
+func (c *rollbackClient) Close() error {
+	return nil
+}
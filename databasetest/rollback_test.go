@@ -0,0 +1,57 @@
+//go:build !ci
+// +build !ci
+
+package databasetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRollback(t *testing.T) {
+	var id int64
+	t.Run("insert", func(t *testing.T) {
+		ctx := context.Background()
+		repo := dao.New(WithRollback(t, testDb))
+
+		rec := &agent{Name: "rolled back"}
+		assert.NoError(t, repo.Insert(ctx, rec))
+		id = rec.ID
+
+		inner := &agent{Name: "inner"}
+		err := repo.WithTX(ctx, func(ctx context.Context) error {
+			if err := repo.Insert(ctx, inner); err != nil {
+				return err
+			}
+			return repo.WithTX(ctx, func(ctx context.Context) error {
+				return errors.New("error")
+			})
+		})
+		assert.Error(t, err)
+
+		exists, err := repo.Exists(ctx, &agent{}, opt.List(opt.Eq("id", id)))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = repo.Exists(ctx, &agent{}, opt.List(opt.Eq("id", inner.ID)))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		committed := &agent{Name: "committed"}
+		assert.NoError(t, repo.WithTX(ctx, func(ctx context.Context) error {
+			return repo.Insert(ctx, committed)
+		}))
+		exists, err = repo.Exists(ctx, &agent{}, opt.List(opt.Eq("id", committed.ID)))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	exists, err := dao.New(testDb).Exists(context.Background(), &agent{}, opt.List(opt.Eq("id", id)))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,82 @@
+package databasetest
+
+import (
+	pg "github.com/go-pg/pg/v10"
+)
+
+// Template is a snapshot of migrated database, recreating the database from the template with
+// `CREATE DATABASE ... TEMPLATE` is much faster than truncating tables of large schema between test suites
+type Template struct {
+	opts     *pg.Options
+	database string
+	name     string
+}
+
+// NewTemplate creates template database name as a copy of database of dsn, e.g. after migrations are applied.
+// Existing template is replaced. Connections to the database are terminated, as Postgres copies database
+// without other connections only
+func NewTemplate(dsn, name string) (*Template, error) {
+	opts, err := pg.ParseURL(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl := &Template{opts: opts, database: opts.Database, name: name}
+	err = tpl.exec(func(conn *pg.DB) error {
+		if err := terminate(conn, tpl.database); err != nil {
+			return err
+		}
+		return recreate(conn, tpl.name, tpl.database)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+// Restore drops database of dsn and recreates it from the template. Connections to the database are terminated,
+// so clients have to be reconnected
+func (tpl *Template) Restore() error {
+	return tpl.exec(func(conn *pg.DB) error {
+		if err := terminate(conn, tpl.database); err != nil {
+			return err
+		}
+		return recreate(conn, tpl.database, tpl.name)
+	})
+}
+
+// Drop drops template database
+func (tpl *Template) Drop() error {
+	return tpl.exec(func(conn *pg.DB) error {
+		return recreate(conn, tpl.name, "")
+	})
+}
+
+// exec runs fn with connection to maintenance database
+func (tpl *Template) exec(fn func(conn *pg.DB) error) error {
+	opts := *tpl.opts
+	opts.Database = "postgres"
+	conn := pg.Connect(&opts)
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+// terminate closes all connections to database
+func terminate(conn *pg.DB, database string) error {
+	_, err := conn.Exec(`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = ? AND pid <> pg_backend_pid()`,
+		database)
+	return err
+}
+
+// recreate drops database and creates it from template, database is only dropped if template is empty
+func recreate(conn *pg.DB, database, template string) error {
+	if _, err := conn.Exec("DROP DATABASE IF EXISTS ?", pg.Ident(database)); err != nil {
+		return err
+	}
+	if template == "" {
+		return nil
+	}
+	_, err := conn.Exec("CREATE DATABASE ? TEMPLATE ?", pg.Ident(database), pg.Ident(template))
+	return err
+}
@@ -0,0 +1,45 @@
+//go:build !ci
+// +build !ci
+
+package databasetest
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	u, err := url.Parse(os.Getenv("DSN"))
+	assert.NoError(t, err)
+	u.Path = "/databasetest_template_work"
+	dsn := u.String()
+
+	dbc, err := test.CreateDB("databasetest_test", dsn)
+	assert.NoError(t, err)
+	seedDB(dbc)
+	assert.NoError(t, dbc.Insert(&agent{Name: "seed"}))
+	assert.NoError(t, dbc.Close())
+
+	tpl, err := NewTemplate(dsn, "databasetest_template")
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, tpl.Drop()) }()
+
+	dbc, err = test.CreateDB("databasetest_test", dsn)
+	assert.NoError(t, err)
+	assert.NoError(t, dbc.Insert(&agent{Name: "changed"}))
+	assert.NoError(t, dbc.Close())
+
+	assert.NoError(t, tpl.Restore())
+
+	dbc, err = test.CreateDB("databasetest_test", dsn)
+	assert.NoError(t, err)
+	defer dbc.Close()
+	var names []string
+	_, err = dbc.Query(&names, `SELECT "name" FROM "agent"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"seed"}, names)
+}
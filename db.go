@@ -8,25 +8,54 @@ import (
 	"github.com/go-pg/pg/v10/orm"
 )
 
+// ConnectWithDSN connects to database of dsn and checks the connection. Connection pool is configured with pool_*
+// parameters of dsn (see PoolMaxConnsParam etc.) unless it is configured with WithPool. TLS is configured with sslmode,
+// sslrootcert, sslcert and sslkey parameters as libpq does unless it is configured with WithTLS
 func ConnectWithDSN(appName, dsn string, options ...Option) (Client, error) {
+	dsn, poolValues, err := cutParams(dsn, poolParams...)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := parsePoolParams(poolValues)
+	if err != nil {
+		return nil, err
+	}
+	dsn, tlsValues, err := cutParams(dsn, tlsParams...)
+	if err != nil {
+		return nil, err
+	}
 	cfg, err := pg.ParseURL(dsn)
 	if err != nil {
 		return nil, err
 	}
+	pool.apply(cfg)
+	if err := configureTLS(cfg, dsn, tlsValues); err != nil {
+		return nil, err
+	}
 
 	client := Connect(appName, cfg, options...)
+	if w, ok := client.(*dbWrapper); ok && w.credentials != nil && w.credentials.err != nil {
+		_ = client.Close()
+		return nil, w.credentials.err
+	}
 	if _, err := client.ExecOne("select 1"); err != nil {
 		return nil, err
 	}
 	return client, nil
 }
 
+// Connect connects to database of cfg changed by options, e.g. WithPool
 func Connect(AppName string, cfg *pg.Options, options ...Option) Client {
 	if cfg.OnConnect == nil {
 		cfg.OnConnect = onConnect(AppName)
 	}
+	if cfg.ApplicationName == "" {
+		cfg.ApplicationName = AppName
+	}
 
-	return NewDbClient(pg.Connect(cfg), options...)
+	configureOptions(cfg, options)
+
+	return newDbClient(pg.Connect(cfg), options)
 }
 
 // GetTableName returns table name by model
@@ -45,3 +74,17 @@ func onConnect(appName string) func(ctx context.Context, conn *pg.Conn) error {
 		return nil
 	}
 }
+
+// addOnConnect makes OnConnect of cfg execute query after the current OnConnect
+func addOnConnect(cfg *pg.Options, query string, params ...interface{}) {
+	onConnect := cfg.OnConnect
+	cfg.OnConnect = func(ctx context.Context, conn *pg.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, conn); err != nil {
+				return err
+			}
+		}
+		_, err := conn.ExecContext(ctx, query, params...)
+		return err
+	}
+}
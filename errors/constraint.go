@@ -0,0 +1,57 @@
+package errors
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+)
+
+const (
+	pgDetailField     = 'D'
+	pgSchemaField     = 's'
+	pgTableField      = 't'
+	pgColumnField     = 'c'
+	pgConstraintField = 'n'
+)
+
+// ConstraintError describes violated constraint, it is wrapped by errors converted from integrity constraint
+// violations, e.g. to render "email already taken" for unique index of email
+type ConstraintError struct {
+	// Constraint is name of the violated constraint or index
+	Constraint string
+	Schema     string
+	Table      string
+	// Column is set for not-null violation only
+	Column string
+	// Detail is detail message of the error, e.g. "Key (email)=(a@b.c) already exists."
+	Detail string
+	err    pg.Error
+}
+
+func newConstraintError(err pg.Error) *ConstraintError {
+	return &ConstraintError{
+		Constraint: err.Field(pgConstraintField),
+		Schema:     err.Field(pgSchemaField),
+		Table:      err.Field(pgTableField),
+		Column:     err.Field(pgColumnField),
+		Detail:     err.Field(pgDetailField),
+		err:        err,
+	}
+}
+
+func (e *ConstraintError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.err
+}
+
+// AsConstraint returns violated constraint of err
+func AsConstraint(err error) (*ConstraintError, bool) {
+	var ce *ConstraintError
+	if errors.As(err, &ce) {
+		return ce, true
+	}
+	return nil, false
+}
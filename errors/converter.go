@@ -3,6 +3,7 @@ package errors
 import (
 	"context"
 	"errors"
+	"net"
 	"strings"
 
 	"github.com/go-pg/pg/v10"
@@ -15,8 +16,47 @@ const (
 	pgMessageField = 'M'
 )
 
-// Convert ...
+// SQLSTATE codes of Postgres errors
+const (
+	codeNotNullViolation      = "23502"
+	codeForeignKeyViolation   = "23503"
+	codeUniqueViolation       = "23505"
+	codeCheckViolation        = "23514"
+	codeExclusionViolation    = "23P01"
+	codeInsufficientPrivilege = "42501"
+	codeSerializationFailure  = "40001"
+	codeDeadlockDetected      = "40P01"
+	codeQueryCanceled         = "57014"
+	codeLockNotAvailable      = "55P03"
+	codeIdleInTxTimeout       = "25P03"
+)
+
+// Convert converts err of query into Error, err already converted (e.g. Conflict of outdated version
+// returned by DAO) is returned unchanged
 func Convert(ctx context.Context, err error) Error {
+	var converted Error
+	if errors.As(err, &converted) {
+		return converted
+	}
+
+	result := withQuery(convertErr(ctx, err), err)
+	if converted, ok := convertRegistered(ctx, result); ok {
+		return converted
+	}
+	return result
+}
+
+func convertErr(ctx context.Context, err error) Error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return NewCanceledError(err).WithMessage(err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewTimeoutError(err).WithMessage(err.Error())
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return NewTimeoutError(err).WithMessage(err.Error())
+	}
+
 	for {
 		if err == pg.ErrNoRows {
 			return NewNotFoundError(err)
@@ -25,7 +65,7 @@ func Convert(ctx context.Context, err error) Error {
 		}
 
 		if errTyped, ok := err.(pg.Error); ok {
-			return convert(errTyped)
+			return convert(ctx, errTyped)
 		}
 
 		oldErr := err
@@ -36,14 +76,36 @@ func Convert(ctx context.Context, err error) Error {
 	}
 }
 
-func convert(err pg.Error) Error {
+func convert(ctx context.Context, err pg.Error) Error {
 	var result Error
 	message := err.Field(pgMessageField)
 
-	if strings.Contains(message, pgDuplicateErr) {
-		result = NewConflictError(err)
-	} else {
-		result = NewInternalError(err)
+	switch err.Field(pgCodeField) {
+	case codeUniqueViolation, codeExclusionViolation:
+		result = NewConflictError(newConstraintError(err))
+	case codeForeignKeyViolation:
+		result = NewFailedPreconditionError(newConstraintError(err))
+	case codeCheckViolation, codeNotNullViolation:
+		result = NewBadRequestError(newConstraintError(err))
+	case codeSerializationFailure, codeDeadlockDetected:
+		result = NewRetryableError(err)
+	case codeInsufficientPrivilege:
+		result = NewForbiddenError(err)
+	case codeQueryCanceled:
+		// statement is cancelled by go-pg when context is done or by statement_timeout
+		if ctx != nil && errors.Is(ctx.Err(), context.Canceled) {
+			result = NewCanceledError(err)
+		} else {
+			result = NewTimeoutError(err)
+		}
+	case codeLockNotAvailable, codeIdleInTxTimeout:
+		result = NewTimeoutError(err)
+	default:
+		if strings.Contains(message, pgDuplicateErr) {
+			result = NewConflictError(err)
+		} else {
+			result = NewInternalError(err)
+		}
 	}
 
 	return result.WithParams(err.Field(pgCodeField), err.Field(pgStatusField)).WithMessage(message)
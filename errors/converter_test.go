@@ -0,0 +1,199 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+type pgError map[byte]string
+
+func (e pgError) Error() string {
+	return e[pgMessageField]
+}
+
+func (e pgError) Field(field byte) string {
+	return e[field]
+}
+
+func (e pgError) IntegrityViolation() bool {
+	return e[pgCodeField][:2] == "23"
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		code string
+		is   func(err error) bool
+	}{
+		{code: "23505", is: IsConflict},
+		{code: "23503", is: IsFailedPrecondition},
+		{code: "23514", is: IsBadRequest},
+		{code: "23502", is: IsBadRequest},
+		{code: "40001", is: IsRetryable},
+		{code: "40P01", is: IsRetryable},
+		{code: "42P01", is: IsInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			err := Convert(context.Background(), pgError{pgCodeField: tt.code, pgMessageField: "failed"})
+			assert.True(t, tt.is(err))
+			assert.Equal(t, tt.code, err.Code())
+			assert.Equal(t, "failed", err.Error())
+		})
+	}
+}
+
+func TestConvert_Constraint(t *testing.T) {
+	err := Convert(context.Background(), pgError{
+		pgCodeField:       "23505",
+		pgMessageField:    `duplicate key value violates unique constraint "user_email_key"`,
+		pgDetailField:     "Key (email)=(a@b.c) already exists.",
+		pgSchemaField:     "public",
+		pgTableField:      "user",
+		pgConstraintField: "user_email_key",
+	})
+	assert.True(t, IsConflict(err))
+
+	ce, ok := AsConstraint(err)
+	assert.True(t, ok)
+	assert.Equal(t, "user_email_key", ce.Constraint)
+	assert.Equal(t, "public", ce.Schema)
+	assert.Equal(t, "user", ce.Table)
+	assert.Equal(t, "Key (email)=(a@b.c) already exists.", ce.Detail)
+
+	_, ok = AsConstraint(Convert(context.Background(), pgError{pgCodeField: "40001"}))
+	assert.False(t, ok)
+}
+
+func TestStatus(t *testing.T) {
+	err := Convert(context.Background(), pgError{pgCodeField: "23503", pgMessageField: "violates foreign key"})
+	assert.Equal(t, codes.FailedPrecondition, GRPCStatus(err).Code())
+	assert.Equal(t, "violates foreign key", GRPCStatus(err).Message())
+	assert.Equal(t, http.StatusUnprocessableEntity, HTTPStatus(err))
+
+	err = NewNotFoundError(errors.New("not found"))
+	assert.Equal(t, codes.NotFound, GRPCStatus(err).Code())
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(err))
+
+	plain := errors.New("unknown")
+	assert.Equal(t, codes.Internal, GRPCStatus(plain).Code())
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(plain))
+
+	assert.Equal(t, codes.OK, GRPCStatus(nil).Code())
+	assert.Equal(t, http.StatusOK, HTTPStatus(nil))
+}
+
+func TestConvert_Query(t *testing.T) {
+	src := NewQueryError(pgError{pgCodeField: "23505", pgConstraintField: "user_email_key"},
+		`INSERT INTO "user" ("id", "email") VALUES (1, 'it''s@b.c')`, `"user"`)
+	err := Convert(context.Background(), src)
+	assert.True(t, IsConflict(err))
+
+	var qe *QueryError
+	assert.True(t, errors.As(err, &qe))
+	assert.Equal(t, "INSERT", qe.Operation)
+	assert.Equal(t, `"user"`, qe.Table)
+	assert.Equal(t, `INSERT INTO "user" ("id", "email") VALUES (?, ?)`, qe.Query)
+
+	ce, ok := AsConstraint(err)
+	assert.True(t, ok)
+	assert.Equal(t, "user_email_key", ce.Constraint)
+}
+
+func TestErrors_Is(t *testing.T) {
+	err := fmt.Errorf("find user: %w", NewNotFoundError(errors.New("no rows")))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrConflict))
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsInternal(err))
+
+	var typed Error
+	assert.True(t, errors.As(err, &typed))
+	assert.True(t, typed.TypeOf(NotFound))
+
+	for sentinel, err := range map[error]Error{
+		ErrConflict:           NewConflictError(nil),
+		ErrBadRequest:         NewBadRequestError(nil),
+		ErrFailedPrecondition: NewFailedPreconditionError(nil),
+		ErrRetryable:          NewRetryableError(nil),
+		ErrForbidden:          NewForbiddenError(nil),
+		ErrTimeout:            NewTimeoutError(nil),
+		ErrCanceled:           NewCanceledError(nil),
+		ErrInternal:           NewInternalError(nil),
+	} {
+		assert.True(t, errors.Is(err, sentinel), sentinel.Error())
+		assert.False(t, errors.Is(err, ErrNotFound), sentinel.Error())
+	}
+	assert.True(t, IsInternal(errors.New("plain")))
+}
+
+func TestConvert_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Convert(ctx, fmt.Errorf("select: %w", context.Canceled))
+	assert.True(t, errors.Is(err, ErrCanceled))
+	assert.Equal(t, StatusClientClosedRequest, HTTPStatus(err))
+
+	err = Convert(ctx, pgError{pgCodeField: "57014", pgMessageField: "canceling statement due to user request"})
+	assert.True(t, IsCanceled(err))
+
+	err = Convert(context.Background(), pgError{pgCodeField: "57014", pgMessageField: "canceling statement due to statement timeout"})
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, http.StatusGatewayTimeout, HTTPStatus(err))
+
+	err = Convert(context.Background(), context.DeadlineExceeded)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, context.DeadlineExceeded.Error(), err.Error())
+
+	err = Convert(context.Background(), pgError{pgCodeField: "55P03"})
+	assert.True(t, IsTimeout(err))
+}
+
+type emailTakenError struct{}
+
+func (emailTakenError) Error() string {
+	return "email already taken"
+}
+
+func TestRegisterConverter(t *testing.T) {
+	defer resetConverters()
+	RegisterConverter(func(ctx context.Context, err error) (error, bool) {
+		if ce, ok := AsConstraint(err); ok && ce.Constraint == "user_email_key" {
+			return emailTakenError{}, true
+		}
+		return nil, false
+	})
+	RegisterConverter(func(ctx context.Context, err error) (error, bool) {
+		if errors.Is(err, context.Canceled) {
+			return NewBadRequestError(err), true
+		}
+		return nil, false
+	})
+
+	err := Convert(context.Background(), pgError{pgCodeField: "23505", pgConstraintField: "user_email_key"})
+	assert.True(t, IsConflict(err))
+	assert.Equal(t, "23505", err.Code())
+	assert.Equal(t, "email already taken", err.Error())
+	assert.True(t, errors.As(err, new(emailTakenError)))
+
+	err = Convert(context.Background(), pgError{pgCodeField: "23505", pgConstraintField: "user_login_key"})
+	assert.True(t, IsConflict(err))
+	assert.False(t, errors.As(err, new(emailTakenError)))
+
+	assert.True(t, IsBadRequest(Convert(context.Background(), context.Canceled)))
+}
+
+func TestConvert_Converted(t *testing.T) {
+	conflict := NewConflictError(errors.New("version 1 is outdated"))
+	assert.Equal(t, conflict, Convert(context.Background(), conflict))
+
+	err := Convert(context.Background(), fmt.Errorf("soft delete: %w", conflict))
+	assert.True(t, IsConflict(err))
+	assert.Equal(t, conflict, err)
+}
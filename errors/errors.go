@@ -1,12 +1,19 @@
 package errors
 
+import "errors"
+
 type ErrorType string
 
 const (
-	Internal   = "Internal error"
-	NotFound   = "Entity not found"
-	Conflict   = "Entity already exists"
-	BadRequest = "Found too many entities"
+	Internal           = "Internal error"
+	NotFound           = "Entity not found"
+	Conflict           = "Entity already exists"
+	BadRequest         = "Found too many entities"
+	FailedPrecondition = "Referenced entity not found"
+	Retryable          = "Transaction must be retried"
+	Forbidden          = "Operation not permitted"
+	Timeout            = "Operation timed out"
+	Canceled           = "Operation canceled"
 )
 
 type Error interface {
@@ -93,34 +100,107 @@ func NewConflictError(err error) Error {
 	return &dbError{typ: Conflict, err: err}
 }
 
-func IsInternal(err error) bool {
-	v, ok := err.(Error)
-	if !ok {
-		return true
+// NewFailedPreconditionError creates error of operation referencing missing entity or deleting referenced one
+func NewFailedPreconditionError(err error) Error {
+	return &dbError{typ: FailedPrecondition, err: err}
+}
+
+// NewRetryableError creates error of transaction which can succeed if it is retried, e.g. serialization failure
+func NewRetryableError(err error) Error {
+	return &dbError{typ: Retryable, err: err}
+}
+
+// NewForbiddenError creates error of operation not permitted to the database user
+func NewForbiddenError(err error) Error {
+	return &dbError{typ: Forbidden, err: err}
+}
+
+// NewTimeoutError creates error of operation cancelled on timeout
+func NewTimeoutError(err error) Error {
+	return &dbError{typ: Timeout, err: err}
+}
+
+// NewCanceledError creates error of operation cancelled by the caller
+func NewCanceledError(err error) Error {
+	return &dbError{typ: Canceled, err: err}
+}
+
+// typeError is sentinel of error type, errors of the type match it with errors.Is
+type typeError ErrorType
+
+func (e typeError) Error() string {
+	return string(e)
+}
+
+// Sentinels of error types, e.g. errors.Is(err, ErrNotFound) is equal to IsNotFound(err)
+var (
+	ErrInternal           error = typeError(Internal)
+	ErrNotFound           error = typeError(NotFound)
+	ErrConflict           error = typeError(Conflict)
+	ErrBadRequest         error = typeError(BadRequest)
+	ErrFailedPrecondition error = typeError(FailedPrecondition)
+	ErrRetryable          error = typeError(Retryable)
+	ErrForbidden          error = typeError(Forbidden)
+	ErrTimeout            error = typeError(Timeout)
+	ErrCanceled           error = typeError(Canceled)
+)
+
+// Is reports whether target is sentinel of the error type
+func (e *dbError) Is(target error) bool {
+	t, ok := target.(typeError)
+	return ok && ErrorType(t) == e.typ
+}
+
+// typeOf reports whether err or an error it wraps is Error of typ, found is false if there is no Error
+func typeOf(err error, typ ErrorType) (is, found bool) {
+	var v Error
+	if !errors.As(err, &v) {
+		return false, false
 	}
-	return v.TypeOf(Internal)
+	return v.TypeOf(typ), true
+}
+
+func IsInternal(err error) bool {
+	is, found := typeOf(err, Internal)
+	return is || !found
 }
 
 func IsNotFound(err error) bool {
-	v, ok := err.(Error)
-	if !ok {
-		return false
-	}
-	return v.TypeOf(NotFound)
+	is, _ := typeOf(err, NotFound)
+	return is
 }
 
 func IsBadRequest(err error) bool {
-	v, ok := err.(Error)
-	if !ok {
-		return false
-	}
-	return v.TypeOf(BadRequest)
+	is, _ := typeOf(err, BadRequest)
+	return is
 }
 
 func IsConflict(err error) bool {
-	v, ok := err.(Error)
-	if !ok {
-		return false
-	}
-	return v.TypeOf(Conflict)
+	is, _ := typeOf(err, Conflict)
+	return is
+}
+
+func IsFailedPrecondition(err error) bool {
+	is, _ := typeOf(err, FailedPrecondition)
+	return is
+}
+
+func IsRetryable(err error) bool {
+	is, _ := typeOf(err, Retryable)
+	return is
+}
+
+func IsForbidden(err error) bool {
+	is, _ := typeOf(err, Forbidden)
+	return is
+}
+
+func IsTimeout(err error) bool {
+	is, _ := typeOf(err, Timeout)
+	return is
+}
+
+func IsCanceled(err error) bool {
+	is, _ := typeOf(err, Canceled)
+	return is
 }
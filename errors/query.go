@@ -0,0 +1,66 @@
+package errors
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// maxQueryLen is the max length of query snippet of QueryError
+const maxQueryLen = 256
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// QueryError describes failed query, it is attached to errors of clients created with WithQueryErrors option
+// and kept by Convert, so it can be retrieved with errors.As
+type QueryError struct {
+	// Operation is the first keyword of the query, e.g. SELECT
+	Operation string
+	// Table is table of the query model, empty for queries without model
+	Table string
+	// Query is the query with string and numeric literals replaced with ?, truncated to 256 bytes
+	Query string
+	err   error
+}
+
+// NewQueryError wraps err of query run with model of table, literals of query are redacted
+func NewQueryError(err error, query, table string) *QueryError {
+	query = strings.TrimSpace(query)
+	operation := query
+	if i := strings.IndexAny(query, " \t\n"); i >= 0 {
+		operation = query[:i]
+	}
+
+	query = numericLiteral.ReplaceAllString(stringLiteral.ReplaceAllString(query, "?"), "?")
+	if len(query) > maxQueryLen {
+		query = query[:maxQueryLen] + "..."
+	}
+	return &QueryError{Operation: strings.ToUpper(operation), Table: table, Query: query, err: err}
+}
+
+func (e *QueryError) Error() string {
+	if e.Table == "" {
+		return e.Operation + ": " + e.err.Error()
+	}
+	return e.Operation + " " + e.Table + ": " + e.err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.err
+}
+
+// withQuery attaches QueryError of src to result
+func withQuery(result Error, src error) Error {
+	var qe *QueryError
+	e, ok := result.(*dbError)
+	if !ok || !errors.As(src, &qe) {
+		return result
+	}
+	wrapped := *qe
+	wrapped.err = e.err
+	e.err = &wrapped
+	return e
+}
@@ -0,0 +1,53 @@
+package errors
+
+import (
+	"context"
+	"sync"
+)
+
+// ConverterFunc converts err into domain specific error, it reports false if err is not handled
+type ConverterFunc func(ctx context.Context, err error) (error, bool)
+
+var (
+	convertersMu sync.RWMutex
+	converters   []ConverterFunc
+)
+
+// RegisterConverter adds fn to Convert, registered converters are tried in order of registration with the result
+// of the default conversion wrapping the original error, e.g. AsConstraint works for it. Error returned by fn is
+// returned by Convert as is if it implements Error, otherwise it is wrapped into Error of the default conversion type,
+// so predicates keep working and errors.As finds the domain error
+func RegisterConverter(fn ConverterFunc) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters = append(converters, fn)
+}
+
+// resetConverters removes registered converters
+func resetConverters() {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters = nil
+}
+
+// convertRegistered converts result of the default conversion with the first matching registered converter
+func convertRegistered(ctx context.Context, result Error) (Error, bool) {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+
+	for _, fn := range converters {
+		converted, ok := fn(ctx, result)
+		if !ok || converted == nil {
+			continue
+		}
+		if typed, ok := converted.(Error); ok {
+			return typed, true
+		}
+		e := &dbError{typ: Internal, message: converted.Error(), err: converted}
+		if d, ok := result.(*dbError); ok {
+			e.typ, e.code, e.status = d.typ, d.code, d.status
+		}
+		return e, true
+	}
+	return nil, false
+}
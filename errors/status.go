@@ -0,0 +1,68 @@
+package errors
+
+import (
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is non-standard HTTP status of request cancelled by the client
+const StatusClientClosedRequest = 499
+
+// GRPCStatus returns gRPC status of err, errors not converted with Convert are Internal
+func GRPCStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	return status.New(grpcCode(err), err.Error())
+}
+
+// HTTPStatus returns HTTP status code of err, errors not converted with Convert are Internal Server Error
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case IsNotFound(err):
+		return http.StatusNotFound
+	case IsConflict(err):
+		return http.StatusConflict
+	case IsBadRequest(err):
+		return http.StatusBadRequest
+	case IsFailedPrecondition(err):
+		return http.StatusUnprocessableEntity
+	case IsRetryable(err):
+		return http.StatusServiceUnavailable
+	case IsForbidden(err):
+		return http.StatusForbidden
+	case IsTimeout(err):
+		return http.StatusGatewayTimeout
+	case IsCanceled(err):
+		return StatusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func grpcCode(err error) codes.Code {
+	switch {
+	case IsNotFound(err):
+		return codes.NotFound
+	case IsConflict(err):
+		return codes.AlreadyExists
+	case IsBadRequest(err):
+		return codes.InvalidArgument
+	case IsFailedPrecondition(err):
+		return codes.FailedPrecondition
+	case IsRetryable(err):
+		return codes.Aborted
+	case IsForbidden(err):
+		return codes.PermissionDenied
+	case IsTimeout(err):
+		return codes.DeadlineExceeded
+	case IsCanceled(err):
+		return codes.Canceled
+	default:
+		return codes.Internal
+	}
+}
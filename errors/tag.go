@@ -1,5 +1,7 @@
 package errors
 
+import "errors"
+
 type Tag struct{}
 
 func NewTag() *Tag {
@@ -7,8 +9,8 @@ func NewTag() *Tag {
 }
 
 func (t Tag) IsTagged(err error) bool {
-	v, ok := err.(Error)
-	if !ok {
+	var v Error
+	if !errors.As(err, &v) {
 		return false
 	}
 
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// explainTimeout limits EXPLAIN of slow query run by logger
+const explainTimeout = 5 * time.Second
+
+// explainKey marks context of EXPLAIN run by logger, so the EXPLAIN itself is neither logged nor explained.
+// Distinct type keeps it apart from keys of other context values
+type explainKey struct{}
+
+// explainable are the first keywords of statements supported by EXPLAIN
+var explainable = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "WITH": true, "VALUES": true, "TABLE": true,
+}
+
+// WithAutoExplain makes logger run EXPLAIN (FORMAT JSON) of the logged query taking longer than threshold
+// on a separate connection and log the plan in plan field. The query is planned, not executed again, and is planned
+// outside of its transaction, so queries of objects created in the transaction fail to explain. The failure is logged
+// in explain_error field. All literals of the plan are masked if WithParamRedaction is enabled
+func WithAutoExplain(threshold time.Duration) LoggerOption {
+	return func(l *dbLogger) {
+		l.explainThreshold = threshold
+	}
+}
+
+// explain returns plan of query run for duration if WithAutoExplain is enabled and duration exceeds its threshold
+func (d *dbLogger) explain(query string, duration time.Duration) (string, error) {
+	if d.explainThreshold <= 0 || duration < d.explainThreshold || d.db == nil || !isExplainable(query) {
+		return "", nil
+	}
+
+	plan, err := runExplain(d.db, query)
+	if err != nil || d.redactor == nil {
+		return plan, err
+	}
+	return redactPlan(plan)
+}
+
+// runExplain returns JSON plan of query run on db
+func runExplain(db *pg.DB, query string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), explainKey{}, true), explainTimeout)
+	defer cancel()
+
+	var plan string
+	_, err := db.QueryOneContext(ctx, pg.Scan(&plan), "EXPLAIN (ANALYZE false, FORMAT JSON) "+query)
+	return plan, err
+}
+
+// redactPlan masks literals of expressions of JSON plan
+func redactPlan(plan string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(plan), &v); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(redactPlanNode(v))
+	return string(b), err
+}
+
+func redactPlanNode(v interface{}) interface{} {
+	switch n := v.(type) {
+	case string:
+		return literalRegexp.ReplaceAllString(n, redactedValue)
+	case []interface{}:
+		for i := range n {
+			n[i] = redactPlanNode(n[i])
+		}
+	case map[string]interface{}:
+		for k := range n {
+			n[k] = redactPlanNode(n[k])
+		}
+	}
+	return v
+}
+
+// isExplainable reports whether query is a statement supported by EXPLAIN
+func isExplainable(query string) bool {
+	fields := strings.Fields(strings.TrimLeft(query, " \t\r\n("))
+	return len(fields) > 0 && explainable[strings.ToUpper(fields[0])]
+}
+
+// isExplain reports whether ctx is the context of EXPLAIN run by logger
+func isExplain(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	explain, _ := ctx.Value(explainKey{}).(bool)
+	return explain
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"io"
 
 	"github.com/go-pg/pg/v10"
@@ -13,19 +14,24 @@ var LoggerKey = new(struct{})
 
 type Client interface {
 	Db() *pg.DB
-	// DEPRECATED. Use Db().Begin()
+	// Tx returns transaction of the context the client is bound to with WithContext
 	Tx() *pg.Tx
-
-	// DEPRECATED. Use Db().Begin()
-	StartTx() (*pg.Tx, error)
-	// DEPRECATED. Use Db().Begin() with pg.Tx.Commit()
-	Commit() error
-	// DEPRECATED. Use Db().Begin() with pg.Tx.Rollback()
-	Rollback() error
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
 
 	Context() context.Context
 	WithContext(ctx context.Context) Client
 	Close() error
+	// Shutdown rejects new queries, waits for in-flight ones until ctx is done and closes the client
+	Shutdown(ctx context.Context) error
+	HealthReport() HealthReport
+	// HealthCheck checks the databases synchronously with replication and migrations probes of opts
+	HealthCheck(ctx context.Context, opts HealthOpts) HealthCheckReport
+	// Stats returns stats of connection pools and top queries of pg_stat_statements if WithTopQueries is enabled
+	Stats(ctx context.Context) (Stats, error)
+	// ActiveQueries returns backends of the client from pg_stat_activity
+	ActiveQueries(ctx context.Context) ([]ActiveQuery, error)
+	// SQLDB returns database/sql handle of the primary sharing its connection settings and lifecycle
+	SQLDB() (*sql.DB, error)
 
 	Model(model ...interface{}) *orm.Query
 	Select(model interface{}) error
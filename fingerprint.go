@@ -0,0 +1,34 @@
+package database
+
+import (
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	commentRegexp    = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+	spaceRegexp      = regexp.MustCompile(`\s+`)
+	inListRegexp     = regexp.MustCompile(`(?i)\bIN\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	valuesListRegexp = regexp.MustCompile(`(?i)(\bVALUES\s*)(\([^()]*\))(?:\s*,\s*\([^()]*\))+`)
+)
+
+// NormalizeQuery returns shape of query: comments are removed, string and numeric literals are replaced with ?,
+// IN lists and multi-row VALUES are collapsed and whitespaces are squeezed, so queries differing only in values
+// have the same shape
+func NormalizeQuery(query string) string {
+	query = literalRegexp.ReplaceAllString(query, redactedValue)
+	query = commentRegexp.ReplaceAllString(query, " ")
+	query = inListRegexp.ReplaceAllString(query, "IN (...)")
+	query = valuesListRegexp.ReplaceAllString(query, "${1}${2}")
+	return strings.TrimSpace(spaceRegexp.ReplaceAllString(query, " "))
+}
+
+// QueryFingerprint returns hex FNV-1a hash of normalized query, it is logged in query_fingerprint field by WithLogger
+// to group queries of the same shape, like queryid of pg_stat_statements
+func QueryFingerprint(query string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(NormalizeQuery(query)))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			query:    "SELECT * FROM \"users\" WHERE \"name\" = 'it''s'\n\tAND age > 30 /* request_id='1' */",
+			expected: `SELECT * FROM "users" WHERE "name" = ? AND age > ?`,
+		},
+		{
+			query:    `SELECT * FROM "users2" WHERE id IN (1, 2, 3) AND kind NOT IN ('a')`,
+			expected: `SELECT * FROM "users2" WHERE id IN (...) AND kind NOT IN (...)`,
+		},
+		{
+			query:    `INSERT INTO "users" ("id", "name") VALUES (DEFAULT, 'a'), (DEFAULT, 'b') RETURNING "id"`,
+			expected: `INSERT INTO "users" ("id", "name") VALUES (DEFAULT, ?) RETURNING "id"`,
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, NormalizeQuery(tt.query))
+	}
+}
+
+func TestQueryFingerprint(t *testing.T) {
+	assert.Equal(t,
+		QueryFingerprint(`SELECT * FROM "users" WHERE id IN (1, 2) AND name = 'a'`),
+		QueryFingerprint(`SELECT *  FROM "users" WHERE id IN (3) AND name = 'b' -- comment`))
+	assert.NotEqual(t,
+		QueryFingerprint(`SELECT * FROM "users" WHERE id = 1`),
+		QueryFingerprint(`SELECT * FROM "accounts" WHERE id = 1`))
+}
@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// NodeHealth is a health state of the primary or replica
+type NodeHealth struct {
+	Addr      string
+	Healthy   bool
+	Failures  int
+	LastError error
+	CheckedAt time.Time
+}
+
+// HealthReport is a health state of the client databases
+type HealthReport struct {
+	Primary  NodeHealth
+	Replicas []NodeHealth
+}
+
+// Healthy reports whether the primary is healthy, unhealthy replicas are out of rotation, so they don't affect
+// readiness of the client
+func (r HealthReport) Healthy() bool {
+	return r.Primary.Healthy
+}
+
+type healthChecker struct {
+	// dbs returns the primary followed by replicas
+	dbs func() []*pg.DB
+	// replicas are taken out of rotation if not nil
+	replicas  *replicaPool
+	interval  time.Duration
+	threshold int
+
+	mu    sync.RWMutex
+	nodes []NodeHealth
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// WithHealthCheck enables background `SELECT 1` checks of the primary and replicas every interval. Replica failing
+// threshold checks in a row is out of rotation until the next successful check, reads hit the primary
+// if all the replicas are out
+func WithHealthCheck(interval time.Duration, threshold int) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		if threshold < 1 {
+			threshold = 1
+		}
+		w.health = newHealthChecker(w.dbs, w.replicas, interval, threshold)
+		go w.health.run()
+		return w
+	})
+}
+
+// HealthReport returns health state of the primary and replicas. It is the state of the last background check
+// if WithHealthCheck is enabled, otherwise databases are checked synchronously
+func (w *dbWrapper) HealthReport() HealthReport {
+	if w.health != nil {
+		return w.health.report()
+	}
+
+	h := newHealthChecker(w.dbs, nil, defaultHealthCheckTimeout, 1)
+	h.check()
+	return h.report()
+}
+
+func newHealthChecker(dbs func() []*pg.DB, replicas *replicaPool, interval time.Duration, threshold int) *healthChecker {
+	h := &healthChecker{
+		dbs:       dbs,
+		replicas:  replicas,
+		interval:  interval,
+		threshold: threshold,
+		stop:      make(chan struct{}),
+	}
+	for _, db := range dbs() {
+		h.nodes = append(h.nodes, NodeHealth{Addr: db.Options().Addr, Healthy: true})
+	}
+	return h
+}
+
+func (h *healthChecker) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			h.check()
+		}
+	}
+}
+
+func (h *healthChecker) close() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+}
+
+// check pings all the databases concurrently and updates their state
+func (h *healthChecker) check() {
+	var wg sync.WaitGroup
+	for i, db := range h.dbs() {
+		wg.Add(1)
+		go func(i int, db *pg.DB) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+			defer cancel()
+			_, err := db.ExecContext(ctx, "SELECT 1")
+			h.update(i, err)
+		}(i, db)
+	}
+	wg.Wait()
+}
+
+func (h *healthChecker) update(i int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	node := &h.nodes[i]
+	node.CheckedAt = time.Now()
+	node.LastError = err
+	if err != nil {
+		node.Failures++
+	} else {
+		node.Failures = 0
+	}
+	node.Healthy = node.Failures < h.threshold
+
+	// the first node is the primary
+	if i > 0 && h.replicas != nil {
+		var out int32
+		if !node.Healthy {
+			out = 1
+		}
+		atomic.StoreInt32(&h.replicas.out[i-1], out)
+	}
+}
+
+func (h *healthChecker) report() HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return HealthReport{
+		Primary:  h.nodes[0],
+		Replicas: append([]NodeHealth(nil), h.nodes[1:]...),
+	}
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbWrapper_HealthReport(t *testing.T) {
+	// nothing listens on the port, so checks fail without waiting for timeout
+	unreachable := func() *pg.DB {
+		return pg.Connect(&pg.Options{Addr: "127.0.0.1:1"})
+	}
+
+	t.Run("Synchronous", func(t *testing.T) {
+		client := NewDbClient(unreachable())
+		defer client.Close()
+
+		report := client.HealthReport()
+		assert.False(t, report.Healthy())
+		assert.Equal(t, 1, report.Primary.Failures)
+		assert.Error(t, report.Primary.LastError)
+		assert.Empty(t, report.Replicas)
+	})
+
+	t.Run("Replica eviction", func(t *testing.T) {
+		primary, replica := unreachable(), unreachable()
+		client := NewDbClientWithReplicas(primary, []*pg.DB{replica}, WithHealthCheck(10*time.Millisecond, 2))
+		defer client.Close()
+		w := client.(*dbWrapper)
+
+		assert.Equal(t, replica, w.readDB(WithReplicaRead(context.Background()), "SELECT 1"))
+		assert.Eventually(t, func() bool {
+			report := client.HealthReport()
+			return len(report.Replicas) == 1 && !report.Replicas[0].Healthy && report.Replicas[0].Failures >= 2
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, primary, w.readDB(WithReplicaRead(context.Background()), "SELECT 1"))
+
+		// recovery is emulated with successful check after background checks are stopped
+		w.health.close()
+		assert.Eventually(t, func() bool {
+			w.health.update(1, nil)
+			return client.HealthReport().Replicas[0].Healthy && w.readDB(WithReplicaRead(context.Background()), "SELECT 1") == replica
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestDbWrapper_HealthCheck(t *testing.T) {
+	client := NewDbClientWithReplicas(pg.Connect(&pg.Options{Addr: "127.0.0.1:1"}),
+		[]*pg.DB{pg.Connect(&pg.Options{Addr: "127.0.0.1:2"})})
+	defer client.Close()
+
+	report := client.HealthCheck(context.Background(), HealthOpts{
+		Timeout:                time.Second,
+		CheckReplication:       true,
+		CheckMigrationsVersion: 3,
+	})
+	assert.False(t, report.Healthy)
+	assert.Equal(t, "127.0.0.1:1", report.Primary.Addr)
+	assert.Error(t, report.Primary.Error)
+	if assert.Len(t, report.Replicas, 1) {
+		assert.Equal(t, "127.0.0.1:2", report.Replicas[0].Addr)
+		assert.False(t, report.Replicas[0].Healthy)
+	}
+	assert.Error(t, report.ReplicationError)
+	if assert.NotNil(t, report.Migrations) {
+		assert.Error(t, report.Migrations.Error)
+	}
+
+	report = client.HealthCheck(context.Background(), HealthOpts{})
+	assert.Nil(t, report.Migrations)
+	assert.NoError(t, report.ReplicationError)
+}
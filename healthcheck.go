@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// defaultMigrationsTable is the table of migration version created by migrate package
+const defaultMigrationsTable = "schema_migrations"
+
+// HealthOpts configures HealthCheck
+type HealthOpts struct {
+	// Timeout limits the check, 5 seconds by default
+	Timeout time.Duration
+	// CheckReplication reads replication state of standbys from pg_stat_replication of the primary
+	// and replay lag of the replicas
+	CheckReplication bool
+	// CheckMigrationsVersion is the min migration version required for readiness, 0 disables the check
+	CheckMigrationsVersion uint
+	// MigrationsTable is the table of migration version, schema_migrations by default, it may be schema-qualified
+	MigrationsTable string
+}
+
+// HealthCheckReport is a result of HealthCheck
+type HealthCheckReport struct {
+	// Healthy reports readiness: the primary responds and migrations are applied if checked.
+	// Unhealthy replicas are out of rotation, so they don't affect readiness
+	Healthy  bool
+	Primary  NodeCheck
+	Replicas []NodeCheck
+	// Replication is replication state of standbys of the primary if CheckReplication is set
+	Replication      []ReplicationState
+	ReplicationError error
+	// Migrations is the state of migrations if CheckMigrationsVersion is set
+	Migrations *MigrationsState
+}
+
+// NodeCheck is a result of check of the primary or replica
+type NodeCheck struct {
+	Addr    string
+	Healthy bool
+	Error   error
+	// Latency is the time of SELECT 1 round trip
+	Latency time.Duration
+	Pool    pg.PoolStats
+	// ReplayLag is the time since the last transaction replayed by replica if CheckReplication is set
+	ReplayLag time.Duration
+}
+
+// ReplicationState is a state of standby of the primary
+type ReplicationState struct {
+	ApplicationName string
+	ClientAddr      string
+	State           string
+	ReplayLag       time.Duration
+}
+
+// MigrationsState is the state of migrations of the primary
+type MigrationsState struct {
+	Version uint
+	Dirty   bool
+	Error   error
+}
+
+// HealthCheck checks the primary and replicas synchronously, it is meant for readiness and liveness probes
+func (w *dbWrapper) HealthCheck(ctx context.Context, opts HealthOpts) HealthCheckReport {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	dbs := w.dbs()
+	nodes := make([]NodeCheck, len(dbs))
+	var report HealthCheckReport
+	var wg sync.WaitGroup
+	for i, db := range dbs {
+		wg.Add(1)
+		go func(i int, db *pg.DB) {
+			defer wg.Done()
+			nodes[i] = checkNode(ctx, db, i > 0 && opts.CheckReplication)
+		}(i, db)
+	}
+	if opts.CheckReplication {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Replication, report.ReplicationError = QueryReplicationState(ctx, dbs[0])
+		}()
+	}
+	if opts.CheckMigrationsVersion > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Migrations = QueryMigrationsState(ctx, dbs[0], opts)
+		}()
+	}
+	wg.Wait()
+
+	report.Primary, report.Replicas = nodes[0], nodes[1:]
+	report.Healthy = report.Primary.Healthy
+	if m := report.Migrations; m != nil {
+		report.Healthy = report.Healthy && m.Error == nil
+	}
+	return report
+}
+
+// checkNode pings db and reads replay lag of replica
+func checkNode(ctx context.Context, db *pg.DB, replica bool) NodeCheck {
+	node := NodeCheck{Addr: db.Options().Addr}
+	start := time.Now()
+	_, node.Error = db.ExecContext(ctx, "SELECT 1")
+	node.Latency = time.Since(start)
+	node.Healthy = node.Error == nil
+	if stats := db.PoolStats(); stats != nil {
+		node.Pool = *stats
+	}
+
+	if replica && node.Healthy {
+		var lag float64
+		_, err := db.QueryOneContext(ctx, pg.Scan(&lag),
+			"SELECT COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)")
+		if err != nil {
+			node.Error = err
+		}
+		node.ReplayLag = time.Duration(lag * float64(time.Second))
+	}
+	return node
+}
+
+// QueryReplicationState reads pg_stat_replication of the primary, db is a handle or client of the primary
+func QueryReplicationState(ctx context.Context, db orm.DB) ([]ReplicationState, error) {
+	var rows []struct {
+		ApplicationName string
+		ClientAddr      string
+		State           string
+		ReplayLag       float64
+	}
+	_, err := db.QueryContext(ctx, &rows, `SELECT application_name, COALESCE(host(client_addr), '') AS client_addr,
+		state, COALESCE(EXTRACT(EPOCH FROM replay_lag), 0) AS replay_lag FROM pg_stat_replication`)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]ReplicationState, 0, len(rows))
+	for _, r := range rows {
+		states = append(states, ReplicationState{
+			ApplicationName: r.ApplicationName,
+			ClientAddr:      r.ClientAddr,
+			State:           r.State,
+			ReplayLag:       time.Duration(r.ReplayLag * float64(time.Second)),
+		})
+	}
+	return states, nil
+}
+
+// QueryMigrationsState reads migration version of MigrationsTable of opts created by migrate package, error is set
+// if the migrations are dirty or behind CheckMigrationsVersion of opts
+func QueryMigrationsState(ctx context.Context, db orm.DB, opts HealthOpts) *MigrationsState {
+	if opts.MigrationsTable == "" {
+		opts.MigrationsTable = defaultMigrationsTable
+	}
+	var state MigrationsState
+	_, state.Error = db.QueryOneContext(ctx, pg.Scan(&state.Version, &state.Dirty),
+		"SELECT version, dirty FROM ? LIMIT 1", pg.Ident(opts.MigrationsTable))
+	if state.Error == nil && (state.Dirty || state.Version < opts.CheckMigrationsVersion) {
+		state.Error = fmt.Errorf("migration version %d (dirty %t) is behind %d", state.Version, state.Dirty,
+			opts.CheckMigrationsVersion)
+	}
+	return &state
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// LeaderLeaseTableSQL creates table of leadership leases used by Elect
+const LeaderLeaseTableSQL = `CREATE TABLE IF NOT EXISTS "leader_lease" (
+	"name"    VARCHAR(256) PRIMARY KEY,
+	"holder"  VARCHAR(256) NOT NULL,
+	"expires" TIMESTAMP NOT NULL
+)`
+
+// minLeaderTTL is the min ttl of Elect, the lease is stored with millisecond precision and renewed every third of ttl
+const minLeaderTTL = 3 * time.Millisecond
+
+// LeaderCallbacks are called by Elect on change of leadership
+type LeaderCallbacks struct {
+	// OnElected is called in a separate goroutine when the instance becomes the leader,
+	// ctx is cancelled when the leadership is lost
+	OnElected func(ctx context.Context)
+	// OnLost is called after OnElected returns when the leadership is lost
+	OnLost func()
+}
+
+// Elect campaigns for leadership of name until ctx is done, so exactly one instance runs e.g. periodic maintenance.
+// The leader holds the lease in leader_lease table (see LeaderLeaseTableSQL) and renews it every third of ttl,
+// the lease of the leader unable to renew it expires after ttl and is taken by another instance. The leader steps
+// down on failed renewal, as it doesn't know whether the lease is still held. The lease is released on return.
+// ttl must be at least 3 milliseconds
+func Elect(ctx context.Context, client Client, name string, ttl time.Duration, callbacks LeaderCallbacks) error {
+	if ttl < minLeaderTTL {
+		return fmt.Errorf("pg: leader lease ttl %s is less than %s", ttl, minLeaderTTL)
+	}
+	holder := leaderID()
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	var stopLead func()
+	stepDown := func() {
+		if stopLead == nil {
+			return
+		}
+		stopLead()
+		stopLead = nil
+		if callbacks.OnLost != nil {
+			callbacks.OnLost()
+		}
+	}
+	defer func() {
+		stepDown()
+		releaseLease(client, name, holder)
+	}()
+
+	for {
+		leader, err := renewLease(ctx, client, name, holder, ttl)
+		switch {
+		case err != nil || !leader:
+			stepDown()
+		case stopLead == nil:
+			stopLead = lead(ctx, callbacks.OnElected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs onElected in a separate goroutine, returned stop func cancels its context and waits for it to return
+func lead(ctx context.Context, onElected func(ctx context.Context)) (stop func()) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if onElected != nil {
+			onElected(leadCtx)
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// renewLease takes the lease if it is free or expired, or prolongs the lease held by holder
+func renewLease(ctx context.Context, client Client, name, holder string, ttl time.Duration) (bool, error) {
+	var current string
+	_, err := client.WithContext(ctx).QueryOne(pg.Scan(&current), `INSERT INTO "leader_lease" ("name", "holder", "expires")
+		VALUES (?, ?, now() + ? * interval '1 millisecond')
+		ON CONFLICT ("name") DO UPDATE SET "holder" = EXCLUDED."holder", "expires" = EXCLUDED."expires"
+		WHERE "leader_lease"."holder" = EXCLUDED."holder" OR "leader_lease"."expires" < now()
+		RETURNING "holder"`, name, holder, ttl.Milliseconds())
+	if err == pg.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+// releaseLease deletes the lease held by holder, so another instance doesn't wait for it to expire
+func releaseLease(client Client, name, holder string) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+	defer cancel()
+	_, _ = client.WithContext(ctx).Exec(`DELETE FROM "leader_lease" WHERE "name" = ? AND "holder" = ?`, name, holder)
+}
+
+// leaderID returns unique id of the campaigning instance
+func leaderID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,62 @@
+//go:build integration
+// +build integration
+
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElect(t *testing.T) {
+	c := cfg
+	c.PoolSize = 10
+	conn := pg.Connect(&c)
+	defer conn.Close()
+	client := NewDbClient(conn)
+
+	assert.Error(t, Elect(context.Background(), client, "maintenance", 0, LeaderCallbacks{}))
+
+	_, err := client.Exec(LeaderLeaseTableSQL)
+	assert.Nil(t, err)
+	_, err = client.Exec(`DELETE FROM "leader_lease"`)
+	assert.Nil(t, err)
+
+	var leaders, elected, lost int32
+	callbacks := LeaderCallbacks{
+		OnElected: func(ctx context.Context) {
+			atomic.AddInt32(&elected, 1)
+			assert.Equal(t, int32(1), atomic.AddInt32(&leaders, 1), "the only leader at a time")
+			<-ctx.Done()
+			atomic.AddInt32(&leaders, -1)
+		},
+		OnLost: func() {
+			atomic.AddInt32(&lost, 1)
+		},
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan error)
+	go func() { done1 <- Elect(ctx1, client, "maintenance", 300*time.Millisecond, callbacks) }()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&elected) == 1 }, time.Second, 10*time.Millisecond)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go func() { _ = Elect(ctx2, client, "maintenance", 300*time.Millisecond, callbacks) }()
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&elected), "the leader renews the lease")
+
+	cancel1()
+	assert.Equal(t, context.Canceled, <-done1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lost))
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&elected) == 2 }, time.Second, 10*time.Millisecond,
+		"the second instance takes the released lease")
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZapLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := ZapLogger(zap.New(core))
+
+	logger.Debug("debug")
+	logger.Info("info", "key", "value")
+	logger.Warn("warn")
+	logger.Error("error", "error", errors.New("failed"))
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 4)
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, "value", entries[1].ContextMap()["key"])
+	assert.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	assert.Equal(t, "failed", entries[3].ContextMap()["error"])
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	logger.Debug("debug")
+	logger.Info("info", "key", "value")
+	logger.Warn("warn")
+	logger.Error("error", "error", errors.New("failed"))
+
+	out := buf.String()
+	assert.Contains(t, out, "level=DEBUG msg=debug")
+	assert.Contains(t, out, "level=INFO msg=info key=value")
+	assert.Contains(t, out, "level=WARN msg=warn")
+	assert.Contains(t, out, "level=ERROR msg=error error=failed")
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/go-pg/pg/v10"
@@ -15,16 +16,92 @@ type DBLogger interface {
 	pg.QueryHook
 }
 
+// LoggerOption configures query logger of WithLogger
+type LoggerOption func(l *dbLogger)
+
+// WithLegacyFormat makes logger write query, duration and error concatenated into the message instead of fields
+func WithLegacyFormat() LoggerOption {
+	return func(l *dbLogger) {
+		l.legacy = true
+	}
+}
+
+// WithErrorLogging makes logger write failed queries at error level regardless of duration, successful queries
+// are logged at info level or at warn level if they take longer than non-zero duration of WithLogger
+func WithErrorLogging() LoggerOption {
+	return func(l *dbLogger) {
+		l.errors = true
+	}
+}
+
+// ContextWithLogger returns copy of ctx carrying request scoped logger, e.g. with request and trace ids fields,
+// which is used instead of the configured one for queries and transactions run with the context
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, &LoggerKey, logger)
+}
+
+// LoggerFromContext returns logger stored in ctx by ContextWithLogger, fallback if there is no logger.
+// *zap.Logger and *slog.Logger stored under LoggerKey (e.g. by middlewares of services) are adapted
+// with ZapLogger and SlogLogger
+func LoggerFromContext(ctx context.Context, fallback Logger) Logger {
+	if ctx == nil {
+		return fallback
+	}
+	value := ctx.Value(&LoggerKey)
+	if value == nil {
+		value = ctx.Value(LoggerKey)
+	}
+	switch logger := value.(type) {
+	case Logger:
+		if logger != nil {
+			return logger
+		}
+	case *zap.Logger:
+		if logger != nil {
+			return ZapLogger(logger)
+		}
+	case *slog.Logger:
+		if logger != nil {
+			return SlogLogger(logger)
+		}
+	}
+	return fallback
+}
+
+// WithParamRedaction masks values of the columns bound into logged queries: values compared with or assigned
+// to the columns, listed in IN of the columns and inserted into the columns are replaced with ?. All string and
+// numeric literals of logged queries are masked if no columns are passed
+func WithParamRedaction(columns ...string) LoggerOption {
+	return func(l *dbLogger) {
+		l.redactor = newParamRedactor(columns)
+	}
+}
+
 type dbLogger struct {
-	logger   *zap.Logger
+	logger   Logger
 	duration time.Duration
+	appName  string
+	legacy   bool
+	errors   bool
+	redactor *paramRedactor
+
+	db               *pg.DB
+	explainThreshold time.Duration
+
+	sampleRate  float64
+	rateLimiter *rateLimiter
 }
 
-func newDBLogger(logger *zap.Logger, duration time.Duration) DBLogger {
-	return &dbLogger{
-		logger:   logger,
-		duration: duration,
+func newDBLogger(logger Logger, duration time.Duration, opts ...LoggerOption) *dbLogger {
+	l := &dbLogger{
+		logger:     logger,
+		duration:   duration,
+		sampleRate: 1,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 func (d *dbLogger) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
@@ -36,30 +113,104 @@ func (d *dbLogger) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (conte
 }
 
 func (d *dbLogger) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	if isExplain(ctx) {
+		return nil
+	}
 	query, err := event.FormattedQuery()
-	if err == nil {
-		var duration time.Duration
-		if event.Stash != nil {
-			if v, ok := event.Stash[queryStartTime]; ok {
-				duration = time.Since(v.(time.Time))
-			}
+	if err != nil {
+		return nil
+	}
+
+	var duration time.Duration
+	if event.Stash != nil {
+		if v, ok := event.Stash[queryStartTime]; ok {
+			duration = time.Since(v.(time.Time))
+		}
+	}
+	logger := LoggerFromContext(ctx, d.logger)
+	log := logger.Info
+	switch {
+	case d.errors && event.Err != nil:
+		log = logger.Error
+	case d.duration != 0:
+		if d.duration > duration {
+			return nil
+		}
+		log = logger.Warn
+	}
+
+	var suppressed int
+	if event.Err == nil {
+		if !d.sampled() {
+			return nil
 		}
-		logLevel := zap.InfoLevel
-		if d.duration != 0 {
-			if d.duration > duration {
+		if d.rateLimiter != nil {
+			var ok bool
+			if ok, suppressed = d.rateLimiter.allow(QueryFingerprint(string(query)), time.Now()); !ok {
 				return nil
 			}
-			logLevel = zap.WarnLevel
 		}
-		txt := "query: " + string(query)
-		if duration != 0 {
-			txt += fmt.Sprintf(" [%d ms]", duration.Nanoseconds()/1000000)
-		}
-		if event.Err != nil {
-			txt += "\nerror: " + event.Err.Error()
+	}
+
+	plan, explainErr := d.explain(string(query), duration)
+	if d.redactor != nil {
+		query = []byte(d.redactor.redact(string(query)))
+	}
+
+	if d.legacy {
+		msg := legacyMessage(string(query), duration, event.Err)
+		if plan != "" {
+			msg += "\nplan: " + plan
 		}
+		log(msg)
+		return nil
+	}
 
-		d.logger.Log(logLevel, txt)
+	fields := d.fields(event, string(query), duration)
+	if plan != "" {
+		fields = append(fields, "plan", plan)
 	}
+	if explainErr != nil {
+		fields = append(fields, "explain_error", explainErr)
+	}
+	if suppressed > 0 {
+		fields = append(fields, "suppressed", suppressed)
+	}
+	log("query", fields...)
 	return nil
 }
+
+// fields returns structured fields of the query event as alternating keys and values
+func (d *dbLogger) fields(event *pg.QueryEvent, query string, duration time.Duration) []interface{} {
+	_, tx := event.DB.(*pg.Tx)
+	fields := []interface{}{
+		"query", query,
+		"query_fingerprint", QueryFingerprint(query),
+		"duration_ms", duration.Milliseconds(),
+		"tx", tx,
+	}
+	if d.appName != "" {
+		fields = append(fields, "app_name", d.appName)
+	}
+	if event.Result != nil {
+		fields = append(fields,
+			"rows_returned", event.Result.RowsReturned(),
+			"rows_affected", event.Result.RowsAffected())
+	}
+	if event.Err != nil {
+		fields = append(fields, "error", event.Err)
+	}
+	return fields
+}
+
+// legacyMessage returns message of the query in format used before structured fields
+func legacyMessage(query string, duration time.Duration, err error) string {
+	txt := "query: " + query
+	if duration != 0 {
+		txt += fmt.Sprintf(" [%d ms]", duration.Nanoseconds()/1000000)
+	}
+	if err != nil {
+		txt += "\nerror: " + err.Error()
+	}
+	return txt
+}
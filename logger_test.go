@@ -0,0 +1,184 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDBLogger(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1", ApplicationName: "app"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0))
+	logs.TakeAll()
+
+	_, err := client.Exec("SELECT 1")
+	require.Error(t, err)
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "query", entries[0].Message)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "SELECT 1", fields["query"])
+	assert.Equal(t, QueryFingerprint("SELECT 1"), fields["query_fingerprint"])
+	assert.Equal(t, false, fields["tx"])
+	assert.Equal(t, "app", fields["app_name"])
+	assert.Contains(t, fields, "duration_ms")
+	assert.Contains(t, fields, "error")
+	assert.NotContains(t, fields, "rows_returned")
+}
+
+func TestDBLogger_LegacyFormat(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0, WithLegacyFormat()))
+	logs.TakeAll()
+
+	_, _ = client.Exec("SELECT 1")
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0].Message, "query: SELECT 1")
+	assert.Contains(t, entries[0].Message, "\nerror: ")
+	assert.Empty(t, entries[0].Context)
+}
+
+func TestDBLogger_ContextLogger(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0))
+	logs.TakeAll()
+
+	ctx := ContextWithLogger(context.Background(), ZapLogger(zap.New(core).With(zap.String("request_id", "42"))))
+	var n int
+	_ = client.WithContext(ctx).Model().ColumnExpr("1").Select(pg.Scan(&n))
+	_ = client.WithContext(context.Background()).Model().ColumnExpr("2").Select(pg.Scan(&n))
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "42", entries[0].ContextMap()["request_id"])
+	assert.NotContains(t, entries[1].ContextMap(), "request_id")
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	fallback := NopLogger()
+	assert.Equal(t, fallback, LoggerFromContext(context.Background(), fallback))
+
+	logger := ZapLogger(zap.NewExample())
+	assert.Equal(t, logger, LoggerFromContext(ContextWithLogger(context.Background(), logger), fallback))
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx := context.WithValue(context.Background(), LoggerKey, zap.New(core))
+	LoggerFromContext(ctx, fallback).Info("zap")
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "zap", entries[0].Message)
+
+	var buf bytes.Buffer
+	ctx = context.WithValue(context.Background(), &LoggerKey, slog.New(slog.NewTextHandler(&buf, nil)))
+	LoggerFromContext(ctx, fallback).Info("slog")
+	assert.Contains(t, buf.String(), "msg=slog")
+
+	var nilLogger *zap.Logger
+	assert.Equal(t, fallback, LoggerFromContext(context.WithValue(context.Background(), &LoggerKey, nilLogger), fallback))
+}
+
+func TestDBLogger_ParamRedaction(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0, WithParamRedaction("inn")))
+	logs.TakeAll()
+
+	_, _ = client.Exec(`SELECT * FROM "users" WHERE "inn" = ? AND "id" = ?`, "7701234567", 1)
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, `SELECT * FROM "users" WHERE "inn" = ? AND "id" = 1`, entries[0].ContextMap()["query"])
+}
+
+func TestDBLogger_AutoExplain(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0, WithAutoExplain(time.Nanosecond)))
+	logs.TakeAll()
+
+	_, _ = client.Exec("SELECT 1")
+	_, _ = client.Exec("VACUUM")
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 2)
+	assert.Contains(t, entries[0].ContextMap(), "explain_error")
+	assert.NotContains(t, entries[1].ContextMap(), "explain_error")
+}
+
+func TestRedactPlan(t *testing.T) {
+	plan, err := redactPlan(`[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users2", "Total Cost": 1.5,
+		"Filter": "((inn)::text = '7701234567'::text AND (age > 30))"}}]`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "users2", "Total Cost": 1.5,
+		"Filter": "((inn)::text = ?::text AND (age > ?))"}}]`, plan)
+}
+
+func TestIsExplainable(t *testing.T) {
+	// context keys of other values are not taken for the key of EXPLAIN
+	assert.False(t, isExplain(WithPrimary(context.Background())))
+	assert.True(t, isExplainable("SELECT 1"))
+	assert.True(t, isExplainable(" (select 1) UNION (select 2)"))
+	assert.True(t, isExplainable("WITH t AS (SELECT 1) SELECT * FROM t"))
+	assert.False(t, isExplainable("VACUUM"))
+	assert.False(t, isExplainable("EXPLAIN SELECT 1"))
+}
+
+func TestDBLogger_SamplingKeepsErrors(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), 0, WithLogSampling(0), WithLogRateLimit(1, time.Hour)))
+	logs.TakeAll()
+
+	_, _ = client.Exec("SELECT 1")
+	_, _ = client.Exec("SELECT 1")
+
+	assert.Len(t, logs.TakeAll(), 2)
+}
+
+func TestDBLogger_ErrorLogging(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), time.Hour, WithErrorLogging()))
+	logs.TakeAll()
+
+	_, _ = client.Exec("SELECT 1")
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Contains(t, entries[0].ContextMap(), "error")
+}
+
+func TestDBLogger_Threshold(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	core, logs := observer.New(zapcore.InfoLevel)
+	client := NewDbClient(conn, WithLogger(ZapLogger(zap.New(core)), time.Hour))
+	logs.TakeAll()
+
+	_, _ = client.Exec("SELECT 1")
+
+	assert.Empty(t, logs.TakeAll())
+}
@@ -0,0 +1,153 @@
+// Package metrics exports Prometheus metrics of queries and connection pools of go-pg databases.
+// go-pg doesn't expose time queries wait for pool connection, so there is no wait duration metric: the wait is
+// included into query_duration_seconds, and pool_misses_total and pool_timeouts_total show the pool saturation
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "pg_client"
+
+const queryStartTime = "MetricsStartTime"
+
+// Collector is a query hook collecting query metrics and a Prometheus collector of pool stats of added databases
+type Collector struct {
+	queries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	mu  sync.RWMutex
+	dbs []*pg.DB
+
+	poolConns    *prometheus.Desc
+	poolHits     *prometheus.Desc
+	poolMisses   *prometheus.Desc
+	poolTimeouts *prometheus.Desc
+}
+
+// New creates Collector and registers it with registerer
+func New(registerer prometheus.Registerer) (*Collector, error) {
+	labels := []string{"operation", "table"}
+	c := &Collector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queries_total",
+			Help:      "Number of executed queries.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_errors_total",
+			Help:      "Number of failed queries.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries.",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+
+		poolConns: prometheus.NewDesc(namespace+"_pool_connections",
+			"Number of pool connections by state.", []string{"addr", "state"}, nil),
+		poolHits: prometheus.NewDesc(namespace+"_pool_hits_total",
+			"Number of times free connection was found in the pool.", []string{"addr"}, nil),
+		poolMisses: prometheus.NewDesc(namespace+"_pool_misses_total",
+			"Number of times free connection was not found in the pool.", []string{"addr"}, nil),
+		poolTimeouts: prometheus.NewDesc(namespace+"_pool_timeouts_total",
+			"Number of times wait for connection timed out.", []string{"addr"}, nil),
+	}
+
+	if err := registerer.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// AddDB adds query hook to db and exports stats of its pool
+func (c *Collector) AddDB(db *pg.DB) {
+	db.AddQueryHook(c)
+
+	c.mu.Lock()
+	c.dbs = append(c.dbs, db)
+	c.mu.Unlock()
+}
+
+// BeforeQuery implements pg.QueryHook
+func (c *Collector) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	if event.Stash == nil {
+		event.Stash = make(map[interface{}]interface{})
+	}
+	event.Stash[queryStartTime] = time.Now()
+	return ctx, nil
+}
+
+// AfterQuery implements pg.QueryHook
+func (c *Collector) AfterQuery(_ context.Context, event *pg.QueryEvent) error {
+	start, ok := event.Stash[queryStartTime].(time.Time)
+	if !ok {
+		// the query is rejected by another hook
+		return nil
+	}
+
+	operation, table := describe(event.Query)
+	c.queries.WithLabelValues(operation, table).Inc()
+	c.duration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+	if event.Err != nil && event.Err != pg.ErrNoRows {
+		c.errors.WithLabelValues(operation, table).Inc()
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.queries.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+	ch <- c.poolConns
+	ch <- c.poolHits
+	ch <- c.poolMisses
+	ch <- c.poolTimeouts
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.queries.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, db := range c.dbs {
+		addr := db.Options().Addr
+		stats := db.PoolStats()
+		ch <- prometheus.MustNewConstMetric(c.poolConns, prometheus.GaugeValue, float64(stats.IdleConns), addr, "idle")
+		ch <- prometheus.MustNewConstMetric(c.poolConns, prometheus.GaugeValue, float64(stats.TotalConns-stats.IdleConns), addr, "busy")
+		ch <- prometheus.MustNewConstMetric(c.poolConns, prometheus.GaugeValue, float64(stats.StaleConns), addr, "stale")
+		ch <- prometheus.MustNewConstMetric(c.poolHits, prometheus.CounterValue, float64(stats.Hits), addr)
+		ch <- prometheus.MustNewConstMetric(c.poolMisses, prometheus.CounterValue, float64(stats.Misses), addr)
+		ch <- prometheus.MustNewConstMetric(c.poolTimeouts, prometheus.CounterValue, float64(stats.Timeouts), addr)
+	}
+}
+
+// describe returns operation and table of the query, table is known for queries built with Model only
+func describe(query interface{}) (operation, table string) {
+	switch q := query.(type) {
+	case orm.QueryCommand:
+		operation = string(q.Operation())
+		if m := q.Query().TableModel(); m != nil && m.Table() != nil {
+			table = strings.Trim(string(m.Table().SQLName), `"`)
+		}
+	case string:
+		if fields := strings.Fields(q); len(fields) > 0 {
+			operation = strings.ToUpper(fields[0])
+		}
+	}
+	return operation, table
+}
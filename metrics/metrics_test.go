@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type agent struct {
+	tableName struct{} `pg:"agent"`
+	ID        int
+}
+
+func TestCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	c, err := New(registry)
+	assert.NoError(t, err)
+
+	db := pg.Connect(&pg.Options{Addr: "db:5432"})
+	defer db.Close()
+	c.AddDB(db)
+
+	run := func(query interface{}, err error) {
+		event := &pg.QueryEvent{Query: query}
+		_, _ = c.BeforeQuery(context.Background(), event)
+		event.Err = err
+		assert.NoError(t, c.AfterQuery(context.Background(), event))
+	}
+	run(orm.NewSelectQuery(orm.NewQuery(db, &agent{})), nil)
+	run(orm.NewSelectQuery(orm.NewQuery(db, &agent{})), pg.ErrNoRows)
+	run(orm.NewInsertQuery(orm.NewQuery(db, &agent{})), errors.New("error"))
+	run("select 1", nil)
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			key := f.GetName()
+			for _, l := range m.GetLabel() {
+				key += "," + l.GetName() + "=" + l.GetValue()
+			}
+			switch {
+			case m.GetCounter() != nil:
+				values[key] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[key] = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				values[key] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	assert.Equal(t, 2.0, values["pg_client_queries_total,operation=SELECT,table=agent"])
+	assert.Equal(t, 1.0, values["pg_client_queries_total,operation=INSERT,table=agent"])
+	assert.Equal(t, 1.0, values["pg_client_queries_total,operation=SELECT,table="])
+	assert.Equal(t, 2.0, values["pg_client_query_duration_seconds,operation=SELECT,table=agent"])
+	assert.Equal(t, 1.0, values["pg_client_query_errors_total,operation=INSERT,table=agent"])
+	assert.NotContains(t, values, "pg_client_query_errors_total,operation=SELECT,table=agent")
+	assert.Contains(t, values, "pg_client_pool_connections,addr=db:5432,state=idle")
+	assert.Contains(t, values, "pg_client_pool_hits_total,addr=db:5432")
+}
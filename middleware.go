@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// QueryFunc runs query with ctx
+type QueryFunc func(ctx context.Context) (orm.Result, error)
+
+// Middleware intercepts query of the client, query is SQL of the query (params of Exec and Query are not formatted
+// into it) and model is the model rows are scanned into (usually orm.TableModel for queries built with Model),
+// nil for Exec. Middleware calls next to run the query, possibly several times or with changed context, or returns
+// without calling it. Errors returned by next are not wrapped by WithQueryErrors yet, so they can be inspected,
+// e.g. by retrying middleware
+type Middleware func(ctx context.Context, query string, model interface{}, next QueryFunc) (orm.Result, error)
+
+// WithQueryMiddleware intercepts Exec, Query, their *One and *Context variants and queries built with Model
+// and ModelContext, DAO queries among them, by mw. The first middleware is the outermost one, middleware of several
+// options are chained in order of the options. Queries within transaction are intercepted too, so middleware
+// retrying queries has to check InTx
+func WithQueryMiddleware(mw ...Middleware) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		w.middleware = append(w.middleware, mw...)
+		return w
+	})
+}
+
+// process runs query with processor through middleware of the client
+func (w *dbWrapper) process(ctx context.Context, query, model interface{}, processor QueryFunc) (orm.Result, error) {
+	if len(w.middleware) == 0 {
+		return processor(ctx)
+	}
+
+	queryString := w.queryString(query)
+	next := processor
+	for i := len(w.middleware) - 1; i >= 0; i-- {
+		mw, inner := w.middleware[i], next
+		next = func(ctx context.Context) (orm.Result, error) {
+			return mw(ctx, queryString, model, inner)
+		}
+	}
+	return next(ctx)
+}
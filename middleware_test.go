@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type middlewareKey struct{}
+
+func TestWithQueryMiddleware(t *testing.T) {
+	type user struct {
+		ID int
+	}
+
+	var calls []string
+	outer := func(ctx context.Context, query string, model interface{}, next QueryFunc) (orm.Result, error) {
+		calls = append(calls, "outer "+query)
+		return next(context.WithValue(ctx, middlewareKey{}, "outer"))
+	}
+	inner := func(ctx context.Context, query string, model interface{}, next QueryFunc) (orm.Result, error) {
+		calls = append(calls, "inner "+ctx.Value(middlewareKey{}).(string))
+		if model != nil {
+			_, ok := model.(*user)
+			calls = append(calls, "model "+map[bool]string{true: "user", false: "other"}[ok])
+		}
+		return next(ctx)
+	}
+
+	client := Connect("test", &pg.Options{Addr: "127.0.0.1:1"}, WithQueryMiddleware(outer), WithQueryMiddleware(inner))
+	defer client.Close()
+
+	_, err := client.Exec("SELECT 1")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"outer SELECT 1", "inner outer"}, calls)
+
+	calls = nil
+	u := &user{}
+	_, err = client.Query(u, "SELECT 1")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"outer SELECT 1", "inner outer", "model user"}, calls)
+
+	calls = nil
+	err = client.Model(u).Where("id = ?", 1).Select()
+	assert.Error(t, err)
+	require.Len(t, calls, 3)
+	assert.Contains(t, calls[0], `FROM "users" AS "user" WHERE (id = 1)`)
+}
+
+func TestWithQueryMiddleware_ShortCircuit(t *testing.T) {
+	errRejected := errors.New("rejected")
+	reject := func(ctx context.Context, query string, model interface{}, next QueryFunc) (orm.Result, error) {
+		return nil, errRejected
+	}
+
+	client := Connect("test", &pg.Options{Addr: "127.0.0.1:1"}, WithQueryMiddleware(reject), WithQueryErrors())
+	defer client.Close()
+
+	_, err := client.ExecOne("SELECT 1")
+	assert.ErrorIs(t, err, errRejected)
+	_, err = client.QueryOne(pg.Scan(new(int)), "SELECT 1")
+	assert.ErrorIs(t, err, errRejected)
+}
+
+func TestWithQueryMiddleware_ModelContext(t *testing.T) {
+	type user struct {
+		ID int
+	}
+
+	var models []interface{}
+	record := func(ctx context.Context, query string, model interface{}, next QueryFunc) (orm.Result, error) {
+		models = append(models, model)
+		return next(ctx)
+	}
+
+	client := Connect("test", &pg.Options{Addr: "127.0.0.1:1"}, WithQueryMiddleware(record))
+	defer client.Close()
+
+	_, err := client.(orm.DB).ModelContext(context.Background(), &user{}).Where("id = 1").Delete()
+	assert.Error(t, err)
+	_, err = client.(orm.DB).ModelContext(context.Background(), &user{}).Count()
+	assert.Error(t, err)
+	assert.Len(t, models, 2)
+}
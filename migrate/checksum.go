@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang-migrate/migrate/database/postgres"
+	"github.com/golang-migrate/migrate/source"
+	"github.com/lib/pq"
+)
+
+// ChecksumMode is action on migration changed after it was applied
+type ChecksumMode int
+
+// Checksum modes
+const (
+	// ChecksumOff disables tracking of checksums
+	ChecksumOff ChecksumMode = iota
+	// ChecksumWarn logs changed migrations
+	ChecksumWarn
+	// ChecksumFail fails run before applying migrations
+	ChecksumFail
+)
+
+// checksums keeps SHA-256 of applied up migrations in the table named after migrations table
+type checksums struct {
+	db    *sql.DB
+	table string
+}
+
+func newChecksums(db *sql.DB, migrationsTable string) (*checksums, error) {
+	if migrationsTable == "" {
+		migrationsTable = postgres.DefaultMigrationsTable
+	}
+	c := &checksums{db: db, table: pq.QuoteIdentifier(migrationsTable + "_checksums")}
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + c.table + ` (version bigint NOT NULL PRIMARY KEY, checksum text NOT NULL)`)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// store records checksum of applied up migration, checksum of down migration is removed
+func (c *checksums) store(ex execer, h header, body []byte) error {
+	if h.direction == directionDown {
+		_, err := ex.Exec(`DELETE FROM `+c.table+` WHERE version = $1`, h.version)
+		return err
+	}
+	_, err := ex.Exec(`INSERT INTO `+c.table+` (version, checksum) VALUES ($1, $2)
+		ON CONFLICT (version) DO UPDATE SET checksum = EXCLUDED.checksum`, h.version, checksum(body))
+	return err
+}
+
+// verify compares recorded checksums with up migrations of src, migrations applied before tracking was enabled
+// and missing in src are skipped
+func (c *checksums) verify(src source.Driver) ([]ChangedMigration, error) {
+	rows, err := c.db.Query(`SELECT version, checksum FROM ` + c.table + ` ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recorded := make(map[uint]string)
+	var versions []uint
+	for rows.Next() {
+		var version uint
+		var sum string
+		if err := rows.Scan(&version, &sum); err != nil {
+			return nil, err
+		}
+		recorded[version] = sum
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var changed []ChangedMigration
+	for _, version := range versions {
+		r, name, err := src.ReadUp(version)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if _, body, ok := splitHeader(b); ok {
+			b = body
+		}
+		if checksum(b) != recorded[version] {
+			changed = append(changed, ChangedMigration{Version: version, Name: name})
+		}
+	}
+	return changed, nil
+}
+
+// ChangedMigration is applied migration changed afterwards
+type ChangedMigration struct {
+	Version uint
+	Name    string
+}
+
+// ChecksumError is returned by run in ChecksumFail mode if applied migrations were changed
+type ChecksumError struct {
+	Changed []ChangedMigration
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("migrate: %d applied migrations changed, the first is %d %s",
+		len(e.Changed), e.Changed[0].Version, e.Changed[0].Name)
+}
+
+// verifyChecksums checks applied migrations according to checksum mode of the migrator
+func (m *Migrator) verifyChecksums(c *checksums, src source.Driver) error {
+	changed, err := c.verify(src)
+	if err != nil || len(changed) == 0 {
+		return err
+	}
+	for _, ch := range changed {
+		m.logger.Warn("applied migration changed", "version", ch.Version, "name", ch.Name)
+	}
+	if m.checksumMode == ChecksumFail {
+		return &ChecksumError{Changed: changed}
+	}
+	return nil
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
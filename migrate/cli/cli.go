@@ -0,0 +1,199 @@
+// Package cli implements migrate command of the application, e.g. "./app migrate up", running Migrator
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/alexandr-kononykhin-vay/postgres/migrate"
+)
+
+const usage = `Usage: migrate <command> [arguments]
+
+Commands:
+  up [N]        apply all or N up migrations
+  down [N]      apply N down migrations, all of them with -all
+  status        print current version and pending migrations
+  force VERSION set version without applying migrations, -1 means no migration is applied
+  create NAME   generate up and down migration files
+`
+
+// ErrUsage is returned for unknown command or invalid arguments, usage is printed to output of the command
+var ErrUsage = errors.New("migrate: invalid usage")
+
+// Command runs migration commands with the migrator
+type Command struct {
+	migrator *migrate.Migrator
+	out      io.Writer
+}
+
+// New creates Command printing to stdout
+func New(migrator *migrate.Migrator) *Command {
+	return &Command{migrator: migrator, out: os.Stdout}
+}
+
+// SetOutput sets writer of status and usage
+func (c *Command) SetOutput(out io.Writer) {
+	c.out = out
+}
+
+// Run runs command of args without program and command name, e.g. os.Args[2:] for "./app migrate up"
+func (c *Command) Run(args []string) error {
+	if len(args) == 0 {
+		return c.usage()
+	}
+
+	switch args[0] {
+	case "up":
+		return c.up(args[1:])
+	case "down":
+		return c.down(args[1:])
+	case "status":
+		return c.status(args[1:])
+	case "force":
+		return c.force(args[1:])
+	case "create":
+		return c.create(args[1:])
+	case "help", "-h", "-help", "--help":
+		_, _ = fmt.Fprint(c.out, usage)
+		return nil
+	default:
+		return c.usage()
+	}
+}
+
+func (c *Command) up(args []string) error {
+	fs := c.flagSet("up")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	switch fs.NArg() {
+	case 0:
+		return c.migrator.Run()
+	case 1:
+		n, err := positive(fs.Arg(0))
+		if err != nil {
+			return c.usage()
+		}
+		return c.migrator.Steps(n)
+	default:
+		return c.usage()
+	}
+}
+
+func (c *Command) down(args []string) error {
+	fs := c.flagSet("down")
+	all := fs.Bool("all", false, "apply all down migrations")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+
+	switch {
+	case *all && fs.NArg() == 0:
+		return c.migrator.Down()
+	case !*all && fs.NArg() == 1:
+		n, err := positive(fs.Arg(0))
+		if err != nil {
+			return c.usage()
+		}
+		return c.migrator.Steps(-n)
+	default:
+		return c.usage()
+	}
+}
+
+func (c *Command) status(args []string) error {
+	fs := c.flagSet("status")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() != 0 {
+		return c.usage()
+	}
+
+	version, dirty, err := c.migrator.Version()
+	if err != nil {
+		return err
+	}
+	switch {
+	case version < 0:
+		_, _ = fmt.Fprintln(c.out, "version: none")
+	case dirty:
+		_, _ = fmt.Fprintf(c.out, "version: %d (dirty)\n", version)
+		return nil
+	default:
+		_, _ = fmt.Fprintf(c.out, "version: %d\n", version)
+	}
+
+	plan, err := c.migrator.Plan()
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(c.out, "pending: %d\n", len(plan))
+	for _, p := range plan {
+		_, _ = fmt.Fprintf(c.out, "  %d %s\n", p.Version, p.Name)
+	}
+	return nil
+}
+
+func (c *Command) force(args []string) error {
+	fs := c.flagSet("force")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() != 1 {
+		return c.usage()
+	}
+
+	version, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || version < -1 {
+		return c.usage()
+	}
+	return c.migrator.Force(version)
+}
+
+func (c *Command) create(args []string) error {
+	fs := c.flagSet("create")
+	if err := fs.Parse(args); err != nil {
+		return ErrUsage
+	}
+	if fs.NArg() != 1 {
+		return c.usage()
+	}
+
+	up, down, err := c.migrator.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(c.out, up)
+	_, _ = fmt.Fprintln(c.out, down)
+	return nil
+}
+
+func (c *Command) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.out)
+	fs.Usage = func() { _, _ = fmt.Fprint(c.out, usage) }
+	return fs
+}
+
+func (c *Command) usage() error {
+	_, _ = fmt.Fprint(c.out, usage)
+	return ErrUsage
+}
+
+func positive(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("%d is not positive", n)
+	}
+	return n, nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexandr-kononykhin-vay/postgres/migrate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand_Usage(t *testing.T) {
+	var out bytes.Buffer
+	cmd := New(migrate.NewMigrator("migrations", "postgres://localhost:1/none"))
+	cmd.SetOutput(&out)
+
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"up", "0"},
+		{"up", "1", "2"},
+		{"down"},
+		{"down", "-all", "1"},
+		{"down", "-1"},
+		{"status", "1"},
+		{"force"},
+		{"force", "-2"},
+		{"force", "x"},
+		{"create"},
+	} {
+		out.Reset()
+		require.ErrorIs(t, cmd.Run(args), ErrUsage, args)
+		require.Contains(t, out.String(), "Usage: migrate", args)
+	}
+
+	out.Reset()
+	require.NoError(t, cmd.Run([]string{"help"}))
+	require.Contains(t, out.String(), "Commands:")
+}
+
+func TestCommand_Create(t *testing.T) {
+	dir, err := os.MkdirTemp(".", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	cmd := New(migrate.NewMigrator(dir, "postgres://localhost:1/none",
+		migrate.WithTemplate("-- {{.Name}} up\n", "-- {{.Name}} down\n")))
+	cmd.SetOutput(&out)
+
+	require.NoError(t, cmd.Run([]string{"create", "Add users"}))
+	files := strings.Fields(out.String())
+	require.Len(t, files, 2)
+	require.Regexp(t, `/\d{14}_add_users\.up\.sql$`, files[0])
+	require.Regexp(t, `/\d{14}_add_users\.down\.sql$`, files[1])
+	require.Equal(t, filepath.Clean(dir), filepath.Dir(files[0]))
+
+	b, err := os.ReadFile(files[1])
+	require.NoError(t, err)
+	require.Equal(t, "-- add_users down\n", string(b))
+}
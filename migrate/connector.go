@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/lib/pq"
+)
+
+// clientConnector opens lib/pq connections with address, credentials, database and dialer of go-pg options
+type clientConnector struct {
+	dsn    string
+	dialer clientDialer
+}
+
+// errNoClientOptions is returned by connector of client without go-pg handle, e.g. client of pgxclient
+var errNoClientOptions = errors.New("migrate: WithClient requires client of go-pg connection, use WithConnector")
+
+// newClientConnector creates connector of client options. TLS is required if the options have TLS config and
+// verified against system roots unless InsecureSkipVerify is set, custom roots of the config are not used.
+// Connector of client without go-pg handle fails to connect with errNoClientOptions
+func newClientConnector(client db.Client) driver.Connector {
+	if client.Db() == nil {
+		return errConnector{err: errNoClientOptions}
+	}
+	opts := client.Db().Options()
+
+	params := map[string]string{
+		"user":             opts.User,
+		"password":         opts.Password,
+		"dbname":           opts.Database,
+		"application_name": opts.ApplicationName,
+		"sslmode":          "disable",
+	}
+	if host, _, err := net.SplitHostPort(opts.Addr); err == nil {
+		params["host"] = host
+	}
+	if opts.TLSConfig != nil {
+		params["sslmode"] = "verify-full"
+		if opts.TLSConfig.InsecureSkipVerify {
+			params["sslmode"] = "require"
+		}
+	}
+	if opts.DialTimeout > 0 {
+		params["connect_timeout"] = fmt.Sprint(int(opts.DialTimeout.Seconds()))
+	}
+
+	pairs := make([]string, 0, len(params))
+	for k, v := range params {
+		if v != "" {
+			pairs = append(pairs, k+"='"+strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)+"'")
+		}
+	}
+	return &clientConnector{dsn: strings.Join(pairs, " "), dialer: clientDialer{opts: opts}}
+}
+
+func (c *clientConnector) Connect(context.Context) (driver.Conn, error) {
+	return pq.DialOpen(c.dialer, c.dsn)
+}
+
+func (c *clientConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// errConnector fails to connect with err
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// clientDialer dials network and address of go-pg options with their dialer, address of lib/pq is ignored
+type clientDialer struct {
+	opts *pg.Options
+}
+
+func (d clientDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d clientDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d clientDialer) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	return d.opts.Dialer(ctx, d.opts.Network, d.opts.Addr)
+}
+
+// searchPathConnector sets search_path of each connection opened by connector
+type searchPathConnector struct {
+	driver.Connector
+	schema string
+}
+
+func (c searchPathConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("migrate: connection doesn't support setting search_path")
+	}
+	if _, err := execer.ExecContext(ctx, "SET search_path TO "+pq.QuoteIdentifier(c.schema), nil); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,321 @@
+package migrate
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang-migrate/migrate"
+	"github.com/golang-migrate/migrate/database"
+	"github.com/golang-migrate/migrate/source"
+)
+
+// headerPrefix starts header line of migration body passed through migrate to funcDriver
+const headerPrefix = "-- migration: "
+
+// MigrationFn is Go migration run within transaction
+type MigrationFn func(tx *sql.Tx) error
+
+type funcMigration struct {
+	up   MigrationFn
+	down MigrationFn
+}
+
+var (
+	funcsMu sync.RWMutex
+	funcs   = make(map[uint]funcMigration)
+)
+
+// Register adds Go migration of version applied along with SQL files, e.g. data backfill requiring application
+// logic. Down can be nil if the migration is irreversible. Register panics if the version is registered twice,
+// version of SQL file equal to registered one fails migrator run
+func Register(version uint, up, down MigrationFn) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	if _, ok := funcs[version]; ok {
+		panic(fmt.Sprintf("migrate: Register called twice for version %d", version))
+	}
+	funcs[version] = funcMigration{up: up, down: down}
+}
+
+// unregister removes Go migration of version
+func unregister(version uint) {
+	funcsMu.Lock()
+	defer funcsMu.Unlock()
+	delete(funcs, version)
+}
+
+// registeredFuncs returns copy of registered Go migrations
+func registeredFuncs() map[uint]funcMigration {
+	funcsMu.RLock()
+	defer funcsMu.RUnlock()
+	res := make(map[uint]funcMigration, len(funcs))
+	for v, f := range funcs {
+		res[v] = f
+	}
+	return res
+}
+
+// funcSource merges registered Go migrations with migrations of the source, body of every migration is prefixed
+// with header recognized by funcDriver, so Go migration body is the header only
+type funcSource struct {
+	source.Driver
+	funcs    map[uint]funcMigration
+	versions versionList
+}
+
+// newFuncSource merges Go migrations with migrations of src
+func newFuncSource(src source.Driver, fns map[uint]funcMigration) (*funcSource, error) {
+	s := &funcSource{Driver: src, funcs: fns}
+	for v := range fns {
+		s.versions = append(s.versions, v)
+	}
+
+	v, err := src.First()
+	for err == nil {
+		if _, ok := fns[v]; ok {
+			return nil, fmt.Errorf("migrate: version %d is both registered and in source", v)
+		}
+		s.versions = append(s.versions, v)
+		v, err = src.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	s.versions.sort()
+	return s, nil
+}
+
+func (s *funcSource) First() (uint, error) {
+	return s.versions.first()
+}
+
+func (s *funcSource) Prev(version uint) (uint, error) {
+	return s.versions.prev(version)
+}
+
+func (s *funcSource) Next(version uint) (uint, error) {
+	return s.versions.next(version)
+}
+
+func (s *funcSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if f, ok := s.funcs[version]; ok {
+		return s.readFunc(version, directionUp, f.up)
+	}
+	return s.readSQL(version, directionUp, s.Driver.ReadUp)
+}
+
+func (s *funcSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if f, ok := s.funcs[version]; ok {
+		return s.readFunc(version, directionDown, f.down)
+	}
+	return s.readSQL(version, directionDown, s.Driver.ReadDown)
+}
+
+func (s *funcSource) readFunc(version uint, direction string, fn MigrationFn) (io.ReadCloser, string, error) {
+	if fn == nil {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: sourceName, Err: os.ErrNotExist}
+	}
+	h := header{version: version, direction: direction, kind: kindGo, name: kindGo}
+	return io.NopCloser(strings.NewReader(h.String())), h.name, nil
+}
+
+func (s *funcSource) readSQL(version uint, direction string, read func(uint) (io.ReadCloser, string, error)) (io.ReadCloser, string, error) {
+	r, name, err := read(version)
+	if err != nil {
+		return nil, "", err
+	}
+	h := header{version: version, direction: direction, kind: kindSQL, name: name}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(strings.NewReader(h.String()), r), r}, name, nil
+}
+
+// Migration directions and kinds of header
+const (
+	directionUp   = "up"
+	directionDown = "down"
+	kindSQL       = "sql"
+	kindGo        = "go"
+)
+
+// header is the first line of migration body added by funcSource, so funcDriver knows which migration it runs
+type header struct {
+	version   uint
+	direction string
+	kind      string
+	name      string
+}
+
+func (h header) String() string {
+	return fmt.Sprintf("%s%d %s %s %s\n", headerPrefix, h.version, h.direction, h.kind, h.name)
+}
+
+// splitHeader parses header of body and returns the rest of body
+func splitHeader(b []byte) (header, []byte, bool) {
+	if !bytes.HasPrefix(b, []byte(headerPrefix)) {
+		return header{}, b, false
+	}
+	line, rest, _ := bytes.Cut(b[len(headerPrefix):], []byte("\n"))
+	parts := strings.SplitN(string(line), " ", 4)
+	if len(parts) != 4 {
+		return header{}, b, false
+	}
+	version, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return header{}, b, false
+	}
+	return header{version: uint(version), direction: parts[1], kind: parts[2], name: parts[3]}, rest, true
+}
+
+// funcDriver runs Go migrations marked by funcSource within transaction, passes SQL migrations to the driver
+// and calls hooks around each of them. Between begin and end all migrations and versions are written within
+// the single transaction
+type funcDriver struct {
+	database.Driver
+	db              *sql.DB
+	migrationsTable string
+	table           string
+	funcs           map[uint]funcMigration
+	hooks           hooks
+	checksums       *checksums
+	applied         *appliedVersions
+	tx              *sql.Tx
+}
+
+func (d *funcDriver) Run(migration io.Reader) error {
+	b, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	h, body, ok := splitHeader(b)
+	if !ok {
+		return d.Driver.Run(bytes.NewReader(b))
+	}
+
+	d.hooks.beforeEach(h.version, h.name)
+	switch {
+	case h.kind == kindGo:
+		err = d.runFunc(h)
+	case d.tx != nil:
+		_, err = d.tx.Exec(string(body))
+	default:
+		err = d.Driver.Run(bytes.NewReader(body))
+	}
+	if err != nil {
+		return err
+	}
+	if d.checksums != nil && (h.kind == kindSQL || h.direction == directionDown) {
+		if err := d.checksums.store(d.execer(), h, body); err != nil {
+			return err
+		}
+	}
+	if d.applied != nil {
+		if err := d.applied.store(d.execer(), h.version, h.direction); err != nil {
+			return err
+		}
+	}
+	d.hooks.afterEach(h.version, h.name)
+	return nil
+}
+
+// runFunc runs Go migration within transaction
+func (d *funcDriver) runFunc(h header) error {
+	f := d.funcs[h.version]
+	fn := f.up
+	if h.direction == directionDown {
+		fn = f.down
+	}
+	if fn == nil {
+		return fmt.Errorf("migrate: %s migration of version %d is not registered", h.direction, h.version)
+	}
+	if d.tx != nil {
+		if err := fn(d.tx); err != nil {
+			return fmt.Errorf("migration %d %s failed: %w", h.version, h.direction, err)
+		}
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %d %s failed: %w", h.version, h.direction, err)
+	}
+	return tx.Commit()
+}
+
+// execer is *sql.DB or *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (d *funcDriver) execer() execer {
+	if d.tx != nil {
+		return d.tx
+	}
+	return d.db
+}
+
+// SetVersion writes version within the single transaction if it is started
+func (d *funcDriver) SetVersion(version int, dirty bool) error {
+	if d.tx == nil {
+		return d.Driver.SetVersion(version, dirty)
+	}
+	if _, err := d.tx.Exec(`TRUNCATE ` + d.table); err != nil {
+		return err
+	}
+	if version < 0 {
+		return nil
+	}
+	_, err := d.tx.Exec(`INSERT INTO `+d.table+` (version, dirty) VALUES ($1, $2)`, version, dirty)
+	return err
+}
+
+// Version reads version within the single transaction if it is started
+func (d *funcDriver) Version() (int, bool, error) {
+	if d.tx == nil {
+		return d.Driver.Version()
+	}
+	var version int
+	var dirty bool
+	err := d.tx.QueryRow(`SELECT version, dirty FROM `+d.table+` LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.NilVersion, false, nil
+	}
+	return version, dirty, err
+}
+
+// begin starts the single transaction
+func (d *funcDriver) begin() error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	d.tx = tx
+	return nil
+}
+
+// end commits the single transaction if err is nil or migrate.ErrNoChange, otherwise rolls it back
+func (d *funcDriver) end(err error) error {
+	tx := d.tx
+	d.tx = nil
+	if err != nil && err != migrate.ErrNoChange {
+		_ = tx.Rollback()
+		return err
+	}
+	if cerr := tx.Commit(); cerr != nil {
+		return cerr
+	}
+	return err
+}
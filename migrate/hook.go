@@ -0,0 +1,22 @@
+package migrate
+
+// MigrationHook is called with version and name of the migration, name of Go migration is "go"
+type MigrationHook func(version uint, name string)
+
+type hooks struct {
+	before   []MigrationHook
+	after    []MigrationHook
+	afterAll []func(version uint)
+}
+
+func (h hooks) beforeEach(version uint, name string) {
+	for _, fn := range h.before {
+		fn(version, name)
+	}
+}
+
+func (h hooks) afterEach(version uint, name string) {
+	for _, fn := range h.after {
+		fn(version, name)
+	}
+}
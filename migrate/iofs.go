@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/golang-migrate/migrate/source"
+)
+
+// fsSource is source driver reading migrations from fs.FS, e.g. embedded with go:embed
+type fsSource struct {
+	fsys       fs.FS
+	migrations *source.Migrations
+}
+
+// newFSSource reads migration files of fsys root, files not matching migration name format are ignored
+func newFSSource(fsys fs.FS) (*fsSource, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fsSource{fsys: fsys, migrations: source.NewMigrations()}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m, err := source.DefaultParse(e.Name())
+		if err != nil {
+			continue
+		}
+		if !s.migrations.Append(m) {
+			return nil, fmt.Errorf("unable to parse file %v", e.Name())
+		}
+	}
+	return s, nil
+}
+
+// Open is not supported, as the source is created with instance
+func (s *fsSource) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("fs source cannot be opened by url %s", url)
+}
+
+func (s *fsSource) Close() error {
+	return nil
+}
+
+func (s *fsSource) First() (uint, error) {
+	v, ok := s.migrations.First()
+	if !ok {
+		return 0, &os.PathError{Op: "first", Path: ".", Err: os.ErrNotExist}
+	}
+	return v, nil
+}
+
+func (s *fsSource) Prev(version uint) (uint, error) {
+	v, ok := s.migrations.Prev(version)
+	if !ok {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: ".", Err: os.ErrNotExist}
+	}
+	return v, nil
+}
+
+func (s *fsSource) Next(version uint) (uint, error) {
+	v, ok := s.migrations.Next(version)
+	if !ok {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: ".", Err: os.ErrNotExist}
+	}
+	return v, nil
+}
+
+func (s *fsSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	if m, ok := s.migrations.Up(version); ok {
+		return s.read(m)
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: ".", Err: os.ErrNotExist}
+}
+
+func (s *fsSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	if m, ok := s.migrations.Down(version); ok {
+		return s.read(m)
+	}
+	return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: ".", Err: os.ErrNotExist}
+}
+
+func (s *fsSource) read(m *source.Migration) (io.ReadCloser, string, error) {
+	f, err := s.fsys.Open(m.Raw)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, m.Identifier, nil
+}
@@ -1,31 +1,113 @@
 package migrate
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	db "github.com/alexandr-kononykhin-vay/postgres"
 	"github.com/golang-migrate/migrate"
 	"github.com/golang-migrate/migrate/database/postgres"
+	"github.com/golang-migrate/migrate/source"
 	_ "github.com/golang-migrate/migrate/source/file"
-	_ "github.com/lib/pq"
-	"go.uber.org/zap"
+	"github.com/lib/pq"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
-const driverName = "postgres"
+const (
+	driverName    = "postgres"
+	sourceName    = "migrations"
+	versionFormat = "20060102150405"
+)
 
 type Migrator struct {
-	path string
-	dsn  string
+	paths []string
+	fsys  fs.FS
+	dsn   string
 
 	cleanScheme []string
-	logger      *zap.Logger
+	logger      db.Logger
+	dryRun      bool
+	lockKey     *int64
+	hooks       hooks
+	schema      string
+	table       string
+
+	upTemplate   string
+	downTemplate string
+	checksumMode ChecksumMode
+	cleanConfirm string
+	singleTx     bool
+	connector    driver.Connector
+	outOfOrder   bool
+}
+
+// CleanConfirmEnv is environment variable with pattern of database names allowed to be cleaned,
+// used if WithCleanConfirm is not set
+const CleanConfirmEnv = "MIGRATE_CLEAN_CONFIRM"
+
+// ErrCleanNotConfirmed is returned by Run with WithClean if cleaning of the database is not confirmed
+var ErrCleanNotConfirmed = errors.New("migrate: clean is not confirmed")
+
+// PlannedMigration is up migration to be applied by Run
+type PlannedMigration struct {
+	Version uint
+	Name    string
+	SQL     string
 }
 
 func NewMigrator(path, dsn string, options ...OptionFn) *Migrator {
 	m := &Migrator{
-		path:   fmt.Sprintf("file://%s", strings.TrimPrefix(strings.TrimPrefix(path, "."), "/")),
+		paths:  []string{fileURL(path)},
+		dsn:    dsn,
+		logger: db.NopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(m)
+	}
+	return m
+}
+
+// NewMigratorDirs creates Migrator applying migrations of all paths merged in order of version, e.g. base
+// migrations shared by services and migrations of the service. The same version in several paths fails run
+func NewMigratorDirs(paths []string, dsn string, options ...OptionFn) *Migrator {
+	m := &Migrator{
+		dsn:    dsn,
+		logger: db.NopLogger(),
+	}
+	for _, path := range paths {
+		m.paths = append(m.paths, fileURL(path))
+	}
+
+	for _, opt := range options {
+		opt(m)
+	}
+	return m
+}
+
+// fileURL returns URL of file source of path
+func fileURL(path string) string {
+	return fmt.Sprintf("file://%s", strings.TrimPrefix(strings.TrimPrefix(path, "."), "/"))
+}
+
+// NewMigratorFS creates Migrator reading migrations from the root of fsys, so migrations can be embedded
+// into the binary with go:embed (use fs.Sub for a subdirectory of embed.FS)
+func NewMigratorFS(fsys fs.FS, dsn string, options ...OptionFn) *Migrator {
+	m := &Migrator{
+		fsys:   fsys,
 		dsn:    dsn,
-		logger: zap.NewNop(),
+		logger: db.NopLogger(),
 	}
 
 	for _, opt := range options {
@@ -34,15 +116,294 @@ func NewMigrator(path, dsn string, options ...OptionFn) *Migrator {
 	return m
 }
 
+// Run applies all up migrations, in dry-run mode planned migrations are logged instead
+// (see WithDryRun)
 func (m *Migrator) Run() error {
-	db, err := sql.Open(driverName, m.dsn)
+	if m.dryRun {
+		plan, err := m.Plan()
+		if err != nil {
+			return err
+		}
+		if len(plan) == 0 {
+			m.logger.Info("no new database changes")
+		}
+		for _, p := range plan {
+			m.logger.Info("migration planned", "version", p.Version, "name", p.Name)
+			m.logger.Debug("migration sql", "version", p.Version, "sql", p.SQL)
+		}
+		return nil
+	}
+
+	return m.run(true, func(migration *migrate.Migrate) error {
+		return migration.Up()
+	})
+}
+
+// Down applies all down migrations
+func (m *Migrator) Down() error {
+	return m.run(false, func(migration *migrate.Migrate) error {
+		return migration.Down()
+	})
+}
+
+// Steps applies n up migrations if n is positive or -n down migrations if n is negative
+func (m *Migrator) Steps(n int) error {
+	return m.run(false, func(migration *migrate.Migrate) error {
+		return migration.Steps(n)
+	})
+}
+
+// To applies up or down migrations to reach version
+func (m *Migrator) To(version uint) error {
+	return m.run(false, func(migration *migrate.Migrate) error {
+		return migration.Migrate(version)
+	})
+}
+
+// Force sets version without applying migrations and resets dirty state, so failed migration can be repaired
+// manually and retried. Version -1 means no migration is applied
+func (m *Migrator) Force(version int) error {
+	return m.run(false, func(migration *migrate.Migrate) error {
+		return migration.Force(version)
+	})
+}
+
+// Create generates empty or templated (see WithTemplate) up and down migration files named by current UTC time
+// and name in the migrations directory, the last one for NewMigratorDirs. It returns paths of the files
+func (m *Migrator) Create(name string) (up, down string, err error) {
+	if m.fsys != nil || len(m.paths) == 0 {
+		return "", "", errors.New("migrate: migrations directory is not set")
+	}
+	name = migrationName(name)
+	if name == "" {
+		return "", "", errors.New("migrate: migration name is empty")
+	}
+
+	dir := strings.TrimPrefix(m.paths[len(m.paths)-1], "file://")
+	data := struct {
+		Version uint64
+		Name    string
+	}{Name: name}
+	data.Version, err = strconv.ParseUint(time.Now().UTC().Format(versionFormat), 10, 64)
+	if err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%d_%s", data.Version, name))
+	up, down = base+".up.sql", base+".down.sql"
+	if err := createFile(up, m.upTemplate, data); err != nil {
+		return "", "", err
+	}
+	if err := createFile(down, m.downTemplate, data); err != nil {
+		_ = os.Remove(up)
+		return "", "", err
+	}
+	m.logger.Info("migration created", "up", up, "down", down)
+	return up, down, nil
+}
+
+// migrationName converts name into lower snake case
+func migrationName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return strings.Trim(b.String(), "_")
+}
+
+// createFile writes executed text template into new file of path, existing file is not overwritten
+func createFile(path, text string, data interface{}) error {
+	tmpl, err := template.New(filepath.Base(path)).Parse(text)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(f, data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// Version returns version of the last applied migration, -1 means no migration is applied. Dirty is set
+// if the migration failed
+func (m *Migrator) Version() (version int, dirty bool, err error) {
+	db, driver, err := m.connect()
+	if err != nil {
+		return 0, false, err
+	}
+	defer db.Close()
+
+	return driver.Version()
+}
+
+// Plan returns up migrations not applied to database yet in order of applying, schemes to be cleaned by Run
+// are not taken into account
+func (m *Migrator) Plan() ([]PlannedMigration, error) {
+	db, driver, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	version, dirty, err := driver.Version()
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, migrate.ErrDirty{Version: version}
+	}
+
+	src, err := m.newSource()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var plan []PlannedMigration
+	for {
+		var next uint
+		if version < 0 {
+			next, err = src.First()
+		} else {
+			next, err = src.Next(uint(version))
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return plan, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		version = int(next)
+
+		r, name, err := src.ReadUp(next)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if h, body, ok := splitHeader(b); ok && h.kind == kindSQL {
+			b = body
+		}
+		plan = append(plan, PlannedMigration{Version: next, Name: name, SQL: string(b)})
+	}
+}
+
+// connect opens database and creates migrate driver of it
+func (m *Migrator) connect() (*sql.DB, *funcDriver, error) {
+	db, err := m.open()
+	if err != nil {
+		m.logger.Error("failed to connect database", "error", err)
+		return nil, nil, err
+	}
+
+	driver, err := m.newDriver(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return db, driver, nil
+}
+
+// newDriver creates migrate driver of db, the migrations table is created if it doesn't exist
+func (m *Migrator) newDriver(db *sql.DB) (*funcDriver, error) {
+	if m.schema != "" {
+		if _, err := db.Exec("CREATE SCHEMA IF NOT EXISTS " + pq.QuoteIdentifier(m.schema)); err != nil {
+			return nil, err
+		}
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: m.table})
+	if err != nil {
+		return nil, err
+	}
+	table := m.table
+	if table == "" {
+		table = postgres.DefaultMigrationsTable
+	}
+	return &funcDriver{
+		Driver:          driver,
+		db:              db,
+		migrationsTable: table,
+		table:           pq.QuoteIdentifier(table),
+		funcs:           registeredFuncs(),
+		hooks:           m.hooks,
+	}, nil
+}
+
+// open opens database with connector or DSN of the migrator
+func (m *Migrator) open() (*sql.DB, error) {
+	if m.connector != nil {
+		connector := m.connector
+		if m.schema != "" {
+			connector = searchPathConnector{Connector: connector, schema: m.schema}
+		}
+		return sql.OpenDB(connector), nil
+	}
+
+	dsn := m.dsn
+	if m.schema != "" {
+		var err error
+		if dsn, err = withSearchPath(dsn, m.schema); err != nil {
+			return nil, err
+		}
+	}
+	return sql.Open(driverName, dsn)
+}
+
+// withSearchPath sets search_path run-time parameter of connections of dsn given as URL or key=value pairs
+func withSearchPath(dsn, schema string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(schema)
+	return strings.TrimSpace(dsn + " search_path='" + value + "'"), nil
+}
+
+// run connects database and runs fn, up is set by Run: schemes are cleaned and out-of-order migrations are applied
+// before fn
+func (m *Migrator) run(up bool, fn func(migration *migrate.Migrate) error) error {
+	db, err := m.open()
 	if err != nil {
-		m.logger.Error("failed to connect database", zap.Error(err))
+		m.logger.Error("failed to connect database", "error", err)
 		return err
 	}
 	defer db.Close()
 
-	if len(m.cleanScheme) > 0 {
+	if m.lockKey != nil {
+		unlock, err := m.lock(db, *m.lockKey)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if up && len(m.cleanScheme) > 0 {
+		if err := m.confirmClean(db); err != nil {
+			return err
+		}
 		for _, scheme := range m.cleanScheme {
 			if err := m.cleanDatabase(db, scheme); err != nil {
 				return err
@@ -50,29 +411,69 @@ func (m *Migrator) Run() error {
 		}
 	}
 
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	driver, err := m.newDriver(db)
 	if err != nil {
 		return err
 	}
-
-	migration, err := migrate.NewWithDatabaseInstance(m.path, driverName, driver)
+	src, err := m.newSource()
+	if err != nil {
+		return err
+	}
+	if m.checksumMode != ChecksumOff {
+		if driver.checksums, err = newChecksums(db, m.table); err != nil {
+			return err
+		}
+		if err := m.verifyChecksums(driver.checksums, src); err != nil {
+			_ = src.Close()
+			return err
+		}
+	}
+	// applied versions are recorded by every run, so out-of-order runs don't apply migrations of runs without
+	// the option again
+	if driver.applied, err = newAppliedVersions(driver, src, driver.migrationsTable); err != nil {
+		_ = src.Close()
+		return err
+	}
+	migration, err := migrate.NewWithInstance(sourceName, src, driverName, driver)
 	if err != nil {
 		return err
 	}
 
 	beforeVersion, dirty, err := migration.Version()
-	if err != nil && beforeVersion != 0 {
+	if err != nil && err != migrate.ErrNilVersion {
 		return err
 	}
 
-	m.logger.Info("migration started", zap.Uint("version", beforeVersion))
+	m.logger.Info("migration started", "version", beforeVersion)
 
 	if dirty {
 		m.logger.Warn("previous migration failed")
 	}
 
-	err = migration.Up()
+	apply := func() error {
+		var n int
+		if up && m.outOfOrder {
+			var err error
+			if n, err = m.applyOutOfOrder(driver, src); err != nil {
+				return err
+			}
+		}
+		err := fn(migration)
+		if n > 0 && err == migrate.ErrNoChange {
+			return nil
+		}
+		return err
+	}
+	if m.singleTx {
+		if err := driver.begin(); err != nil {
+			return err
+		}
+		err = driver.end(apply())
+	} else {
+		err = apply()
+	}
 
+	changed := err == nil
 	if err != nil && err != migrate.ErrNoChange {
 		return err
 	} else if err == migrate.ErrNoChange {
@@ -80,11 +481,16 @@ func (m *Migrator) Run() error {
 	}
 
 	afterVersion, dirty, err := migration.Version()
-	if err != nil && beforeVersion != 0 {
+	if err != nil && err != migrate.ErrNilVersion {
 		return err
 	}
+	if changed {
+		for _, fn := range m.hooks.afterAll {
+			fn(afterVersion)
+		}
+	}
 
-	m.logger.Info("migration done", zap.Uint("version", afterVersion))
+	m.logger.Info("migration done", "version", afterVersion)
 
 	if dirty {
 		m.logger.Warn("previous migration failed")
@@ -93,14 +499,104 @@ func (m *Migrator) Run() error {
 	return nil
 }
 
+// newSource creates source driver reading migrations from the paths or fs of the migrator merged with
+// registered Go migrations
+func (m *Migrator) newSource() (source.Driver, error) {
+	var src source.Driver
+	var err error
+	if m.fsys == nil {
+		src, err = m.openPaths()
+	} else {
+		src, err = newFSSource(m.fsys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newFuncSource(src, registeredFuncs())
+}
+
+// openPaths opens file sources of the paths, several sources are merged
+func (m *Migrator) openPaths() (source.Driver, error) {
+	if len(m.paths) == 1 {
+		return source.Open(m.paths[0])
+	}
+
+	srcs := make([]source.Driver, 0, len(m.paths))
+	for _, path := range m.paths {
+		src, err := source.Open(path)
+		if err != nil {
+			for _, s := range srcs {
+				_ = s.Close()
+			}
+			return nil, err
+		}
+		srcs = append(srcs, src)
+	}
+	src, err := newMultiSource(srcs...)
+	if err != nil {
+		for _, s := range srcs {
+			_ = s.Close()
+		}
+		return nil, err
+	}
+	return src, nil
+}
+
+// lock waits for session advisory lock of key on dedicated connection, returned func releases the lock
+func (m *Migrator) lock(db *sql.DB, key int64) (func(), error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Info("waiting for migration lock", "key", key)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+			m.logger.Warn("failed to release migration lock", "error", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// confirmClean checks name of the database matches pattern of WithCleanConfirm or CleanConfirmEnv
+func (m *Migrator) confirmClean(db *sql.DB) error {
+	pattern := m.cleanConfirm
+	if pattern == "" {
+		pattern = os.Getenv(CleanConfirmEnv)
+	}
+	if pattern == "" {
+		return ErrCleanNotConfirmed
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	if err := db.QueryRow("SELECT current_database()").Scan(&name); err != nil {
+		return err
+	}
+	if !re.MatchString(name) {
+		m.logger.Error("clean refused", "database", name, "pattern", pattern)
+		return fmt.Errorf("%w: database %s doesn't match %s", ErrCleanNotConfirmed, name, pattern)
+	}
+	return nil
+}
+
 // Clean database public scheme
 func (m *Migrator) cleanDatabase(db *sql.DB, schema string) error {
-	m.logger.Info("clean schema", zap.String("schema", schema))
-	_, err := db.Query("DROP SCHEMA " + schema + " CASCADE")
+	m.logger.Info("clean schema", "schema", schema)
+	_, err := db.Exec("DROP SCHEMA " + schema + " CASCADE")
 	if err != nil {
 		return err
 	}
-	_, err = db.Query("CREATE SCHEMA " + schema)
+	_, err = db.Exec("CREATE SCHEMA " + schema)
 	if err != nil {
 		return err
 	}
@@ -4,12 +4,27 @@
 package migrate
 
 import (
+	"context"
+	"database/sql"
+	"embed"
+	db "github.com/alexandr-kononykhin-vay/postgres"
 	"github.com/alexandr-kononykhin-vay/postgres/migrate/test"
+	"github.com/alexandr-kononykhin-vay/postgres/pgxclient"
+	"github.com/go-pg/pg/v10"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"io/fs"
 	"os"
+	"path"
 	"testing"
 )
 
+//go:embed test/migrations/*.sql
+var migrations embed.FS
+
 type Item struct {
 	tableName struct{} `pg:"test1"`
 	ID        int64    `pg:"id"`
@@ -31,3 +46,358 @@ func TestMigrate_Run(t *testing.T) {
 	require.Equal(t, "test", item.Field1)
 	require.Equal(t, 123, item.Field2)
 }
+
+func TestMigrate_RunFS(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	fsys, err := fs.Sub(migrations, "test/migrations")
+	require.NoError(t, err)
+
+	migrator := NewMigratorFS(fsys, os.Getenv("DSN"), WithClean("public"))
+	err = migrator.Run()
+	require.NoError(t, err)
+
+	item := Item{ID: 1}
+	err = testDb.Select(&item)
+
+	require.NoError(t, err)
+	require.Equal(t, "test", item.Field1)
+	require.Equal(t, 123, item.Field2)
+}
+
+func TestMigrate_DownStepsTo(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	migrator := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"))
+	require.NoError(t, migrator.Run())
+
+	require.NoError(t, migrator.Steps(-1))
+	count, err := testDb.Model(&Item{}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	require.NoError(t, migrator.To(20220101000001))
+	count, err = testDb.Model(&Item{}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	require.NoError(t, migrator.Down())
+	_, err = testDb.Model(&Item{}).Count()
+	require.Error(t, err)
+
+	require.NoError(t, migrator.Force(20220101000001))
+	var version int64
+	_, err = testDb.QueryOne(pg.Scan(&version), `SELECT "version" FROM "schema_migrations"`)
+	require.NoError(t, err)
+	require.Equal(t, int64(20220101000001), version)
+
+	require.NoError(t, migrator.Force(-1))
+	require.NoError(t, migrator.Run())
+	count, err = testDb.Model(&Item{}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestMigrate_DryRun(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	migrator := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"))
+	require.NoError(t, migrator.Run())
+	require.NoError(t, migrator.Down())
+
+	plan, err := migrator.Plan()
+	require.NoError(t, err)
+	require.Len(t, plan, 2)
+	require.Equal(t, uint(20220101000000), plan[0].Version)
+	require.Contains(t, plan[1].SQL, "insert into")
+
+	require.NoError(t, migrator.To(20220101000000))
+
+	core, logs := observer.New(zap.DebugLevel)
+	dryRun := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"), WithDryRun(), WithLogger(db.ZapLogger(zap.New(core))))
+	require.NoError(t, dryRun.Run())
+	require.Equal(t, 1, logs.FilterMessage("migration planned").Len())
+	require.Equal(t, 1, logs.FilterMessage("migration sql").Len())
+
+	count, err := testDb.Model(&Item{}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+}
+
+func TestMigrate_WithLock(t *testing.T) {
+	test.CleanDB(testDb, t)
+	require.NoError(t, NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public")).Run())
+	require.NoError(t, NewMigrator("test/migrations", os.Getenv("DSN")).Down())
+
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- NewMigrator("test/migrations", os.Getenv("DSN"), WithLock(42)).Run()
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		require.NoError(t, <-errs)
+	}
+
+	count, err := testDb.Model(&Item{}).Count()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestMigrate_Register(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	const version = 20220101000002
+	Register(version, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE "test1" SET "field2" = "field2" + 1`)
+		return err
+	}, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE "test1" SET "field2" = "field2" - 1`)
+		return err
+	})
+	defer unregister(version)
+
+	migrator := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"))
+	require.NoError(t, migrator.Run())
+
+	item := Item{ID: 1}
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 124, item.Field2)
+
+	require.NoError(t, migrator.Steps(-1))
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 123, item.Field2)
+
+	require.Panics(t, func() { Register(version, nil, nil) })
+}
+
+func TestMigrate_Hooks(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	var before, after []uint
+	var names []string
+	var last []uint
+	migrator := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"),
+		WithBeforeEach(func(version uint, name string) {
+			before = append(before, version)
+		}),
+		WithAfterEach(func(version uint, name string) {
+			after = append(after, version)
+			names = append(names, name)
+		}),
+		WithAfterAll(func(version uint) {
+			last = append(last, version)
+		}))
+
+	require.NoError(t, migrator.Run())
+	require.Equal(t, []uint{20220101000000, 20220101000001}, before)
+	require.Equal(t, before, after)
+	require.Equal(t, []string{"test1", "test1"}, names)
+	require.Equal(t, []uint{20220101000001}, last)
+
+	require.NoError(t, NewMigrator("test/migrations", os.Getenv("DSN"), WithAfterAll(func(version uint) {
+		t.Fatal("no migration is applied")
+	})).Run())
+}
+
+func TestMigrate_Schema(t *testing.T) {
+	test.CleanDB(testDb, t)
+	defer func() {
+		_, err := testDb.Exec(`DROP SCHEMA IF EXISTS "billing" CASCADE`)
+		require.NoError(t, err)
+	}()
+
+	migrator := NewMigrator("test/migrations", os.Getenv("DSN"),
+		WithSchema("billing"), WithMigrationsTable("billing_schema_migrations"))
+	require.NoError(t, migrator.Run())
+
+	var count int
+	_, err := testDb.QueryOne(pg.Scan(&count), `SELECT count(*) FROM "billing"."test1"`)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	var version int64
+	_, err = testDb.QueryOne(pg.Scan(&version), `SELECT version FROM "billing"."billing_schema_migrations"`)
+	require.NoError(t, err)
+	require.EqualValues(t, 20220101000001, version)
+}
+
+func TestMigrate_Dirs(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	migrator := NewMigratorDirs([]string{"test/service", "test/migrations"}, os.Getenv("DSN"), WithClean("public"))
+	require.NoError(t, migrator.Run())
+
+	var field3 int
+	_, err := testDb.QueryOne(pg.Scan(&field3), `SELECT "field3" FROM "test1" WHERE "id" = 1`)
+	require.NoError(t, err)
+
+	require.NoError(t, migrator.Steps(-1))
+	_, err = testDb.QueryOne(pg.Scan(&field3), `SELECT "field3" FROM "test1" WHERE "id" = 1`)
+	require.Error(t, err)
+
+	duplicated := NewMigratorDirs([]string{"test/migrations", "test/migrations"}, os.Getenv("DSN"))
+	require.Error(t, duplicated.Run())
+}
+
+func TestMigrate_Checksums(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	dir, err := os.MkdirTemp(".", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files, err := fs.Glob(migrations, "test/migrations/*.sql")
+	require.NoError(t, err)
+	for _, f := range files {
+		b, err := fs.ReadFile(migrations, f)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dir+"/"+path.Base(f), b, 0o644))
+	}
+
+	migrator := NewMigrator(dir, os.Getenv("DSN"), WithClean("public"), WithChecksums(ChecksumFail))
+	require.NoError(t, migrator.Run())
+	require.NoError(t, NewMigrator(dir, os.Getenv("DSN"), WithChecksums(ChecksumFail)).Run())
+
+	require.NoError(t, os.WriteFile(dir+"/20220101000001_test1.up.sql",
+		[]byte(`insert into "test1" ("field1", "field2") VALUES ('test', 456);`), 0o644))
+
+	err = NewMigrator(dir, os.Getenv("DSN"), WithChecksums(ChecksumFail)).Run()
+	var checksumErr *ChecksumError
+	require.ErrorAs(t, err, &checksumErr)
+	require.Equal(t, []ChangedMigration{{Version: 20220101000001, Name: "test1"}}, checksumErr.Changed)
+
+	require.NoError(t, NewMigrator(dir, os.Getenv("DSN"), WithChecksums(ChecksumWarn)).Run())
+}
+
+func TestMigrate_CleanConfirm(t *testing.T) {
+	t.Setenv(CleanConfirmEnv, "")
+
+	err := NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public")).Run()
+	require.ErrorIs(t, err, ErrCleanNotConfirmed)
+
+	err = NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"), WithCleanConfirm("^production$")).Run()
+	require.ErrorIs(t, err, ErrCleanNotConfirmed)
+
+	t.Setenv(CleanConfirmEnv, "^production$")
+	err = NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public")).Run()
+	require.ErrorIs(t, err, ErrCleanNotConfirmed)
+
+	require.NoError(t, NewMigrator("test/migrations", os.Getenv("DSN"), WithClean("public"), WithCleanConfirm(".")).Run())
+}
+
+func TestMigrate_SingleTransaction(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	dir, err := os.MkdirTemp(".", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	b, err := fs.ReadFile(migrations, "test/migrations/20220101000000_test1.up.sql")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dir+"/20220101000000_test1.up.sql", b, 0o644))
+	require.NoError(t, os.WriteFile(dir+"/20220101000001_test1.up.sql", []byte(`insert into "missing" values (1);`), 0o644))
+
+	migrator := NewMigrator(dir, os.Getenv("DSN"), WithClean("public"), WithSingleTransaction())
+	require.Error(t, migrator.Run())
+
+	version, dirty, err := migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, -1, version)
+	require.False(t, dirty)
+	_, err = testDb.Exec(`SELECT 1 FROM "test1"`)
+	require.Error(t, err)
+
+	require.NoError(t, os.Remove(dir+"/20220101000001_test1.up.sql"))
+	require.NoError(t, migrator.Run())
+	version, dirty, err = migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, 20220101000000, version)
+	require.False(t, dirty)
+}
+
+func TestMigrate_WithClient(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	migrator := NewMigrator("test/migrations", "", WithClean("public"), WithClient(testDb))
+	require.NoError(t, migrator.Run())
+
+	item := Item{ID: 1}
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 123, item.Field2)
+}
+
+func TestMigrate_WithClient_NoConnection(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), os.Getenv("DSN"))
+	require.NoError(t, err)
+	client := pgxclient.New(pool)
+	defer client.Close()
+
+	migrator := NewMigrator("test/migrations", "", WithClient(client))
+	require.ErrorContains(t, migrator.Run(), errNoClientOptions.Error())
+}
+
+func TestMigrate_WithConnector(t *testing.T) {
+	test.CleanDB(testDb, t)
+	defer func() {
+		_, err := testDb.Exec(`DROP SCHEMA IF EXISTS "billing" CASCADE`)
+		require.NoError(t, err)
+	}()
+
+	connector, err := pq.NewConnector(os.Getenv("DSN"))
+	require.NoError(t, err)
+	migrator := NewMigrator("test/migrations", "", WithConnector(connector), WithSchema("billing"))
+	require.NoError(t, migrator.Run())
+
+	var count int
+	_, err = testDb.QueryOne(pg.Scan(&count), `SELECT count(*) FROM "billing"."test1"`)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestMigrate_AllowOutOfOrder(t *testing.T) {
+	test.CleanDB(testDb, t)
+
+	dir, err := os.MkdirTemp(".", "migrations")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	files, err := fs.Glob(migrations, "test/migrations/*.sql")
+	require.NoError(t, err)
+	for _, f := range files {
+		b, err := fs.ReadFile(migrations, f)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dir+"/"+path.Base(f), b, 0o644))
+	}
+
+	migrator := NewMigrator(dir, os.Getenv("DSN"), WithClean("public"), WithAllowOutOfOrder())
+	require.NoError(t, migrator.Run())
+
+	require.NoError(t, os.WriteFile(dir+"/20211231000000_test0.up.sql", []byte(`update "test1" set "field2" = 200;`), 0o644))
+	require.NoError(t, NewMigrator(dir, os.Getenv("DSN")).Run())
+	item := Item{ID: 1}
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 123, item.Field2)
+
+	var applied []uint
+	migrator = NewMigrator(dir, os.Getenv("DSN"), WithAllowOutOfOrder(), WithAfterEach(func(version uint, name string) {
+		applied = append(applied, version)
+	}))
+	require.NoError(t, migrator.Run())
+	require.Equal(t, []uint{20211231000000}, applied)
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 200, item.Field2)
+
+	version, _, err := migrator.Version()
+	require.NoError(t, err)
+	require.Equal(t, 20220101000001, version)
+
+	require.NoError(t, migrator.Run())
+	require.Len(t, applied, 1)
+
+	// migrations applied by runs without the option are not applied again
+	require.NoError(t, os.WriteFile(dir+"/20220201000000_test3.up.sql", []byte(`update "test1" set "field2" = "field2" + 1;`), 0o644))
+	require.NoError(t, NewMigrator(dir, os.Getenv("DSN")).Run())
+	require.NoError(t, os.WriteFile(dir+"/20220301000000_test4.up.sql", []byte(`select 1;`), 0o644))
+	require.NoError(t, migrator.Run())
+	require.Equal(t, []uint{20211231000000, 20220301000000}, applied)
+	require.NoError(t, testDb.Select(&item))
+	require.Equal(t, 201, item.Field2)
+}
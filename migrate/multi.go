@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/golang-migrate/migrate/source"
+)
+
+// versionList is sorted list of migration versions
+type versionList []uint
+
+func (l versionList) sort() {
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+}
+
+func (l versionList) first() (uint, error) {
+	if len(l) == 0 {
+		return 0, &os.PathError{Op: "first", Path: sourceName, Err: os.ErrNotExist}
+	}
+	return l[0], nil
+}
+
+func (l versionList) prev(version uint) (uint, error) {
+	i := sort.Search(len(l), func(i int) bool { return l[i] >= version })
+	if i == 0 || i == len(l) || l[i] != version {
+		return 0, &os.PathError{Op: fmt.Sprintf("prev for version %v", version), Path: sourceName, Err: os.ErrNotExist}
+	}
+	return l[i-1], nil
+}
+
+func (l versionList) next(version uint) (uint, error) {
+	i := sort.Search(len(l), func(i int) bool { return l[i] >= version })
+	if i >= len(l)-1 || l[i] != version {
+		return 0, &os.PathError{Op: fmt.Sprintf("next for version %v", version), Path: sourceName, Err: os.ErrNotExist}
+	}
+	return l[i+1], nil
+}
+
+// multiSource merges migrations of several sources in order of version, each version is read from the source
+// containing it
+type multiSource struct {
+	sources  []source.Driver
+	owners   map[uint]source.Driver
+	versions versionList
+}
+
+// newMultiSource merges migrations of srcs, the same version in several sources is an error
+func newMultiSource(srcs ...source.Driver) (*multiSource, error) {
+	s := &multiSource{sources: srcs, owners: make(map[uint]source.Driver)}
+	for _, src := range srcs {
+		v, err := src.First()
+		for err == nil {
+			if _, ok := s.owners[v]; ok {
+				return nil, fmt.Errorf("migrate: version %d is in several sources", v)
+			}
+			s.owners[v] = src
+			s.versions = append(s.versions, v)
+			v, err = src.Next(v)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	s.versions.sort()
+	return s, nil
+}
+
+// Open is not supported, as the source is created with instance
+func (s *multiSource) Open(url string) (source.Driver, error) {
+	return nil, fmt.Errorf("multi source cannot be opened by url %s", url)
+}
+
+func (s *multiSource) Close() error {
+	var err error
+	for _, src := range s.sources {
+		if cerr := src.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *multiSource) First() (uint, error) {
+	return s.versions.first()
+}
+
+func (s *multiSource) Prev(version uint) (uint, error) {
+	return s.versions.prev(version)
+}
+
+func (s *multiSource) Next(version uint) (uint, error) {
+	return s.versions.next(version)
+}
+
+func (s *multiSource) ReadUp(version uint) (io.ReadCloser, string, error) {
+	src, ok := s.owners[version]
+	if !ok {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: sourceName, Err: os.ErrNotExist}
+	}
+	return src.ReadUp(version)
+}
+
+func (s *multiSource) ReadDown(version uint) (io.ReadCloser, string, error) {
+	src, ok := s.owners[version]
+	if !ok {
+		return nil, "", &os.PathError{Op: fmt.Sprintf("read version %v", version), Path: sourceName, Err: os.ErrNotExist}
+	}
+	return src.ReadDown(version)
+}
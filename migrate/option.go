@@ -1,22 +1,140 @@
 package migrate
 
 import (
-	"go.uber.org/zap"
+	"database/sql/driver"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
 )
 
 type Option []OptionFn
 type OptionFn func(m *Migrator)
 
-// WithClean clean database
+// WithClean clean database, cleaning has to be confirmed with WithCleanConfirm or CleanConfirmEnv
 func WithClean(scheme ...string) OptionFn {
 	return func(m *Migrator) {
 		m.cleanScheme = scheme
 	}
 }
 
+// WithCleanConfirm allows WithClean to clean database with name matching regular expression pattern,
+// e.g. "_test$", Run fails with ErrCleanNotConfirmed for other databases
+func WithCleanConfirm(pattern string) OptionFn {
+	return func(m *Migrator) {
+		m.cleanConfirm = pattern
+	}
+}
+
 // WithLogger implement logger
-func WithLogger(logger *zap.Logger) OptionFn {
+func WithLogger(logger db.Logger) OptionFn {
 	return func(m *Migrator) {
 		m.logger = logger
 	}
 }
+
+// WithDryRun makes Run log migrations to be applied without applying them, SQL of migrations is logged
+// at debug level
+func WithDryRun() OptionFn {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// WithLock makes migrations of several instances run one by one under Postgres advisory lock of key,
+// instances waiting for the lock find migrations applied and do nothing
+func WithLock(key int64) OptionFn {
+	return func(m *Migrator) {
+		m.lockKey = &key
+	}
+}
+
+// WithBeforeEach adds hook called before each applied migration, up and down ones
+func WithBeforeEach(fn MigrationHook) OptionFn {
+	return func(m *Migrator) {
+		m.hooks.before = append(m.hooks.before, fn)
+	}
+}
+
+// WithAfterEach adds hook called after each successfully applied migration, up and down ones
+func WithAfterEach(fn MigrationHook) OptionFn {
+	return func(m *Migrator) {
+		m.hooks.after = append(m.hooks.after, fn)
+	}
+}
+
+// WithAfterAll adds hook called with the resulting version after run applying at least one migration,
+// e.g. to refresh materialized views once
+func WithAfterAll(fn func(version uint)) OptionFn {
+	return func(m *Migrator) {
+		m.hooks.afterAll = append(m.hooks.afterAll, fn)
+	}
+}
+
+// WithSchema makes migrations run with search_path set to schema, so unqualified objects and the migrations table
+// are created there. The schema is created if it doesn't exist
+func WithSchema(schema string) OptionFn {
+	return func(m *Migrator) {
+		m.schema = schema
+	}
+}
+
+// WithMigrationsTable sets name of the table keeping migration version, schema_migrations by default
+func WithMigrationsTable(table string) OptionFn {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithTemplate sets text/template of up and down migration files generated by Create, templates are executed
+// with .Version and .Name of the migration
+func WithTemplate(up, down string) OptionFn {
+	return func(m *Migrator) {
+		m.upTemplate = up
+		m.downTemplate = down
+	}
+}
+
+// WithChecksums makes Migrator record checksums of applied SQL migrations and check them before applying new ones,
+// so editing already applied migration is reported according to mode
+func WithChecksums(mode ChecksumMode) OptionFn {
+	return func(m *Migrator) {
+		m.checksumMode = mode
+	}
+}
+
+// WithSingleTransaction makes Migrator apply all migrations of the run within one transaction, so failed migration
+// leaves database at the previous version instead of dirty one. Migrations have to be allowed in transaction block,
+// e.g. CREATE INDEX CONCURRENTLY is not. Hooks of migrations are called before the transaction commits
+func WithSingleTransaction() OptionFn {
+	return func(m *Migrator) {
+		m.singleTx = true
+	}
+}
+
+// WithConnector makes Migrator open database with connector instead of DSN, e.g. connector of pgx/stdlib or lib/pq
+// configured for the application, so TLS, pgbouncer or IAM token settings are shared with migrations. The database
+// is closed after each operation of Migrator. DSN of the constructor is ignored
+func WithConnector(connector driver.Connector) OptionFn {
+	return func(m *Migrator) {
+		m.connector = connector
+	}
+}
+
+// WithClient makes Migrator open database with address, credentials, database name, dialer and TLS mode of client
+// options instead of DSN. Custom root certificates of the client TLS config are not used, the server certificate
+// is verified against system roots unless InsecureSkipVerify is set. DSN of the constructor is ignored.
+// Clients without go-pg handle (Db returns nil), e.g. of pgxclient, are not supported: Migrator fails to connect,
+// use WithConnector with connector of the pool, e.g. stdlib.GetPoolConnector of pgx
+func WithClient(client db.Client) OptionFn {
+	return func(m *Migrator) {
+		m.connector = newClientConnector(client)
+	}
+}
+
+// WithAllowOutOfOrder makes Run apply pending migrations with versions lower than the current one, e.g. merged
+// from another branch. Applied migrations are recorded by every run with or without the option, migrations up to
+// the current version not recorded yet, e.g. applied by another tool, are considered applied
+func WithAllowOutOfOrder() OptionFn {
+	return func(m *Migrator) {
+		m.outOfOrder = true
+	}
+}
@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+
+	"github.com/golang-migrate/migrate"
+	"github.com/golang-migrate/migrate/source"
+	"github.com/lib/pq"
+)
+
+// appliedVersions keeps every applied migration in the table named after migrations table, so migrations
+// with versions lower than the current one can be found and applied
+type appliedVersions struct {
+	table string
+}
+
+// newAppliedVersions creates the table and reconciles it with the current version: versions of src above the last
+// recorded one up to the current one are recorded as applied, as they were applied in order before tracking was
+// enabled or by a migrator not recording them, e.g. of another tool
+func newAppliedVersions(d *funcDriver, src source.Driver, migrationsTable string) (*appliedVersions, error) {
+	a := &appliedVersions{table: pq.QuoteIdentifier(migrationsTable + "_applied")}
+	ex := d.execer()
+	_, err := ex.Exec(`CREATE TABLE IF NOT EXISTS ` + a.table + ` (version bigint NOT NULL PRIMARY KEY,
+		applied timestamp NOT NULL DEFAULT now())`)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded sql.NullInt64
+	if err := d.queryRow(`SELECT max(version) FROM ` + a.table).Scan(&recorded); err != nil {
+		return nil, err
+	}
+	current, _, err := d.Version()
+	if err != nil || current < 0 || (recorded.Valid && recorded.Int64 >= int64(current)) {
+		return a, err
+	}
+
+	v, err := src.First()
+	for err == nil && v <= uint(current) {
+		if !recorded.Valid || int64(v) > recorded.Int64 {
+			if err := a.store(ex, v, directionUp); err != nil {
+				return nil, err
+			}
+		}
+		v, err = src.Next(v)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return a, nil
+}
+
+// store records applied up migration, down migration is removed
+func (a *appliedVersions) store(ex execer, version uint, direction string) error {
+	if direction == directionDown {
+		_, err := ex.Exec(`DELETE FROM `+a.table+` WHERE version = $1`, version)
+		return err
+	}
+	_, err := ex.Exec(`INSERT INTO `+a.table+` (version) VALUES ($1) ON CONFLICT (version) DO NOTHING`, version)
+	return err
+}
+
+// applyOutOfOrder applies up migrations of src with versions lower than the current one which are not applied yet,
+// it returns the number of applied migrations
+func (m *Migrator) applyOutOfOrder(d *funcDriver, src source.Driver) (int, error) {
+	current, dirty, err := d.Version()
+	if err != nil || current < 0 {
+		return 0, err
+	}
+	if dirty {
+		return 0, migrate.ErrDirty{Version: current}
+	}
+
+	rows, err := d.query(`SELECT version FROM ` + d.applied.table)
+	if err != nil {
+		return 0, err
+	}
+	applied := make(map[uint]bool)
+	for rows.Next() {
+		var v uint
+		if err := rows.Scan(&v); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		applied[v] = true
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	v, err := src.First()
+	for err == nil && v < uint(current) {
+		if !applied[v] {
+			if err := m.applyUp(d, src, v, current); err != nil {
+				return n, err
+			}
+			n++
+		}
+		v, err = src.Next(v)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return n, err
+	}
+	return n, nil
+}
+
+// applyUp runs up migration of version, missing up migration is skipped. The current version is marked dirty
+// while the migration runs, so its failure stops next runs until the database is fixed and the version is forced
+func (m *Migrator) applyUp(d *funcDriver, src source.Driver, version uint, current int) error {
+	r, name, err := src.ReadUp(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	m.logger.Info("applying out-of-order migration", "version", version, "name", name)
+	if err := d.SetVersion(current, true); err != nil {
+		return err
+	}
+	if err := d.Run(r); err != nil {
+		return err
+	}
+	return d.SetVersion(current, false)
+}
+
+// query runs query within the single transaction if it is started
+func (d *funcDriver) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if d.tx != nil {
+		return d.tx.Query(query, args...)
+	}
+	return d.db.Query(query, args...)
+}
+
+// queryRow runs query within the single transaction if it is started
+func (d *funcDriver) queryRow(query string, args ...interface{}) *sql.Row {
+	if d.tx != nil {
+		return d.tx.QueryRow(query, args...)
+	}
+	return d.db.QueryRow(query, args...)
+}
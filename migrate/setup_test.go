@@ -24,6 +24,9 @@ func setupDB() db.Client {
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
+	if os.Getenv(CleanConfirmEnv) == "" {
+		_ = os.Setenv(CleanConfirmEnv, ".*")
+	}
 	dbc, err := test.CreateDB("dao_test", os.Getenv("DSN"))
 	if err != nil {
 		log.Fatalf("Failed to create database, error: %v", err)
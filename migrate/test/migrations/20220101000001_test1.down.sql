@@ -1 +1 @@
-delete from "test1" where "field1" = "test" and "field2" =  123;
\ No newline at end of file
+delete from "test1" where "field1" = 'test' and "field2" = 123;
\ No newline at end of file
@@ -0,0 +1 @@
+alter table "test1" drop column "field3";
\ No newline at end of file
@@ -0,0 +1 @@
+alter table "test1" add column "field3" INT NOT NULL DEFAULT 0;
\ No newline at end of file
@@ -1,18 +1,110 @@
 package database
 
 import (
-	"go.uber.org/zap"
+	"log"
 	"time"
+
+	"github.com/alexandr-kononykhin-vay/postgres/metrics"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-type Option func(w *dbWrapper) *dbWrapper
+// Option configures client. Options are created by With* functions, Option is not a function of the client anymore,
+// as some options configure connection of Connect and ConnectWithDSN, e.g. WithPool. Such options are ignored by
+// clients of existing connections (NewDbClient, NewDbClientWithReplicas) with a warning
+type Option struct {
+	// name is the name of option configuring connection only, it is logged if the option is ignored
+	name string
+	// configure changes options of the primary before it is connected, it is applied by Connect and ConnectWithDSN
+	configure func(cfg *pg.Options)
+	apply     func(w *dbWrapper) *dbWrapper
+}
 
-func WithLogger(logger *zap.Logger, duration time.Duration) Option {
-	logger.Info("long db query logging enabled", zap.Duration("over", duration))
+// option returns Option applied to the created client
+func option(apply func(w *dbWrapper) *dbWrapper) Option {
+	return Option{apply: apply}
+}
 
-	return func(w *dbWrapper) *dbWrapper {
-		dbLogger := newDBLogger(logger, duration)
-		w.Db().AddQueryHook(dbLogger)
-		return w
+// configureOptions changes cfg by options before connection
+func configureOptions(cfg *pg.Options, options []Option) {
+	for _, o := range options {
+		if o.configure != nil {
+			o.configure(cfg)
+		}
+	}
+}
+
+// warnConnectOptions logs options configuring connection only, as they are ignored by client of existing connection
+func (w *dbWrapper) warnConnectOptions(options []Option) {
+	for _, o := range options {
+		if o.configure == nil || o.apply != nil {
+			continue
+		}
+		msg := o.name + " is applied by Connect and ConnectWithDSN only, it is ignored by client of existing connection"
+		if w.logger != nil {
+			w.logger.Warn(msg)
+		} else {
+			log.Println(msg)
+		}
+	}
+}
+
+// applyOptions applies options to the created client
+func applyOptions(w *dbWrapper, options []Option) *dbWrapper {
+	for _, o := range options {
+		if o.apply != nil {
+			w = o.apply(w)
+		}
+	}
+	if w.credentials != nil {
+		go w.credentials.run(w.logger)
 	}
+	return w
+}
+
+// WithLogger logs queries of the primary and replicas with structured fields: query, query_fingerprint
+// (see QueryFingerprint), duration_ms, rows_returned, rows_affected, error, tx and app_name. Queries are logged
+// at info level, or at warn level if they take longer than non-zero duration. Logger stored in context of the query
+// with ContextWithLogger is used instead of logger, so the logs carry request scoped fields. Zap and slog loggers
+// are adapted with ZapLogger and SlogLogger
+func WithLogger(logger Logger, duration time.Duration, opts ...LoggerOption) Option {
+	logger.Info("long db query logging enabled", "over", duration)
+
+	return option(func(w *dbWrapper) *dbWrapper {
+		w.logger = logger
+		for _, db := range w.dbs() {
+			dbLogger := newDBLogger(logger, duration, opts...)
+			dbLogger.appName = db.Options().ApplicationName
+			dbLogger.db = db
+			db.AddQueryHook(dbLogger)
+		}
+		return w
+	})
+}
+
+// WithMetrics exports query and connection pool metrics of the primary and replicas to registerer.
+// It panics if metrics cannot be registered, registerer of every client has to be wrapped with distinct labels
+// (prometheus.WrapRegistererWith) if there are several clients
+func WithMetrics(registerer prometheus.Registerer) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		collector, err := metrics.New(registerer)
+		if err != nil {
+			panic(err)
+		}
+		for _, db := range w.dbs() {
+			collector.AddDB(db)
+		}
+		return w
+	})
+}
+
+// WithQueryErrors wraps errors of failed queries with pkgerr.QueryError describing operation, table and query with
+// redacted literals, pkgerr.Convert keeps it in the converted error, so it can be retrieved with errors.As.
+// pg.ErrNoRows, pg.ErrMultiRows and errors go-pg ORM retries on, e.g. integrity violations of inserts checked by
+// Query.SelectOrInsert, are not wrapped
+func WithQueryErrors() Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		w.queryErrors = true
+		return w
+	})
 }
@@ -0,0 +1,188 @@
+// Package outbox implements transactional outbox: events are written into outbox table within the transaction
+// changing the data and are published by relay after the transaction commits, at least once. A single relay
+// publishes events in order of writing, relays of several instances don't keep the order (see RelayBatch)
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// CreateTableSQL creates outbox table
+const CreateTableSQL = `CREATE TABLE IF NOT EXISTS "outbox" (
+	"id"         BIGSERIAL PRIMARY KEY,
+	"topic"      VARCHAR(256) NOT NULL,
+	"key"        VARCHAR(256) NOT NULL DEFAULT '',
+	"payload"    JSONB,
+	"headers"    JSONB,
+	"attempts"   INT NOT NULL DEFAULT 0,
+	"last_error" TEXT NOT NULL DEFAULT '',
+	"created"    TIMESTAMP NOT NULL DEFAULT now(),
+	"dispatched" TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS "outbox_pending_idx" ON "outbox" ("id") WHERE "dispatched" IS NULL`
+
+// Event is a message to be published
+type Event struct {
+	tableName  struct{}          `pg:"outbox"`
+	ID         int64             `pg:"id"`
+	Topic      string            `pg:"topic,notnull"`
+	Key        string            `pg:"key,notnull,use_zero"`
+	Payload    json.RawMessage   `pg:"payload,type:jsonb"`
+	Headers    map[string]string `pg:"headers,type:jsonb"`
+	Attempts   int               `pg:"attempts,notnull,use_zero"`
+	LastError  string            `pg:"last_error,notnull,use_zero"`
+	Created    time.Time         `pg:"created,notnull,type:timestamp"`
+	Dispatched *time.Time        `pg:"dispatched,type:timestamp"`
+}
+
+// Publisher publishes events to a broker
+type Publisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// PublisherFunc is a function implementing Publisher
+type PublisherFunc func(ctx context.Context, event *Event) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+// RelayOpts configures Relay
+type RelayOpts struct {
+	// BatchSize is the max number of events published by one poll, 100 by default
+	BatchSize int
+	// PollInterval is the pause between polls of empty or failing outbox, 1 second by default
+	PollInterval time.Duration
+}
+
+// Outbox writes and relays events
+type Outbox struct {
+	db db.Client
+}
+
+// New creates Outbox
+func New(dbc db.Client) *Outbox {
+	return &Outbox{db: dbc}
+}
+
+// Write inserts events within transaction of ctx (e.g. started by DAO WithTX), so they are published
+// only if the transaction commits
+func (o *Outbox) Write(ctx context.Context, events ...*Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, e := range events {
+		if e.Created.IsZero() {
+			e.Created = now
+		}
+	}
+
+	_, err := o.db.WithContext(ctx).Model(&events).Insert()
+	return err
+}
+
+// WritePayload marshals payload into JSON and writes event of the topic
+func (o *Outbox) WritePayload(ctx context.Context, topic, key string, payload interface{}) (*Event, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{Topic: topic, Key: key, Payload: b}
+	return event, o.Write(ctx, event)
+}
+
+// Relay publishes pending events with pub until ctx is done, run it within db.Elect to keep order of events
+// when several instances relay them
+func (o *Outbox) Relay(ctx context.Context, pub Publisher, opts RelayOpts) error {
+	opts = opts.withDefaults()
+	for ctx.Err() == nil {
+		n, err := o.RelayBatch(ctx, pub, opts.BatchSize)
+		if err == nil && n == opts.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.PollInterval):
+		}
+	}
+	return ctx.Err()
+}
+
+// RelayBatch publishes up to batchSize pending events in order of writing and marks them dispatched, it returns
+// the number of published events. Events are locked with FOR UPDATE SKIP LOCKED, so relays of several instances
+// don't publish the same event, but they publish their batches concurrently, so the order is kept by a single relay
+// only. Publishing stops on the first failure to keep the order, the failure is recorded into the event and returned
+func (o *Outbox) RelayBatch(ctx context.Context, pub Publisher, batchSize int) (int, error) {
+	var published int
+	var pubErr error
+	err := o.db.RunInTx(ctx, func(ctx context.Context) error {
+		dbc := o.db.WithContext(ctx)
+
+		var events []*Event
+		err := dbc.Model(&events).
+			Where("dispatched IS NULL").
+			Order("id").
+			Limit(batchSize).
+			For("UPDATE SKIP LOCKED").
+			Select()
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int64, 0, len(events))
+		for _, e := range events {
+			if pubErr = pub.Publish(ctx, e); pubErr != nil {
+				_, err := dbc.Exec(`UPDATE "outbox" SET "attempts" = "attempts" + 1, "last_error" = ? WHERE "id" = ?`,
+					pubErr.Error(), e.ID)
+				if err != nil {
+					return err
+				}
+				break
+			}
+			ids = append(ids, e.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		res, err := dbc.Exec(`UPDATE "outbox" SET "dispatched" = now(), "attempts" = "attempts" + 1 WHERE "id" IN (?)`,
+			pg.In(ids))
+		if err != nil {
+			return err
+		}
+		published = res.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return published, pubErr
+}
+
+// Purge deletes events dispatched before t and returns the number of deleted events
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int, error) {
+	res, err := o.db.WithContext(ctx).Exec(`DELETE FROM "outbox" WHERE "dispatched" < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+func (o RelayOpts) withDefaults() RelayOpts {
+	if o.BatchSize < 1 {
+		o.BatchSize = 100
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	return o
+}
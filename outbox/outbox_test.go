@@ -0,0 +1,108 @@
+//go:build !ci
+// +build !ci
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+)
+
+func TestOutbox_Write(t *testing.T) {
+	test.CleanDB(testDb, t)
+	o := New(testDb)
+	repo := dao.New(testDb)
+
+	err := repo.WithTX(context.Background(), func(ctx context.Context) error {
+		if _, err := o.WritePayload(ctx, "agent.created", "1", map[string]int{"id": 1}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.Error(t, err)
+
+	err = repo.WithTX(context.Background(), func(ctx context.Context) error {
+		return o.Write(ctx, &Event{Topic: "agent.created", Key: "2", Headers: map[string]string{"trace": "abc"}})
+	})
+	assert.NoError(t, err)
+
+	var events []*Event
+	assert.NoError(t, testDb.Model(&events).Select())
+	assert.Len(t, events, 1)
+	assert.Equal(t, "2", events[0].Key)
+	assert.Equal(t, "abc", events[0].Headers["trace"])
+}
+
+func TestOutbox_RelayBatch(t *testing.T) {
+	test.CleanDB(testDb, t)
+	o := New(testDb)
+	ctx := context.Background()
+
+	for _, key := range []string{"1", "2", "3"} {
+		_, err := o.WritePayload(ctx, "agent.updated", key, nil)
+		assert.NoError(t, err)
+	}
+
+	var keys []string
+	failing := PublisherFunc(func(ctx context.Context, event *Event) error {
+		if event.Key == "2" {
+			return errors.New("broker is unavailable")
+		}
+		keys = append(keys, event.Key)
+		return nil
+	})
+	n, err := o.RelayBatch(ctx, failing, 10)
+	assert.EqualError(t, err, "broker is unavailable")
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"1"}, keys)
+
+	failed := &Event{}
+	assert.NoError(t, testDb.Model(failed).Where("key = '2'").Select())
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "broker is unavailable", failed.LastError)
+	assert.Nil(t, failed.Dispatched)
+
+	keys = nil
+	ok := PublisherFunc(func(ctx context.Context, event *Event) error {
+		keys = append(keys, event.Key)
+		return nil
+	})
+	n, err = o.RelayBatch(ctx, ok, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"2", "3"}, keys, "events are published in order")
+
+	n, err = o.Purge(ctx, time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestOutbox_Relay(t *testing.T) {
+	test.CleanDB(testDb, t)
+	o := New(testDb)
+
+	for i := 0; i < 5; i++ {
+		_, err := o.WritePayload(context.Background(), "agent.deleted", "", i)
+		assert.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var published int
+	err := o.Relay(ctx, PublisherFunc(func(ctx context.Context, event *Event) error {
+		if published++; published == 5 {
+			cancel()
+		}
+		return nil
+	}), RelayOpts{BatchSize: 2, PollInterval: 10 * time.Millisecond})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 5, published)
+}
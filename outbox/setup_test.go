@@ -0,0 +1,46 @@
+//go:build !ci
+// +build !ci
+
+package outbox
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/joho/godotenv"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+)
+
+var (
+	testDb db.Client
+)
+
+func TestMain(m *testing.M) {
+	testDb = setupDB()
+	seedDB(testDb)
+
+	os.Exit(m.Run())
+}
+
+func setupDB() db.Client {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	dbc, err := test.CreateDB("outbox_test", os.Getenv("DSN"))
+	if err != nil {
+		log.Fatalf("Failed to create database, error: %v", err)
+	}
+
+	return dbc
+}
+
+func seedDB(dbc db.Client) {
+	_, err := dbc.Exec(CreateTableSQL)
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package partition
+
+import (
+	"fmt"
+	"time"
+)
+
+// Interval is the time range covered by a partition
+type Interval int
+
+// Intervals of partitions
+const (
+	Daily Interval = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// start returns the beginning of the interval t belongs to, weeks start on Monday
+func (i Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case Weekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next returns the beginning of the interval following the one starting at start
+func (i Interval) next(start time.Time) time.Time {
+	switch i {
+	case Daily:
+		return start.AddDate(0, 0, 1)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// suffix returns suffix of name of the partition of the interval starting at start, e.g. 202401 for January 2024
+func (i Interval) suffix(start time.Time) string {
+	switch i {
+	case Daily, Weekly:
+		return start.Format("20060102")
+	case Monthly:
+		return start.Format("200601")
+	default:
+		return start.Format("2006")
+	}
+}
+
+func (i Interval) String() string {
+	switch i {
+	case Daily:
+		return "daily"
+	case Weekly:
+		return "weekly"
+	case Monthly:
+		return "monthly"
+	case Yearly:
+		return "yearly"
+	}
+	return fmt.Sprintf("Interval(%d)", int(i))
+}
@@ -0,0 +1,244 @@
+// Package partition manages time-range partitions of tables partitioned with `PARTITION BY RANGE (column)`:
+// partitions are created ahead of time, attached, detached and dropped when they expire. Tables are referenced
+// by models with partition_by tag, e.g. `pg:"events,partition_by:RANGE(created)"`, or by names
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// boundFormat formats partition bounds, they are in UTC as the client sets timezone to UTC on connect
+const boundFormat = "2006-01-02 15:04:05"
+
+var (
+	fromRegexp   = regexp.MustCompile(`(?i)\bFROM \('([^']*)'\)`)
+	toRegexp     = regexp.MustCompile(`(?i)\bTO \('([^']*)'\)`)
+	boundLayouts = []string{"2006-01-02 15:04:05.999999999Z07", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+)
+
+// ErrNotPartitioned is returned for model which table is not partitioned by range
+var ErrNotPartitioned = errors.New("partition: table is not partitioned by range")
+
+// Partition is a partition of the table with its range, From is inclusive and To is exclusive
+type Partition struct {
+	Name string
+	From time.Time
+	To   time.Time
+	// Default is set for the default partition, it has no range
+	Default bool
+}
+
+// Manager manages partitions of tables
+type Manager struct {
+	db  db.Client
+	now func() time.Time
+}
+
+// New creates Manager of partitions of dbc
+func New(dbc db.Client) *Manager {
+	return &Manager{db: dbc, now: time.Now}
+}
+
+// EnsurePartitions creates missing partitions of table for the current interval and ahead following ones,
+// e.g. EnsurePartitions(ctx, (*Event)(nil), Monthly, 3) creates partitions of this month and three next months.
+// Partitions are named after the table and the beginning of the interval, e.g. events_202401 or events_20240101
+// for daily and weekly ones, weeks start on Monday. Table is a model or a name of the table optionally qualified
+// with schema. It returns names of the created partitions
+func (m *Manager) EnsurePartitions(ctx context.Context, table interface{}, interval Interval, ahead int) ([]string, error) {
+	schema, name, err := tableName(table)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := m.Partitions(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		exists[p.Name] = true
+	}
+
+	var created []string
+	from := interval.start(m.now())
+	for i := 0; i <= ahead; i++ {
+		to := interval.next(from)
+		partition := name + "_" + interval.suffix(from)
+		if !exists[partition] {
+			_, err := m.db.WithContext(ctx).Exec("CREATE TABLE IF NOT EXISTS ? PARTITION OF ? FOR VALUES FROM (?) TO (?)",
+				ident(schema, partition), ident(schema, name), from.Format(boundFormat), to.Format(boundFormat))
+			if err != nil {
+				return created, err
+			}
+			created = append(created, partition)
+		}
+		from = to
+	}
+	return created, nil
+}
+
+// Attach attaches existing table partition to table as partition of values in [from, to) range
+func (m *Manager) Attach(ctx context.Context, table interface{}, partition string, from, to time.Time) error {
+	schema, name, err := tableName(table)
+	if err != nil {
+		return err
+	}
+	_, err = m.db.WithContext(ctx).Exec("ALTER TABLE ? ATTACH PARTITION ? FOR VALUES FROM (?) TO (?)",
+		ident(schema, name), ident(schema, partition), from.UTC().Format(boundFormat), to.UTC().Format(boundFormat))
+	return err
+}
+
+// Detach detaches partition from table keeping it as a standalone table, e.g. to archive it. Concurrent detach
+// doesn't block queries of the table, it can't run within transaction and requires PostgreSQL 14
+func (m *Manager) Detach(ctx context.Context, table interface{}, partition string, concurrently bool) error {
+	schema, name, err := tableName(table)
+	if err != nil {
+		return err
+	}
+	query := "ALTER TABLE ? DETACH PARTITION ?"
+	if concurrently {
+		query += " CONCURRENTLY"
+	}
+	_, err = m.db.WithContext(ctx).Exec(query, ident(schema, name), ident(schema, partition))
+	return err
+}
+
+// DropExpired drops partitions of table with values before t only, e.g. time.Now().AddDate(0, -6, 0) to keep
+// half a year of data. It returns names of the dropped partitions
+func (m *Manager) DropExpired(ctx context.Context, table interface{}, before time.Time) ([]string, error) {
+	schema, _, err := tableName(table)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := m.Partitions(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []string
+	for _, p := range partitions {
+		if p.Default || p.To.IsZero() || p.To.After(before) {
+			continue
+		}
+		if _, err := m.db.WithContext(ctx).Exec("DROP TABLE ?", ident(schema, p.Name)); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, p.Name)
+	}
+	return dropped, nil
+}
+
+// Partitions returns partitions of table ordered by range, the default partition goes first. Partitions
+// with unbounded (MINVALUE or MAXVALUE) ranges have zero From or To
+func (m *Manager) Partitions(ctx context.Context, table interface{}) ([]Partition, error) {
+	schema, name, err := tableName(table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	_, err = m.db.WithContext(ctx).Query(&rows, `SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass(?)`, string(types.AppendIdent(nil, string(ident(schema, name)), 1)))
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]Partition, 0, len(rows))
+	for _, row := range rows {
+		partitions = append(partitions, parseBound(row.Name, row.Bound))
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Default != partitions[j].Default {
+			return partitions[i].Default
+		}
+		return partitions[i].From.Before(partitions[j].From)
+	})
+	return partitions, nil
+}
+
+// parseBound returns partition of range bound expression, e.g. `FOR VALUES FROM ('2024-01-01') TO ('2024-02-01')`
+func parseBound(name, bound string) Partition {
+	p := Partition{Name: name}
+	if strings.EqualFold(bound, "DEFAULT") {
+		p.Default = true
+		return p
+	}
+	// MINVALUE and MAXVALUE bounds are not quoted, so they are not matched
+	if m := fromRegexp.FindStringSubmatch(bound); m != nil {
+		p.From = parseTime(m[1])
+	}
+	if m := toRegexp.FindStringSubmatch(bound); m != nil {
+		p.To = parseTime(m[1])
+	}
+	return p
+}
+
+// parseTime parses bound of timestamp, timestamptz or date column, zero time is returned for other values
+func parseTime(s string) time.Time {
+	for _, layout := range boundLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// tableName returns schema and name of table of model or of name qualified with schema
+func tableName(table interface{}) (string, string, error) {
+	var name string
+	switch table := table.(type) {
+	case string:
+		name = table
+	default:
+		typ := reflect.TypeOf(table)
+		for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+			typ = typ.Elem()
+		}
+		if typ == nil || typ.Kind() != reflect.Struct {
+			return "", "", fmt.Errorf("partition: table must be a name or model, got %T", table)
+		}
+		t := orm.GetTable(typ)
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(t.PartitionBy)), "RANGE") {
+			return "", "", fmt.Errorf("%w: %s", ErrNotPartitioned, t.SQLName)
+		}
+		name = unquote(string(t.SQLName))
+	}
+
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:], nil
+	}
+	return "", name, nil
+}
+
+// unquote returns table name escaped by go-pg as it is written in model tag, e.g. billing.events for
+// "billing"."events"
+func unquote(sqlName string) string {
+	parts := strings.Split(sqlName, `"."`)
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(strings.Trim(part, `"`), `""`, `"`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// ident returns identifier of name qualified with schema if it is not empty
+func ident(schema, name string) pg.Ident {
+	if schema == "" {
+		return pg.Ident(name)
+	}
+	return pg.Ident(schema + "." + name)
+}
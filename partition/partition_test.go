@@ -0,0 +1,86 @@
+package partition
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type event struct {
+	tableName struct{} `pg:"billing.events,partition_by:RANGE(created)"`
+	ID        int64
+	Created   time.Time
+}
+
+type plain struct {
+	ID int64
+}
+
+func TestInterval(t *testing.T) {
+	now := time.Date(2024, 2, 29, 15, 4, 5, 0, time.FixedZone("", 3*3600))
+	tests := []struct {
+		interval Interval
+		start    time.Time
+		next     time.Time
+		suffix   string
+	}{
+		{Daily, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "20240229"},
+		{Weekly, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), "20240226"},
+		{Monthly, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "202402"},
+		{Yearly, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "2024"},
+	}
+	for _, tt := range tests {
+		start := tt.interval.start(now)
+		assert.Equal(t, tt.start, start, tt.interval.String())
+		assert.Equal(t, tt.next, tt.interval.next(start), tt.interval.String())
+		assert.Equal(t, tt.suffix, tt.interval.suffix(start), tt.interval.String())
+	}
+
+	// Sunday belongs to the week started on Monday
+	assert.Equal(t, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), Weekly.start(time.Date(2024, 3, 3, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestParseBound(t *testing.T) {
+	p := parseBound("events_202401", "FOR VALUES FROM ('2024-01-01 00:00:00') TO ('2024-02-01 00:00:00')")
+	assert.Equal(t, Partition{Name: "events_202401", From: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		To: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}, p)
+
+	p = parseBound("events_2024", "FOR VALUES FROM ('2024-01-01 03:00:00+03') TO ('2025-01-01')")
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), p.From)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), p.To)
+
+	p = parseBound("events_old", "FOR VALUES FROM (MINVALUE) TO ('2024-01-01')")
+	assert.True(t, p.From.IsZero())
+	assert.False(t, p.To.IsZero())
+
+	assert.True(t, parseBound("events_default", "DEFAULT").Default)
+}
+
+func TestTableName(t *testing.T) {
+	schema, name, err := tableName((*event)(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "billing", schema)
+	assert.Equal(t, "events", name)
+
+	schema, name, err = tableName("events")
+	require.NoError(t, err)
+	assert.Equal(t, "", schema)
+	assert.Equal(t, "events", name)
+
+	_, _, err = tableName(&plain{})
+	assert.True(t, errors.Is(err, ErrNotPartitioned))
+
+	_, _, err = tableName(42)
+	assert.Error(t, err)
+}
+
+func TestIdent(t *testing.T) {
+	fmter := orm.NewFormatter()
+	assert.Equal(t, `ALTER TABLE "billing"."events" DETACH PARTITION "billing"."events_202401"`,
+		string(fmter.FormatQuery(nil, "ALTER TABLE ? DETACH PARTITION ?", ident("billing", "events"),
+			ident("billing", "events_202401"))))
+}
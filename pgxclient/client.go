@@ -0,0 +1,552 @@
+// Package pgxclient implements database Client on top of pgx connection pool, so repositories built on the DAO can be
+// moved from go-pg driver to pgx without rewriting. Queries are built and formatted by go-pg ORM and sent by pgx
+// with simple protocol, rows are scanned into go-pg models from text format, so models and opt work as is.
+// go-pg handles (Db, Tx), query hooks and options of the database package are not supported, pgx tracers of the pool
+// config are used instead. Helpers requiring go-pg handle don't support the client: migrate.WithClient fails
+// to connect (use migrate.WithConnector with stdlib.GetPoolConnector of the pool) and databasetest.WithRollback
+// fails the test
+package pgxclient
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// TxFromContext returns pgx transaction stored in context by RunInTx, nil if there is no transaction
+func TxFromContext(ctx context.Context) pgx.Tx {
+	tx, _ := ctx.Value(&db.TxKey).(pgx.Tx)
+	return tx
+}
+
+// querier runs queries on the pool or within transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+type client struct {
+	ctx   context.Context
+	pool  *pgxpool.Pool
+	tx    pgx.Tx
+	fmter *orm.Formatter
+	sql   *sqlDB
+	drain *db.Drain
+}
+
+var _ db.Client = (*client)(nil)
+var _ orm.DB = (*client)(nil)
+
+// sqlDB is database/sql handle of the pool created by SQLDB on first use
+type sqlDB struct {
+	once sync.Once
+	db   *sql.DB
+}
+
+// New creates client of pool, the pool is closed by Close of the client. Db of the client returns nil,
+// so helpers requiring go-pg handle (migrate.WithClient, databasetest.WithRollback) don't support it
+func New(pool *pgxpool.Pool) db.Client {
+	return &client{pool: pool, fmter: orm.NewFormatter(), sql: &sqlDB{}, drain: db.NewDrain()}
+}
+
+// Connect creates pool of dsn (see pgxpool.ParseConfig) and checks connection, the client is the one of New
+func Connect(ctx context.Context, dsn string) (db.Client, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return New(pool), nil
+}
+
+// Db returns nil, as there is no go-pg connection
+func (c *client) Db() *pg.DB {
+	return nil
+}
+
+// Tx returns nil, as transaction isn't go-pg one, see TxFromContext
+func (c *client) Tx() *pg.Tx {
+	return nil
+}
+
+// RunInTx executes fn within transaction, the transaction is stored in context passed to fn only, so clients bound
+// to the context with WithContext run queries within it. The transaction is rolled back if fn returns an error,
+// panics or ctx is done, otherwise it is committed and callbacks of db.AfterCommit are called. If ctx already contains
+// transaction, fn joins it
+func (c *client) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if db.InTx(ctx) {
+		return fn(ctx)
+	}
+	if !c.drain.Acquire(false) {
+		return db.ErrShutdown
+	}
+	defer c.drain.Release()
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return convertError(err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.Background())
+			panic(p)
+		}
+	}()
+
+	txCtx, committed := db.ContextWithAfterCommit(context.WithValue(ctx, &db.TxKey, tx))
+	if err := fn(txCtx); err != nil || ctx.Err() != nil {
+		// rollback isn't sent within done ctx
+		if rollbackErr := tx.Rollback(context.Background()); rollbackErr != nil {
+			db.LogRollbackError(ctx, nil, rollbackErr)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return convertError(err)
+	}
+	committed()
+	return nil
+}
+
+// Context returns context the client is bound to with WithContext
+func (c *client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// WithContext returns a shallow copy of the client bound to ctx, so the client is safe for concurrent use.
+// The copy runs queries within transaction of ctx started by RunInTx, if any
+func (c *client) WithContext(ctx context.Context) db.Client {
+	cp := *c
+	cp.ctx = ctx
+	cp.tx = TxFromContext(ctx)
+	return &cp
+}
+
+// Close closes database/sql handle of SQLDB and the pool, it waits for acquired connections to be released
+func (c *client) Close() error {
+	var err error
+	c.sql.once.Do(func() {})
+	if c.sql.db != nil {
+		err = c.sql.db.Close()
+	}
+	c.pool.Close()
+	return err
+}
+
+// Shutdown rejects new queries and transactions with db.ErrShutdown, waits for in-flight queries and transactions
+// until ctx is done and closes the client. ctx error is returned if they are not done, the pool is closed after
+// they are anyway
+func (c *client) Shutdown(ctx context.Context) error {
+	c.drain.Close()
+	if err := c.drain.Wait(ctx); err != nil {
+		go c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+// addr returns address of the pool
+func (c *client) addr() string {
+	cfg := c.pool.Config().ConnConfig
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port)))
+}
+
+// HealthReport pings the pool synchronously
+func (c *client) HealthReport() db.HealthReport {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	node := db.NodeHealth{Addr: c.addr(), CheckedAt: time.Now()}
+	node.LastError = c.pool.Ping(ctx)
+	node.Healthy = node.LastError == nil
+	if !node.Healthy {
+		node.Failures = 1
+	}
+	return db.HealthReport{Primary: node}
+}
+
+// HealthCheck pings the pool and checks replication and migrations of opts, there are no replicas
+func (c *client) HealthCheck(ctx context.Context, opts db.HealthOpts) db.HealthCheckReport {
+	if opts.Timeout <= 0 {
+		opts.Timeout = healthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var report db.HealthCheckReport
+	start := time.Now()
+	report.Primary = db.NodeCheck{Addr: c.addr(), Error: c.pool.Ping(ctx), Latency: time.Since(start),
+		Pool: c.poolStats()}
+	report.Primary.Healthy = report.Primary.Error == nil
+	report.Healthy = report.Primary.Healthy
+
+	if opts.CheckReplication {
+		report.Replication, report.ReplicationError = db.QueryReplicationState(ctx, c)
+	}
+	if opts.CheckMigrationsVersion > 0 {
+		report.Migrations = db.QueryMigrationsState(ctx, c, opts)
+		report.Healthy = report.Healthy && report.Migrations.Error == nil
+	}
+	return report
+}
+
+// poolStats returns stats of the pool in terms of go-pg pool
+func (c *client) poolStats() pg.PoolStats {
+	stat := c.pool.Stat()
+	return pg.PoolStats{
+		Hits:       uint32(stat.AcquireCount() - stat.EmptyAcquireCount()),
+		Misses:     uint32(stat.EmptyAcquireCount()),
+		Timeouts:   uint32(stat.CanceledAcquireCount()),
+		TotalConns: uint32(stat.TotalConns()),
+		IdleConns:  uint32(stat.IdleConns()),
+	}
+}
+
+// Stats returns stats of the pool, top queries of pg_stat_statements are not supported
+func (c *client) Stats(context.Context) (db.Stats, error) {
+	return db.Stats{Pools: []db.NodeStats{{Addr: c.addr(), PoolStats: c.poolStats()}}}, nil
+}
+
+// ActiveQueries returns backends with application name of the client from pg_stat_activity
+func (c *client) ActiveQueries(ctx context.Context) ([]db.ActiveQuery, error) {
+	return db.QueryActiveQueries(ctx, c, c.addr())
+}
+
+// SQLDB returns database/sql handle sharing the pool, it is closed by Close of the client
+func (c *client) SQLDB() (*sql.DB, error) {
+	c.sql.once.Do(func() {
+		c.sql.db = stdlib.OpenDBFromPool(c.pool)
+	})
+	if c.sql.db == nil {
+		return nil, db.ErrShutdown
+	}
+	return c.sql.db, nil
+}
+
+// Model ...
+func (c *client) Model(model ...interface{}) *orm.Query {
+	q := orm.NewQuery(c, model...)
+	if c.ctx != nil {
+		q = q.Context(c.ctx)
+	}
+	return q
+}
+
+// ModelContext ...
+func (c *client) ModelContext(ctx context.Context, model ...interface{}) *orm.Query {
+	return orm.NewQuery(c, model...).Context(ctx)
+}
+
+// Select ...
+func (c *client) Select(model interface{}) error {
+	return c.Model(model).WherePK().Select()
+}
+
+// Insert ...
+func (c *client) Insert(model ...interface{}) error {
+	_, err := c.Model(model...).Insert()
+	return err
+}
+
+// Update ...
+func (c *client) Update(model interface{}) error {
+	_, err := c.Model(model).WherePK().Update()
+	return err
+}
+
+// Delete ...
+func (c *client) Delete(model interface{}) error {
+	_, err := c.Model(model).WherePK().Delete()
+	return err
+}
+
+// ForceDelete ...
+func (c *client) ForceDelete(model interface{}) error {
+	_, err := c.Model(model).WherePK().ForceDelete()
+	return err
+}
+
+// Exec ...
+func (c *client) Exec(query interface{}, params ...interface{}) (orm.Result, error) {
+	return c.ExecContext(c.Context(), query, params...)
+}
+
+// ExecOne ...
+func (c *client) ExecOne(query interface{}, params ...interface{}) (orm.Result, error) {
+	return c.ExecOneContext(c.Context(), query, params...)
+}
+
+// Query ...
+func (c *client) Query(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return c.QueryContext(c.Context(), model, query, params...)
+}
+
+// QueryOne ...
+func (c *client) QueryOne(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	return c.QueryOneContext(c.Context(), model, query, params...)
+}
+
+// querier returns transaction the client is bound to or the pool
+func (c *client) querier() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.pool
+}
+
+// ExecContext ...
+func (c *client) ExecContext(ctx context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	q, err := c.format(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	if !c.drain.Acquire(c.tx != nil) {
+		return nil, db.ErrShutdown
+	}
+	defer c.drain.Release()
+	tag, err := c.querier().Exec(ctx, q, pgx.QueryExecModeSimpleProtocol)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &result{affected: int(tag.RowsAffected())}, nil
+}
+
+// ExecOneContext ...
+func (c *client) ExecOneContext(ctx context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	res, err := c.ExecContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	return assertOneRow(res)
+}
+
+// QueryContext ...
+func (c *client) QueryContext(ctx context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	q, err := c.format(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	if !c.drain.Acquire(c.tx != nil) {
+		return nil, db.ErrShutdown
+	}
+	defer c.drain.Release()
+	rows, err := c.querier().Query(ctx, q, pgx.QueryExecModeSimpleProtocol)
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return scan(ctx, rows, model)
+}
+
+// QueryOneContext ...
+func (c *client) QueryOneContext(ctx context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	res, err := c.QueryContext(ctx, model, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	return assertOneRow(res)
+}
+
+// CopyFrom copies data from r to table by `COPY ... FROM STDIN` query
+func (c *client) CopyFrom(r io.Reader, query interface{}, params ...interface{}) (orm.Result, error) {
+	q, err := c.format(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	var tag pgconn.CommandTag
+	err = c.withConn(func(conn *pgconn.PgConn) (err error) {
+		tag, err = conn.CopyFrom(c.Context(), r, q)
+		return err
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &result{affected: int(tag.RowsAffected())}, nil
+}
+
+// CopyTo copies data to w by `COPY ... TO STDOUT` query
+func (c *client) CopyTo(w io.Writer, query interface{}, params ...interface{}) (orm.Result, error) {
+	q, err := c.format(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	var tag pgconn.CommandTag
+	err = c.withConn(func(conn *pgconn.PgConn) (err error) {
+		tag, err = conn.CopyTo(c.Context(), w, q)
+		return err
+	})
+	if err != nil {
+		return nil, convertError(err)
+	}
+	return &result{affected: int(tag.RowsAffected())}, nil
+}
+
+// withConn calls fn with connection of transaction the client is bound to or with connection acquired from the pool
+func (c *client) withConn(fn func(conn *pgconn.PgConn) error) error {
+	if !c.drain.Acquire(c.tx != nil) {
+		return db.ErrShutdown
+	}
+	defer c.drain.Release()
+	if c.tx != nil {
+		return fn(c.tx.Conn().PgConn())
+	}
+	conn, err := c.pool.Acquire(c.Context())
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return fn(conn.Conn().PgConn())
+}
+
+// FormatQuery ...
+func (c *client) FormatQuery(b []byte, query string, params ...interface{}) []byte {
+	return c.fmter.FormatQuery(b, query, params...)
+}
+
+// Formatter ...
+func (c *client) Formatter() orm.QueryFormatter {
+	return c.fmter
+}
+
+// format returns SQL of the query with params, as go-pg formats it
+func (c *client) format(query interface{}, params ...interface{}) (string, error) {
+	switch query := query.(type) {
+	case orm.QueryAppender:
+		b, err := query.AppendQuery(c.fmter.WithModel(query), nil)
+		return string(b), err
+	case string:
+		if len(params) > 0 {
+			if model, ok := params[len(params)-1].(orm.TableModel); ok {
+				return string(c.fmter.WithTableModel(model).FormatQuery(nil, query, params[:len(params)-1]...)), nil
+			}
+		}
+		return string(c.fmter.FormatQuery(nil, query, params...)), nil
+	}
+	return "", fmt.Errorf("pgxclient: can't append %T", query)
+}
+
+type result struct {
+	model    orm.Model
+	affected int
+	returned int
+}
+
+func (r *result) Model() orm.Model {
+	return r.model
+}
+
+func (r *result) RowsAffected() int {
+	return r.affected
+}
+
+func (r *result) RowsReturned() int {
+	return r.returned
+}
+
+// assertOneRow returns res if the query affected exactly one row
+func assertOneRow(res orm.Result) (orm.Result, error) {
+	switch n := res.RowsAffected(); {
+	case n == 0:
+		return nil, pg.ErrNoRows
+	case n > 1:
+		return nil, pg.ErrMultiRows
+	}
+	return res, nil
+}
+
+// scan scans rows into model as go-pg does, rows are in text format as the query is sent with simple protocol
+func scan(ctx context.Context, rows pgx.Rows, model interface{}) (*result, error) {
+	defer rows.Close()
+
+	res := &result{}
+	var firstErr error
+	if model != nil {
+		m, err := orm.NewModel(model)
+		if err == nil {
+			err = m.Init()
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.model = m
+	}
+
+	var columns []types.ColumnInfo
+	for rows.Next() {
+		res.returned++
+		if res.model == nil {
+			continue
+		}
+		if columns == nil {
+			for i, f := range rows.FieldDescriptions() {
+				columns = append(columns, types.ColumnInfo{Index: int16(i), DataType: int32(f.DataTypeOID), Name: f.Name})
+			}
+		}
+		if err := scanRow(ctx, res.model, columns, rows.RawValues()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, convertError(err)
+	}
+
+	res.affected = int(rows.CommandTag().RowsAffected())
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return res, nil
+}
+
+// scanRow passes values of the row to the next column scanner of model
+func scanRow(ctx context.Context, model orm.Model, columns []types.ColumnInfo, values [][]byte) error {
+	scanner := model.NextColumnScanner()
+	if h, ok := scanner.(orm.BeforeScanHook); ok {
+		if err := h.BeforeScan(ctx); err != nil {
+			return err
+		}
+	}
+
+	for i, value := range values {
+		n := len(value)
+		if value == nil {
+			n = -1
+		}
+		if err := scanner.ScanColumn(columns[i], &bytesReader{b: value}, n); err != nil {
+			return err
+		}
+	}
+
+	if h, ok := scanner.(orm.AfterScanHook); ok {
+		if err := h.AfterScan(ctx); err != nil {
+			return err
+		}
+	}
+	return model.AddColumnScanner(scanner)
+}
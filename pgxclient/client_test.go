@@ -0,0 +1,106 @@
+package pgxclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	dberrors "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testModel struct {
+	ID      int
+	Name    string
+	Deleted *time.Time
+}
+
+func TestConvertError(t *testing.T) {
+	err := convertError(&pgconn.PgError{Severity: "ERROR", Code: "23505", Message: "duplicate key",
+		ConstraintName: "users_email_key"})
+
+	assert.True(t, dberrors.IsConflict(dberrors.Convert(context.Background(), err)))
+	constraint, ok := dberrors.AsConstraint(dberrors.Convert(context.Background(), err))
+	require.True(t, ok)
+	assert.Equal(t, "users_email_key", constraint.Constraint)
+}
+
+func TestScanRow(t *testing.T) {
+	var models []testModel
+	m, err := orm.NewModel(&models)
+	require.NoError(t, err)
+	require.NoError(t, m.Init())
+
+	columns := []types.ColumnInfo{{Index: 0, Name: "id"}, {Index: 1, Name: "name"}, {Index: 2, Name: "deleted"}}
+	require.NoError(t, scanRow(context.Background(), m, columns, [][]byte{[]byte("1"), []byte("first"), nil}))
+	require.NoError(t, scanRow(context.Background(), m, columns,
+		[][]byte{[]byte("2"), []byte("second"), []byte("2024-01-02 03:04:05+00")}))
+
+	require.Len(t, models, 2)
+	assert.Equal(t, testModel{ID: 1, Name: "first"}, models[0])
+	assert.Equal(t, 2, models[1].ID)
+	require.NotNil(t, models[1].Deleted)
+	assert.True(t, models[1].Deleted.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+func TestClient_Format(t *testing.T) {
+	c := &client{fmter: orm.NewFormatter()}
+
+	q, err := c.format("SELECT ?", "it's")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 'it''s'", q)
+
+	q, err = c.format(c.Model((*testModel)(nil)).Where("id = ?", 1))
+	require.NoError(t, err)
+	assert.Contains(t, q, `FROM "test_models" AS "test_model" WHERE (id = 1)`)
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := Connect(ctx, "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	assert.Error(t, err)
+
+	pool, err := pgxpool.New(ctx, "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	require.NoError(t, err)
+	c := New(pool)
+	defer c.Close()
+
+	err = c.RunInTx(ctx, func(ctx context.Context) error {
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Nil(t, c.Db())
+	assert.False(t, c.HealthReport().Primary.Healthy)
+
+	sqlDB, err := c.SQLDB()
+	require.NoError(t, err)
+	assert.Error(t, sqlDB.PingContext(ctx))
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	require.NoError(t, err)
+	c := New(pool)
+
+	// in-flight query
+	require.True(t, c.(*client).drain.Acquire(false))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Shutdown(ctx), context.DeadlineExceeded)
+	c.(*client).drain.Release()
+
+	_, err = c.Exec("SELECT 1")
+	assert.ErrorIs(t, err, db.ErrShutdown)
+	err = c.RunInTx(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, db.ErrShutdown)
+}
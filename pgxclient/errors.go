@@ -0,0 +1,88 @@
+package pgxclient
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgError adapts pgx error of Postgres to pg.Error, so it is converted by errors package as go-pg one
+type pgError struct {
+	err *pgconn.PgError
+}
+
+var _ pg.Error = pgError{}
+
+// convertError returns pg.Error for Postgres error, other errors are returned as is
+func convertError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgError{err: pgErr}
+	}
+	return err
+}
+
+func (e pgError) Error() string {
+	return fmt.Sprintf("%s #%s %s", e.err.Severity, e.err.Code, e.err.Message)
+}
+
+func (e pgError) Unwrap() error {
+	return e.err
+}
+
+// Field returns field of error message, see https://www.postgresql.org/docs/current/protocol-error-fields.html
+func (e pgError) Field(field byte) string {
+	switch field {
+	case 'S', 'V':
+		return e.err.Severity
+	case 'C':
+		return e.err.Code
+	case 'M':
+		return e.err.Message
+	case 'D':
+		return e.err.Detail
+	case 'H':
+		return e.err.Hint
+	case 'P':
+		return positionField(e.err.Position)
+	case 'p':
+		return positionField(e.err.InternalPosition)
+	case 'q':
+		return e.err.InternalQuery
+	case 'W':
+		return e.err.Where
+	case 's':
+		return e.err.SchemaName
+	case 't':
+		return e.err.TableName
+	case 'c':
+		return e.err.ColumnName
+	case 'd':
+		return e.err.DataTypeName
+	case 'n':
+		return e.err.ConstraintName
+	case 'F':
+		return e.err.File
+	case 'L':
+		return positionField(e.err.Line)
+	case 'R':
+		return e.err.Routine
+	}
+	return ""
+}
+
+// IntegrityViolation reports whether the error is of Integrity Constraint Violation class
+func (e pgError) IntegrityViolation() bool {
+	return strings.HasPrefix(e.err.Code, "23")
+}
+
+func positionField(n int32) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(n))
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// DSN parameters of connection pool parsed by ConnectWithDSN, durations are in time.ParseDuration format
+const (
+	PoolMaxConnsParam    = "pool_max_conns"
+	PoolMinIdleParam     = "pool_min_idle"
+	PoolMaxConnAgeParam  = "pool_max_conn_age"
+	PoolIdleTimeoutParam = "pool_idle_timeout"
+	PoolTimeoutParam     = "pool_timeout"
+)
+
+var poolParams = []string{PoolMaxConnsParam, PoolMinIdleParam, PoolMaxConnAgeParam, PoolIdleTimeoutParam, PoolTimeoutParam}
+
+// PoolConfig is configuration of connection pool, zero values keep defaults of pg.Options
+type PoolConfig struct {
+	// MaxConns is the max number of connections, pg.Options.PoolSize
+	MaxConns int
+	// MinIdle is the min number of idle connections kept open, pg.Options.MinIdleConns
+	MinIdle int
+	// MaxConnAge is the age of connection it is closed at, pg.Options.MaxConnAge
+	MaxConnAge time.Duration
+	// IdleTimeout is the time idle connection is closed after, pg.Options.IdleTimeout
+	IdleTimeout time.Duration
+	// PoolTimeout is the time query waits for free connection, pg.Options.PoolTimeout
+	PoolTimeout time.Duration
+}
+
+// WithPool configures connection pool of the primary, it is applied by Connect and ConnectWithDSN and overrides
+// pool parameters of DSN
+func WithPool(pool PoolConfig) Option {
+	return Option{name: "WithPool", configure: pool.apply}
+}
+
+// apply sets non-zero values of the pool configuration to cfg
+func (p PoolConfig) apply(cfg *pg.Options) {
+	if p.MaxConns > 0 {
+		cfg.PoolSize = p.MaxConns
+	}
+	if p.MinIdle > 0 {
+		cfg.MinIdleConns = p.MinIdle
+	}
+	if p.MaxConnAge > 0 {
+		cfg.MaxConnAge = p.MaxConnAge
+	}
+	if p.IdleTimeout > 0 {
+		cfg.IdleTimeout = p.IdleTimeout
+	}
+	if p.PoolTimeout > 0 {
+		cfg.PoolTimeout = p.PoolTimeout
+	}
+}
+
+// parsePoolParams returns pool configuration of DSN parameters
+func parsePoolParams(params url.Values) (PoolConfig, error) {
+	var p PoolConfig
+	var err error
+	for _, param := range []struct {
+		name  string
+		value interface{}
+	}{
+		{PoolMaxConnsParam, &p.MaxConns},
+		{PoolMinIdleParam, &p.MinIdle},
+		{PoolMaxConnAgeParam, &p.MaxConnAge},
+		{PoolIdleTimeoutParam, &p.IdleTimeout},
+		{PoolTimeoutParam, &p.PoolTimeout},
+	} {
+		s := params.Get(param.name)
+		if s == "" {
+			continue
+		}
+		switch v := param.value.(type) {
+		case *int:
+			*v, err = strconv.Atoi(s)
+		case *time.Duration:
+			*v, err = time.ParseDuration(s)
+		}
+		if err != nil {
+			return PoolConfig{}, fmt.Errorf("invalid %s: %w", param.name, err)
+		}
+	}
+	return p, nil
+}
+
+// cutParams removes parameters of names from query of dsn, pg.ParseURL fails on parameters it doesn't support
+func cutParams(dsn string, names ...string) (string, url.Values, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := u.Query()
+	cut := make(url.Values)
+	for _, name := range names {
+		if values, ok := query[name]; ok {
+			cut[name] = values
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), cut, nil
+}
@@ -0,0 +1,259 @@
+// Package queue implements Postgres-backed job queue. Jobs are claimed with SELECT ... FOR UPDATE SKIP LOCKED
+// and stay invisible to other workers for visibility timeout, so a job of crashed worker is retried after it expires
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+)
+
+// ErrSkip can be returned by handler (wrapped as well) to dead-letter the job without retries
+var ErrSkip = errors.New("queue: job skipped")
+
+// DefaultQueue is the name of queue used if no other is set
+const DefaultQueue = "default"
+
+// CreateTableSQL creates jobs table
+const CreateTableSQL = `CREATE TABLE IF NOT EXISTS "job_queue" (
+	"id"           BIGSERIAL PRIMARY KEY,
+	"queue"        VARCHAR(256) NOT NULL DEFAULT 'default',
+	"kind"         VARCHAR(256) NOT NULL DEFAULT '',
+	"payload"      JSONB,
+	"status"       VARCHAR(32) NOT NULL DEFAULT 'pending',
+	"attempts"     INT NOT NULL DEFAULT 0,
+	"run_at"       TIMESTAMP NOT NULL DEFAULT now(),
+	"locked_until" TIMESTAMP,
+	"last_error"   TEXT NOT NULL DEFAULT '',
+	"created"      TIMESTAMP NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS "job_queue_pending_idx" ON "job_queue" ("queue", "run_at") WHERE "status" = 'pending'`
+
+// Job is a task of the queue, completed jobs are deleted, jobs failed more than MaxRetries times are kept
+// with StatusDead
+type Job struct {
+	tableName   struct{}        `pg:"job_queue"`
+	ID          int64           `pg:"id"`
+	Queue       string          `pg:"queue,notnull"`
+	Kind        string          `pg:"kind,notnull,use_zero"`
+	Payload     json.RawMessage `pg:"payload,type:jsonb"`
+	Status      string          `pg:"status,notnull"`
+	Attempts    int             `pg:"attempts,notnull,use_zero"`
+	RunAt       time.Time       `pg:"run_at,notnull,type:timestamp"`
+	LockedUntil *time.Time      `pg:"locked_until,type:timestamp"`
+	LastError   string          `pg:"last_error,notnull,use_zero"`
+	Created     time.Time       `pg:"created,notnull,type:timestamp"`
+}
+
+// Unmarshal decodes payload of the job into v
+func (j *Job) Unmarshal(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler processes the job, returned error makes the job to be retried
+type Handler func(ctx context.Context, job *Job) error
+
+// WorkerOpts configures Worker
+type WorkerOpts struct {
+	// Queue is the name of processed queue, DefaultQueue by default
+	Queue string
+	// Concurrency is the number of jobs processed concurrently, 1 by default
+	Concurrency int
+	// PollInterval is the pause between checks of empty queue, 1 second by default
+	PollInterval time.Duration
+	// MaxRetries is the number of retries of failed job before it is dead-lettered, 0 means no retries
+	MaxRetries int
+	// VisibilityTimeout is the time the claimed job is invisible to other workers, 5 minutes by default.
+	// Handler has to finish the job within the timeout, otherwise the job is processed again
+	VisibilityTimeout time.Duration
+	// Backoff returns delay of retry after attempt, exponential starting with 1 second by default
+	Backoff func(attempt int) time.Duration
+}
+
+// Queue enqueues and processes jobs
+type Queue struct {
+	db db.Client
+}
+
+// New creates Queue
+func New(dbc db.Client) *Queue {
+	return &Queue{db: dbc}
+}
+
+// Enqueue adds job to the queue, the job is inserted within transaction of ctx if any, so it is visible to workers
+// after the transaction commits. Queue, Status and RunAt of the job are set to defaults if empty
+func (q *Queue) Enqueue(ctx context.Context, job *Job) error {
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	job.Status = StatusPending
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.Created.IsZero() {
+		job.Created = time.Now()
+	}
+
+	_, err := q.db.WithContext(ctx).Model(job).Insert()
+	return err
+}
+
+// EnqueuePayload marshals payload into JSON and adds job of the kind to the queue
+func (q *Queue) EnqueuePayload(ctx context.Context, queue, kind string, payload interface{}) (*Job, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{Queue: queue, Kind: kind, Payload: b}
+	return job, q.Enqueue(ctx, job)
+}
+
+// Worker processes jobs of the queue with handler until ctx is done
+func (q *Queue) Worker(ctx context.Context, handler Handler, opts WorkerOpts) error {
+	opts = opts.withDefaults()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler, opts)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// work processes jobs one by one, pausing for poll interval if the queue is empty or claim fails
+func (q *Queue) work(ctx context.Context, handler Handler, opts WorkerOpts) {
+	for ctx.Err() == nil {
+		processed, err := q.ProcessNext(ctx, handler, opts)
+		if err == nil && processed {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.PollInterval):
+		}
+	}
+}
+
+// ProcessNext claims the next job of the queue and processes it with handler, it reports false
+// if there is no job ready to run
+func (q *Queue) ProcessNext(ctx context.Context, handler Handler, opts WorkerOpts) (bool, error) {
+	opts = opts.withDefaults()
+
+	job, err := q.claim(ctx, opts)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	return true, q.finish(ctx, job, safeHandle(ctx, handler, job), opts)
+}
+
+// claim locks the next job ready to run for visibility timeout
+func (q *Queue) claim(ctx context.Context, opts WorkerOpts) (*Job, error) {
+	job := &Job{}
+	_, err := q.db.WithContext(ctx).QueryOne(job, `UPDATE "job_queue" SET
+			"locked_until" = now() + ? * interval '1 millisecond',
+			"attempts" = "attempts" + 1
+		WHERE "id" = (
+			SELECT "id" FROM "job_queue"
+			WHERE "queue" = ? AND "status" = ? AND "run_at" <= now() AND ("locked_until" IS NULL OR "locked_until" < now())
+			ORDER BY "run_at", "id"
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, opts.VisibilityTimeout.Milliseconds(), opts.Queue, StatusPending)
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// finish deletes completed job, schedules retry of failed one or dead-letters it. The job is changed only if it is
+// not claimed again after visibility timeout
+func (q *Queue) finish(ctx context.Context, job *Job, handleErr error, opts WorkerOpts) error {
+	dbc := q.db.WithContext(ctx)
+	if handleErr == nil {
+		_, err := dbc.Exec(`DELETE FROM "job_queue" WHERE "id" = ? AND "attempts" = ?`, job.ID, job.Attempts)
+		return err
+	}
+
+	if job.Attempts > opts.MaxRetries || errors.Is(handleErr, ErrSkip) {
+		_, err := dbc.Exec(`UPDATE "job_queue" SET "status" = ?, "locked_until" = NULL, "last_error" = ?
+			WHERE "id" = ? AND "attempts" = ?`, StatusDead, handleErr.Error(), job.ID, job.Attempts)
+		return err
+	}
+
+	_, err := dbc.Exec(`UPDATE "job_queue" SET "run_at" = now() + ? * interval '1 millisecond', "locked_until" = NULL,
+		"last_error" = ? WHERE "id" = ? AND "attempts" = ?`,
+		opts.Backoff(job.Attempts).Milliseconds(), handleErr.Error(), job.ID, job.Attempts)
+	return err
+}
+
+// Retry returns dead job back to the queue
+func (q *Queue) Retry(ctx context.Context, id int64) error {
+	res, err := q.db.WithContext(ctx).Exec(`UPDATE "job_queue" SET "status" = ?, "attempts" = 0, "run_at" = now()
+		WHERE "id" = ? AND "status" = ?`, StatusPending, id, StatusDead)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return pg.ErrNoRows
+	}
+	return nil
+}
+
+// safeHandle calls handler converting panic into error
+func safeHandle(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+func (o WorkerOpts) withDefaults() WorkerOpts {
+	if o.Queue == "" {
+		o.Queue = DefaultQueue
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = time.Second
+	}
+	if o.VisibilityTimeout <= 0 {
+		o.VisibilityTimeout = 5 * time.Minute
+	}
+	if o.Backoff == nil {
+		o.Backoff = exponentialBackoff
+	}
+	return o
+}
+
+func exponentialBackoff(attempt int) time.Duration {
+	return time.Duration(math.Min(math.Pow(2, float64(attempt-1)), 3600)) * time.Second
+}
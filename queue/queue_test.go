@@ -0,0 +1,139 @@
+//go:build !ci
+// +build !ci
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+)
+
+type payload struct {
+	N int `json:"n"`
+}
+
+func TestQueue_ProcessNext(t *testing.T) {
+	test.CleanDB(testDb, t)
+	q := New(testDb)
+	ctx := context.Background()
+	opts := WorkerOpts{MaxRetries: 1, Backoff: func(int) time.Duration { return 0 }}
+
+	job, err := q.EnqueuePayload(ctx, "", "count", payload{N: 1})
+	assert.NoError(t, err)
+	assert.NotZero(t, job.ID)
+
+	var attempts int
+	handler := func(ctx context.Context, job *Job) error {
+		attempts++
+		var p payload
+		assert.NoError(t, job.Unmarshal(&p))
+		assert.Equal(t, 1, p.N)
+		assert.Equal(t, attempts, job.Attempts)
+		return fmt.Errorf("attempt %d failed", attempts)
+	}
+
+	for i := 0; i < 2; i++ {
+		processed, err := q.ProcessNext(ctx, handler, opts)
+		assert.NoError(t, err)
+		assert.True(t, processed)
+	}
+	processed, err := q.ProcessNext(ctx, handler, opts)
+	assert.NoError(t, err)
+	assert.False(t, processed, "dead job is not processed")
+
+	dead := &Job{ID: job.ID}
+	assert.NoError(t, testDb.Select(dead))
+	assert.Equal(t, StatusDead, dead.Status)
+	assert.Equal(t, "attempt 2 failed", dead.LastError)
+
+	assert.NoError(t, q.Retry(ctx, job.ID))
+	processed, err = q.ProcessNext(ctx, func(ctx context.Context, job *Job) error { return nil }, opts)
+	assert.NoError(t, err)
+	assert.True(t, processed)
+
+	cnt, err := testDb.Model(&Job{}).Count()
+	assert.NoError(t, err)
+	assert.Zero(t, cnt, "completed job is deleted")
+}
+
+func TestQueue_Skip(t *testing.T) {
+	test.CleanDB(testDb, t)
+	q := New(testDb)
+	ctx := context.Background()
+
+	job := &Job{Kind: "skip"}
+	assert.NoError(t, q.Enqueue(ctx, job))
+	processed, err := q.ProcessNext(ctx, func(ctx context.Context, job *Job) error {
+		return fmt.Errorf("invalid payload: %w", ErrSkip)
+	}, WorkerOpts{MaxRetries: 5})
+	assert.NoError(t, err)
+	assert.True(t, processed)
+
+	assert.NoError(t, testDb.Select(job))
+	assert.Equal(t, StatusDead, job.Status)
+}
+
+func TestQueue_VisibilityTimeout(t *testing.T) {
+	test.CleanDB(testDb, t)
+	q := New(testDb)
+	ctx := context.Background()
+	opts := WorkerOpts{VisibilityTimeout: 50 * time.Millisecond}
+
+	assert.NoError(t, q.Enqueue(ctx, &Job{Kind: "slow"}))
+	job, err := q.claim(ctx, opts.withDefaults())
+	assert.NoError(t, err)
+	assert.NotNil(t, job)
+
+	job2, err := q.claim(ctx, opts.withDefaults())
+	assert.NoError(t, err)
+	assert.Nil(t, job2, "claimed job is invisible")
+
+	time.Sleep(100 * time.Millisecond)
+	job2, err = q.claim(ctx, opts.withDefaults())
+	assert.NoError(t, err)
+	assert.NotNil(t, job2, "job is visible after timeout")
+	assert.Equal(t, 2, job2.Attempts)
+
+	// the first worker finishes late, its result is ignored
+	assert.NoError(t, q.finish(ctx, job, nil, opts.withDefaults()))
+	assert.NoError(t, testDb.Select(job2))
+}
+
+func TestQueue_Worker(t *testing.T) {
+	test.CleanDB(testDb, t)
+	q := New(testDb)
+
+	for i := 0; i < 20; i++ {
+		_, err := q.EnqueuePayload(context.Background(), "", "count", payload{N: i})
+		assert.NoError(t, err)
+	}
+
+	var processed int64
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := q.Worker(ctx, func(ctx context.Context, job *Job) error {
+		mu.Lock()
+		assert.False(t, seen[job.ID], "job is processed once")
+		seen[job.ID] = true
+		mu.Unlock()
+
+		if atomic.AddInt64(&processed, 1) == 20 {
+			cancel()
+		}
+		return nil
+	}, WorkerOpts{Concurrency: 4, PollInterval: 10 * time.Millisecond})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, int64(20), processed)
+}
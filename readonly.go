@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// ErrReadOnly is returned instead of running write query by read-only client
+var ErrReadOnly = errors.New("pg: client is read-only")
+
+var (
+	// writeStatements are the first keywords of statements changing data or schema
+	writeStatements = map[string]bool{
+		"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "TRUNCATE": true, "CREATE": true,
+		"ALTER": true, "DROP": true, "GRANT": true, "REVOKE": true, "COMMENT": true, "REINDEX": true,
+		"VACUUM": true, "CLUSTER": true, "REFRESH": true, "LOCK": true, "CALL": true, "DO": true, "IMPORT": true,
+		"SECURITY": true,
+	}
+	// dmlRegexp matches data-modifying statements of WITH and EXPLAIN
+	dmlRegexp = regexp.MustCompile(`(?is)\b(?:INSERT\s+INTO|DELETE\s+FROM|MERGE\s+INTO)\b|\bUPDATE\b[^;]*?\bSET\b`)
+	// copyFromRegexp matches COPY loading data into table, file name literal is redacted before matching
+	copyFromRegexp = regexp.MustCompile(`(?i)\bFROM\s+(?:STDIN|PROGRAM|\?)`)
+)
+
+// WithReadOnly makes the client reject INSERT, UPDATE, DELETE, DDL and other write statements of the primary
+// and replicas with ErrReadOnly before they are sent, including queries built with Model, so services connected
+// with replica DSN can't write by accident. default_transaction_read_only is also set on connect, so the server
+// rejects writes the client lets through, e.g. by functions called in SELECT, connections of handles passed
+// to NewDbClient opened before the client is created don't have it set. Database/sql handle of SQLDB is not guarded
+func WithReadOnly() Option {
+	// configured is the config of the primary changed by Connect, so it isn't changed again by apply
+	var configured *pg.Options
+	return Option{
+		configure: func(cfg *pg.Options) {
+			configured = cfg
+			addOnConnect(cfg, "SET default_transaction_read_only = on")
+		},
+		apply: func(w *dbWrapper) *dbWrapper {
+			for _, db := range w.dbs() {
+				if db.Options() != configured {
+					addOnConnect(db.Options(), "SET default_transaction_read_only = on")
+				}
+				db.AddQueryHook(readOnly{})
+			}
+			return w
+		},
+	}
+}
+
+// NewReadOnlyClient creates client of conn rejecting write queries, see WithReadOnly
+func NewReadOnlyClient(conn *pg.DB, options ...Option) Client {
+	return NewDbClient(conn, append(options, WithReadOnly())...)
+}
+
+// readOnly is a query hook rejecting write queries
+type readOnly struct{}
+
+func (readOnly) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	query, err := event.UnformattedQuery()
+	if err != nil {
+		return ctx, nil
+	}
+	if isWrite(string(query)) {
+		return ctx, ErrReadOnly
+	}
+	return ctx, nil
+}
+
+func (readOnly) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
+
+// isWrite reports whether query changes data or schema. Literals and comments are skipped, data-modifying
+// statements of WITH and EXPLAIN (ANALYZE executes the statement) are writes, as well as COPY ... FROM
+func isWrite(query string) bool {
+	query = literalRegexp.ReplaceAllString(query, redactedValue)
+	query = commentRegexp.ReplaceAllString(query, " ")
+	fields := strings.Fields(strings.TrimLeft(query, " \t\r\n("))
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch keyword := strings.ToUpper(strings.TrimRight(fields[0], ";")); keyword {
+	case "WITH", "EXPLAIN":
+		return dmlRegexp.MatchString(query)
+	case "COPY":
+		return copyFromRegexp.MatchString(query)
+	default:
+		return writeStatements[keyword]
+	}
+}
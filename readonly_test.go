@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWrite(t *testing.T) {
+	tests := []struct {
+		query string
+		write bool
+	}{
+		{query: "SELECT * FROM users WHERE name = 'DELETE FROM users'", write: false},
+		{query: "  (SELECT 1)", write: false},
+		{query: "/* DROP */ SHOW search_path", write: false},
+		{query: "BEGIN", write: false},
+		{query: "SELECT * FROM users FOR UPDATE", write: false},
+		{query: "WITH u AS (SELECT id FROM users) SELECT * FROM u", write: false},
+		{query: "EXPLAIN (FORMAT JSON) SELECT 1", write: false},
+		{query: "COPY (SELECT * FROM users) TO STDOUT", write: false},
+		{query: "insert into users (id) values (1)", write: true},
+		{query: "/*endpoint='x'*/ UPDATE users SET name = 'a'", write: true},
+		{query: "DELETE FROM users", write: true},
+		{query: "TRUNCATE users;", write: true},
+		{query: "CREATE TABLE t (id int)", write: true},
+		{query: "WITH d AS (DELETE FROM users RETURNING id) SELECT * FROM d", write: true},
+		{query: "EXPLAIN ANALYZE UPDATE users SET name = 'a'", write: true},
+		{query: "COPY users FROM STDIN", write: true},
+		{query: "COPY users FROM '/tmp/users.csv'", write: true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.write, isWrite(tt.query), tt.query)
+	}
+}
+
+func TestWithReadOnly(t *testing.T) {
+	type user struct {
+		ID   int
+		Name string
+	}
+
+	client := Connect("test", &pg.Options{Addr: "127.0.0.1:1"}, WithReadOnly())
+	defer client.Close()
+
+	assert.ErrorIs(t, client.Insert(&user{ID: 1}), ErrReadOnly)
+	assert.ErrorIs(t, client.Update(&user{ID: 1}), ErrReadOnly)
+	assert.ErrorIs(t, client.Delete(&user{ID: 1}), ErrReadOnly)
+	_, err := client.Exec("DELETE FROM users")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = client.WithContext(context.Background()).Model(&user{}).Where("id = 1").Set("name = 'a'").Update()
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	// reads are sent to the unreachable server
+	err = client.Select(&user{ID: 1})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrReadOnly)
+}
+
+func TestNewReadOnlyClient(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "127.0.0.1:1"})
+	client := NewReadOnlyClient(conn)
+	defer client.Close()
+	assert.NotNil(t, conn.Options().OnConnect)
+
+	_, err := client.Exec("INSERT INTO users (id) VALUES (1)")
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
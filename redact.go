@@ -0,0 +1,161 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// redactedValue replaces masked values in logged queries
+	redactedValue  = "?"
+	literalPattern = `'(?:[^']|'')*'|-?\b\d+(?:\.\d+)?\b`
+)
+
+var (
+	literalRegexp = regexp.MustCompile(literalPattern)
+	insertRegexp  = regexp.MustCompile(`(?is)\bINSERT\s+INTO\s+[^(\s]+(?:\s+AS\s+\S+)?\s*\(([^)]*)\)\s*VALUES\s*`)
+)
+
+// paramRedactor masks values bound into formatted queries
+type paramRedactor struct {
+	// columns are lower case names of redacted columns, nil means all literals are redacted
+	columns  map[string]bool
+	compared *regexp.Regexp
+	in       *regexp.Regexp
+}
+
+// newParamRedactor creates redactor of values of columns, all literals are redacted if there are no columns
+func newParamRedactor(columns []string) *paramRedactor {
+	if len(columns) == 0 {
+		return &paramRedactor{}
+	}
+
+	r := &paramRedactor{columns: make(map[string]bool, len(columns))}
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		r.columns[strings.ToLower(c)] = true
+		names = append(names, regexp.QuoteMeta(c))
+	}
+	column := `("(?:` + strings.Join(names, "|") + `)"|\b(?:` + strings.Join(names, "|") + `)\b)`
+	r.compared = regexp.MustCompile(`(?i)` + column + `(\s*(?:=|<>|!=|<=|>=|<|>|\bI?LIKE\b)\s*)(?:` + literalPattern + `)`)
+	r.in = regexp.MustCompile(`(?i)` + column + `(\s+(?:NOT\s+)?IN\s*\()((?:'(?:[^']|'')*'|[^')])*)\)`)
+	return r
+}
+
+// redact returns query with values of the columns replaced with ?: compared with or assigned to the columns,
+// listed in IN of the columns and inserted into the columns. All string and numeric literals are replaced
+// if the redactor has no columns
+func (r *paramRedactor) redact(query string) string {
+	if r.columns == nil {
+		return literalRegexp.ReplaceAllString(query, redactedValue)
+	}
+
+	query = r.compared.ReplaceAllString(query, "${1}${2}"+redactedValue)
+	query = r.in.ReplaceAllStringFunc(query, func(s string) string {
+		m := r.in.FindStringSubmatch(s)
+		return m[1] + m[2] + literalRegexp.ReplaceAllString(m[3], redactedValue) + ")"
+	})
+	return r.redactInserts(query)
+}
+
+// redactInserts replaces values of the columns in VALUES lists of INSERT queries
+func (r *paramRedactor) redactInserts(query string) string {
+	matches := insertRegexp.FindAllStringSubmatchIndex(query, -1)
+	// inserts are rewritten from the end, so indexes of the preceding ones stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		var positions []bool
+		var found bool
+		for _, c := range strings.Split(query[m[2]:m[3]], ",") {
+			redacted := r.columns[strings.ToLower(strings.Trim(strings.TrimSpace(c), `"`))]
+			positions = append(positions, redacted)
+			found = found || redacted
+		}
+		if found {
+			query = query[:m[1]] + redactTuples(query[m[1]:], positions)
+		}
+	}
+	return query
+}
+
+// redactTuples replaces values at redacted positions of comma separated tuples at the beginning of s
+func redactTuples(s string, positions []bool) string {
+	var b strings.Builder
+	i := 0
+	for {
+		end, values, ok := scanTuple(s, i)
+		if !ok {
+			break
+		}
+		b.WriteString(s[i:values[0][0]])
+		for j, v := range values {
+			if j > 0 {
+				b.WriteString(",")
+			}
+			value := s[v[0]:v[1]]
+			if j < len(positions) && positions[j] {
+				value = redactValue(value)
+			}
+			b.WriteString(value)
+		}
+		b.WriteString(")")
+
+		i = end
+		next := i
+		for next < len(s) && (s[next] == ' ' || s[next] == '\n' || s[next] == '\t') {
+			next++
+		}
+		if next == len(s) || s[next] != ',' {
+			break
+		}
+		b.WriteString(s[i : next+1])
+		i = next + 1
+		for i < len(s) && (s[i] == ' ' || s[i] == '\n' || s[i] == '\t') {
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String() + s[i:]
+}
+
+// redactValue replaces value keeping its surrounding spaces, DEFAULT and NULL are kept as they are
+func redactValue(value string) string {
+	trimmed := strings.TrimSpace(value)
+	switch strings.ToUpper(trimmed) {
+	case "", "DEFAULT", "NULL":
+		return value
+	}
+	start := strings.Index(value, trimmed)
+	return value[:start] + redactedValue + value[start+len(trimmed):]
+}
+
+// scanTuple scans parenthesized tuple starting at i, it returns index after the tuple and bounds of its values.
+// Quoted literals and identifiers, nested parentheses and brackets are skipped
+func scanTuple(s string, i int) (int, [][2]int, bool) {
+	if i >= len(s) || s[i] != '(' {
+		return 0, nil, false
+	}
+
+	var values [][2]int
+	depth, start := 0, i+1
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '\'', '"':
+			for j++; j < len(s) && s[j] != c; j++ {
+			}
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+			if depth == 0 {
+				return j + 1, append(values, [2]int{start, j}), true
+			}
+		case ',':
+			if depth == 1 {
+				values = append(values, [2]int{start, j})
+				start = j + 1
+			}
+		}
+	}
+	return 0, nil, false
+}
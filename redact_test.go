@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParamRedactor(t *testing.T) {
+	tests := []struct {
+		name     string
+		columns  []string
+		query    string
+		expected string
+	}{
+		{
+			name:     "all literals",
+			query:    `SELECT * FROM "users" WHERE "name" = 'John' AND "age" > 30 LIMIT 1`,
+			expected: `SELECT * FROM "users" WHERE "name" = ? AND "age" > ? LIMIT ?`,
+		},
+		{
+			name:     "compared column",
+			columns:  []string{"inn", "name"},
+			query:    `SELECT * FROM "users" WHERE "inn" = '7701234567' AND "users"."name" ILIKE 'J%' AND "age" > 30`,
+			expected: `SELECT * FROM "users" WHERE "inn" = ? AND "users"."name" ILIKE ? AND "age" > 30`,
+		},
+		{
+			name:     "assigned column",
+			columns:  []string{"token"},
+			query:    `UPDATE "sessions" SET "token" = 'secret', "user_token" = 'kept' WHERE id = 1`,
+			expected: `UPDATE "sessions" SET "token" = ?, "user_token" = 'kept' WHERE id = 1`,
+		},
+		{
+			name:     "in list",
+			columns:  []string{"inn"},
+			query:    `SELECT * FROM "users" WHERE inn IN ('1', 'a)b') AND id IN (1, 2)`,
+			expected: `SELECT * FROM "users" WHERE inn IN (?, ?) AND id IN (1, 2)`,
+		},
+		{
+			name:    "insert",
+			columns: []string{"name", "tags"},
+			query: `INSERT INTO "users" ("id", "name", "tags", "age") VALUES (DEFAULT, 'a,b', '{"x","y"}', 1), ` +
+				`(DEFAULT, 'it''s', ARRAY[1,2], NULL) RETURNING "id"`,
+			expected: `INSERT INTO "users" ("id", "name", "tags", "age") VALUES (DEFAULT, ?, ?, 1), ` +
+				`(DEFAULT, ?, ?, NULL) RETURNING "id"`,
+		},
+		{
+			name:     "insert without columns",
+			columns:  []string{"name"},
+			query:    `INSERT INTO "users" ("id", "age") VALUES (1, 2)`,
+			expected: `INSERT INTO "users" ("id", "age") VALUES (1, 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, newParamRedactor(tt.columns).redact(tt.query))
+		})
+	}
+}
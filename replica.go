@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	pg "github.com/go-pg/pg/v10"
+	orm "github.com/go-pg/pg/v10/orm"
+)
+
+// primaryKey is the context key of WithPrimary, distinct type keeps it apart from keys of other context values
+type primaryKey struct{}
+
+// replicaReadKey is the context key of WithReplicaRead, distinct type keeps it apart from keys of other context values
+type replicaReadKey struct{}
+
+var lockingClause = regexp.MustCompile(`(?i)\sFOR\s+(UPDATE|NO\s+KEY\s+UPDATE|SHARE|KEY\s+SHARE)\b`)
+
+// ReplicaBalancer is a strategy of choosing replica for read query
+type ReplicaBalancer int
+
+// Replica balancers
+const (
+	// RoundRobin chooses replicas in turn
+	RoundRobin ReplicaBalancer = iota
+	// LeastLoaded chooses replica with the least number of connections in use
+	LeastLoaded
+)
+
+type replicaPool struct {
+	dbs      []*pg.DB
+	balancer ReplicaBalancer
+	next     uint32
+	// out marks replicas taken out of rotation by health check
+	out []int32
+}
+
+// NewDbClientWithReplicas creates client routing read queries to replicas. Queries built with Model().Select(),
+// Count() etc. and Select are reads, raw SELECT queries of Query and QueryOne are reads only with context of
+// WithReplicaRead as they may call volatile functions (e.g. nextval, pg_advisory_lock or pg_notify). All the other
+// queries, queries within transaction and queries with locking clause (e.g. FOR UPDATE) hit the primary. Options
+// configuring connection (e.g. WithPool) are ignored with a warning
+func NewDbClientWithReplicas(primary *pg.DB, replicas []*pg.DB, options ...Option) Client {
+	dbc := &dbWrapper{conn: primary, drain: newDrain(), sql: &sqlDB{}}
+	if len(replicas) > 0 {
+		dbc.replicas = &replicaPool{dbs: replicas, out: make([]int32, len(replicas))}
+	}
+	for _, db := range dbc.dbs() {
+		db.AddQueryHook(dbc.drain)
+	}
+	w := applyOptions(dbc, options)
+	w.warnConnectOptions(options)
+	return w
+}
+
+// WithReplicaBalancer sets strategy of choosing replica, RoundRobin is used by default
+func WithReplicaBalancer(balancer ReplicaBalancer) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		if w.replicas != nil {
+			w.replicas.balancer = balancer
+		}
+		return w
+	})
+}
+
+// WithPrimary returns context forcing read queries to the primary, e.g. to read records just written
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimaryForced reports whether read queries of context are forced to the primary with WithPrimary
+func IsPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// WithReplicaRead returns context allowing raw SELECT queries of Query and QueryOne to be routed to replicas, the
+// caller guarantees they don't write, lock or call volatile functions
+func WithReplicaRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadKey{}, true)
+}
+
+// IsReplicaReadAllowed reports whether raw SELECT queries of context may be routed to replicas with WithReplicaRead
+func IsReplicaReadAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaReadKey{}).(bool)
+	return allowed
+}
+
+// readDB returns database to run query: replica for read query or primary otherwise
+func (w *dbWrapper) readDB(ctx context.Context, query interface{}) *pg.DB {
+	if w.replicas == nil || !w.isRead(ctx, query) {
+		return w.primary()
+	}
+	return w.replicaDB(ctx)
+}
+
+// replicaDB returns replica to run read query, primary if there are no replicas or primary is forced by ctx
+func (w *dbWrapper) replicaDB(ctx context.Context) *pg.DB {
+	if w.replicas == nil || (ctx != nil && IsPrimaryForced(ctx)) {
+		return w.primary()
+	}
+	if db := w.replicas.pick(); db != nil {
+		return db
+	}
+	return w.primary()
+}
+
+// isRead reports whether query is a SELECT without locking clause, raw query is a read only if ctx allows it
+func (w *dbWrapper) isRead(ctx context.Context, query interface{}) bool {
+	switch query.(type) {
+	case *orm.SelectQuery:
+	case string:
+		if ctx == nil || !IsReplicaReadAllowed(ctx) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	q := strings.TrimLeft(w.queryString(query), " \t\r\n(")
+	if len(q) < len("SELECT") || !strings.EqualFold(q[:len("SELECT")], "SELECT") {
+		return false
+	}
+	return !lockingClause.MatchString(q)
+}
+
+// pick returns replica chosen by balancer, nil if all the replicas are out of rotation
+func (p *replicaPool) pick() *pg.DB {
+	if p.balancer == LeastLoaded {
+		var best *pg.DB
+		var bestInUse uint32
+		for i, db := range p.dbs {
+			if !p.available(i) {
+				continue
+			}
+			stats := db.PoolStats()
+			if inUse := stats.TotalConns - stats.IdleConns; best == nil || inUse < bestInUse {
+				best, bestInUse = db, inUse
+			}
+		}
+		return best
+	}
+
+	for range p.dbs {
+		i := int((atomic.AddUint32(&p.next, 1) - 1) % uint32(len(p.dbs)))
+		if p.available(i) {
+			return p.dbs[i]
+		}
+	}
+	return nil
+}
+
+func (p *replicaPool) available(i int) bool {
+	return atomic.LoadInt32(&p.out[i]) == 0
+}
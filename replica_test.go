@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+type replicaModel struct {
+	tableName struct{} `pg:"replica_model"`
+	ID        int
+}
+
+func TestDbWrapper_Replicas(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "primary:5432"})
+	replicas := []*pg.DB{pg.Connect(&pg.Options{Addr: "replica1:5432"}), pg.Connect(&pg.Options{Addr: "replica2:5432"})}
+	client := NewDbClientWithReplicas(primary, replicas)
+	defer client.Close()
+	w := client.(*dbWrapper)
+
+	readCtx := WithReplicaRead(context.Background())
+
+	t.Run("Reads", func(t *testing.T) {
+		model := &replicaModel{}
+		for _, tc := range []struct {
+			query interface{}
+			read  bool
+		}{
+			{query: "SELECT 1", read: true},
+			{query: " select * FROM replica_model", read: true},
+			{query: "SELECT * FROM replica_model FOR UPDATE", read: false},
+			{query: "SELECT * FROM replica_model FOR NO KEY UPDATE SKIP LOCKED", read: false},
+			{query: "INSERT INTO replica_model VALUES (1)", read: false},
+			{query: "WITH d AS (DELETE FROM replica_model RETURNING *) SELECT * FROM d", read: false},
+			{query: orm.NewSelectQuery(orm.NewQuery(w, model)), read: true},
+			{query: orm.NewSelectQuery(orm.NewQuery(w, model).For("UPDATE")), read: false},
+			{query: orm.NewInsertQuery(orm.NewQuery(w, model)), read: false},
+		} {
+			assert.Equal(t, tc.read, w.isRead(readCtx, tc.query), "%v", tc.query)
+		}
+	})
+
+	t.Run("Raw queries", func(t *testing.T) {
+		assert.False(t, w.isRead(context.Background(), "SELECT 1"))
+		assert.False(t, w.isRead(context.Background(), "SELECT pg_notify('channel', 'key')"))
+		assert.True(t, w.isRead(context.Background(), orm.NewSelectQuery(orm.NewQuery(w, &replicaModel{}))))
+		assert.Equal(t, primary, w.readDB(context.Background(), "SELECT 1"))
+		assert.True(t, IsReplicaReadAllowed(WithQueryTags(readCtx, map[string]string{"route": "/"})))
+		assert.False(t, IsReplicaReadAllowed(WithPrimary(context.Background())))
+	})
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		first := w.readDB(readCtx, "SELECT 1")
+		second := w.readDB(readCtx, "SELECT 1")
+		assert.NotEqual(t, first, second)
+		assert.Contains(t, replicas, first)
+		assert.Contains(t, replicas, second)
+		assert.Equal(t, first, w.readDB(readCtx, "SELECT 1"))
+	})
+
+	t.Run("Primary", func(t *testing.T) {
+		assert.Equal(t, primary, w.readDB(context.Background(), "UPDATE replica_model SET id = 1"))
+		assert.Equal(t, primary, w.readDB(WithPrimary(readCtx), "SELECT 1"))
+		assert.Equal(t, primary, w.readDB(WithQueryTags(WithPrimary(readCtx), map[string]string{"route": "/"}), "SELECT 1"))
+		assert.False(t, IsPrimaryForced(WithQueryTags(context.Background(), map[string]string{"route": "/"})))
+		assert.Equal(t, primary, NewDbClient(primary).(*dbWrapper).readDB(readCtx, "SELECT 1"))
+	})
+
+	t.Run("LeastLoaded", func(t *testing.T) {
+		w := NewDbClientWithReplicas(primary, replicas, WithReplicaBalancer(LeastLoaded)).(*dbWrapper)
+		assert.Equal(t, replicas[0], w.readDB(readCtx, "SELECT 1"))
+	})
+}
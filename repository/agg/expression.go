@@ -0,0 +1,105 @@
+package agg
+
+import "github.com/go-pg/pg/v10"
+
+// Expression common facade for aggregate expressions
+type Expression interface {
+	Expression() string
+	Params() []interface{}
+}
+
+// Sum sum of column values
+type Sum string
+
+// Min minimal column value
+type Min string
+
+// Max maximal column value
+type Max string
+
+// Avg average of column values
+type Avg string
+
+// Count count of not NULL column values, count of all rows for "*" or empty column
+type Count string
+
+// CountDistinct count of distinct not NULL column values
+type CountDistinct string
+
+// Expression provide query expression
+func (e Sum) Expression() string {
+	return "sum(?)"
+}
+
+// Params provide query params
+func (e Sum) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
+
+// Expression provide query expression
+func (e Min) Expression() string {
+	return "min(?)"
+}
+
+// Params provide query params
+func (e Min) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
+
+// Expression provide query expression
+func (e Max) Expression() string {
+	return "max(?)"
+}
+
+// Params provide query params
+func (e Max) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
+
+// Expression provide query expression
+func (e Avg) Expression() string {
+	return "avg(?)"
+}
+
+// Params provide query params
+func (e Avg) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
+
+// Expression provide query expression
+func (e Count) Expression() string {
+	if e == "" || e == "*" {
+		return "count(*)"
+	}
+	return "count(?)"
+}
+
+// Params provide query params
+func (e Count) Params() []interface{} {
+	if e == "" || e == "*" {
+		return nil
+	}
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
+
+// Expression provide query expression
+func (e CountDistinct) Expression() string {
+	return "count(DISTINCT ?)"
+}
+
+// Params provide query params
+func (e CountDistinct) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(string(e)),
+	}
+}
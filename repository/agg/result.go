@@ -0,0 +1,46 @@
+package agg
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10/types"
+)
+
+// Result values of aggregate expressions in the order they were requested
+type Result []sql.NullString
+
+// IsNull responds whether i-th value is NULL, e.g. sum over empty set of rows
+func (r Result) IsNull(i int) bool {
+	return !r[i].Valid
+}
+
+// String returns i-th value as is, NULL is returned as empty string
+func (r Result) String(i int) string {
+	return r[i].String
+}
+
+// Int64 returns i-th value as integer, NULL is returned as 0
+func (r Result) Int64(i int) (int64, error) {
+	if r.IsNull(i) {
+		return 0, nil
+	}
+	return strconv.ParseInt(r[i].String, 10, 64)
+}
+
+// Float64 returns i-th value as float, NULL is returned as 0
+func (r Result) Float64(i int) (float64, error) {
+	if r.IsNull(i) {
+		return 0, nil
+	}
+	return strconv.ParseFloat(r[i].String, 64)
+}
+
+// Time returns i-th value as time, NULL is returned as zero time
+func (r Result) Time(i int) (time.Time, error) {
+	if r.IsNull(i) {
+		return time.Time{}, nil
+	}
+	return types.ParseTimeString(r[i].String)
+}
@@ -0,0 +1,270 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// Actions of audit entries
+const (
+	ActionInsert     = "insert"
+	ActionUpdate     = "update"
+	ActionSoftDelete = "soft_delete"
+	ActionRestore    = "restore"
+	ActionDelete     = "delete"
+)
+
+// DefaultTableName is the name of audit log table
+const DefaultTableName = "audit_log"
+
+// CreateTableSQL creates audit log table, table name is passed as the only param
+const CreateTableSQL = `CREATE TABLE IF NOT EXISTS ? (
+	"id"         BIGSERIAL PRIMARY KEY,
+	"table_name" VARCHAR(256) NOT NULL,
+	"record_id"  VARCHAR(256) NOT NULL,
+	"action"     VARCHAR(32) NOT NULL,
+	"actor"      VARCHAR(256) NOT NULL DEFAULT '',
+	"old_data"   JSONB,
+	"new_data"   JSONB,
+	"created"    TIMESTAMP NOT NULL DEFAULT now()
+)`
+
+// actorKey is the context key of actor, distinct type keeps it apart from keys of other context values
+type actorKey struct{}
+
+// Entry is a record of audit log, OldData and NewData contain changed columns only.
+// Entries of the table set by WithTableName are selected with TableExpr
+type Entry struct {
+	tableName struct{}        `pg:"audit_log"`
+	ID        int64           `pg:"id"`
+	Table     string          `pg:"table_name,notnull"`
+	RecordID  string          `pg:"record_id,notnull"`
+	Action    string          `pg:"action,notnull"`
+	Actor     string          `pg:"actor,notnull,use_zero"`
+	OldData   json.RawMessage `pg:"old_data,type:jsonb"`
+	NewData   json.RawMessage `pg:"new_data,type:jsonb"`
+	Created   time.Time       `pg:"created,notnull,type:timestamp"`
+}
+
+// WithActor returns context with actor to be written into audit entries
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns actor stored in context with WithActor
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Option configures Auditor
+type Option func(a *Auditor)
+
+// WithTableName sets name of audit log table
+func WithTableName(name string) Option {
+	return func(a *Auditor) {
+		a.tableName = name
+	}
+}
+
+// WithDeletedColumn sets soft delete column name used to distinguish soft delete and restore from update
+func WithDeletedColumn(column string) Option {
+	return func(a *Auditor) {
+		a.deletedColumn = column
+	}
+}
+
+// Auditor writes audit entries of records changed with DAO. Entries are written within the transaction of
+// the change (DAO starts one for models with hooks), so they are committed or rolled back together with the change
+type Auditor struct {
+	tableName     string
+	deletedColumn string
+}
+
+// New creates Auditor
+func New(opts ...Option) *Auditor {
+	a := &Auditor{
+		tableName:     DefaultTableName,
+		deletedColumn: "deleted",
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Enable registers DAO hooks writing audit entries on Insert, Update, SoftDelete, Restore and HardDelete of models
+func (a *Auditor) Enable(d *dao.DAO, models ...interface{}) {
+	for _, model := range models {
+		d.RegisterHook(model, dao.AfterInsert, func(ctx context.Context, rec interface{}) error {
+			return a.write(ctx, d, rec, ActionInsert, nil, columns(rec))
+		})
+
+		d.RegisterHook(model, dao.BeforeUpdate, remember(d))
+		d.RegisterHook(model, dao.AfterUpdate, func(ctx context.Context, rec interface{}) error {
+			old := forget(ctx, rec)
+			cur, err := load(ctx, d, rec)
+			if err != nil {
+				return err
+			}
+
+			oldData, newData := diff(old, cur)
+			if len(newData) == 0 {
+				return nil
+			}
+			return a.write(ctx, d, rec, a.updateAction(old, cur), oldData, newData)
+		})
+
+		d.RegisterHook(model, dao.BeforeDelete, remember(d))
+		d.RegisterHook(model, dao.AfterDelete, func(ctx context.Context, rec interface{}) error {
+			old := forget(ctx, rec)
+			if old == nil {
+				old = columns(rec)
+			}
+			return a.write(ctx, d, rec, ActionDelete, old, nil)
+		})
+	}
+}
+
+// remember returns hook storing current state of the record before change in hook values of the operation
+func remember(d *dao.DAO) dao.HookFn {
+	return func(ctx context.Context, rec interface{}) error {
+		values := dao.HookValues(ctx)
+		if values == nil {
+			return nil
+		}
+
+		old, err := load(ctx, d, rec)
+		if err != nil {
+			return err
+		}
+		values.Store(rec, old)
+		return nil
+	}
+}
+
+// forget returns state of the record stored by remember hook of the operation
+func forget(ctx context.Context, rec interface{}) map[string]json.RawMessage {
+	values := dao.HookValues(ctx)
+	if values == nil {
+		return nil
+	}
+	old, _ := values.LoadAndDelete(rec)
+	res, _ := old.(map[string]json.RawMessage)
+	return res
+}
+
+func (a *Auditor) updateAction(old, cur map[string]json.RawMessage) string {
+	wasDeleted, isDeleted := old[a.deletedColumn], cur[a.deletedColumn]
+	if wasDeleted == nil || isDeleted == nil {
+		return ActionUpdate
+	}
+
+	switch null := "null"; {
+	case string(wasDeleted) == null && string(isDeleted) != null:
+		return ActionSoftDelete
+	case string(wasDeleted) != null && string(isDeleted) == null:
+		return ActionRestore
+	}
+	return ActionUpdate
+}
+
+func (a *Auditor) write(ctx context.Context, d *dao.DAO, rec interface{}, action string, old, cur map[string]json.RawMessage) error {
+	t := orm.GetTable(reflect.TypeOf(rec).Elem())
+	entry := &Entry{
+		Table:    strings.Trim(string(t.SQLName), `"`),
+		RecordID: recordID(t, rec),
+		Action:   action,
+		Actor:    ActorFromContext(ctx),
+		Created:  time.Now(),
+	}
+
+	var err error
+	if entry.OldData, err = marshal(old); err != nil {
+		return err
+	}
+	if entry.NewData, err = marshal(cur); err != nil {
+		return err
+	}
+
+	_, err = d.DB().WithContext(ctx).Exec(`INSERT INTO ? ("table_name", "record_id", "action", "actor", "old_data", "new_data", "created")
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, pg.Ident(a.tableName),
+		entry.Table, entry.RecordID, entry.Action, entry.Actor, jsonParam(entry.OldData), jsonParam(entry.NewData), entry.Created)
+	return err
+}
+
+// load selects current state of the record by primary key
+func load(ctx context.Context, d *dao.DAO, rec interface{}) (map[string]json.RawMessage, error) {
+	cur := reflect.New(reflect.TypeOf(rec).Elem())
+	cur.Elem().Set(reflect.ValueOf(rec).Elem())
+
+	err := d.DB().WithContext(ctx).Model(cur.Interface()).WherePK().Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return columns(cur.Interface()), nil
+}
+
+// columns returns JSON encoded column values of the record
+func columns(rec interface{}) map[string]json.RawMessage {
+	v := reflect.ValueOf(rec).Elem()
+	t := orm.GetTable(v.Type())
+
+	res := make(map[string]json.RawMessage, len(t.Fields))
+	for _, f := range t.Fields {
+		b, err := json.Marshal(f.Value(v).Interface())
+		if err != nil {
+			b = []byte(fmt.Sprintf("%q", fmt.Sprint(f.Value(v).Interface())))
+		}
+		res[f.SQLName] = b
+	}
+	return res
+}
+
+// diff returns changed columns with old and new values
+func diff(old, cur map[string]json.RawMessage) (oldData, newData map[string]json.RawMessage) {
+	oldData = make(map[string]json.RawMessage)
+	newData = make(map[string]json.RawMessage)
+	for column, val := range cur {
+		if prev, ok := old[column]; !ok || string(prev) != string(val) {
+			oldData[column] = old[column]
+			newData[column] = val
+		}
+	}
+	return oldData, newData
+}
+
+func marshal(data map[string]json.RawMessage) (json.RawMessage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return json.Marshal(data)
+}
+
+// jsonParam returns query param of JSON value, empty value is written as NULL
+func jsonParam(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+func recordID(t *orm.Table, rec interface{}) string {
+	v := reflect.ValueOf(rec).Elem()
+	ids := make([]string, 0, len(t.PKs))
+	for _, f := range t.PKs {
+		ids = append(ids, fmt.Sprint(f.Value(v).Interface()))
+	}
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,149 @@
+//go:build !ci
+// +build !ci
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+)
+
+type Item struct {
+	tableName struct{}   `pg:"item"`
+	ID        int64      `pg:"id"`
+	Name      string     `pg:"name,notnull,use_zero"`
+	Updated   time.Time  `pg:"updated,notnull,type:timestamp,default:now()"`
+	Deleted   *time.Time `pg:"deleted,type:timestamp"`
+}
+
+func (i *Item) SetDeleted(t time.Time) {
+	i.Deleted = &t
+}
+
+func (i *Item) ClearDeleted() {
+	i.Deleted = nil
+}
+
+func TestActorFromContext(t *testing.T) {
+	assert.Empty(t, ActorFromContext(dao.WithTenant(context.Background(), "tenant")))
+
+	ctx := dao.WithTenant(dao.WithStatementTimeout(WithActor(context.Background(), "admin"), time.Second), "tenant")
+	assert.Equal(t, "admin", ActorFromContext(ctx))
+}
+
+// TestContextHelpers layers all the context helpers, so values of different keys don't shadow each other
+func TestContextHelpers(t *testing.T) {
+	logger := db.NopLogger()
+	ctx := context.Background()
+	ctx = db.WithPrimary(ctx)
+	ctx = dao.WithTenant(ctx, int64(7))
+	ctx = db.WithQueryTags(ctx, map[string]string{"endpoint": "GET /agents"})
+	ctx = dao.WithStatementTimeout(ctx, 30*time.Second)
+	ctx = WithActor(ctx, "admin")
+	ctx = db.ContextWithSearchPath(ctx, "billing")
+	ctx = dao.WithLockTimeout(ctx, time.Second)
+	ctx = dao.WithLocalSetting(ctx, "app.user_id", "42")
+	ctx = db.ContextWithLogger(ctx, logger)
+
+	assert.True(t, db.IsPrimaryForced(ctx))
+	tenantID, ok := dao.TenantFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), tenantID)
+	assert.Equal(t, map[string]string{"endpoint": "GET /agents"}, db.QueryTagsFromContext(ctx))
+	statement, _ := dao.StatementTimeoutFromContext(ctx)
+	assert.Equal(t, 30*time.Second, statement)
+	assert.Equal(t, "admin", ActorFromContext(ctx))
+	assert.Equal(t, "billing", db.SearchPathFromContext(ctx))
+	lock, _ := dao.LockTimeoutFromContext(ctx)
+	assert.Equal(t, time.Second, lock)
+	assert.Equal(t, []dao.LocalSetting{{Name: "app.user_id", Value: "42"}}, dao.LocalSettingsFromContext(ctx))
+	assert.Equal(t, logger, db.LoggerFromContext(ctx, nil))
+
+	ctx = context.Background()
+	assert.False(t, db.IsPrimaryForced(dao.WithTenant(ctx, true)))
+	_, ok = dao.TenantFromContext(db.WithPrimary(ctx))
+	assert.False(t, ok)
+	assert.Empty(t, ActorFromContext(dao.WithTenant(ctx, "admin")))
+	assert.Empty(t, db.QueryTagsFromContext(dao.WithLocalSetting(ctx, "app.user_id", "42")))
+	assert.Empty(t, db.SearchPathFromContext(WithActor(ctx, "admin")))
+}
+
+func TestAuditor(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := dao.New(testDb)
+	New().Enable(repo, &Item{})
+
+	ctx := WithActor(context.Background(), "admin")
+	item := &Item{ID: 1, Name: "first"}
+	err := repo.WithTX(ctx, func(ctx context.Context) error {
+		return repo.Insert(ctx, item)
+	})
+	assert.NoError(t, err)
+
+	item.Name = "second"
+	assert.NoError(t, repo.Update(ctx, item, "name"))
+	assert.NoError(t, repo.SoftDelete(ctx, item))
+	assert.NoError(t, repo.Restore(ctx, item))
+	assert.NoError(t, repo.HardDelete(context.Background(), item))
+
+	var entries []*Entry
+	err = testDb.Model(&entries).Order("id").Select()
+	assert.NoError(t, err)
+
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, "item", entry.Table)
+		assert.Equal(t, "1", entry.RecordID)
+	}
+	assert.Equal(t, []string{ActionInsert, ActionUpdate, ActionSoftDelete, ActionRestore, ActionDelete}, actions)
+	assert.Equal(t, "admin", entries[0].Actor)
+	assert.Equal(t, "", entries[4].Actor)
+
+	var oldData, newData map[string]interface{}
+	assert.NoError(t, json.Unmarshal(entries[1].OldData, &oldData))
+	assert.NoError(t, json.Unmarshal(entries[1].NewData, &newData))
+	assert.Equal(t, "first", oldData["name"])
+	assert.Equal(t, "second", newData["name"])
+	assert.NotContains(t, newData, "id")
+	assert.Nil(t, entries[4].NewData)
+}
+
+func TestAuditor_Rollback(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := dao.New(testDb)
+	New().Enable(repo, &Item{})
+
+	err := repo.WithTX(context.Background(), func(ctx context.Context) error {
+		if err := repo.Insert(ctx, &Item{ID: 1, Name: "first"}); err != nil {
+			return err
+		}
+		return context.Canceled
+	})
+	assert.Error(t, err)
+
+	cnt, err := testDb.Model(&Entry{}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+}
+
+func TestAuditor_FailedWrite(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := dao.New(testDb)
+	New(WithTableName("missing_audit_log")).Enable(repo, &Item{})
+
+	err := repo.Insert(context.Background(), &Item{ID: 1, Name: "first"})
+	assert.Error(t, err)
+
+	cnt, err := testDb.Model(&Item{}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cnt)
+}
@@ -0,0 +1,58 @@
+//go:build !ci
+// +build !ci
+
+package audit
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/joho/godotenv"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
+	pg "github.com/go-pg/pg/v10"
+)
+
+var (
+	testDb db.Client
+)
+
+func TestMain(m *testing.M) {
+	testDb = setupDB()
+	seedDB(testDb)
+
+	os.Exit(m.Run())
+}
+
+func setupDB() db.Client {
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	dbc, err := test.CreateDB("audit_test", os.Getenv("DSN"))
+	if err != nil {
+		log.Fatalf("Failed to create database, error: %v", err)
+	}
+
+	return dbc
+}
+
+func seedDB(dbc db.Client) {
+	_, err := dbc.Exec(`CREATE TABLE IF NOT EXISTS "item" (
+    		"id"      BIGSERIAL PRIMARY KEY,
+    		"name"    VARCHAR(256) NOT NULL,
+    		"updated" TIMESTAMP NOT NULL DEFAULT now(),
+    		"deleted" TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+
+	_, err = dbc.Exec(CreateTableSQL, pg.Ident(DefaultTableName))
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+}
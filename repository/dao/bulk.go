@@ -0,0 +1,161 @@
+package dao
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// BulkLoad streams recs into the table with COPY ... FROM STDIN in CSV format and returns count of loaded rows.
+// If columns are not passed, all model columns are loaded except of those, which are left to database defaults
+// in every record (e.g. zero serial id). Zero values of the loaded columns are written the same way as Insert does.
+func (r *DAO) BulkLoad(ctx context.Context, recs interface{}, columns ...string) (int, error) {
+	v := reflect.Indirect(reflect.ValueOf(recs))
+	if v.Kind() != reflect.Slice {
+		return 0, pkgerr.NewBadRequestError(errors.New("recs must be slice or pointer to slice"))
+	}
+	if v.Len() == 0 {
+		return 0, nil
+	}
+	if r.hooksTx(ctx, recs) {
+		var loaded int
+		err := r.WithTX(ctx, func(ctx context.Context) (err error) {
+			loaded, err = r.BulkLoad(ctx, recs, columns...)
+			return err
+		})
+		return loaded, err
+	}
+	ctx = r.hooksContext(ctx, recs)
+
+	r.touchInserted(recs)
+	if err := r.setTenant(ctx, recs); err != nil {
+		return 0, err
+	}
+	if err := r.runHooks(ctx, BeforeInsert, recs); err != nil {
+		return 0, err
+	}
+	if len(columns) > 0 && r.hasTimestamps(recs) {
+		created, updated := r.timestampsColumns(recs)
+		for _, column := range []string{created, updated} {
+			if !containsString(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if _, ok := r.tenantField(ctx, recs); ok && len(columns) > 0 && !containsString(columns, r.tenantColumn) {
+		columns = append(columns, r.tenantColumn)
+	}
+
+	t := orm.GetTable(getType(v.Interface()))
+	fields, err := bulkFields(t, v, columns)
+	if err != nil {
+		return 0, pkgerr.NewBadRequestError(err)
+	}
+
+	res, err := r.copyCSV(ctx, t.SQLName, fields, v)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+
+	return res.RowsAffected(), r.runHooks(ctx, AfterInsert, recs)
+}
+
+// copyCSV streams fields of recs into table with COPY ... FROM STDIN in CSV format
+func (r *DAO) copyCSV(ctx context.Context, table types.Safe, fields []*orm.Field, recs reflect.Value) (orm.Result, error) {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, string(f.Column))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(writeCSV(pw, fields, recs))
+	}()
+	defer pr.Close()
+
+	return r.db.WithContext(ctx).CopyFrom(pr, "COPY ? (?) FROM STDIN WITH (FORMAT csv)",
+		table, pg.Safe(strings.Join(names, ", ")))
+}
+
+// bulkFields returns model fields to be loaded by COPY
+func bulkFields(t *orm.Table, recs reflect.Value, columns []string) ([]*orm.Field, error) {
+	if len(columns) > 0 {
+		fields := make([]*orm.Field, 0, len(columns))
+		for _, column := range columns {
+			f, ok := t.FieldsMap[column]
+			if !ok {
+				return nil, fmt.Errorf("column %s does not exist in table %s", column, t.SQLName)
+			}
+			fields = append(fields, f)
+		}
+		return fields, nil
+	}
+
+	fields := make([]*orm.Field, 0, len(t.Fields))
+	for _, f := range t.Fields {
+		for i := 0; i < recs.Len(); i++ {
+			if !isDefaultValue(f, reflect.Indirect(recs.Index(i))) {
+				fields = append(fields, f)
+				break
+			}
+		}
+	}
+	return fields, nil
+}
+
+// writeCSV writes records as CSV rows, NULL is written as unquoted empty value
+func writeCSV(w io.Writer, fields []*orm.Field, recs reflect.Value) error {
+	bw := bufio.NewWriter(w)
+	var b []byte
+	for i := 0; i < recs.Len(); i++ {
+		strct := reflect.Indirect(recs.Index(i))
+		for j, f := range fields {
+			if j > 0 {
+				_ = bw.WriteByte(',')
+			}
+			if isNullValue(f, strct) {
+				continue
+			}
+
+			b = f.AppendValue(b[:0], strct, 0)
+			_ = bw.WriteByte('"')
+			_, _ = bw.Write(bytes.ReplaceAll(b, []byte{'"'}, []byte{'"', '"'}))
+			_ = bw.WriteByte('"')
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// isDefaultValue reports whether Insert would write DEFAULT for the field
+func isDefaultValue(f *orm.Field, strct reflect.Value) bool {
+	return (f.Default != "" || f.NullZero()) && f.HasZeroValue(strct)
+}
+
+// isNullValue reports whether the field value is written as NULL
+func isNullValue(f *orm.Field, strct reflect.Value) bool {
+	if !f.HasZeroValue(strct) {
+		return false
+	}
+	if f.NullZero() {
+		return true
+	}
+	switch f.Type.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+package dao
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/filter"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// CacheChannel is the channel of LISTEN/NOTIFY used to invalidate cached records on all instances
+const CacheChannel = "dao_cache_invalidation"
+
+// Cache is a backend of DAO read cache, e.g. MemoryCache or rediscache.Cache
+type Cache interface {
+	// Get returns cached value of the key, false is returned if the key is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value of the key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys
+	Delete(ctx context.Context, keys ...string) error
+}
+
+type readCache struct {
+	backend Cache
+	ttl     time.Duration
+}
+
+// WithCache enables caching of records selected by FindOne with the only opt.Eq condition on primary key.
+// Records are encoded with encoding/gob, so only exported fields are cached. The cache is bypassed within
+// transaction, for tenant scoped models and with search_path override of context (see db.ContextWithSearchPath).
+// Cached records are invalidated by updates and deletes of the DAO, records changed by operations with conditions
+// (e.g. UpdateWhere, HardDeleteWhere) are found with RETURNING of their primary keys. Other instances running ListenCacheInvalidation are notified with NOTIFY on CacheChannel.
+// Records changed bypassing the DAO are stale for ttl
+func (r *DAO) WithCache(cache Cache, ttl time.Duration) {
+	if cache == nil {
+		r.cache = nil
+		return
+	}
+	r.cache = &readCache{backend: cache, ttl: ttl}
+}
+
+// ListenCacheInvalidation removes records changed by other instances from the cache until ctx is done
+func (r *DAO) ListenCacheInvalidation(ctx context.Context) error {
+	if r.cache == nil {
+		return pkgerr.NewInternalError(fmt.Errorf("cache is not enabled"))
+	}
+
+	ln, err := r.listen(ctx, CacheChannel)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	ch := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-ch:
+			if !ok {
+				return ctx.Err()
+			}
+			_ = r.cache.backend.Delete(ctx, n.Payload)
+		}
+	}
+}
+
+// listen subscribes to NOTIFY channels, it is supported by go-pg client only
+func (r *DAO) listen(ctx context.Context, channels ...string) (*pg.Listener, error) {
+	pgdb := r.db.Db()
+	if pgdb == nil {
+		return nil, pkgerr.NewInternalError(fmt.Errorf("LISTEN is not supported by the client"))
+	}
+	return pgdb.Listen(ctx, channels...), nil
+}
+
+// findCached selects receiver from the cache, it reports false if the query is not cacheable or the record
+// is not cached, returned key is empty for not cacheable queries
+func (r *DAO) findCached(ctx context.Context, receiver interface{}, opts []opt.FnOpt) (string, bool) {
+	if r.cache == nil || db.InTx(ctx) {
+		return "", false
+	}
+	if _, ok := r.tenantField(ctx, receiver); ok {
+		return "", false
+	}
+	// keys don't include schema, so records of schemas of tenants and search_path overrides aren't cached
+	if _, ok := r.tenantSchemaName(ctx); ok || db.SearchPathFromContext(ctx) != "" {
+		return "", false
+	}
+	key, ok := pkLookupKey(receiver, opts)
+	if !ok {
+		return "", false
+	}
+
+	b, ok, err := r.cache.backend.Get(ctx, key)
+	if err != nil || !ok {
+		return key, false
+	}
+	v := reflect.ValueOf(receiver).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(receiver); err != nil {
+		return key, false
+	}
+	return key, true
+}
+
+// storeCached stores the record selected by FindOne, failures are ignored as the record is read from database again
+func (r *DAO) storeCached(ctx context.Context, key string, rec interface{}) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return
+	}
+	_ = r.cache.backend.Set(ctx, key, buf.Bytes(), r.cache.ttl)
+}
+
+// invalidate removes recs from the cache and notifies other instances. Within transaction recs are removed after
+// commit (see db.AfterCommit), so records selected before commit by concurrent FindOne aren't left cached, failure
+// of the removal is ignored then. The notification is transactional, so it is delivered after commit too
+func (r *DAO) invalidate(ctx context.Context, recs ...interface{}) error {
+	if r.cache == nil {
+		return nil
+	}
+
+	var keys []string
+	for _, rec := range recs {
+		_ = eachRecord(rec, func(rec interface{}) error {
+			if key, ok := recordKey(rec); ok {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	}
+	return r.invalidateKeys(ctx, keys)
+}
+
+// returningPKs makes q return primary keys of changed rows of model into pks if the cache is enabled, values
+// returned are passed to Update or Delete of q to scan the keys, see invalidatePKs
+func (r *DAO) returningPKs(q *orm.Query, model interface{}, pks *[]string) (*orm.Query, []interface{}) {
+	if r.cache == nil {
+		return q, nil
+	}
+	typ := modelType(model)
+	if typ == nil {
+		return q, nil
+	}
+	table := orm.GetTable(typ)
+	if len(table.PKs) != 1 {
+		return q, nil
+	}
+	return q.Returning("?::text", table.PKs[0].Column), []interface{}{pks}
+}
+
+// invalidatePKs removes records of model with primary keys returned by query of returningPKs from the cache
+func (r *DAO) invalidatePKs(ctx context.Context, model interface{}, pks []string) error {
+	if r.cache == nil || len(pks) == 0 {
+		return nil
+	}
+	table := orm.GetTable(modelType(model))
+	keys := make([]string, 0, len(pks))
+	for _, pk := range pks {
+		keys = append(keys, strings.Trim(string(table.SQLName), `"`)+":"+pk)
+	}
+	return r.invalidateKeys(ctx, keys)
+}
+
+// invalidateKeys removes keys from the cache and notifies other instances, see invalidate
+func (r *DAO) invalidateKeys(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if db.InTx(ctx) {
+		db.AfterCommit(ctx, func() {
+			_ = r.cache.backend.Delete(ctx, keys...)
+		})
+	} else if err := r.cache.backend.Delete(ctx, keys...); err != nil {
+		return pkgerr.NewInternalError(err)
+	}
+	_, err := r.db.WithContext(ctx).Exec("SELECT pg_notify(?, key) FROM unnest(?::text[]) AS key", CacheChannel, pg.Array(keys))
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	return nil
+}
+
+// pkLookupKey returns cache key of the record selected by opts if opts is the only equality condition on primary key
+func pkLookupKey(receiver interface{}, opts []opt.FnOpt) (string, bool) {
+	typ := reflect.TypeOf(receiver)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return "", false
+	}
+	table := orm.GetTable(typ.Elem())
+	if len(table.PKs) != 1 {
+		return "", false
+	}
+
+	o := opt.New(opts...)
+	if o.IsColumns() || o.IsDistinct() || o.IsGroup() || o.IsFn() || o.IsPaging() || o.IsSorting() ||
+		len(o.Joins) > 0 || len(o.Having) > 0 || len(o.Relations) > 0 || len(o.Filter) != 1 {
+		return "", false
+	}
+	eq, ok := o.Filter[0].(filter.Eq)
+	if !ok || len(eq) != 1 {
+		return "", false
+	}
+	for column, val := range eq {
+		if column != table.PKs[0].SQLName {
+			return "", false
+		}
+		return cacheKey(table, val)
+	}
+	return "", false
+}
+
+// recordKey returns cache key of the record by its primary key
+func recordKey(rec interface{}) (string, bool) {
+	typ := modelType(rec)
+	if typ == nil {
+		return "", false
+	}
+	table := orm.GetTable(typ)
+	if len(table.PKs) != 1 {
+		return "", false
+	}
+	v := reflect.Indirect(reflect.ValueOf(rec))
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+	return cacheKey(table, table.PKs[0].Value(v).Interface())
+}
+
+// cacheKey returns key of the record in the table, false is returned for nil primary key
+func cacheKey(table *orm.Table, pk interface{}) (string, bool) {
+	v := reflect.ValueOf(pk)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", false
+	}
+	return strings.Trim(string(table.SQLName), `"`) + ":" + fmt.Sprint(v.Interface()), true
+}
+
+// MemoryCache is Cache keeping values in memory of the process, expired values are evicted lazily
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sweepAt int
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryCache creates MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]memoryEntry)}
+}
+
+// Get implements Cache
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set implements Cache, zero ttl means no expiration
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.entries[key] = memoryEntry{value: value, expires: expires}
+
+	// expired entries are swept when the cache doubles since the last sweep
+	if len(c.entries) > c.sweepAt {
+		now := time.Now()
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2 * len(c.entries)
+		if c.sweepAt < 1024 {
+			c.sweepAt = 1024
+		}
+	}
+	return nil
+}
+
+// Delete implements Cache
+func (c *MemoryCache) Delete(_ context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// Len returns the number of cached values including expired but not evicted ones
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
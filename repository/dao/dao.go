@@ -4,36 +4,61 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"reflect"
 	"strings"
 	"time"
 
 	db "github.com/alexandr-kononykhin-vay/postgres"
 	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/agg"
 	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
 	pg "github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 type DeletedSetter interface {
 	SetDeleted(time.Time)
 }
 
+// DeletedClearer is implemented by soft deletable models supporting restore
+type DeletedClearer interface {
+	ClearDeleted()
+}
+
 type DAO struct {
-	db           db.Client
-	updatedField string
-	deletedField string
+	db             db.Client
+	createdField   string
+	updatedField   string
+	deletedField   string
+	optsValidation bool
+	tenantColumn   string
+	tenantSchema   func(tenantID interface{}) string
+	localSettings  []LocalSettingsFn
+	hooks          hookRegistry
+	fields         fieldsRegistry
+	cache          *readCache
 }
 
 func New(db db.Client) *DAO {
 	return &DAO{
 		db:           db,
+		createdField: "created",
 		updatedField: "updated",
 		deletedField: "deleted",
 	}
 }
 
+// SetCreatedField sets default name of created column, which is used for models setting timestamps
+// (see TimestampsSetter and RegisterModelFields)
+func (r *DAO) SetCreatedField(fieldName string) {
+	if fieldName == "" {
+		return
+	}
+	r.createdField = fieldName
+}
+
 func (r *DAO) SetUpdatedField(fieldName string) {
 	if fieldName == "" {
 		return
@@ -48,6 +73,12 @@ func (r *DAO) SetDeletedField(fieldName string) {
 	r.deletedField = fieldName
 }
 
+// SetOptsValidation enables check of columns referenced in opts against model before query execution,
+// unknown column results in BadRequest error instead of database error
+func (r *DAO) SetOptsValidation(enabled bool) {
+	r.optsValidation = enabled
+}
+
 func (r *DAO) DB() db.Client {
 	return r.db
 }
@@ -57,37 +88,68 @@ func (r *DAO) Ping(ctx context.Context) error {
 	return err
 }
 
-// WithTX executes passed function within transaction
+// WithTX executes passed function within transaction, nested calls join the transaction of context.
+// Queries of the transaction and its failed rollback are logged with the logger of ctx (see db.ContextWithLogger)
 func (r *DAO) WithTX(ctx context.Context, fn func(context.Context) error) error {
-	if r.db.Tx() != nil {
+	if db.InTx(ctx) {
 		return fn(ctx)
 	}
 
-	tx, err := r.db.WithContext(ctx).StartTx()
-	if err != nil {
+	var fnErr error
+	err := r.db.RunInTx(ctx, func(ctx context.Context) error {
+		if err := r.setLocals(ctx); err != nil {
+			return err
+		}
+		fnErr = fn(ctx)
+		return fnErr
+	})
+	if err != nil && err != fnErr && err != ctx.Err() {
 		return pkgerr.Convert(ctx, err)
 	}
+	return err
+}
 
-	if err := fn(newTxContext(ctx, tx)); err != nil || ctx.Err() != nil {
-		if rollbackErr := r.db.Rollback(); rollbackErr != nil {
-			// TODO: get logger from context
-			log.Println(fmt.Sprintf("failed to rollback transaction: %s", rollbackErr.Error()))
-		}
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
+// FindOne selects the only record from database according to opts
+func (r *DAO) FindOne(ctx context.Context, receiver interface{}, opts []opt.FnOpt) error {
+	if err := r.validateOpts(receiver, opts); err != nil {
 		return err
 	}
+	opts = r.tenantOpts(ctx, receiver, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	defer done()
 
-	if err := r.db.Commit(); err != nil {
+	key, cached := r.findCached(ctx, receiver, opts)
+	if cached {
+		return nil
+	}
+
+	err = r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).First()
+	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
+	if key != "" {
+		r.storeCached(ctx, key, receiver)
+	}
+
 	return nil
 }
 
-// FindOne selects the only record from database according to opts
-func (r *DAO) FindOne(ctx context.Context, receiver interface{}, opts []opt.FnOpt) error {
-	err := r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).First()
+// FindList selects all records from database according to opts
+func (r *DAO) FindList(ctx context.Context, receiver interface{}, opts []opt.FnOpt) error {
+	if err := r.validateOpts(receiver, opts); err != nil {
+		return err
+	}
+	opts = r.tenantOpts(ctx, receiver, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	err = r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).Select()
 	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
@@ -95,9 +157,38 @@ func (r *DAO) FindOne(ctx context.Context, receiver interface{}, opts []opt.FnOp
 	return nil
 }
 
-// FindList selects all records from database according to opts
-func (r *DAO) FindList(ctx context.Context, receiver interface{}, opts []opt.FnOpt) error {
-	err := r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).Select()
+// FindEach selects records from database according to opts and calls fn for each of them without loading the whole list.
+// Model must be a pointer to struct, record passed to fn is reused between calls, so it has to be copied to be retained.
+// Iteration stops on the first error returned by fn, the error is returned as is.
+func (r *DAO) FindEach(ctx context.Context, model interface{}, opts []opt.FnOpt, fn func(rec interface{}) error) error {
+	if err := r.validateOpts(model, opts); err != nil {
+		return err
+	}
+	opts = r.tenantOpts(ctx, model, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	typ := reflect.TypeOf(model)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return pkgerr.NewBadRequestError(errors.New("model must be pointer to struct"))
+	}
+
+	var fnErr error
+	each := reflect.MakeFunc(
+		reflect.FuncOf([]reflect.Type{typ}, []reflect.Type{errorType}, false),
+		func(args []reflect.Value) []reflect.Value {
+			fnErr = fn(args[0].Interface())
+			return []reflect.Value{reflect.ValueOf(&fnErr).Elem()}
+		},
+	)
+
+	err = r.db.WithContext(ctx).Model(model).Apply(opt.Apply(opts...)).ForEach(each.Interface())
+	if fnErr != nil {
+		return fnErr
+	}
 	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
@@ -107,6 +198,16 @@ func (r *DAO) FindList(ctx context.Context, receiver interface{}, opts []opt.FnO
 
 // FindListWithTotal selects all records and total count of records from database according to opts
 func (r *DAO) FindListWithTotal(ctx context.Context, receiver interface{}, opts []opt.FnOpt) (total int, err error) {
+	if err := r.validateOpts(receiver, opts); err != nil {
+		return 0, err
+	}
+	opts = r.tenantOpts(ctx, receiver, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
 	total, err = r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).SelectAndCount()
 	if err != nil {
 		return 0, pkgerr.Convert(ctx, err)
@@ -117,6 +218,16 @@ func (r *DAO) FindListWithTotal(ctx context.Context, receiver interface{}, opts
 
 // GetTotal get total count of records from database according to opts
 func (r *DAO) GetTotal(ctx context.Context, receiver interface{}, opts []opt.FnOpt) (int, error) {
+	if err := r.validateOpts(receiver, opts); err != nil {
+		return 0, err
+	}
+	opts = r.tenantOpts(ctx, receiver, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
 	total, err := r.db.WithContext(ctx).Model(receiver).Apply(opt.Apply(opts...)).Count()
 	if err != nil {
 		return 0, pkgerr.Convert(ctx, err)
@@ -125,101 +236,461 @@ func (r *DAO) GetTotal(ctx context.Context, receiver interface{}, opts []opt.FnO
 	return total, nil
 }
 
+// FindOrCreate selects the record matching opts filter into rec or inserts defaults if there is no such record,
+// inserted record is returned in rec. Defaults must be of the same type as rec, rec itself is inserted if defaults
+// is nil. Concurrent insert is handled with ON CONFLICT DO NOTHING and retry of select, so the filter must match
+// a unique key of the table
+func (r *DAO) FindOrCreate(ctx context.Context, rec interface{}, opts []opt.FnOpt, defaults interface{}) (created bool, err error) {
+	if err := r.validateOpts(rec, opts); err != nil {
+		return false, err
+	}
+	opts = r.tenantOpts(ctx, rec, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return false, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	v := reflect.ValueOf(rec)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return false, pkgerr.NewBadRequestError(errors.New("rec must be pointer to struct"))
+	}
+	if defaults != nil {
+		dv := reflect.Indirect(reflect.ValueOf(defaults))
+		if dv.Type() != v.Elem().Type() {
+			return false, pkgerr.NewBadRequestError(fmt.Errorf("defaults must be of type %s, got %T", v.Elem().Type(), defaults))
+		}
+		v.Elem().Set(dv)
+	}
+	r.touchInserted(rec)
+	if err := r.setTenant(ctx, rec); err != nil {
+		return false, err
+	}
+
+	// select has to see the record inserted concurrently, so replicas are not used
+	created, err = r.db.WithContext(db.WithPrimary(ctx)).Model(rec).Apply(opt.ApplyFilter(opts...)).OnConflict("DO NOTHING").SelectOrInsert()
+	if err != nil {
+		return false, pkgerr.Convert(ctx, err)
+	}
+
+	return created, nil
+}
+
+// Exists checks whether any record matching opts exists in database
+func (r *DAO) Exists(ctx context.Context, model interface{}, opts []opt.FnOpt) (bool, error) {
+	if err := r.validateOpts(model, opts); err != nil {
+		return false, err
+	}
+	opts = r.tenantOpts(ctx, model, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return false, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	dbc := r.db.WithContext(ctx)
+	q := dbc.Model(model).Apply(opt.Apply(opts...)).ColumnExpr("1")
+
+	var exists bool
+	_, err = dbc.QueryOne(pg.Scan(&exists), "SELECT EXISTS (?)", q)
+	if err != nil {
+		return false, pkgerr.Convert(ctx, err)
+	}
+
+	return exists, nil
+}
+
+// Pluck selects values of the single column into dest slice according to opts
+func (r *DAO) Pluck(ctx context.Context, model interface{}, column string, dest interface{}, opts []opt.FnOpt) error {
+	if err := r.validateOpts(model, opts); err != nil {
+		return err
+	}
+	opts = r.tenantOpts(ctx, model, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	err = r.db.WithContext(ctx).Model(model).Apply(opt.Apply(opts...)).Column(column).Select(dest)
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+
+	return nil
+}
+
+// Aggregate calculates aggregate expressions over records according to opts filters
+func (r *DAO) Aggregate(ctx context.Context, model interface{}, opts []opt.FnOpt, aggs ...agg.Expression) (agg.Result, error) {
+	if err := r.validateOpts(model, opts); err != nil {
+		return nil, err
+	}
+	opts = r.tenantOpts(ctx, model, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return nil, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	if len(aggs) == 0 {
+		return nil, pkgerr.NewBadRequestError(errors.New("aggregate expressions cannot be empty"))
+	}
+
+	o := opt.New(opts...)
+	q := r.db.WithContext(ctx).Model(model).Apply(o.ApplyJoins()).Apply(o.ApplyFilter()).Apply(o.ApplyFn())
+
+	res := make(agg.Result, len(aggs))
+	values := make([]interface{}, 0, len(aggs))
+	for i, a := range aggs {
+		q.ColumnExpr(a.Expression(), a.Params()...)
+		values = append(values, &res[i])
+	}
+
+	if err := q.Select(values...); err != nil {
+		return nil, pkgerr.Convert(ctx, err)
+	}
+
+	return res, nil
+}
+
 // Update updates a record
 func (r *DAO) Update(ctx context.Context, rec interface{}, columns ...string) error {
-	columns = append(columns, r.updatedField)
+	if r.hooksTx(ctx, rec) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.Update(ctx, rec, columns...) })
+	}
+	ctx = r.hooksContext(ctx, rec)
+	r.touchUpdated(rec)
+	if err := r.runHooks(ctx, BeforeUpdate, rec); err != nil {
+		return err
+	}
+
+	columns = append(columns, r.updatedColumn(rec))
 	q := r.db.WithContext(ctx).Model(rec).Column(columns...)
 	// Slice not require additional filter
 	if reflect.ValueOf(rec).Elem().Type().Kind() != reflect.Slice {
 		q.WherePK()
 	}
-	_, err := q.Update()
+	r.tenantQuery(ctx, rec, q)
+	if err := r.updateVersioned(ctx, rec, q); err != nil {
+		return err
+	}
+	if err := r.invalidate(ctx, rec); err != nil {
+		return err
+	}
+
+	return r.runHooks(ctx, AfterUpdate, rec)
+}
+
+// updateVersioned runs update query q of rec, if versioning is enabled for the model, the version is incremented
+// and the record is updated only if its version is not changed, Conflict error is returned otherwise
+func (r *DAO) updateVersioned(ctx context.Context, rec interface{}, q *orm.Query) error {
+	f, fv, ok := r.versionField(rec)
+	if !ok {
+		if _, err := q.Update(); err != nil {
+			return pkgerr.Convert(ctx, err)
+		}
+		return nil
+	}
+
+	version := fv.Int()
+	fv.SetInt(version + 1)
+	q.Column(f.SQLName).Where("?TableAlias.? = ?", f.Column, version)
+	res, err := q.Update()
 	if err != nil {
+		fv.SetInt(version)
 		return pkgerr.Convert(ctx, err)
 	}
-
+	if res.RowsAffected() == 0 {
+		fv.SetInt(version)
+		return pkgerr.NewConflictError(fmt.Errorf("version %d of %T is outdated", version, rec))
+	}
 	return nil
 }
 
-// UpdateWhere updates a record with condition
-func (r *DAO) UpdateWhere(ctx context.Context, rec interface{}, opts []opt.FnOpt, setFieldValuePairs ...interface{}) error {
+// UpdateBulk updates setColumns of recs matched by keyColumns with a single `UPDATE ... FROM (VALUES ...)` statement
+// and returns count of updated records
+func (r *DAO) UpdateBulk(ctx context.Context, recs interface{}, keyColumns []string, setColumns ...string) (int64, error) {
+	if len(keyColumns) == 0 {
+		return 0, pkgerr.NewBadRequestError(errors.New("keyColumns cannot be empty"))
+	}
+	if len(setColumns) == 0 {
+		return 0, pkgerr.NewBadRequestError(errors.New("setColumns cannot be empty"))
+	}
+
+	v := reflect.ValueOf(recs)
+	if v.Kind() == reflect.Slice {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		recs, v = ptr.Interface(), ptr
+	}
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return 0, pkgerr.NewBadRequestError(errors.New("recs must be slice or pointer to slice"))
+	}
+	if v.Elem().Len() == 0 {
+		return 0, nil
+	}
+	if r.hooksTx(ctx, recs) {
+		var updated int64
+		err := r.WithTX(ctx, func(ctx context.Context) (err error) {
+			updated, err = r.UpdateBulk(ctx, recs, keyColumns, setColumns...)
+			return err
+		})
+		return updated, err
+	}
+	ctx = r.hooksContext(ctx, recs)
+	if err := r.runHooks(ctx, BeforeUpdate, recs); err != nil {
+		return 0, err
+	}
+
+	columns := make([]string, 0, len(setColumns)+len(keyColumns))
+	columns = append(append(columns, setColumns...), keyColumns...)
+	q := r.db.WithContext(ctx).Model(recs).Column(columns...)
+	updated := r.updatedColumn(recs)
+	setUpdated := true
+	for _, column := range setColumns {
+		q.Set("? = _data.?", pg.Ident(column), pg.Ident(column))
+		setUpdated = setUpdated && column != updated
+	}
+	if setUpdated {
+		q.Set("? = ?", pg.Ident(updated), time.Now())
+	}
+	for _, column := range keyColumns {
+		q.Where("?TableAlias.? = _data.?", pg.Ident(column), pg.Ident(column))
+	}
+	r.tenantQuery(ctx, recs, q)
+
+	res, err := q.Update()
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	if err := r.invalidate(ctx, recs); err != nil {
+		return 0, err
+	}
+
+	return int64(res.RowsAffected()), r.runHooks(ctx, AfterUpdate, recs)
+}
+
+// UpdateWhere updates records with condition and returns count of updated records
+func (r *DAO) UpdateWhere(ctx context.Context, rec interface{}, opts []opt.FnOpt, setFieldValuePairs ...interface{}) (int64, error) {
+	if err := r.validateOpts(rec, opts); err != nil {
+		return 0, err
+	}
+	opts = r.tenantOpts(ctx, rec, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
 	if len(setFieldValuePairs)&1 != 0 {
-		return pkgerr.NewInternalError(fmt.Errorf("UpdateWhere: setFieldValuePairs must be even, got %d", len(setFieldValuePairs)))
+		return 0, pkgerr.NewInternalError(fmt.Errorf("UpdateWhere: setFieldValuePairs must be even, got %d", len(setFieldValuePairs)))
 	}
-	setFieldValuePairs = append(setFieldValuePairs, r.updatedField, time.Now())
+	setFieldValuePairs = append(setFieldValuePairs, r.updatedColumn(rec), time.Now())
 	q := r.db.WithContext(ctx).Model(rec).Apply(opt.Apply(opts...))
 	for i := 0; i < len(setFieldValuePairs); i += 2 {
 		column, ok := setFieldValuePairs[i].(string)
 		if !ok {
-			return pkgerr.NewInternalError(fmt.Errorf("UpdateWhere: field must be string, got %T (%v)", setFieldValuePairs[i], setFieldValuePairs[i]))
+			return 0, pkgerr.NewInternalError(fmt.Errorf("UpdateWhere: field must be string, got %T (%v)", setFieldValuePairs[i], setFieldValuePairs[i]))
 		}
 		q.Set(column+" = ?", setFieldValuePairs[i+1])
 	}
-	_, err := q.Update()
+	var pks []string
+	q, scan := r.returningPKs(q, rec, &pks)
+	res, err := q.Update(scan...)
 	if err != nil {
-		return pkgerr.Convert(ctx, err)
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	if err := r.invalidatePKs(ctx, rec, pks); err != nil {
+		return 0, err
 	}
 
-	return nil
+	return int64(res.RowsAffected()), nil
 }
 
 // UpdateWithReturning updates a record
 func (r *DAO) UpdateWithReturning(ctx context.Context, rec interface{}, columns ...string) error {
-	columns = append(columns, r.updatedField)
-	_, err := r.db.WithContext(ctx).Model(rec).Column(columns...).WherePK().Returning("*").Update()
-	if err != nil {
-		return pkgerr.Convert(ctx, err)
+	if r.hooksTx(ctx, rec) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.UpdateWithReturning(ctx, rec, columns...) })
+	}
+	ctx = r.hooksContext(ctx, rec)
+	r.touchUpdated(rec)
+	if err := r.runHooks(ctx, BeforeUpdate, rec); err != nil {
+		return err
 	}
 
-	return nil
+	columns = append(columns, r.updatedColumn(rec))
+	q := r.db.WithContext(ctx).Model(rec).Column(columns...).WherePK().Returning("*")
+	if err := r.updateVersioned(ctx, rec, r.tenantQuery(ctx, rec, q)); err != nil {
+		return err
+	}
+	if err := r.invalidate(ctx, rec); err != nil {
+		return err
+	}
+
+	return r.runHooks(ctx, AfterUpdate, rec)
 }
 
 // Insert creates a new record
 func (r *DAO) Insert(ctx context.Context, rec ...interface{}) error {
+	if r.hooksTx(ctx, rec...) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.Insert(ctx, rec...) })
+	}
+	ctx = r.hooksContext(ctx, rec...)
+	r.touchInserted(rec...)
+	if err := r.setTenant(ctx, rec...); err != nil {
+		return err
+	}
+	if err := r.runHooks(ctx, BeforeInsert, rec...); err != nil {
+		return err
+	}
+
 	err := r.db.WithContext(ctx).Insert(rec...)
 	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
 
-	return nil
+	return r.runHooks(ctx, AfterInsert, rec...)
 }
 
 // SoftDelete marks record as deleted
 func (r *DAO) SoftDelete(ctx context.Context, rec DeletedSetter) error {
 	rec.SetDeleted(time.Now())
-	err := r.Update(ctx, rec, r.deletedField)
-	if err != nil {
-		return pkgerr.Convert(ctx, err)
-	}
+	return r.Update(ctx, rec, r.deletedColumn(rec))
+}
 
-	return nil
+// SoftDeleteWhere marks records matching opts as deleted and returns count of marked records,
+// already deleted records are left untouched
+func (r *DAO) SoftDeleteWhere(ctx context.Context, model interface{}, opts []opt.FnOpt) (int64, error) {
+	deleted := r.deletedColumn(model)
+	opts = append(append(make([]opt.FnOpt, 0, len(opts)+1), opts...), opt.IsNull(deleted))
+	return r.UpdateWhere(ctx, model, opts, deleted, time.Now())
+}
+
+// Restore unmarks soft deleted record
+func (r *DAO) Restore(ctx context.Context, rec DeletedClearer) error {
+	rec.ClearDeleted()
+	return r.Update(ctx, rec, r.deletedColumn(rec))
+}
+
+// RestoreWhere unmarks soft deleted records matching opts and returns count of restored records
+func (r *DAO) RestoreWhere(ctx context.Context, model interface{}, opts []opt.FnOpt) (int64, error) {
+	deleted := r.deletedColumn(model)
+	opts = append(append(make([]opt.FnOpt, 0, len(opts)+1), opts...), opt.NotNull(deleted))
+	return r.UpdateWhere(ctx, model, opts, deleted, nil)
 }
 
 // HardDelete removes record from database
 func (r *DAO) HardDelete(ctx context.Context, rec interface{}) error {
-	err := r.db.WithContext(ctx).Delete(rec)
+	if r.hooksTx(ctx, rec) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.HardDelete(ctx, rec) })
+	}
+	ctx = r.hooksContext(ctx, rec)
+	if err := r.runHooks(ctx, BeforeDelete, rec); err != nil {
+		return err
+	}
+
+	q := r.db.WithContext(ctx).Model(rec).WherePK()
+	_, err := r.tenantQuery(ctx, rec, q).Delete()
 	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
+	if err := r.invalidate(ctx, rec); err != nil {
+		return err
+	}
 
-	return nil
+	return r.runHooks(ctx, AfterDelete, rec)
 }
 
 // HardDeleteWhere removes record from database
 func (r *DAO) HardDeleteWhere(ctx context.Context, rec interface{}, opts []opt.FnOpt) error {
-	_, err := r.db.WithContext(ctx).Model(rec).Apply(opt.ApplyFilter(opts...)).Delete()
+	_, err := r.HardDeleteWhereCount(ctx, rec, opts)
+	return err
+}
+
+// HardDeleteWhereCount removes records from database and returns count of removed records
+func (r *DAO) HardDeleteWhereCount(ctx context.Context, rec interface{}, opts []opt.FnOpt) (int64, error) {
+	if err := r.validateOpts(rec, opts); err != nil {
+		return 0, err
+	}
+	opts = r.tenantOpts(ctx, rec, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	var pks []string
+	q, scan := r.returningPKs(r.db.WithContext(ctx).Model(rec).Apply(opt.ApplyFilter(opts...)), rec, &pks)
+	res, err := q.Delete(scan...)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	if err := r.invalidatePKs(ctx, rec, pks); err != nil {
+		return 0, err
+	}
+
+	return int64(res.RowsAffected()), nil
+}
+
+// HardDeleteReturning removes records matching opts from database and scans them into receiver,
+// receiver must be pointer to empty slice
+func (r *DAO) HardDeleteReturning(ctx context.Context, receiver interface{}, opts []opt.FnOpt) error {
+	if r.hooksTx(ctx, receiver) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.HardDeleteReturning(ctx, receiver, opts) })
+	}
+	ctx = r.hooksContext(ctx, receiver)
+	if err := r.validateOpts(receiver, opts); err != nil {
+		return err
+	}
+	opts = r.tenantOpts(ctx, receiver, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
 	if err != nil {
 		return pkgerr.Convert(ctx, err)
 	}
+	defer done()
 
-	return nil
+	v := reflect.ValueOf(receiver)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return pkgerr.NewBadRequestError(errors.New("receiver must be pointer to slice"))
+	}
+	if v.Elem().Len() > 0 {
+		return pkgerr.NewBadRequestError(errors.New("receiver must be empty"))
+	}
+
+	_, err = r.db.WithContext(ctx).Model(receiver).Apply(opt.ApplyFilter(opts...)).Returning("*").Delete()
+	if err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	if err := r.invalidate(ctx, receiver); err != nil {
+		return err
+	}
+
+	return r.runHooks(ctx, AfterDelete, receiver)
+}
+
+// UpsertOpts customizes ON CONFLICT clause of upsert
+type UpsertOpts struct {
+	// ConflictWhere is a predicate of partial unique index used as conflict target, e.g. `deleted IS NULL`
+	ConflictWhere string
+	// UpdateWhere is a condition of conflicting row update, e.g. `EXCLUDED.updated > setting.updated`,
+	// rows not matching the condition are left untouched
+	UpdateWhere string
 }
 
 // Upsert inserts recs, on conflict update columns
 func (r *DAO) Upsert(ctx context.Context, recs interface{}, keys []string, columns ...string) error {
+	return r.UpsertWithOpts(ctx, recs, keys, UpsertOpts{}, columns...)
+}
+
+// UpsertWithOpts inserts recs, on conflict update columns, conflict clause is customized with uo
+func (r *DAO) UpsertWithOpts(ctx context.Context, recs interface{}, keys []string, uo UpsertOpts, columns ...string) error {
 	if len(keys) == 0 {
 		return pkgerr.NewBadRequestError(errors.New("keys cannot be empty"))
 	}
+	if r.hooksTx(ctx, recs) {
+		return r.WithTX(ctx, func(ctx context.Context) error { return r.UpsertWithOpts(ctx, recs, keys, uo, columns...) })
+	}
+	ctx = r.hooksContext(ctx, recs)
 
 	goNames := make([]string, 0, len(keys))
 	if t := orm.GetTable(getType(recs)); t != nil {
@@ -248,14 +719,103 @@ func (r *DAO) Upsert(ctx context.Context, recs interface{}, keys []string, colum
 		return pkgerr.NewBadRequestError(errors.New("models cannot be empty"))
 	}
 
-	q := r.db.WithContext(ctx).Model(&models).OnConflict("(" + strings.Join(keys, ",") + ") DO UPDATE")
+	r.touchInserted(models...)
+	if err := r.setTenant(ctx, models...); err != nil {
+		return err
+	}
+	if err := r.runHooks(ctx, BeforeInsert, models...); err != nil {
+		return err
+	}
+	if updated := r.updatedColumn(recs); len(columns) > 0 && r.hasTimestamps(recs) && !containsString(columns, updated) {
+		columns = append(columns, updated)
+	}
+
+	target := "(" + strings.Join(keys, ",") + ")"
+	if uo.ConflictWhere != "" {
+		target += " WHERE " + uo.ConflictWhere
+	}
+	q := r.db.WithContext(ctx).Model(&models).OnConflict(target + " DO UPDATE")
 
 	for _, column := range columns {
 		q = q.Set(column + " = EXCLUDED." + column)
 	}
+	if uo.UpdateWhere != "" {
+		q = q.Where(uo.UpdateWhere)
+	}
 
-	_, err := q.Insert()
-	return err
+	if _, err := q.Insert(); err != nil {
+		return err
+	}
+	if err := r.invalidate(ctx, models...); err != nil {
+		return err
+	}
+
+	return r.runHooks(ctx, AfterInsert, models...)
+}
+
+// InsertIgnoreConflict inserts recs skipping those conflicting by keys and returns count of inserted records,
+// conflict with any unique constraint is skipped if keys are empty
+func (r *DAO) InsertIgnoreConflict(ctx context.Context, recs interface{}, keys ...string) (int64, error) {
+	if r.hooksTx(ctx, recs) {
+		var inserted int64
+		err := r.WithTX(ctx, func(ctx context.Context) (err error) {
+			inserted, err = r.InsertIgnoreConflict(ctx, recs, keys...)
+			return err
+		})
+		return inserted, err
+	}
+	ctx = r.hooksContext(ctx, recs)
+
+	target := "DO NOTHING"
+	if len(keys) > 0 {
+		target = "(" + strings.Join(keys, ",") + ") " + target
+	}
+
+	if v := reflect.ValueOf(recs); v.Kind() == reflect.Slice {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		recs = ptr.Interface()
+	}
+	r.touchInserted(recs)
+	if err := r.setTenant(ctx, recs); err != nil {
+		return 0, err
+	}
+	if err := r.runHooks(ctx, BeforeInsert, recs); err != nil {
+		return 0, err
+	}
+
+	if r.hasEventHooks(recs, AfterInsert) {
+		// records are inserted one by one to call AfterInsert hooks for inserted ones only
+		var inserted int64
+		err := eachRecord(recs, func(rec interface{}) error {
+			res, err := r.db.WithContext(ctx).Model(rec).OnConflict(target).Insert()
+			if err != nil {
+				return pkgerr.Convert(ctx, err)
+			}
+			if res.RowsAffected() == 0 {
+				return nil
+			}
+			inserted++
+			return r.runHooks(ctx, AfterInsert, rec)
+		})
+		return inserted, err
+	}
+
+	res, err := r.db.WithContext(ctx).Model(recs).OnConflict(target).Insert()
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+
+	return int64(res.RowsAffected()), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
 
 func getType(models interface{}) reflect.Type {
@@ -310,6 +870,9 @@ func GetUniqueModels(models interface{}, f func(model interface{}) string) []int
 	return unique
 }
 
-func newTxContext(ctx context.Context, tx *pg.Tx) context.Context {
-	return context.WithValue(ctx, &db.TxKey, tx)
+func (r *DAO) validateOpts(model interface{}, opts []opt.FnOpt) error {
+	if !r.optsValidation {
+		return nil
+	}
+	return opt.Validate(model, opts...)
 }
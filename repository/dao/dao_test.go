@@ -6,7 +6,10 @@ package dao
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-pg/pg/v10"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,11 +17,16 @@ import (
 
 	"github.com/alexandr-kononykhin-vay/postgres/repository/filter"
 
+	db "github.com/alexandr-kononykhin-vay/postgres"
 	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/agg"
 	"github.com/alexandr-kononykhin-vay/postgres/repository/dao/test"
 	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
 
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestRepository_WithTX(t *testing.T) {
@@ -321,8 +329,13 @@ func TestRepository_UpdateWhere(t *testing.T) {
 
 	updateNameValue := "111"
 
-	err := repo.UpdateWhere(context.Background(), &Agent{}, opt.List(opt.Eq("name", updateNameValue)), "inn", "222")
+	cnt, err := repo.UpdateWhere(context.Background(), &Agent{}, opt.List(opt.Eq("name", updateNameValue)), "inn", "222")
 	assert.Nil(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	cnt, err = repo.UpdateWhere(context.Background(), &Agent{}, opt.List(opt.Eq("name", "none")), "inn", "222")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
 
 	var gotList []*Agent
 	err = testDb.Model(&gotList).Select()
@@ -337,6 +350,529 @@ func TestRepository_UpdateWhere(t *testing.T) {
 	}
 }
 
+func TestRepository_UpdateBulk(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	ts := time.Now().Add(-time.Hour)
+	err := testDb.Insert(
+		&Setting{ID: 1, AgentID: 1, Key: "lang", Value: "en", Updated: ts},
+		&Setting{ID: 2, AgentID: 1, Key: "tz", Value: "UTC", Updated: ts},
+		&Setting{ID: 3, AgentID: 2, Key: "lang", Value: "en", Updated: ts},
+	)
+	assert.Nil(t, err)
+
+	cnt, err := repo.UpdateBulk(context.Background(), []Setting{
+		{AgentID: 1, Key: "lang", Value: "ru"},
+		{AgentID: 1, Key: "tz", Value: "CET"},
+		{AgentID: 3, Key: "lang", Value: "de"},
+	}, []string{"agent_id", "key"}, "value")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	var got []*Setting
+	err = testDb.Model(&got).Order("id").Select()
+	assert.NoError(t, err)
+	assert.Equal(t, "ru", got[0].Value)
+	assert.Equal(t, "CET", got[1].Value)
+	assert.Equal(t, "en", got[2].Value)
+	assert.True(t, got[0].Updated.Unix() > ts.Unix())
+}
+
+func TestRepository_FindOrCreate(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	err := testDb.Insert(&Setting{ID: 1, AgentID: 1, Key: "lang", Value: "en"})
+	assert.Nil(t, err)
+
+	t.Run("Found", func(t *testing.T) {
+		var rec Setting
+		created, err := repo.FindOrCreate(context.Background(), &rec,
+			opt.List(opt.Eq("agent_id", 1), opt.Eq("key", "lang")), &Setting{AgentID: 1, Key: "lang", Value: "ru"})
+
+		assert.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, int64(1), rec.ID)
+		assert.Equal(t, "en", rec.Value)
+	})
+
+	t.Run("Created", func(t *testing.T) {
+		var rec Setting
+		created, err := repo.FindOrCreate(context.Background(), &rec,
+			opt.List(opt.Eq("agent_id", 2), opt.Eq("key", "lang")), Setting{AgentID: 2, Key: "lang", Value: "ru"})
+
+		assert.NoError(t, err)
+		assert.True(t, created)
+		assert.NotZero(t, rec.ID)
+		assert.Equal(t, "ru", rec.Value)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		g, gCtx := errgroup.WithContext(context.Background())
+		createdCnt := int32(0)
+		for i := 0; i < 5; i++ {
+			g.Go(func() error {
+				rec := &Setting{AgentID: 3, Key: "lang", Value: "de"}
+				created, err := repo.FindOrCreate(gCtx, rec, opt.List(opt.Eq("agent_id", 3), opt.Eq("key", "lang")), nil)
+				if created {
+					atomic.AddInt32(&createdCnt, 1)
+				}
+				return err
+			})
+		}
+
+		assert.NoError(t, g.Wait())
+		assert.Equal(t, int32(1), createdCnt)
+	})
+}
+
+func TestRepository_HardDeleteWhereCount(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "111"},
+		&Agent{ID: 3, Name: "222"},
+	)
+	assert.Nil(t, err)
+
+	cnt, err := repo.HardDeleteWhereCount(context.Background(), &Agent{}, opt.List(opt.Eq("name", "111")))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	cnt, err = repo.HardDeleteWhereCount(context.Background(), &Agent{}, opt.List(opt.Eq("name", "111")))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func TestRepository_HardDeleteReturning(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "111"},
+		&Agent{ID: 3, Name: "222"},
+	)
+	assert.Nil(t, err)
+
+	var deleted []*Agent
+	err = repo.HardDeleteReturning(context.Background(), &deleted, opt.List(opt.Eq("name", "111")))
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 2)
+	for _, rec := range deleted {
+		assert.Equal(t, "111", rec.Name)
+	}
+
+	total, err := repo.GetTotal(context.Background(), &Agent{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+}
+
+func TestRepository_SoftDeleteWhere(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	ts := time.Now().Add(-time.Hour)
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "111", Deleted: &ts},
+		&Agent{ID: 3, Name: "222"},
+	)
+	assert.Nil(t, err)
+
+	cnt, err := repo.SoftDeleteWhere(context.Background(), &Agent{}, opt.List(opt.Eq("name", "111")))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	var got []*Agent
+	err = repo.FindList(context.Background(), &got, opt.List(opt.Asc("id")))
+	assert.NoError(t, err)
+	assert.NotNil(t, got[0].Deleted)
+	assert.True(t, got[0].Updated.Unix() >= got[0].Deleted.Unix())
+	assert.Equal(t, ts.Unix(), got[1].Deleted.Unix())
+	assert.Nil(t, got[2].Deleted)
+}
+
+func TestRepository_Restore(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	ts := time.Now().Add(-time.Hour)
+	agents := []*Agent{
+		{ID: 1, Name: "111", Deleted: &ts},
+		{ID: 2, Name: "222", Deleted: &ts},
+		{ID: 3, Name: "222", Deleted: &ts},
+		{ID: 4, Name: "222"},
+	}
+	for _, agent := range agents {
+		err := testDb.Insert(agent)
+		assert.Nil(t, err)
+	}
+
+	err := repo.Restore(context.Background(), agents[0])
+	assert.NoError(t, err)
+	assert.Nil(t, agents[0].Deleted)
+
+	cnt, err := repo.RestoreWhere(context.Background(), &Agent{}, opt.List(opt.Eq("name", "222")))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cnt)
+
+	total, err := repo.GetTotal(context.Background(), &Agent{}, opt.List(opt.IsNull("deleted")))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+}
+
+func TestRepository_Timestamps(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	ts := time.Now().Add(-time.Second)
+	doc := &Document{ID: 1, Title: "draft"}
+	err := repo.Insert(context.Background(), doc)
+	assert.NoError(t, err)
+	assert.True(t, doc.CreatedAt.After(ts))
+	assert.Equal(t, doc.CreatedAt, doc.UpdatedAt)
+
+	created := doc.CreatedAt
+	doc.Title = "final"
+	err = repo.Update(context.Background(), doc, "title")
+	assert.NoError(t, err)
+	assert.Equal(t, created, doc.CreatedAt)
+	assert.True(t, doc.UpdatedAt.After(created))
+
+	err = repo.Upsert(context.Background(), []*Document{{ID: 1, Title: "upserted"}, {ID: 2, Title: "new"}}, []string{"id"}, "title")
+	assert.NoError(t, err)
+
+	var got []*Document
+	err = testDb.Model(&got).Order("id").Select()
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, created.Unix(), got[0].CreatedAt.Unix())
+	assert.True(t, got[0].UpdatedAt.After(doc.UpdatedAt))
+	assert.False(t, got[1].CreatedAt.IsZero())
+}
+
+func TestRepository_Hooks(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	var events []string
+	record := func(event string) HookFn {
+		return func(ctx context.Context, rec interface{}) error {
+			events = append(events, fmt.Sprintf("%s %d", event, rec.(*Document).ID))
+			return nil
+		}
+	}
+	repo.RegisterHook(&Document{}, BeforeInsert, func(ctx context.Context, rec interface{}) error {
+		doc := rec.(*Document)
+		if doc.Title == "" {
+			return pkgerr.NewBadRequestError(errors.New("title is required"))
+		}
+		doc.Title = strings.TrimSpace(doc.Title)
+		return nil
+	})
+	repo.RegisterHook(Document{}, AfterInsert, record("inserted"))
+	repo.RegisterHook([]*Document{}, AfterUpdate, record("updated"))
+	repo.RegisterHook(&Document{}, AfterDelete, record("deleted"))
+
+	docs := []*Document{{ID: 1, Title: " first "}, {ID: 2, Title: "second"}}
+	err := repo.Insert(context.Background(), &docs)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", docs[0].Title)
+
+	err = repo.Insert(context.Background(), &Document{ID: 3})
+	assert.True(t, pkgerr.IsBadRequest(err))
+
+	err = repo.Update(context.Background(), docs[1], "title")
+	assert.NoError(t, err)
+
+	err = repo.HardDelete(context.Background(), docs[0])
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"inserted 1", "inserted 2", "updated 2", "deleted 1"}, events)
+
+	total, err := repo.GetTotal(context.Background(), &Document{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+}
+
+func TestTenantFromContext(t *testing.T) {
+	_, ok := TenantFromContext(WithStatementTimeout(db.WithPrimary(context.Background()), time.Second))
+	assert.False(t, ok)
+
+	ctx := WithStatementTimeout(db.WithPrimary(WithTenant(context.Background(), 42)), time.Second)
+	tenantID, ok := TenantFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 42, tenantID)
+}
+
+func TestRepository_Tenant(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+	repo.SetTenantColumn("agent_id")
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Setting{ID: 1, AgentID: 1, Key: "lang", Value: "en"},
+		&Setting{ID: 2, AgentID: 2, Key: "lang", Value: "en"},
+	)
+	assert.Nil(t, err)
+
+	ctx := WithTenant(context.Background(), 1)
+
+	rec := &Setting{Key: "tz", Value: "UTC"}
+	err = repo.Insert(ctx, rec)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rec.AgentID)
+
+	var settings []*Setting
+	err = repo.FindList(ctx, &settings, opt.List(opt.Asc("id")))
+	assert.NoError(t, err)
+	assert.Len(t, settings, 2)
+	for _, setting := range settings {
+		assert.Equal(t, int64(1), setting.AgentID)
+	}
+
+	cnt, err := repo.UpdateWhere(ctx, &Setting{}, opt.List(opt.Eq("key", "lang")), "value", "ru")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	other := &Setting{ID: 2, AgentID: 2, Key: "lang", Value: "de"}
+	err = repo.Update(ctx, other, "value")
+	assert.NoError(t, err)
+	err = repo.FindOne(context.Background(), other, opt.List(opt.Eq("id", 2)))
+	assert.NoError(t, err)
+	assert.Equal(t, "en", other.Value)
+
+	total, err := repo.GetTotal(ctx, &Agent{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestLocalSettingsFromContext(t *testing.T) {
+	ctx := WithLocalSetting(context.Background(), "app.user_id", "42")
+	ctx = WithLocalSetting(WithTenant(WithLockTimeout(ctx, time.Second), 1), "app.role", "admin")
+
+	assert.Equal(t, []LocalSetting{{Name: "app.user_id", Value: "42"}, {Name: "app.role", Value: "admin"}},
+		LocalSettingsFromContext(ctx))
+	_, ok := LockTimeoutFromContext(ctx)
+	assert.True(t, ok)
+}
+
+func TestRepository_WithTX_LocalSettings(t *testing.T) {
+	repo := New(testDb)
+	repo.AddLocalSettings(func(ctx context.Context) []LocalSetting {
+		return []LocalSetting{{Name: "app.tenant", Value: "t1"}}
+	})
+
+	ctx := WithLocalSetting(context.Background(), "app.user_id", "42")
+	err := repo.WithTX(ctx, func(ctx context.Context) error {
+		var userID, tenant string
+		_, err := repo.DB().WithContext(ctx).QueryOne(pg.Scan(&userID, &tenant),
+			"SELECT current_setting('app.user_id'), current_setting('app.tenant')")
+		assert.NoError(t, err)
+		assert.Equal(t, "42", userID)
+		assert.Equal(t, "t1", tenant)
+		return err
+	})
+	assert.NoError(t, err)
+
+	var userID string
+	_, err = testDb.QueryOne(pg.Scan(&userID), "SELECT coalesce(current_setting('app.user_id', true), '')")
+	assert.NoError(t, err)
+	assert.Equal(t, "", userID)
+}
+
+func TestTimeoutFromContext(t *testing.T) {
+	ctx := WithLockTimeout(WithStatementTimeout(context.Background(), 30*time.Second), time.Second)
+
+	statement, ok := StatementTimeoutFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, statement)
+	lock, ok := LockTimeoutFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, lock)
+}
+
+func TestRepository_Timeout(t *testing.T) {
+	repo := New(testDb)
+	slow := opt.Where("pg_sleep(0.2) IS NOT NULL")
+
+	var agents []*Agent
+	err := repo.FindList(context.Background(), &agents, opt.List(slow, opt.Timeout(20*time.Millisecond)))
+	assert.Error(t, err)
+
+	ctx := WithStatementTimeout(context.Background(), 20*time.Millisecond)
+	err = repo.FindList(ctx, &agents, opt.List(slow))
+	assert.Error(t, err)
+
+	err = repo.WithTX(ctx, func(ctx context.Context) error {
+		var timeout string
+		_, err := repo.DB().WithContext(ctx).QueryOne(pg.Scan(&timeout), "SHOW statement_timeout")
+		assert.NoError(t, err)
+		assert.Equal(t, "20ms", timeout)
+		return repo.FindList(ctx, &agents, opt.List(slow))
+	})
+	assert.Error(t, err)
+
+	err = repo.WithTX(context.Background(), func(ctx context.Context) error {
+		if err := repo.FindList(ctx, &agents, opt.List(opt.Timeout(time.Second))); err != nil {
+			return err
+		}
+		var timeout string
+		_, err := repo.DB().WithContext(ctx).QueryOne(pg.Scan(&timeout), "SHOW statement_timeout")
+		assert.Equal(t, "0", timeout)
+		return err
+	})
+	assert.NoError(t, err)
+}
+
+func TestRepository_Explain(t *testing.T) {
+	repo := New(testDb)
+
+	plan, err := repo.Explain(context.Background(), &[]*Agent{}, opt.List(opt.Eq("name", "agent")))
+	assert.NoError(t, err)
+	assert.Contains(t, plan, `"Plan"`)
+	assert.Contains(t, plan, `"Relation Name": "agent"`)
+	assert.NotContains(t, plan, `"Actual Rows"`)
+
+	plan, err = repo.ExplainAnalyze(context.Background(), &[]*Agent{}, opt.List(opt.Eq("name", "agent")))
+	assert.NoError(t, err)
+	assert.Contains(t, plan, `"Actual Rows"`)
+}
+
+func TestRepository_Cache(t *testing.T) {
+	test.CleanDB(testDb, t)
+	ctx := context.Background()
+	cache := NewMemoryCache()
+	repo := New(testDb)
+	repo.WithCache(cache, time.Minute)
+	other := New(testDb)
+	other.WithCache(NewMemoryCache(), time.Minute)
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() { _ = other.ListenCacheInvalidation(listenCtx) }()
+
+	rec := &Agent{Name: "cached"}
+	assert.NoError(t, repo.Insert(ctx, rec))
+
+	got := &Agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, 1, cache.Len())
+	assert.NoError(t, other.FindOne(ctx, &Agent{}, opt.List(opt.Eq("id", rec.ID))))
+
+	// change bypassing the DAO is not seen until invalidation
+	_, err := testDb.Exec(`UPDATE "agent" SET "name" = 'bypassed' WHERE "id" = ?`, rec.ID)
+	assert.NoError(t, err)
+	got = &Agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, "cached", got.Name)
+
+	// records of other schema are not served from the cache
+	got = &Agent{}
+	err = repo.FindOne(db.ContextWithSearchPath(ctx, "other_schema"), got, opt.List(opt.Eq("id", rec.ID)))
+	assert.Error(t, err)
+
+	// not cacheable queries go to database
+	got = &Agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID), opt.Columns("id", "name"))))
+	assert.Equal(t, "bypassed", got.Name)
+
+	rec.Name = "updated"
+	assert.NoError(t, repo.Update(ctx, rec, "name"))
+	assert.Equal(t, 0, cache.Len())
+	got = &Agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, "updated", got.Name)
+
+	assert.Eventually(t, func() bool {
+		got := &Agent{}
+		err := other.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID)))
+		return err == nil && got.Name == "updated"
+	}, time.Second, 10*time.Millisecond)
+
+	// within transaction the record is removed from the cache after commit
+	assert.Equal(t, 1, cache.Len())
+	assert.NoError(t, repo.WithTX(ctx, func(ctx context.Context) error {
+		rec.Name = "committed"
+		if err := repo.Update(ctx, rec, "name"); err != nil {
+			return err
+		}
+		assert.Equal(t, 1, cache.Len())
+		return nil
+	}))
+	assert.Equal(t, 0, cache.Len())
+
+	// records changed by operations with conditions are invalidated by returned primary keys
+	assert.NoError(t, repo.FindOne(ctx, &Agent{}, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, 1, cache.Len())
+	n, err := repo.UpdateWhere(ctx, &Agent{}, opt.List(opt.Eq("name", "committed")), "name", "where")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, 0, cache.Len())
+	got = &Agent{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, "where", got.Name)
+
+	assert.Equal(t, 1, cache.Len())
+	n, err = repo.HardDeleteWhereCount(ctx, &Agent{}, opt.List(opt.Eq("name", "where")))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, 0, cache.Len())
+	err = repo.FindOne(ctx, &Agent{}, opt.List(opt.Eq("id", rec.ID)))
+	assert.True(t, pkgerr.IsNotFound(err))
+}
+
+func TestRepository_ModelFields(t *testing.T) {
+	test.CleanDB(testDb, t)
+	ctx := context.Background()
+	repo := New(testDb)
+	repo.RegisterModelFields(&Article{}, ModelFields{
+		Created: "created_on",
+		Updated: "modified_on",
+		Deleted: "removed_on",
+		Version: "version",
+	})
+
+	rec := &Article{Title: "first"}
+	assert.NoError(t, repo.Insert(ctx, rec))
+	assert.False(t, rec.CreatedOn.IsZero())
+	assert.NotNil(t, rec.ModifiedOn)
+
+	stale := &Article{}
+	assert.NoError(t, repo.FindOne(ctx, stale, opt.List(opt.Eq("id", rec.ID))))
+
+	rec.Title = "second"
+	assert.NoError(t, repo.Update(ctx, rec, "title"))
+	assert.Equal(t, 1, rec.Version)
+
+	stale.Title = "stale"
+	err := repo.Update(ctx, stale, "title")
+	assert.True(t, pkgerr.IsConflict(err))
+	assert.Equal(t, 0, stale.Version)
+
+	assert.NoError(t, repo.SoftDelete(ctx, rec))
+	assert.Equal(t, 2, rec.Version)
+
+	err = repo.SoftDelete(ctx, stale)
+	assert.True(t, pkgerr.IsConflict(err))
+	assert.Equal(t, 0, stale.Version)
+
+	got := &Article{}
+	assert.NoError(t, repo.FindOne(ctx, got, opt.List(opt.Eq("id", rec.ID))))
+	assert.Equal(t, "second", got.Title)
+	assert.NotNil(t, got.RemovedOn)
+
+	n, err := repo.RestoreWhere(ctx, &Article{}, opt.List(opt.Eq("id", rec.ID)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
 func TestRepository_SelectValue(t *testing.T) {
 	test.CleanDB(testDb, t)
 
@@ -483,3 +1019,898 @@ func TestRepository_UpsertSliceWithDoubles(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, name12, got.Name)
 }
+
+func TestRepository_UpsertConflictWhere(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	deleted := time.Now()
+	err := testDb.Insert(
+		&Setting{ID: 1, AgentID: 1, Key: "lang", Value: "de", Deleted: &deleted},
+		&Setting{ID: 2, AgentID: 1, Key: "lang", Value: "en"},
+	)
+	assert.Nil(t, err)
+
+	err = rep.UpsertWithOpts(context.Background(), []*Setting{{AgentID: 1, Key: "lang", Value: "ru"}},
+		[]string{"agent_id", "key"}, UpsertOpts{ConflictWhere: "deleted IS NULL"}, "value")
+	assert.NoError(t, err)
+
+	var got []*Setting
+	err = testDb.Model(&got).Order("id").Select()
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "de", got[0].Value)
+	assert.Equal(t, "ru", got[1].Value)
+}
+
+func TestRepository_UpsertUpdateWhere(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	ts := time.Now().Add(-time.Hour)
+	err := testDb.Insert(
+		&Setting{ID: 1, AgentID: 1, Key: "lang", Value: "en", Updated: ts},
+		&Setting{ID: 2, AgentID: 1, Key: "tz", Value: "UTC", Updated: ts},
+	)
+	assert.Nil(t, err)
+
+	recs := []*Setting{
+		{AgentID: 1, Key: "lang", Value: "ru", Updated: ts.Add(time.Minute)},
+		{AgentID: 1, Key: "tz", Value: "CET", Updated: ts.Add(-time.Minute)},
+	}
+	err = rep.UpsertWithOpts(context.Background(), recs, []string{"agent_id", "key"},
+		UpsertOpts{ConflictWhere: "deleted IS NULL", UpdateWhere: "EXCLUDED.updated > setting.updated"}, "value", "updated")
+	assert.NoError(t, err)
+
+	var got []*Setting
+	err = testDb.Model(&got).Order("id").Select()
+	assert.NoError(t, err)
+	assert.Len(t, got, 2)
+	assert.Equal(t, "ru", got[0].Value)
+	assert.Equal(t, "UTC", got[1].Value)
+}
+
+func TestRepository_InsertIgnoreConflict(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(&Agent{ID: 1, Name: "111"})
+	assert.Nil(t, err)
+
+	cnt, err := rep.InsertIgnoreConflict(context.Background(), []*Agent{{ID: 1, Name: "new"}, {ID: 2, Name: "222"}}, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), cnt)
+
+	var names []string
+	err = rep.Pluck(context.Background(), &Agent{}, "name", &names, opt.List(opt.Asc("id")))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"111", "222"}, names)
+
+	t.Run("Hooks", func(t *testing.T) {
+		var inserted []int64
+		rep.RegisterHook(&Agent{}, AfterInsert, func(ctx context.Context, rec interface{}) error {
+			inserted = append(inserted, rec.(*Agent).ID)
+			return nil
+		})
+
+		cnt, err := rep.InsertIgnoreConflict(context.Background(), []*Agent{{ID: 2, Name: "new"}, {ID: 3, Name: "333"}}, "id")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), cnt)
+		assert.Equal(t, []int64{3}, inserted)
+	})
+}
+
+func TestRepository_BulkLoad(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	serviceLevel := ""
+	recs := []*Agent{
+		{ID: 111, Name: `name "with" quotes`, State: AgentStateRegistered, INN: "111"},
+		{ID: 222, Name: "name,with\ncomma", State: AgentStateApproved, ServiceLevel: &serviceLevel},
+	}
+
+	loaded, err := rep.BulkLoad(context.Background(), recs)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, loaded)
+
+	got := &Agent{ID: 111}
+	err = testDb.Select(got)
+	assert.NoError(t, err)
+	assert.Equal(t, recs[0].Name, got.Name)
+	assert.Equal(t, "111", got.INN)
+	assert.Nil(t, got.ServiceLevel)
+	assert.False(t, got.Created.IsZero())
+
+	got = &Agent{ID: 222}
+	err = testDb.Select(got)
+	assert.NoError(t, err)
+	assert.Equal(t, recs[1].Name, got.Name)
+	assert.Equal(t, AgentStateApproved, got.State)
+	assert.NotNil(t, got.ServiceLevel)
+	assert.Equal(t, "", *got.ServiceLevel)
+
+	t.Run("Unknown column", func(t *testing.T) {
+		_, err := rep.BulkLoad(context.Background(), recs, "unknown")
+		assert.True(t, pkgerr.IsBadRequest(err))
+	})
+}
+
+func TestRepository_FindEach(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Agent{ID: 3, Name: "333"},
+	)
+	assert.Nil(t, err)
+
+	t.Run("All records", func(t *testing.T) {
+		var names []string
+		err := rep.FindEach(context.Background(), &Agent{}, opt.List(opt.Gt("id", 1), opt.Desc("id")), func(rec interface{}) error {
+			names = append(names, rec.(*Agent).Name)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"333", "222"}, names)
+	})
+
+	t.Run("Stop on error", func(t *testing.T) {
+		stopErr := errors.New("stop")
+		calls := 0
+		err := rep.FindEach(context.Background(), &Agent{}, nil, func(rec interface{}) error {
+			calls++
+			return stopErr
+		})
+
+		assert.Equal(t, stopErr, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestRepository_Exists_Pluck(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111", INN: "777"},
+		&Agent{ID: 2, Name: "222", INN: "777"},
+		&Agent{ID: 3, Name: "333"},
+	)
+	assert.Nil(t, err)
+
+	t.Run("Exists", func(t *testing.T) {
+		exists, err := rep.Exists(context.Background(), &Agent{}, opt.List(opt.Eq("name", "222")))
+		assert.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = rep.Exists(context.Background(), &Agent{}, opt.List(opt.Eq("name", "444")))
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Pluck", func(t *testing.T) {
+		var ids []int64
+		err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(opt.Eq("inn", "777"), opt.Asc("id")))
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{1, 2}, ids)
+	})
+}
+
+func TestRepository_Aggregate(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111", INN: "777"},
+		&Agent{ID: 2, Name: "222", INN: "777"},
+		&Agent{ID: 5, Name: "333"},
+	)
+	assert.Nil(t, err)
+
+	t.Run("With filter", func(t *testing.T) {
+		res, err := rep.Aggregate(context.Background(), &Agent{}, opt.List(opt.Eq("inn", "777"), opt.Desc("id")),
+			agg.Sum("id"), agg.Max("id"), agg.Count("*"), agg.Max("created"))
+		assert.NoError(t, err)
+
+		sum, err := res.Int64(0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), sum)
+
+		maxID, err := res.Int64(1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), maxID)
+
+		cnt, err := res.Int64(2)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), cnt)
+
+		created, err := res.Time(3)
+		assert.NoError(t, err)
+		assert.False(t, created.IsZero())
+	})
+
+	t.Run("Empty set", func(t *testing.T) {
+		res, err := rep.Aggregate(context.Background(), &Agent{}, opt.List(opt.Eq("inn", "000")), agg.Avg("id"))
+		assert.NoError(t, err)
+		assert.True(t, res.IsNull(0))
+	})
+}
+
+func TestRepository_FindList_GroupBy(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111", State: AgentStateApproved},
+		&Agent{ID: 2, Name: "222", State: AgentStateApproved},
+		&Agent{ID: 3, Name: "333", State: AgentStateRegistered},
+	)
+	assert.Nil(t, err)
+
+	type stateReport struct {
+		tableName struct{} `pg:"agent"`
+		State     string   `pg:"state"`
+		MaxID     int64    `pg:"max_id"`
+	}
+
+	var recs []*stateReport
+	err = rep.FindList(context.Background(), &recs, opt.List(
+		opt.Columns("state"),
+		opt.ColumnExpr("max(id) AS max_id"),
+		opt.GroupBy("state"),
+		opt.Having(opt.Neq("state", AgentStateRegistered)),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(recs))
+	assert.Equal(t, AgentStateApproved, recs[0].State)
+	assert.Equal(t, int64(2), recs[0].MaxID)
+}
+
+func TestRepository_FindList_Columns(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(&Agent{ID: 1, Name: "111", INN: "111777111"})
+	assert.Nil(t, err)
+
+	var recs []*Agent
+	err = rep.FindList(context.Background(), &recs, opt.List(opt.Columns("id", "name")))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(recs))
+	assert.Equal(t, "111", recs[0].Name)
+	assert.Equal(t, "", recs[0].INN)
+	assert.True(t, recs[0].Created.IsZero())
+}
+
+func TestRepository_FindList_Relation(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Contract{ID: 1, AgentID: 1, State: ContractStateActive},
+		&Contract{ID: 2, AgentID: 1, State: ContractStateClosed},
+		&Contract{ID: 3, AgentID: 1, State: ContractStateActive},
+	)
+	assert.Nil(t, err)
+
+	var recs []*Agent
+	err = rep.FindList(context.Background(), &recs, opt.List(
+		opt.Relation("Contracts", opt.Eq("state", ContractStateActive), opt.Desc("id")),
+		opt.Asc("id"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(recs))
+	assert.Equal(t, 2, len(recs[0].Contracts))
+	assert.Equal(t, int64(3), recs[0].Contracts[0].ID)
+	assert.Equal(t, int64(1), recs[0].Contracts[1].ID)
+	assert.Equal(t, 0, len(recs[1].Contracts))
+}
+
+func TestRepository_FindList_Join(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Contract{ID: 1, AgentID: 1, State: ContractStateActive},
+		&Contract{ID: 2, AgentID: 2, State: ContractStateClosed},
+	)
+	assert.Nil(t, err)
+
+	var recs []*Agent
+	err = rep.FindList(context.Background(), &recs, opt.List(
+		opt.Join("JOIN contract AS c ON c.agent_id = agent.id"),
+		opt.Eq("c.state", ContractStateClosed),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(recs))
+	assert.Equal(t, int64(2), recs[0].ID)
+}
+
+func TestRepository_FindList_Distinct(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Contract{ID: 1, AgentID: 1, State: ContractStateActive},
+		&Contract{ID: 2, AgentID: 1, State: ContractStateActive},
+		&Contract{ID: 3, AgentID: 2, State: ContractStateActive},
+	)
+	assert.Nil(t, err)
+
+	t.Run("Distinct", func(t *testing.T) {
+		var recs []*Agent
+		err := rep.FindList(context.Background(), &recs, opt.List(
+			opt.Distinct(),
+			opt.Join("JOIN contract AS c ON c.agent_id = agent.id"),
+			opt.Eq("c.state", ContractStateActive),
+		))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(recs))
+	})
+
+	t.Run("DistinctOn", func(t *testing.T) {
+		var recs []*Contract
+		err := rep.FindList(context.Background(), &recs, opt.List(opt.DistinctOn("agent_id"), opt.Asc("agent_id")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(recs))
+	})
+}
+
+func TestRepository_FindList_CaseInsensitive(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "Discount 50%"},
+		&Agent{ID: 2, Name: "discount 500"},
+		&Agent{ID: 3, Name: "Other"},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"IEq":       {opt.IEq("name", "OTHER"), []int64{3}},
+		"IContains": {opt.IContains("name", "50%"), []int64{1}},
+		"IPrefix":   {opt.IPrefix("name", "DISCOUNT"), []int64{1, 2}},
+		"ISuffix":   {opt.ISuffix("name", "0%"), []int64{1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(tc.fn, opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_FindList_TextSearch(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "green apple"},
+		&Agent{ID: 2, Name: "green apples and green pears"},
+		&Agent{ID: 3, Name: "red pears"},
+	)
+	assert.Nil(t, err)
+
+	var ids []int64
+	err = rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(
+		opt.TextSearch("name", "green apples", "english"),
+		opt.TextRank("name", "green", "english"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, ids)
+}
+
+func TestRepository_FindList_Array(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Contract{ID: 1, AgentID: 1, Tags: []string{"a", "b"}},
+		&Contract{ID: 2, AgentID: 1, Tags: []string{"b", "c"}},
+		&Contract{ID: 3, AgentID: 1},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"ArrayContains": {opt.ArrayContains("tags", []string{"b", "a"}), []int64{1}},
+		"ArrayOverlaps": {opt.ArrayOverlaps("tags", []string{"a", "c"}), []int64{1, 2}},
+		"AnyEq":         {opt.AnyEq("tags", "c"), []int64{2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Contract{}, "id", &ids, opt.List(tc.fn, opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_FindList_Json(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Meta: `{"limits": {"daily": 100}, "note": null}`},
+		&Agent{ID: 2, Meta: `{"limits": {"daily": 2.5}}`},
+		&Agent{ID: 3, Meta: `{"limits": {}}`},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"JsonExists":         {opt.JsonExists("meta", "limits", "daily"), []int64{1, 2}},
+		"JsonExists on null": {opt.JsonExists("meta", "note"), []int64{1}},
+		"JsonGt":             {opt.JsonGt("meta", 10, "limits", "daily"), []int64{1}},
+		"JsonLt":             {opt.JsonLt("meta", 10, "limits", "daily"), []int64{2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(tc.fn, opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_FindList_Where(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Agent{ID: 3, Name: "333"},
+		&Agent{ID: 4, Name: "444"},
+	)
+	assert.Nil(t, err)
+
+	var ids []int64
+	err = rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(
+		opt.Neq("id", 3),
+		opt.Or(
+			opt.Where("id * ? > ?", 10, 25),
+			opt.And(opt.Eq("name", "111"), opt.Where("length(name) = ?", 3)),
+		),
+		opt.Where("id < ?", 3),
+		opt.WhereOr("name = ?", "444"),
+		opt.Asc("id"),
+	))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 4}, ids)
+}
+
+func TestRepository_FindList_Not(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111", INN: "777"},
+		&Agent{ID: 2, Name: "222", INN: "777"},
+		&Agent{ID: 3, Name: "333", INN: "888"},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"Not And": {opt.Not(opt.Eq("inn", "777"), opt.Eq("name", "111")), []int64{2, 3}},
+		"Not Or":  {opt.Not(opt.Or(opt.Eq("id", 1), opt.Eq("inn", "888"))), []int64{2}},
+		"Empty":   {opt.Not(opt.MayIn("id", []int64{})), []int64{1, 2, 3}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(tc.fn, opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_FindList_Subquery(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Agent{ID: 2, Name: "222"},
+		&Agent{ID: 3, Name: "333"},
+		&Contract{ID: 1, AgentID: 1, State: ContractStateActive},
+		&Contract{ID: 2, AgentID: 2, State: ContractStateClosed},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"InSubquery": {
+			opt.InSubquery("id", &Contract{}, opt.Columns("agent_id"), opt.Eq("state", ContractStateClosed)),
+			[]int64{2},
+		},
+		"ExistsSubquery": {
+			opt.ExistsSubquery(&Contract{}, opt.Where("contract.agent_id = agent.id"), opt.Eq("state", ContractStateActive)),
+			[]int64{1},
+		},
+		"Not ExistsSubquery": {
+			opt.Not(opt.ExistsSubquery(&Contract{}, opt.Where("contract.agent_id = agent.id"))),
+			[]int64{3},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(tc.fn, opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_FindList_Order(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	level := "gold"
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "b", INN: "777"},
+		&Agent{ID: 2, Name: "A", INN: "777", ServiceLevel: &level},
+		&Agent{ID: 3, Name: "c", INN: "888"},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		fn  opt.FnOpt
+		ids []int64
+	}{
+		"OrderBy":   {opt.OrderBy(opt.Desc("inn"), opt.DescNullsLast("service_level")), []int64{3, 2, 1}},
+		"NullFirst": {opt.AscNullsFirst("service_level"), []int64{1, 3, 2}},
+		"OrderExpr": {opt.OrderExpr("lower(?) DESC", pg.Ident("name")), []int64{3, 1, 2}},
+		"Order":     {opt.Order("inn desc"), []int64{3, 1, 2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(opt.OrderBy(tc.fn, opt.Asc("id"))))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+
+	t.Run("Override", func(t *testing.T) {
+		var ids []int64
+		err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(opt.Asc("inn"), opt.Desc("id")))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{3, 2, 1}, ids)
+	})
+}
+
+func TestRepository_OptsValidation(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+	rep.SetOptsValidation(true)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "111"},
+		&Contract{ID: 1, AgentID: 1, State: ContractStateActive},
+	)
+	assert.Nil(t, err)
+
+	for name, tc := range map[string]struct {
+		opts  []opt.FnOpt
+		valid bool
+	}{
+		"Valid":           {opt.List(opt.Eq("name", "111"), opt.Asc("agent.id")), true},
+		"Joined column":   {opt.List(opt.Join("JOIN contract AS c"), opt.JoinOn(opt.Where("c.agent_id = agent.id")), opt.Eq("c.state", ContractStateActive)), true},
+		"Unknown filter":  {opt.List(opt.Eq("title", "111")), false},
+		"Unknown own":     {opt.List(opt.Eq("agent.title", "111")), false},
+		"Unknown order":   {opt.List(opt.Desc("title")), false},
+		"Unknown columns": {opt.List(opt.Columns("id", "title")), false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var agents []*Agent
+			err := rep.FindList(context.Background(), &agents, tc.opts)
+			if tc.valid {
+				assert.NoError(t, err)
+				assert.Len(t, agents, 1)
+				return
+			}
+			assert.True(t, pkgerr.IsBadRequest(err))
+			assert.Contains(t, err.Error(), "unknown column")
+		})
+	}
+}
+
+func TestRepository_FindList_FromStruct(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	err := testDb.Insert(
+		&Agent{ID: 1, Name: "Alpha", INN: "777"},
+		&Agent{ID: 2, Name: "alphabet", INN: "888"},
+		&Agent{ID: 3, Name: "Beta", INN: "777"},
+	)
+	assert.Nil(t, err)
+
+	type AgentFilter struct {
+		Name *string `filter:"name,ilike"`
+		IDs  []int64 `filter:"id,in"`
+		INN  string  `filter:"inn"`
+		Skip string
+	}
+
+	name := "ALPHA"
+	for tcName, tc := range map[string]struct {
+		f   AgentFilter
+		ids []int64
+	}{
+		"Empty":  {AgentFilter{Skip: "x"}, []int64{1, 2, 3}},
+		"ILike":  {AgentFilter{Name: &name}, []int64{1, 2}},
+		"In":     {AgentFilter{IDs: []int64{2, 3}}, []int64{2, 3}},
+		"Eq":     {AgentFilter{INN: "777"}, []int64{1, 3}},
+		"Joined": {AgentFilter{Name: &name, INN: "777"}, []int64{1}},
+	} {
+		t.Run(tcName, func(t *testing.T) {
+			var ids []int64
+			err := rep.Pluck(context.Background(), &Agent{}, "id", &ids, opt.List(opt.FromStruct(tc.f), opt.Asc("id")))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestRepository_WithTempTable(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	recs := []*Agent{
+		{ID: 111, Name: "first", State: AgentStateRegistered},
+		{ID: 222, Name: "second", State: AgentStateRegistered},
+		{ID: 333, Name: "third", State: AgentStateRegistered},
+	}
+	_, err := rep.BulkLoad(context.Background(), recs)
+	assert.NoError(t, err)
+
+	var tmpName string
+	err = rep.WithTempTable(context.Background(), (*Agent)(nil), func(ctx context.Context, tmp TableRef) error {
+		tmpName = string(tmp.Name)
+		loaded, err := tmp.Load(ctx, []*Agent{{ID: 111}, {ID: 333}}, "id")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, loaded)
+
+		_, err = rep.DB().WithContext(ctx).Exec(`UPDATE agent SET state = ? FROM ? AS t WHERE agent.id = t.id`,
+			AgentStateApproved, tmp.Name)
+		return err
+	})
+	assert.NoError(t, err)
+
+	var approved []int64
+	_, err = testDb.Query(&approved, "SELECT id FROM agent WHERE state = ? ORDER BY id", AgentStateApproved)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{111, 333}, approved)
+
+	var exists bool
+	_, err = testDb.QueryOne(pg.Scan(&exists), "SELECT to_regclass(?) IS NOT NULL", strings.Trim(tmpName, `"`))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	t.Run("Rollback", func(t *testing.T) {
+		errRollback := errors.New("rollback")
+		err := rep.WithTempTable(context.Background(), &Agent{}, func(ctx context.Context, tmp TableRef) error {
+			_, err := tmp.Load(ctx, []Agent{{ID: 222}}, "id")
+			assert.NoError(t, err)
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+	})
+}
+
+func TestRepository_RefreshMaterializedView(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	_, err := testDb.Exec(`CREATE MATERIALIZED VIEW IF NOT EXISTS agent_count AS SELECT count(*) AS n FROM agent`)
+	assert.NoError(t, err)
+	defer testDb.Exec(`DROP MATERIALIZED VIEW agent_count`)
+	_, err = testDb.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS agent_count_n ON agent_count (n)`)
+	assert.NoError(t, err)
+
+	count := func() (n int) {
+		_, err := testDb.QueryOne(pg.Scan(&n), "SELECT n FROM agent_count")
+		assert.NoError(t, err)
+		return n
+	}
+
+	assert.NoError(t, rep.RefreshMaterializedView(context.Background(), "agent_count", RefreshOpts{}))
+	assert.Equal(t, 0, count())
+
+	assert.NoError(t, rep.Insert(context.Background(), &Agent{ID: 111, Name: "first", State: AgentStateRegistered}))
+	assert.NoError(t, rep.RefreshMaterializedView(context.Background(), "public.agent_count", RefreshOpts{Concurrently: true}))
+	assert.Equal(t, 1, count())
+
+	t.Run("Refresher", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		refresher := rep.NewViewRefresher(nil)
+		refresher.Register("agent_count", ViewSchedule{Channel: "agent_changed"})
+		done := make(chan error)
+		go func() {
+			done <- refresher.Run(ctx)
+		}()
+
+		assert.NoError(t, rep.Insert(context.Background(), &Agent{ID: 222, Name: "second", State: AgentStateRegistered}))
+		// the listener subscribes asynchronously
+		assert.Eventually(t, func() bool {
+			_, err := testDb.Exec("NOTIFY agent_changed")
+			assert.NoError(t, err)
+			return count() == 2
+		}, 5*time.Second, 100*time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("Logger", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		core, logs := observer.New(zapcore.ErrorLevel)
+		refresher := rep.NewViewRefresher(db.ZapLogger(zap.New(core)))
+		refresher.Register("missing_view", ViewSchedule{Interval: 10 * time.Millisecond})
+		done := make(chan error)
+		go func() {
+			done <- refresher.Run(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return logs.FilterMessage("failed to refresh materialized view").Len() > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestRepository_PurgeDeleted(t *testing.T) {
+	test.CleanDB(testDb, t)
+	rep := New(testDb)
+
+	recs := []*Agent{
+		{ID: 111, Name: "first", State: AgentStateRegistered},
+		{ID: 222, Name: "second", State: AgentStateRegistered},
+		{ID: 333, Name: "third", State: AgentStateRegistered},
+		{ID: 444, Name: "fourth", State: AgentStateRegistered},
+	}
+	assert.NoError(t, rep.Insert(context.Background(), recs[0], recs[1], recs[2], recs[3]))
+	_, err := testDb.Exec("UPDATE agent SET deleted = now() - interval '2 days' WHERE id IN (111, 222, 333)")
+	assert.NoError(t, err)
+	assert.NoError(t, rep.SoftDelete(context.Background(), &Agent{ID: 444, Name: "fourth", State: AgentStateRegistered}))
+
+	purged, err := rep.PurgeDeleted(context.Background(), (*Agent)(nil), 24*time.Hour, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+
+	var ids []int64
+	_, err = testDb.Query(&ids, "SELECT id FROM agent ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{444}, ids)
+
+	_, err = rep.PurgeDeleted(context.Background(), (*Agent)(nil), time.Hour, 0)
+	assert.True(t, pkgerr.IsBadRequest(err))
+
+	t.Run("Logger", func(t *testing.T) {
+		type undeletable struct {
+			tableName struct{} `pg:"agent"`
+			ID        int64    `pg:"id,pk"`
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		core, logs := observer.New(zapcore.ErrorLevel)
+		purger := rep.NewPurger(PurgerOpts{Interval: 10 * time.Millisecond, Logger: db.ZapLogger(zap.New(core))})
+		purger.Register((*undeletable)(nil), time.Hour)
+		done := make(chan error)
+		go func() {
+			done <- purger.Run(ctx)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return logs.FilterMessage("failed to purge deleted rows").Len() > 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestRepository_ValidateSchema(t *testing.T) {
+	rep := New(testDb)
+
+	diffs, err := rep.ValidateSchema(context.Background(), (*Agent)(nil), &Contract{})
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	type driftedAgent struct {
+		tableName struct{}  `pg:"agent"`
+		ID        string    `pg:"id,type:uuid"`
+		Name      int64     `pg:"name"`
+		Email     string    `pg:"email"`
+		Deleted   time.Time `pg:"deleted,notnull,type:timestamp"`
+	}
+	type missing struct {
+		tableName struct{} `pg:"missing_table"`
+		ID        int64
+	}
+	diffs, err = rep.ValidateSchema(context.Background(), (*driftedAgent)(nil), []missing{})
+	assert.NoError(t, err)
+	if assert.Len(t, diffs, 2) {
+		assert.Equal(t, `"agent"`, diffs[0].Table)
+		assert.Equal(t, []string{"email"}, diffs[0].MissingColumns)
+		assert.Equal(t, []ColumnDiff{
+			{Column: "id", Kind: DiffType, Model: "uuid", Table: "bigint"},
+			{Column: "name", Kind: DiffType, Model: "bigint", Table: "character varying(256)"},
+			{Column: "deleted", Kind: DiffNullability, Model: "NOT NULL", Table: "NULL"},
+		}, diffs[0].Columns)
+		assert.Nil(t, diffs[0].PrimaryKey)
+		assert.True(t, diffs[1].MissingTable)
+	}
+
+	_, err = rep.ValidateSchema(context.Background(), 42)
+	assert.True(t, pkgerr.IsBadRequest(err))
+}
+
+func TestRepository_HooksTx(t *testing.T) {
+	test.CleanDB(testDb, t)
+	repo := New(testDb)
+
+	repo.RegisterHook(&Document{}, BeforeUpdate, func(ctx context.Context, rec interface{}) error {
+		HookValues(ctx).Store(rec, rec.(*Document).Title)
+		return nil
+	})
+	repo.RegisterHook(&Document{}, AfterUpdate, func(ctx context.Context, rec interface{}) error {
+		assert.True(t, db.InTx(ctx))
+		title, ok := HookValues(ctx).Load(rec)
+		assert.True(t, ok)
+		assert.Equal(t, "second", title)
+		return errors.New("after hook failed")
+	})
+
+	doc := &Document{ID: 1, Title: "first"}
+	assert.NoError(t, repo.Insert(context.Background(), doc))
+	doc.Title = "second"
+	assert.Error(t, repo.Update(context.Background(), doc, "title"))
+
+	got := &Document{}
+	assert.NoError(t, testDb.Model(got).Where("id = 1").Select())
+	assert.Equal(t, "first", got.Title)
+	assert.Nil(t, HookValues(context.Background()))
+}
@@ -0,0 +1,42 @@
+package dao
+
+import (
+	"context"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// Explain returns plan of the query FindList builds for the model and opts in JSON format
+func (r *DAO) Explain(ctx context.Context, model interface{}, opts []opt.FnOpt) (string, error) {
+	return r.explain(ctx, "EXPLAIN (FORMAT JSON) ?", model, opts)
+}
+
+// ExplainAnalyze executes the query FindList builds for the model and opts and returns its plan
+// with actual timings and buffers usage in JSON format
+func (r *DAO) ExplainAnalyze(ctx context.Context, model interface{}, opts []opt.FnOpt) (string, error) {
+	return r.explain(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) ?", model, opts)
+}
+
+func (r *DAO) explain(ctx context.Context, explain string, model interface{}, opts []opt.FnOpt) (string, error) {
+	if err := r.validateOpts(model, opts); err != nil {
+		return "", err
+	}
+	opts = r.tenantOpts(ctx, model, opts)
+	ctx, done, err := r.applyTimeout(ctx, opts)
+	if err != nil {
+		return "", pkgerr.Convert(ctx, err)
+	}
+	defer done()
+
+	dbc := r.db.WithContext(ctx)
+	q := dbc.Model(model).Apply(opt.Apply(opts...))
+
+	var plan string
+	if _, err := dbc.QueryOne(pg.Scan(&plan), explain, q); err != nil {
+		return "", pkgerr.Convert(ctx, err)
+	}
+
+	return plan, nil
+}
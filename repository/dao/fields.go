@@ -0,0 +1,127 @@
+package dao
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// ModelFields declares special columns of the model, empty columns fall back to DAO fields
+// (see SetCreatedField, SetUpdatedField and SetDeletedField)
+type ModelFields struct {
+	// Created is set to the current time on Insert and Upsert
+	Created string
+	// Updated is set to the current time on Insert, Upsert and Update
+	Updated string
+	// Deleted is set by SoftDelete and cleared by Restore
+	Deleted string
+	// Version enables optimistic locking: Update and UpdateWithReturning of single record increment the version
+	// and fail with Conflict error if the record was changed since it was read. There is no version by default
+	Version string
+}
+
+type fieldsRegistry struct {
+	mu     sync.RWMutex
+	fields map[reflect.Type]ModelFields
+}
+
+// RegisterModelFields declares special columns of the model type, so one DAO serves models of different naming
+// conventions. Timestamps of registered model are set by DAO directly if the model doesn't implement
+// TimestampsSetter, the fields must be of time.Time or *time.Time type. Registered columns take precedence over
+// TimestampsFielder of the model
+func (r *DAO) RegisterModelFields(model interface{}, fields ModelFields) {
+	typ := modelType(model)
+	if typ == nil {
+		panic("RegisterModelFields expects struct model")
+	}
+
+	r.fields.mu.Lock()
+	defer r.fields.mu.Unlock()
+	if r.fields.fields == nil {
+		r.fields.fields = make(map[reflect.Type]ModelFields)
+	}
+	r.fields.fields[typ] = fields
+}
+
+// registeredFields returns columns registered for the model type
+func (r *DAO) registeredFields(model interface{}) (ModelFields, bool) {
+	r.fields.mu.RLock()
+	defer r.fields.mu.RUnlock()
+	fields, ok := r.fields.fields[modelType(model)]
+	return fields, ok
+}
+
+// modelFields returns special columns of the model: registered ones, then those of TimestampsFielder, then DAO fields
+func (r *DAO) modelFields(model interface{}) ModelFields {
+	fields := ModelFields{Created: r.createdField, Updated: r.updatedField, Deleted: r.deletedField}
+	if f, ok := modelInstance(model).(TimestampsFielder); ok {
+		c, u := f.TimestampsFields()
+		fields = mergeFields(fields, ModelFields{Created: c, Updated: u})
+	}
+	if registered, ok := r.registeredFields(model); ok {
+		fields = mergeFields(fields, registered)
+	}
+	return fields
+}
+
+// deletedColumn returns deleted column name of the model
+func (r *DAO) deletedColumn(model interface{}) string {
+	return r.modelFields(model).Deleted
+}
+
+func mergeFields(fields, override ModelFields) ModelFields {
+	if override.Created != "" {
+		fields.Created = override.Created
+	}
+	if override.Updated != "" {
+		fields.Updated = override.Updated
+	}
+	if override.Deleted != "" {
+		fields.Deleted = override.Deleted
+	}
+	if override.Version != "" {
+		fields.Version = override.Version
+	}
+	return fields
+}
+
+// setTime sets column of rec to t if the column is time.Time or *time.Time field of the model
+func setTime(rec interface{}, column string, t time.Time) {
+	v := reflect.ValueOf(rec)
+	if column == "" || v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	f, ok := orm.GetTable(v.Elem().Type()).FieldsMap[column]
+	if !ok {
+		return
+	}
+
+	fv := f.Value(v.Elem())
+	switch fv.Type() {
+	case reflect.TypeOf(t):
+		fv.Set(reflect.ValueOf(t))
+	case reflect.TypeOf(&t):
+		fv.Set(reflect.ValueOf(&t))
+	}
+}
+
+// versionField returns version field of rec if versioning is enabled for the model
+func (r *DAO) versionField(rec interface{}) (*orm.Field, reflect.Value, bool) {
+	column := r.modelFields(rec).Version
+	v := reflect.ValueOf(rec)
+	if column == "" || v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, reflect.Value{}, false
+	}
+	f, ok := orm.GetTable(v.Elem().Type()).FieldsMap[column]
+	if !ok {
+		return nil, reflect.Value{}, false
+	}
+	fv := f.Value(v.Elem())
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return f, fv, true
+	}
+	return nil, reflect.Value{}, false
+}
@@ -0,0 +1,172 @@
+package dao
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+)
+
+// HookEvent is a lifecycle event of the record
+type HookEvent int
+
+// Lifecycle events, hooks of Before events are able to abort the operation by returning an error
+const (
+	BeforeInsert HookEvent = iota
+	AfterInsert
+	BeforeUpdate
+	AfterUpdate
+	BeforeDelete
+	AfterDelete
+)
+
+// HookFn is called with pointer to the record, slices of records are passed element by element
+type HookFn func(ctx context.Context, rec interface{}) error
+
+// hookValuesKey is the context key of values shared by hooks of the operation
+type hookValuesKey struct{}
+
+type hookKey struct {
+	typ   reflect.Type
+	event HookEvent
+}
+
+type hookRegistry struct {
+	mu    sync.RWMutex
+	hooks map[hookKey][]HookFn
+}
+
+// RegisterHook registers fn to be called on event for records of the model type. Hooks are called by
+// Insert, Upsert, BulkLoad, Update, UpdateWithReturning, UpdateBulk, SoftDelete, Restore and HardDelete.
+// InsertIgnoreConflict calls BeforeInsert hooks for all the records and AfterInsert hooks for inserted ones only,
+// records of models with AfterInsert hooks are inserted one by one then. HardDeleteReturning calls AfterDelete hooks
+// with deleted records. Operations with conditions (e.g. UpdateWhere) have no records to pass,
+// so hooks are not called for them. Operations of models with hooks are run within transaction, a new one is started
+// if ctx has none, so error of After hook rolls back the operation. Hooks of the same operation share HookValues
+func (r *DAO) RegisterHook(model interface{}, event HookEvent, fn HookFn) {
+	typ := modelType(model)
+	if typ == nil {
+		panic("RegisterHook expects struct model")
+	}
+
+	r.hooks.mu.Lock()
+	defer r.hooks.mu.Unlock()
+	if r.hooks.hooks == nil {
+		r.hooks.hooks = make(map[hookKey][]HookFn)
+	}
+	key := hookKey{typ: typ, event: event}
+	r.hooks.hooks[key] = append(r.hooks.hooks[key], fn)
+}
+
+// HookValues returns values shared by hooks of the same operation, e.g. the state of the record loaded by Before hook
+// for After hook. Values are dropped when the operation is done, nil is returned outside of hooks
+func HookValues(ctx context.Context) *sync.Map {
+	values, _ := ctx.Value(hookValuesKey{}).(*sync.Map)
+	return values
+}
+
+// hooksTx reports whether operation on models has to start transaction, as hooks of models are registered
+// and ctx has no transaction
+func (r *DAO) hooksTx(ctx context.Context, models ...interface{}) bool {
+	return !db.InTx(ctx) && r.hasHooks(models...)
+}
+
+// hooksContext returns ctx of the operation on models with values shared by their hooks
+func (r *DAO) hooksContext(ctx context.Context, models ...interface{}) context.Context {
+	if !r.hasHooks(models...) {
+		return ctx
+	}
+	return context.WithValue(ctx, hookValuesKey{}, new(sync.Map))
+}
+
+// hasEventHooks reports whether hooks of event of the model are registered
+func (r *DAO) hasEventHooks(model interface{}, event HookEvent) bool {
+	r.hooks.mu.RLock()
+	defer r.hooks.mu.RUnlock()
+	return len(r.hooks.hooks[hookKey{typ: modelType(model), event: event}]) > 0
+}
+
+// hasHooks reports whether hooks of any of models are registered
+func (r *DAO) hasHooks(models ...interface{}) bool {
+	r.hooks.mu.RLock()
+	defer r.hooks.mu.RUnlock()
+	if len(r.hooks.hooks) == 0 {
+		return false
+	}
+
+	for _, model := range models {
+		typ := modelType(model)
+		for event := BeforeInsert; event <= AfterDelete; event++ {
+			if len(r.hooks.hooks[hookKey{typ: typ, event: event}]) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runHooks calls hooks of event for each record of recs, the first error stops the run
+func (r *DAO) runHooks(ctx context.Context, event HookEvent, recs ...interface{}) error {
+	r.hooks.mu.RLock()
+	empty := len(r.hooks.hooks) == 0
+	r.hooks.mu.RUnlock()
+	if empty {
+		return nil
+	}
+
+	for _, rec := range recs {
+		if err := eachRecord(rec, func(rec interface{}) error {
+			r.hooks.mu.RLock()
+			hooks := r.hooks.hooks[hookKey{typ: modelType(rec), event: event}]
+			r.hooks.mu.RUnlock()
+
+			for _, fn := range hooks {
+				if err := fn(ctx, rec); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachRecord calls fn with pointer to rec or to every element of rec slice
+func eachRecord(rec interface{}, fn func(rec interface{}) error) error {
+	v := reflect.ValueOf(rec)
+	for v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return fn(rec)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		if elem.IsNil() {
+			continue
+		}
+		if err := fn(elem.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modelType returns struct type of the model, model can be a struct, a slice or pointers to them
+func modelType(model interface{}) reflect.Type {
+	typ := reflect.TypeOf(model)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return typ
+}
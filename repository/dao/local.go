@@ -0,0 +1,68 @@
+package dao
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// localSettingsKey is the context key of local settings, distinct type keeps it apart from keys of other context values
+type localSettingsKey struct{}
+
+// LocalSetting is a run-time parameter set for the transaction only, e.g. `app.current_user_id` used by RLS policies
+type LocalSetting struct {
+	Name  string
+	Value string
+}
+
+// LocalSettingsFn returns transaction parameters derived from context
+type LocalSettingsFn func(ctx context.Context) []LocalSetting
+
+// WithLocalSetting returns context with parameter to be set by WithTX when it starts the transaction,
+// settings of the outer context are kept
+func WithLocalSetting(ctx context.Context, name, value string) context.Context {
+	prev, _ := ctx.Value(localSettingsKey{}).([]LocalSetting)
+	settings := make([]LocalSetting, 0, len(prev)+1)
+	settings = append(append(settings, prev...), LocalSetting{Name: name, Value: value})
+	return context.WithValue(ctx, localSettingsKey{}, settings)
+}
+
+// LocalSettingsFromContext returns parameters stored in context with WithLocalSetting
+func LocalSettingsFromContext(ctx context.Context) []LocalSetting {
+	settings, _ := ctx.Value(localSettingsKey{}).([]LocalSetting)
+	return settings
+}
+
+// AddLocalSettings adds fn providing transaction parameters to be set by WithTX in addition to those of context
+func (r *DAO) AddLocalSettings(fn LocalSettingsFn) {
+	r.localSettings = append(r.localSettings, fn)
+}
+
+// setLocals sets timeouts and transaction parameters of context and tenant schema with `set_config(name, value, true)`,
+// so they are reset on commit or rollback and do not leak to other users of the pooled connection. The parameters
+// are set by the client bound to the transaction of ctx, so they are set with any backend of the client
+func (r *DAO) setLocals(ctx context.Context) error {
+	settings := append(timeoutSettings(ctx), LocalSettingsFromContext(ctx)...)
+	for _, fn := range r.localSettings {
+		settings = append(settings, fn(ctx)...)
+	}
+	if schema, ok := r.tenantSchemaName(ctx); ok {
+		settings = append(settings, LocalSetting{Name: "search_path", Value: `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`})
+	}
+
+	client := r.db.WithContext(ctx)
+	for _, s := range settings {
+		var err error
+		// ctx is passed to query hooks if the client supports it
+		if tx, ok := client.(orm.DB); ok {
+			_, err = tx.ExecContext(ctx, "SELECT set_config(?, ?, true)", s.Name, s.Value)
+		} else {
+			_, err = client.Exec("SELECT set_config(?, ?, true)", s.Name, s.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package dao
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// RefreshOpts configures refresh of materialized view
+type RefreshOpts struct {
+	// Concurrently refreshes the view without locking out reads of it, the view must have unique index
+	Concurrently bool
+}
+
+// RefreshMaterializedView replaces data of materialized view name, optionally qualified with schema
+func (r *DAO) RefreshMaterializedView(ctx context.Context, name string, opts RefreshOpts) error {
+	query := "REFRESH MATERIALIZED VIEW ?"
+	if opts.Concurrently {
+		query = "REFRESH MATERIALIZED VIEW CONCURRENTLY ?"
+	}
+	if _, err := r.db.WithContext(ctx).Exec(query, pg.Ident(name)); err != nil {
+		return pkgerr.Convert(ctx, err)
+	}
+	return nil
+}
+
+// ViewSchedule configures refresh of materialized view by ViewRefresher
+type ViewSchedule struct {
+	RefreshOpts
+	// Interval is the pause between refreshes, the view is not refreshed periodically if it is zero
+	Interval time.Duration
+	// Channel is NOTIFY channel triggering refresh of the view, e.g. notified by trigger of the source table.
+	// Notifications received during refresh trigger a single refresh after it
+	Channel string
+}
+
+// ViewRefresher refreshes registered materialized views on schedule
+type ViewRefresher struct {
+	dao    *DAO
+	logger db.Logger
+	views  []scheduledView
+}
+
+type scheduledView struct {
+	name     string
+	schedule ViewSchedule
+}
+
+// NewViewRefresher creates refresher of materialized views, views are registered with Register. Failed refreshes
+// are logged with logger unless ctx of Run has one, with standard logger if logger is nil
+func (r *DAO) NewViewRefresher(logger db.Logger) *ViewRefresher {
+	return &ViewRefresher{dao: r, logger: logger}
+}
+
+// Register adds view refreshed by Run on schedule, views are registered before Run is called
+func (v *ViewRefresher) Register(name string, schedule ViewSchedule) {
+	v.views = append(v.views, scheduledView{name: name, schedule: schedule})
+}
+
+// Run refreshes registered views on their schedule until ctx is done. Failed refreshes are logged with the logger
+// of ctx (see db.ContextWithLogger) or the one of NewViewRefresher and retried on the next tick or notification. Views are refreshed by every
+// instance running Run, run it within db.Elect to refresh them once
+func (v *ViewRefresher) Run(ctx context.Context) error {
+	var ln *pg.Listener
+	if channels := v.channels(); len(channels) > 0 {
+		var err error
+		if ln, err = v.dao.listen(ctx, channels...); err != nil {
+			return err
+		}
+		defer ln.Close()
+	}
+
+	triggers := make(map[string][]chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	// refresh loops are stopped when listener fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for _, view := range v.views {
+		trigger := make(chan struct{}, 1)
+		if ch := view.schedule.Channel; ch != "" {
+			triggers[ch] = append(triggers[ch], trigger)
+		}
+
+		wg.Add(1)
+		go func(view scheduledView) {
+			defer wg.Done()
+			v.refreshLoop(ctx, view, trigger)
+		}(view)
+	}
+
+	if ln == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ch := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-ch:
+			if !ok {
+				return ctx.Err()
+			}
+			for _, trigger := range triggers[n.Channel] {
+				select {
+				case trigger <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// channels returns distinct NOTIFY channels of the views
+func (v *ViewRefresher) channels() []string {
+	var channels []string
+	seen := make(map[string]bool)
+	for _, view := range v.views {
+		if ch := view.schedule.Channel; ch != "" && !seen[ch] {
+			seen[ch] = true
+			channels = append(channels, ch)
+		}
+	}
+	return channels
+}
+
+// refreshLoop refreshes view on its interval and triggers until ctx is done
+func (v *ViewRefresher) refreshLoop(ctx context.Context, view scheduledView, trigger <-chan struct{}) {
+	var tick <-chan time.Time
+	if view.schedule.Interval > 0 {
+		ticker := time.NewTicker(view.schedule.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-trigger:
+		}
+
+		err := v.dao.RefreshMaterializedView(ctx, view.name, view.schedule.RefreshOpts)
+		if err != nil && ctx.Err() == nil {
+			if logger := db.LoggerFromContext(ctx, v.logger); logger != nil {
+				logger.Error("failed to refresh materialized view", "view", view.name, "error", err)
+			} else {
+				log.Printf("failed to refresh materialized view %s: %s", view.name, err.Error())
+			}
+		}
+	}
+}
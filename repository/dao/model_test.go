@@ -10,22 +10,86 @@ import (
 
 // Agent is a test model
 type Agent struct {
-	tableName    struct{}   `pg:"agent"`
-	ID           int64      `pg:"id,unique"`
-	Name         string     `pg:"name,notnull,use_zero"`
-	State        string     `pg:"state,notnull,use_zero"`
-	ServiceLevel *string    `pg:"service_level"`
-	INN          string     `pg:"inn"`
-	Meta         string     `pg:"meta"`
-	IsBlocked    bool       `pg:"is_blocked,notnull,use_zero"`
-	Created      time.Time  `pg:"created,notnull,type:timestamp,default:now()"`
-	Updated      time.Time  `pg:"updated,notnull,type:timestamp,default:now()"`
-	Deleted      *time.Time `pg:"deleted,type:timestamp"`
+	tableName    struct{}    `pg:"agent"`
+	ID           int64       `pg:"id,unique"`
+	Name         string      `pg:"name,notnull,use_zero"`
+	State        string      `pg:"state,notnull,use_zero"`
+	ServiceLevel *string     `pg:"service_level"`
+	INN          string      `pg:"inn"`
+	Meta         string      `pg:"meta"`
+	IsBlocked    bool        `pg:"is_blocked,notnull,use_zero"`
+	Created      time.Time   `pg:"created,notnull,type:timestamp,default:now()"`
+	Updated      time.Time   `pg:"updated,notnull,type:timestamp,default:now()"`
+	Deleted      *time.Time  `pg:"deleted,type:timestamp"`
+	Contracts    []*Contract `pg:"rel:has-many"`
+}
+
+// Contract is a test model
+type Contract struct {
+	tableName struct{} `pg:"contract"`
+	ID        int64    `pg:"id"`
+	AgentID   int64    `pg:"agent_id"`
+	State     string   `pg:"state,notnull,use_zero"`
+	Tags      []string `pg:"tags,array"`
+}
+
+// Setting is a test model with partial unique index on (agent_id, key) of not deleted records
+type Setting struct {
+	tableName struct{}   `pg:"setting"`
+	ID        int64      `pg:"id"`
+	AgentID   int64      `pg:"agent_id"`
+	Key       string     `pg:"key,notnull,use_zero"`
+	Value     string     `pg:"value,notnull,use_zero"`
+	Updated   time.Time  `pg:"updated,notnull,type:timestamp,default:now()"`
+	Deleted   *time.Time `pg:"deleted,type:timestamp"`
+}
+
+// Article is a test model with special columns registered in DAO
+type Article struct {
+	tableName  struct{}   `pg:"article"`
+	ID         int64      `pg:"id"`
+	Title      string     `pg:"title,notnull,use_zero"`
+	Version    int        `pg:"version,notnull,use_zero"`
+	CreatedOn  time.Time  `pg:"created_on,type:timestamp"`
+	ModifiedOn *time.Time `pg:"modified_on,type:timestamp"`
+	RemovedOn  *time.Time `pg:"removed_on,type:timestamp"`
+}
+
+// SetDeleted sets removed_on field
+func (a *Article) SetDeleted(t time.Time) {
+	a.RemovedOn = &t
+}
+
+// Document is a test model with timestamps set by DAO
+type Document struct {
+	tableName struct{}  `pg:"document"`
+	ID        int64     `pg:"id"`
+	Title     string    `pg:"title,notnull,use_zero"`
+	CreatedAt time.Time `pg:"created_at,type:timestamp"`
+	UpdatedAt time.Time `pg:"updated_at,type:timestamp"`
+}
+
+// SetCreated sets created_at field
+func (d *Document) SetCreated(t time.Time) {
+	d.CreatedAt = t
+}
+
+// SetUpdated sets updated_at field
+func (d *Document) SetUpdated(t time.Time) {
+	d.UpdatedAt = t
+}
+
+// TimestampsFields returns timestamps column names
+func (d *Document) TimestampsFields() (created, updated string) {
+	return "created_at", "updated_at"
 }
 
 const (
 	AgentStateRegistered string = "registered"
 	AgentStateApproved   string = "approved"
+
+	ContractStateActive string = "active"
+	ContractStateClosed string = "closed"
 )
 
 // SetDeletedAt sets deleted field
@@ -33,6 +97,11 @@ func (b *Agent) SetDeleted(t time.Time) {
 	b.Deleted = &t
 }
 
+// ClearDeleted clears deleted field
+func (b *Agent) ClearDeleted() {
+	b.Deleted = nil
+}
+
 // BeforeInsert is a callback
 func (b *Agent) BeforeInsert(ctx context.Context) (context.Context, error) {
 	now := time.Now()
@@ -0,0 +1,144 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// defaultPurgePause is the pause between batches of PurgeDeleted
+const defaultPurgePause = 100 * time.Millisecond
+
+// PurgerOpts configures Purger
+type PurgerOpts struct {
+	// BatchSize is the max number of rows deleted by one query, 1000 by default
+	BatchSize int
+	// Pause is the pause between batches, so purge doesn't saturate IO and replication, 100ms by default
+	Pause time.Duration
+	// Interval is the pause between purges, 1 hour by default
+	Interval time.Duration
+	// Logger logs failed purges unless ctx of Run has logger, standard logger is used if it is nil
+	Logger db.Logger
+}
+
+// Purger hard-deletes soft deleted rows of registered models periodically
+type Purger struct {
+	dao    *DAO
+	opts   PurgerOpts
+	models []purgedModel
+}
+
+type purgedModel struct {
+	model     interface{}
+	olderThan time.Duration
+}
+
+// PurgeDeleted hard-deletes rows of the table of model soft deleted more than olderThan ago in batches of batchSize
+// rows with a pause between them, so long retention purge doesn't lock the table or bloat replication lag.
+// Rows of all tenants are deleted, hooks are not called. Batches are run outside of transaction unless ctx has one.
+// It returns the number of deleted rows, rows deleted by batches before a failure are counted
+func (r *DAO) PurgeDeleted(ctx context.Context, model interface{}, olderThan time.Duration, batchSize int) (int64, error) {
+	return r.purgeDeleted(ctx, model, olderThan, batchSize, defaultPurgePause)
+}
+
+func (r *DAO) purgeDeleted(ctx context.Context, model interface{}, olderThan time.Duration, batchSize int,
+	pause time.Duration) (int64, error) {
+	if batchSize < 1 {
+		return 0, pkgerr.NewBadRequestError(errors.New("batch size must be positive"))
+	}
+	typ := modelType(model)
+	if typ == nil {
+		return 0, pkgerr.NewBadRequestError(errors.New("model must be struct, slice of structs or pointer to them"))
+	}
+
+	t := orm.GetTable(typ)
+	deleted, ok := t.FieldsMap[r.deletedColumn(model)]
+	if !ok {
+		return 0, pkgerr.NewBadRequestError(fmt.Errorf("model %s has no deleted column", t.TypeName))
+	}
+	keys := "ctid"
+	if len(t.PKs) > 0 {
+		columns := make([]string, 0, len(t.PKs))
+		for _, f := range t.PKs {
+			columns = append(columns, string(f.Column))
+		}
+		keys = strings.Join(columns, ", ")
+	}
+
+	before := time.Now().Add(-olderThan)
+	var total int64
+	for {
+		res, err := r.db.WithContext(ctx).Exec("DELETE FROM ? WHERE (?) IN (SELECT ? FROM ? WHERE ? < ? LIMIT ?)",
+			t.SQLName, pg.Safe(keys), pg.Safe(keys), t.SQLName, deleted.Column, before, batchSize)
+		if err != nil {
+			return total, pkgerr.Convert(ctx, err)
+		}
+		total += int64(res.RowsAffected())
+		if res.RowsAffected() < batchSize {
+			return total, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+}
+
+// NewPurger creates purger of soft deleted rows, models are registered with Register
+func (r *DAO) NewPurger(opts PurgerOpts) *Purger {
+	return &Purger{dao: r, opts: opts.withDefaults()}
+}
+
+// Register adds model which rows soft deleted more than olderThan ago are purged by Run,
+// models are registered before Run is called
+func (p *Purger) Register(model interface{}, olderThan time.Duration) {
+	p.models = append(p.models, purgedModel{model: model, olderThan: olderThan})
+}
+
+// Run purges registered models every interval until ctx is done, the first purge runs immediately. Failed purges are
+// logged with the logger of ctx (see db.ContextWithLogger) or Logger of opts and retried on the next interval. Rows are purged by every
+// instance running Run, run it within db.Elect to purge them once
+func (p *Purger) Run(ctx context.Context) error {
+	for {
+		for _, m := range p.models {
+			_, err := p.dao.purgeDeleted(ctx, m.model, m.olderThan, p.opts.BatchSize, p.opts.Pause)
+			if err != nil && ctx.Err() == nil {
+				table := db.GetTableName(modelInstance(m.model))
+				if logger := db.LoggerFromContext(ctx, p.opts.Logger); logger != nil {
+					logger.Error("failed to purge deleted rows", "table", table, "error", err)
+				} else {
+					log.Printf("failed to purge deleted rows of %s: %s", table, err.Error())
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.opts.Interval):
+		}
+	}
+}
+
+func (o PurgerOpts) withDefaults() PurgerOpts {
+	if o.BatchSize < 1 {
+		o.BatchSize = 1000
+	}
+	if o.Pause <= 0 {
+		o.Pause = defaultPurgePause
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Hour
+	}
+	return o
+}
@@ -0,0 +1,270 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// DiffKind is the kind of difference between field of model and column of its table
+type DiffKind string
+
+// Kinds of column differences
+const (
+	// DiffType is reported if the column type is not compatible with the field type
+	DiffType DiffKind = "type"
+	// DiffNullability is reported if the field can be written as NULL into NOT NULL column without default,
+	// or the field is tagged notnull while the column is nullable
+	DiffNullability DiffKind = "nullability"
+)
+
+// serialTypes are pseudo-types of go-pg fields resolved to types of columns
+var serialTypes = map[string]string{"smallserial": "smallint", "serial": "integer", "bigserial": "bigint"}
+
+// SchemaDiff is the difference between model and its table found by ValidateSchema
+type SchemaDiff struct {
+	// Model is the type of the model, e.g. dao.Agent
+	Model string
+	Table string
+	// MissingTable is set if the table doesn't exist, the other differences are not reported then
+	MissingTable bool
+	// MissingColumns are columns of the model absent in the table
+	MissingColumns []string
+	Columns        []ColumnDiff
+	// PrimaryKey is set if primary key columns of the model and the table differ, views are not checked
+	PrimaryKey *PrimaryKeyDiff
+}
+
+// ColumnDiff is the difference between field of model and column of its table
+type ColumnDiff struct {
+	Column string
+	Kind   DiffKind
+	// Model and Table describe the field and the column, SQL types for DiffType, NULL or NOT NULL for DiffNullability
+	Model string
+	Table string
+}
+
+// PrimaryKeyDiff is the difference between primary key columns of model and its table
+type PrimaryKeyDiff struct {
+	Model []string
+	Table []string
+}
+
+func (d SchemaDiff) String() string {
+	if d.MissingTable {
+		return fmt.Sprintf("%s: table %s does not exist", d.Model, d.Table)
+	}
+	var parts []string
+	if len(d.MissingColumns) > 0 {
+		parts = append(parts, "missing columns "+strings.Join(d.MissingColumns, ", "))
+	}
+	for _, c := range d.Columns {
+		parts = append(parts, fmt.Sprintf("%s of column %s is %s, table has %s", c.Kind, c.Column, c.Model, c.Table))
+	}
+	if d.PrimaryKey != nil {
+		parts = append(parts, fmt.Sprintf("primary key is (%s), table has (%s)", strings.Join(d.PrimaryKey.Model, ", "),
+			strings.Join(d.PrimaryKey.Table, ", ")))
+	}
+	return fmt.Sprintf("%s: table %s: %s", d.Model, d.Table, strings.Join(parts, "; "))
+}
+
+// tableColumn is a column of the table read from pg_attribute
+type tableColumn struct {
+	Name       string
+	Type       string
+	TypeOid    uint32
+	Category   string
+	NotNull    bool
+	HasDefault bool
+	PK         bool
+}
+
+// sqlType is a type resolved by the server
+type sqlType struct {
+	Oid      uint32
+	Category string
+}
+
+// ValidateSchema compares models with their tables and returns differences of models drifted from the schema,
+// e.g. to fail startup if a migration forgot a column. Columns of the models have to exist in the tables,
+// their types have to match explicit `type` tags (modifiers, e.g. length of varchar, are not compared)
+// or to be of the same category as types go-pg derives from Go types, string fields match columns of any type.
+// Nullability and primary keys are compared as well, columns of the tables unknown to models are allowed
+func (r *DAO) ValidateSchema(ctx context.Context, models ...interface{}) ([]SchemaDiff, error) {
+	types := make(map[string]*sqlType)
+	var diffs []SchemaDiff
+	for _, model := range models {
+		typ := modelType(model)
+		if typ == nil {
+			return nil, pkgerr.NewBadRequestError(errors.New("model must be struct, slice of structs or pointer to them"))
+		}
+		diff, err := r.validateTable(ctx, orm.GetTable(typ), types)
+		if err != nil {
+			return nil, pkgerr.Convert(ctx, err)
+		}
+		if diff.MissingTable || len(diff.MissingColumns) > 0 || len(diff.Columns) > 0 || diff.PrimaryKey != nil {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+// validateTable compares table of the model with the schema, types caches types resolved by the server
+func (r *DAO) validateTable(ctx context.Context, t *orm.Table, types map[string]*sqlType) (SchemaDiff, error) {
+	client := r.db.WithContext(ctx)
+	diff := SchemaDiff{Model: t.Type.String(), Table: string(t.SQLName)}
+
+	var relkind string
+	_, err := client.QueryOne(pg.Scan(&relkind), "SELECT relkind FROM pg_class WHERE oid = to_regclass(?)", diff.Table)
+	if err == pg.ErrNoRows {
+		diff.MissingTable = true
+		return diff, nil
+	}
+	if err != nil {
+		return diff, err
+	}
+
+	var columns []tableColumn
+	_, err = client.Query(&columns, `SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type,
+			a.atttypid AS type_oid, t.typcategory AS category, a.attnotnull AS not_null, a.atthasdef AS has_default,
+			EXISTS (SELECT 1 FROM pg_index i WHERE i.indrelid = a.attrelid AND i.indisprimary
+				AND a.attnum = ANY(i.indkey)) AS pk
+		FROM pg_attribute a JOIN pg_type t ON t.oid = a.atttypid
+		WHERE a.attrelid = to_regclass(?) AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, diff.Table)
+	if err != nil {
+		return diff, err
+	}
+	byName := make(map[string]tableColumn, len(columns))
+	var tablePKs []string
+	for _, c := range columns {
+		byName[c.Name] = c
+		if c.PK {
+			tablePKs = append(tablePKs, c.Name)
+		}
+	}
+
+	for _, f := range t.Fields {
+		column, ok := byName[f.SQLName]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, f.SQLName)
+			continue
+		}
+		if typeDiff, err := r.compareType(ctx, f, column, types); err != nil {
+			return diff, err
+		} else if typeDiff != nil {
+			diff.Columns = append(diff.Columns, *typeDiff)
+		}
+		if nullDiff := compareNullability(f, column); nullDiff != nil {
+			diff.Columns = append(diff.Columns, *nullDiff)
+		}
+	}
+
+	// primary keys of views are not defined
+	if relkind == "r" || relkind == "p" {
+		modelPKs := make([]string, 0, len(t.PKs))
+		for _, f := range t.PKs {
+			modelPKs = append(modelPKs, f.SQLName)
+		}
+		if !sameColumns(modelPKs, tablePKs) {
+			diff.PrimaryKey = &PrimaryKeyDiff{Model: modelPKs, Table: tablePKs}
+		}
+	}
+	return diff, nil
+}
+
+// compareType returns difference of types of the field and the column, nil if they are compatible
+func (r *DAO) compareType(ctx context.Context, f *orm.Field, column tableColumn, types map[string]*sqlType) (*ColumnDiff, error) {
+	explicit := f.UserSQLType != ""
+	modelType := f.SQLType
+	if explicit {
+		modelType = f.UserSQLType
+	}
+	if resolved, ok := serialTypes[strings.ToLower(modelType)]; ok {
+		modelType = resolved
+	}
+
+	resolved, ok := types[modelType]
+	if !ok {
+		resolved = &sqlType{}
+		_, err := r.db.WithContext(ctx).QueryOne(resolved,
+			"SELECT oid, typcategory AS category FROM pg_type WHERE oid = to_regtype(?)", modelType)
+		switch {
+		case err == pg.ErrNoRows:
+			resolved = nil
+		case err != nil:
+			return nil, err
+		}
+		types[modelType] = resolved
+	}
+
+	switch {
+	case resolved == nil:
+	case explicit && resolved.Oid == column.TypeOid:
+		return nil, nil
+	case !explicit && (resolved.Category == column.Category || resolved.Category == "S"):
+		return nil, nil
+	}
+	return &ColumnDiff{Column: column.Name, Kind: DiffType, Model: modelType, Table: column.Type}, nil
+}
+
+// compareNullability returns difference of nullability of the field and the column, nil if they match
+func compareNullability(f *orm.Field, column tableColumn) *ColumnDiff {
+	notNull, pk := fieldOptions(f)
+	switch {
+	case notNull && !column.NotNull:
+		return &ColumnDiff{Column: column.Name, Kind: DiffNullability, Model: "NOT NULL", Table: "NULL"}
+	case column.NotNull && !column.HasDefault && !notNull && !pk && fieldNullable(f):
+		return &ColumnDiff{Column: column.Name, Kind: DiffNullability, Model: "NULL", Table: "NOT NULL"}
+	}
+	return nil
+}
+
+// fieldOptions reports whether the field is tagged notnull and pk
+func fieldOptions(f *orm.Field) (notNull, pk bool) {
+	options := strings.Split(f.Field.Tag.Get("pg"), ",")
+	for _, o := range options[1:] {
+		switch strings.TrimSpace(o) {
+		case "notnull":
+			notNull = true
+		case "pk":
+			pk = true
+		}
+	}
+	return notNull, pk
+}
+
+// fieldNullable reports whether the field can be written as NULL
+func fieldNullable(f *orm.Field) bool {
+	if f.NullZero() {
+		return true
+	}
+	switch f.Type.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	}
+	return false
+}
+
+// sameColumns reports whether a and b contain the same columns regardless of order
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -54,4 +54,58 @@ func seedDB(dbc db.Client) {
 	if err != nil {
 		log.Fatalf("Failed to seed database, error: %v", err)
 	}
+
+	_, err = dbc.Exec(`CREATE TABLE IF NOT EXISTS "contract" (
+    		"id"       BIGSERIAL PRIMARY KEY,
+    		"agent_id" BIGINT NOT NULL,
+    		"state"    VARCHAR(100) NOT NULL,
+    		"tags"     TEXT[]
+	)`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+
+	_, err = dbc.Exec(`CREATE TABLE IF NOT EXISTS "setting" (
+    		"id"       BIGSERIAL PRIMARY KEY,
+    		"agent_id" BIGINT NOT NULL,
+    		"key"      VARCHAR(100) NOT NULL,
+    		"value"    VARCHAR(256) NOT NULL,
+    		"updated"  TIMESTAMP NOT NULL DEFAULT now(),
+    		"deleted"  TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+
+	_, err = dbc.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS "setting_agent_id_key_idx" ON "setting" ("agent_id", "key") WHERE "deleted" IS NULL`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+
+	_, err = dbc.Exec(`CREATE TABLE IF NOT EXISTS "article" (
+    		"id"          BIGSERIAL PRIMARY KEY,
+    		"title"       VARCHAR(256) NOT NULL,
+    		"version"     INT NOT NULL DEFAULT 0,
+    		"created_on"  TIMESTAMP,
+    		"modified_on" TIMESTAMP,
+    		"removed_on"  TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
+
+	_, err = dbc.Exec(`CREATE TABLE IF NOT EXISTS "document" (
+    		"id"         BIGSERIAL PRIMARY KEY,
+    		"title"      VARCHAR(256) NOT NULL,
+    		"created_at" TIMESTAMP,
+    		"updated_at" TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatalf("Failed to seed database, error: %v", err)
+	}
 }
@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// tempTableSeq makes names of temporary tables of nested WithTempTable calls distinct
+var tempTableSeq uint64
+
+// TableRef is a temporary table created by WithTempTable
+type TableRef struct {
+	// Name is escaped name of the table to be passed as query param,
+	// e.g. `UPDATE agent SET state = t.state FROM ? AS t WHERE agent.id = t.id`
+	Name types.Safe
+
+	dao   *DAO
+	table *orm.Table
+}
+
+// Load streams recs, slice of models of the table, into the temporary table with COPY and returns count of loaded rows.
+// Columns are chosen as BulkLoad does, hooks and timestamps of the DAO are not applied
+func (t TableRef) Load(ctx context.Context, recs interface{}, columns ...string) (int, error) {
+	v := reflect.Indirect(reflect.ValueOf(recs))
+	if v.Kind() != reflect.Slice {
+		return 0, pkgerr.NewBadRequestError(errors.New("recs must be slice or pointer to slice"))
+	}
+	if v.Len() == 0 {
+		return 0, nil
+	}
+
+	fields, err := bulkFields(t.table, v, columns)
+	if err != nil {
+		return 0, pkgerr.NewBadRequestError(err)
+	}
+	res, err := t.dao.copyCSV(ctx, t.Name, fields, v)
+	if err != nil {
+		return 0, pkgerr.Convert(ctx, err)
+	}
+	return res.RowsAffected(), nil
+}
+
+// WithTempTable creates temporary table with columns of the table of model and calls fn with it, e.g. to bulk-load
+// 100k ids with TableRef.Load and update rows joined with them in a single query instead of passing huge IN list.
+// Constraints and defaults are not copied, so a subset of columns can be loaded. The table is visible
+// to the connection only, so fn runs within transaction (see WithTX) and has to run queries with ctx passed to it.
+// The table is dropped when fn returns. Model may be nil pointer, e.g. (*Agent)(nil)
+func (r *DAO) WithTempTable(ctx context.Context, model interface{}, fn func(ctx context.Context, tmp TableRef) error) error {
+	typ := modelType(model)
+	if typ == nil {
+		return pkgerr.NewBadRequestError(errors.New("model must be struct, slice of structs or pointer to them"))
+	}
+
+	t := orm.GetTable(typ)
+	tmp := TableRef{
+		Name:  types.Safe(`"tmp_` + t.ModelName + "_" + strconv.FormatUint(atomic.AddUint64(&tempTableSeq, 1), 10) + `"`),
+		dao:   r,
+		table: t,
+	}
+
+	return r.WithTX(ctx, func(ctx context.Context) error {
+		client := r.db.WithContext(ctx)
+		// ON COMMIT DROP cleans up the table left by failed fn within outer transaction
+		_, err := client.Exec("CREATE TEMP TABLE ? ON COMMIT DROP AS SELECT * FROM ? WITH NO DATA", tmp.Name, t.SQLName)
+		if err != nil {
+			return pkgerr.Convert(ctx, err)
+		}
+
+		if err := fn(ctx, tmp); err != nil {
+			return err
+		}
+		if _, err := client.Exec("DROP TABLE ?", tmp.Name); err != nil {
+			return pkgerr.Convert(ctx, err)
+		}
+		return nil
+	})
+}
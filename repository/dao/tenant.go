@@ -0,0 +1,111 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// tenantKey is the context key of tenant, distinct type keeps it apart from keys of other context values
+type tenantKey struct{}
+
+// WithTenant returns context scoping DAO queries to the tenant
+func WithTenant(ctx context.Context, tenantID interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns tenant stored in context with WithTenant
+func TenantFromContext(ctx context.Context) (interface{}, bool) {
+	tenantID := ctx.Value(tenantKey{})
+	return tenantID, tenantID != nil
+}
+
+// SetTenantColumn enables tenant scoping by the column: queries of models having the column get `column = tenant`
+// condition and inserted records get the column set to the tenant of context passed with WithTenant.
+// Context without tenant is not scoped
+func (r *DAO) SetTenantColumn(column string) {
+	r.tenantColumn = column
+}
+
+// SetTenantSchema enables schema-per-tenant mode: search_path is set to the schema returned by fn for the tenant
+// of context within WithTX. Queries outside of transaction use connection search_path
+func (r *DAO) SetTenantSchema(fn func(tenantID interface{}) string) {
+	r.tenantSchema = fn
+}
+
+// tenantOpts appends tenant condition to opts if the model is scoped, the column is qualified with table alias
+// explicitly, as ?TableAlias is not expanded in subqueries (e.g. Exists)
+func (r *DAO) tenantOpts(ctx context.Context, model interface{}, opts []opt.FnOpt) []opt.FnOpt {
+	tenantID, ok := r.tenantField(ctx, model)
+	if !ok {
+		return opts
+	}
+
+	return append(append(make([]opt.FnOpt, 0, len(opts)+1), opts...),
+		opt.Where("?.? = ?", orm.GetTable(modelType(model)).Alias, pg.Ident(r.tenantColumn), tenantID))
+}
+
+// tenantQuery adds tenant condition to q if the model is scoped
+func (r *DAO) tenantQuery(ctx context.Context, model interface{}, q *orm.Query) *orm.Query {
+	if tenantID, ok := r.tenantField(ctx, model); ok {
+		q.Where("?.? = ?", orm.GetTable(modelType(model)).Alias, pg.Ident(r.tenantColumn), tenantID)
+	}
+	return q
+}
+
+// setTenant sets tenant column of recs to the tenant of context
+func (r *DAO) setTenant(ctx context.Context, recs ...interface{}) error {
+	for _, rec := range recs {
+		tenantID, ok := r.tenantField(ctx, rec)
+		if !ok {
+			continue
+		}
+
+		f := orm.GetTable(modelType(rec)).FieldsMap[r.tenantColumn]
+		tv := reflect.ValueOf(tenantID)
+		if err := eachRecord(rec, func(rec interface{}) error {
+			fv := f.Value(reflect.ValueOf(rec).Elem())
+			if !tv.Type().ConvertibleTo(fv.Type()) {
+				return pkgerr.NewBadRequestError(fmt.Errorf("tenant of type %s cannot be set to %s", tv.Type(), fv.Type()))
+			}
+			fv.Set(tv.Convert(fv.Type()))
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenantField returns tenant of context if the model has tenant column
+func (r *DAO) tenantField(ctx context.Context, model interface{}) (interface{}, bool) {
+	if r.tenantColumn == "" {
+		return nil, false
+	}
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	typ := modelType(model)
+	if typ == nil || !orm.GetTable(typ).HasField(r.tenantColumn) {
+		return nil, false
+	}
+	return tenantID, true
+}
+
+// tenantSchemaName returns schema of the tenant of context in schema-per-tenant mode
+func (r *DAO) tenantSchemaName(ctx context.Context) (string, bool) {
+	if r.tenantSchema == nil {
+		return "", false
+	}
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return r.tenantSchema(tenantID), true
+}
@@ -0,0 +1,86 @@
+package dao
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	pg "github.com/go-pg/pg/v10"
+)
+
+// context keys of timeouts, distinct types keep them apart from keys of other context values
+type (
+	statementTimeoutKey struct{}
+	lockTimeoutKey      struct{}
+)
+
+// WithStatementTimeout returns context limiting duration of DAO queries: WithTX sets `statement_timeout` locally
+// for the transaction, queries with opts run outside of transaction are cancelled on timeout
+func WithStatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutKey{}, d)
+}
+
+// StatementTimeoutFromContext returns timeout stored in context with WithStatementTimeout
+func StatementTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(statementTimeoutKey{}).(time.Duration)
+	return d, ok && d > 0
+}
+
+// WithLockTimeout returns context limiting wait for locks within transactions started by WithTX with `lock_timeout`
+func WithLockTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, lockTimeoutKey{}, d)
+}
+
+// LockTimeoutFromContext returns timeout stored in context with WithLockTimeout
+func LockTimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(lockTimeoutKey{}).(time.Duration)
+	return d, ok && d > 0
+}
+
+// timeoutSettings returns transaction parameters of timeouts stored in context
+func timeoutSettings(ctx context.Context) []LocalSetting {
+	var settings []LocalSetting
+	if d, ok := StatementTimeoutFromContext(ctx); ok {
+		settings = append(settings, LocalSetting{Name: "statement_timeout", Value: milliseconds(d)})
+	}
+	if d, ok := LockTimeoutFromContext(ctx); ok {
+		settings = append(settings, LocalSetting{Name: "lock_timeout", Value: milliseconds(d)})
+	}
+	return settings
+}
+
+// applyTimeout limits duration of the query with opt.Timeout or with timeout of context. Within transaction
+// `statement_timeout` of opts is set locally and restored by returned done func, timeout of context is already
+// set by WithTX. Outside of transaction the query is cancelled by context deadline
+func (r *DAO) applyTimeout(ctx context.Context, opts []opt.FnOpt) (context.Context, func(), error) {
+	d := opt.New(opts...).Timeout
+	tx := db.FromContext(ctx)
+	if d <= 0 && tx == nil {
+		d, _ = StatementTimeoutFromContext(ctx)
+	}
+	if d <= 0 {
+		return ctx, func() {}, nil
+	}
+
+	if tx == nil {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		return ctx, cancel, nil
+	}
+
+	var prev, cur string
+	if _, err := tx.QueryOneContext(ctx, pg.Scan(&prev, &cur),
+		"SELECT current_setting('statement_timeout'), set_config('statement_timeout', ?, true)", milliseconds(d)); err != nil {
+		return ctx, nil, err
+	}
+	return ctx, func() {
+		// fails if the query is cancelled by timeout, as transaction is aborted
+		_, _ = tx.ExecContext(ctx, "SELECT set_config('statement_timeout', ?, true)", prev)
+	}, nil
+}
+
+// milliseconds formats d as Postgres timeout value, d is rounded up as 0 disables the timeout
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(int64((d+time.Millisecond-1)/time.Millisecond), 10)
+}
@@ -0,0 +1,93 @@
+package dao
+
+import (
+	"reflect"
+	"time"
+)
+
+// TimestampsSetter is implemented by models which created and updated timestamps are set by DAO:
+// both of them on Insert and Upsert, updated only on Update
+type TimestampsSetter interface {
+	SetCreated(time.Time)
+	SetUpdated(time.Time)
+}
+
+// TimestampsFielder overrides names of created and updated columns of the model, DAO fields are used by default
+type TimestampsFielder interface {
+	TimestampsFields() (created, updated string)
+}
+
+// touchInserted sets created and updated timestamps of recs
+func (r *DAO) touchInserted(recs ...interface{}) {
+	now := time.Now()
+	for _, rec := range recs {
+		r.eachTimestamped(rec, func(rec interface{}, created, updated string) {
+			if s, ok := rec.(TimestampsSetter); ok {
+				s.SetCreated(now)
+				s.SetUpdated(now)
+				return
+			}
+			setTime(rec, created, now)
+			setTime(rec, updated, now)
+		})
+	}
+}
+
+// touchUpdated sets updated timestamp of recs
+func (r *DAO) touchUpdated(recs ...interface{}) {
+	now := time.Now()
+	for _, rec := range recs {
+		r.eachTimestamped(rec, func(rec interface{}, _, updated string) {
+			if s, ok := rec.(TimestampsSetter); ok {
+				s.SetUpdated(now)
+				return
+			}
+			setTime(rec, updated, now)
+		})
+	}
+}
+
+// timestampsColumns returns created and updated column names of the model,
+// model can be a struct, a slice or pointers to them
+func (r *DAO) timestampsColumns(model interface{}) (created, updated string) {
+	fields := r.modelFields(model)
+	return fields.Created, fields.Updated
+}
+
+// updatedColumn returns updated column name of the model
+func (r *DAO) updatedColumn(model interface{}) string {
+	_, updated := r.timestampsColumns(model)
+	return updated
+}
+
+// hasTimestamps reports whether timestamps of the model are set by DAO: the model implements TimestampsSetter
+// or its created or updated columns are registered with RegisterModelFields
+func (r *DAO) hasTimestamps(model interface{}) bool {
+	if _, ok := modelInstance(model).(TimestampsSetter); ok {
+		return true
+	}
+	fields, ok := r.registeredFields(model)
+	return ok && (fields.Created != "" || fields.Updated != "")
+}
+
+// eachTimestamped calls fn with created and updated columns for rec or every element of rec slice
+// which timestamps are set by DAO
+func (r *DAO) eachTimestamped(rec interface{}, fn func(rec interface{}, created, updated string)) {
+	if !r.hasTimestamps(rec) {
+		return
+	}
+	created, updated := r.timestampsColumns(rec)
+	_ = eachRecord(rec, func(rec interface{}) error {
+		fn(rec, created, updated)
+		return nil
+	})
+}
+
+// modelInstance returns pointer to new struct of the model type
+func modelInstance(model interface{}) interface{} {
+	typ := modelType(model)
+	if typ == nil {
+		return nil
+	}
+	return reflect.New(typ).Interface()
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 )
 
 // JsonPath store json path and value
@@ -69,6 +70,27 @@ type Contains map[string]string
 // Ends filter
 type Ends map[string]string
 
+// IEq field name equal to value ignoring case
+type IEq map[string]string
+
+// IContains filter, case insensitive, LIKE wildcards in value are matched literally
+type IContains map[string]string
+
+// IPrefix filter, case insensitive, LIKE wildcards in value are matched literally
+type IPrefix map[string]string
+
+// ISuffix filter, case insensitive, LIKE wildcards in value are matched literally
+type ISuffix map[string]string
+
+// ArrayContains array field name contains all of values
+type ArrayContains map[string]interface{}
+
+// ArrayOverlaps array field name has any of values
+type ArrayOverlaps map[string]interface{}
+
+// AnyEq array field name has element equal to value
+type AnyEq map[string]interface{}
+
 // Match filter
 type Match map[string]string
 
@@ -144,6 +166,44 @@ type JsonContainsValue struct {
 	Value  interface{}
 }
 
+// JsonExists filter
+type JsonExists struct {
+	Column string
+	Path   []string
+}
+
+// JsonGt filter, value by path is compared as number
+type JsonGt struct {
+	Column string
+	Path   []string
+	Value  interface{}
+}
+
+// JsonLt filter, value by path is compared as number
+type JsonLt struct {
+	Column string
+	Path   []string
+	Value  interface{}
+}
+
+// InSubquery field name contains in values selected by subquery
+type InSubquery struct {
+	Column string
+	Query  orm.QueryAppender
+}
+
+// ExistsSubquery subquery returns any row
+type ExistsSubquery struct {
+	Query orm.QueryAppender
+}
+
+// TextSearch full text search filter, default text search configuration is used for empty Language
+type TextSearch struct {
+	Column   string
+	Query    string
+	Language string
+}
+
 // PostGISIntersectionWithCircle is the filter to validate the PostGIS geometry object intersection with the circle
 // at the point of Longitude, Latitude, and the given Radius in meters.
 type PostGISIntersectionWithCircle struct {
@@ -409,6 +469,118 @@ func (c Ends) Params() []interface{} {
 	return nil
 }
 
+// Condition provide query condition
+func (c IEq) Condition() string {
+	return "LOWER(?) = LOWER(?)"
+}
+
+// Params provide query params
+func (c IEq) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			val,
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c IContains) Condition() string {
+	return "CAST(? AS text) ILIKE ?"
+}
+
+// Params provide query params
+func (c IContains) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			"%" + escapeLike(val) + "%",
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c IPrefix) Condition() string {
+	return "? ILIKE ?"
+}
+
+// Params provide query params
+func (c IPrefix) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			escapeLike(val) + "%",
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c ISuffix) Condition() string {
+	return "? ILIKE ?"
+}
+
+// Params provide query params
+func (c ISuffix) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			"%" + escapeLike(val),
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c ArrayContains) Condition() string {
+	return "? @> ?"
+}
+
+// Params provide query params
+func (c ArrayContains) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			pg.Array(val),
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c ArrayOverlaps) Condition() string {
+	return "? && ?"
+}
+
+// Params provide query params
+func (c ArrayOverlaps) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			pg.Ident(key),
+			pg.Array(val),
+		}
+	}
+	return nil
+}
+
+// Condition provide query condition
+func (c AnyEq) Condition() string {
+	return "? = ANY(?)"
+}
+
+// Params provide query params
+func (c AnyEq) Params() []interface{} {
+	for key, val := range c {
+		return []interface{}{
+			val,
+			pg.Ident(key),
+		}
+	}
+	return nil
+}
+
 // Condition provide query condition
 func (c Match) Condition() string {
 	return "to_tsvector('russian',?) @@ plainto_tsquery('russian',?)"
@@ -550,6 +722,72 @@ func (c JsonContainsValue) Params() []interface{} {
 	}
 }
 
+// Condition provide query condition
+func (c JsonExists) Condition() string {
+	return "? #> ? IS NOT NULL"
+}
+
+// Params provide query params
+func (c JsonExists) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(c.Column),
+		"{" + strings.Join(c.Path, ",") + "}",
+	}
+}
+
+// Condition provide query condition
+func (c JsonGt) Condition() string {
+	return "(? #>> ?)::numeric > ?"
+}
+
+// Params provide query params
+func (c JsonGt) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(c.Column),
+		"{" + strings.Join(c.Path, ",") + "}",
+		c.Value,
+	}
+}
+
+// Condition provide query condition
+func (c JsonLt) Condition() string {
+	return "(? #>> ?)::numeric < ?"
+}
+
+// Params provide query params
+func (c JsonLt) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(c.Column),
+		"{" + strings.Join(c.Path, ",") + "}",
+		c.Value,
+	}
+}
+
+// Condition provide query condition
+func (c InSubquery) Condition() string {
+	return "? IN (?)"
+}
+
+// Params provide query params
+func (c InSubquery) Params() []interface{} {
+	return []interface{}{
+		pg.Ident(c.Column),
+		c.Query,
+	}
+}
+
+// Condition provide query condition
+func (c ExistsSubquery) Condition() string {
+	return "EXISTS (?)"
+}
+
+// Params provide query params
+func (c ExistsSubquery) Params() []interface{} {
+	return []interface{}{
+		c.Query,
+	}
+}
+
 // Condition provide query condition
 func (c Raw) Condition() string {
 	return c.Query
@@ -682,6 +920,30 @@ func (c BitMaskOrEq) Params() []interface{} {
 	}
 }
 
+// Condition provide query condition
+func (c TextSearch) Condition() string {
+	if c.Language == "" {
+		return "to_tsvector(?) @@ plainto_tsquery(?)"
+	}
+	return "to_tsvector(?, ?) @@ plainto_tsquery(?, ?)"
+}
+
+// Params provide query params
+func (c TextSearch) Params() []interface{} {
+	if c.Language == "" {
+		return []interface{}{
+			pg.Ident(c.Column),
+			c.Query,
+		}
+	}
+	return []interface{}{
+		c.Language,
+		pg.Ident(c.Column),
+		c.Language,
+		c.Query,
+	}
+}
+
 // Condition provide query condition
 func (c PostGISIntersectionWithCircle) Condition() string {
 	// Filter  INTERSECTS g, with      CIRCLE around POINT at (lon,lat) and  radius
@@ -697,3 +959,10 @@ func (c PostGISIntersectionWithCircle) Params() []interface{} {
 		c.RadiusMeters,
 	}
 }
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes LIKE wildcards with default escape character
+func escapeLike(val string) string {
+	return likeReplacer.Replace(val)
+}
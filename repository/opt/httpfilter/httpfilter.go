@@ -0,0 +1,202 @@
+package httpfilter
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/pager"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+)
+
+// Query parameters
+const (
+	FilterParam   = "filter"
+	SortParam     = "sort"
+	PageParam     = "page"
+	PageSizeParam = "per_page"
+)
+
+// Filter operators
+const (
+	OpEq       = "eq"
+	OpNeq      = "neq"
+	OpGt       = "gt"
+	OpGe       = "ge"
+	OpLt       = "lt"
+	OpLe       = "le"
+	OpIn       = "in"
+	OpContains = "contains"
+	OpPrefix   = "prefix"
+	OpSuffix   = "suffix"
+	OpNull     = "null"
+)
+
+// ListSeparator separates values of `in` operator and sort columns
+const ListSeparator = ","
+
+var filterKeyRe = regexp.MustCompile(`^` + FilterParam + `\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// Parser converts HTTP query parameters into options, e.g.
+// `?filter[name][eq]=abc&filter[id][in]=1,2&sort=-created&page=2&per_page=50`.
+// Only whitelisted columns can be used in filters and sorting
+type Parser struct {
+	columns map[string]string
+	pager   *pager.Options
+}
+
+// New creates parser allowing to filter and sort by passed columns
+func New(columns ...string) *Parser {
+	p := &Parser{
+		columns: make(map[string]string, len(columns)),
+		pager:   pager.NewOptions(),
+	}
+	for _, column := range columns {
+		p.columns[column] = column
+	}
+	return p
+}
+
+// WithColumn allows to filter and sort by column under another parameter name
+func (p *Parser) WithColumn(param, column string) *Parser {
+	p.columns[param] = column
+	return p
+}
+
+// WithPagerOptions sets default and max page size
+func (p *Parser) WithPagerOptions(opts *pager.Options) *Parser {
+	p.pager = opts
+	return p
+}
+
+// Parse converts query parameters into options and pager, returned options include paging of the pager
+func (p *Parser) Parse(values url.Values) ([]opt.FnOpt, pager.Pager, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var opts []opt.FnOpt
+	for _, key := range keys {
+		m := filterKeyRe.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+
+		column, err := p.column(m[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		op := m[2]
+		if op == "" {
+			op = OpEq
+		}
+
+		for _, val := range values[key] {
+			fn, err := condition(column, op, val)
+			if err != nil {
+				return nil, nil, err
+			}
+			opts = append(opts, fn)
+		}
+	}
+
+	if sortBy := values.Get(SortParam); sortBy != "" {
+		var orders []opt.FnOpt
+		for _, item := range strings.Split(sortBy, ListSeparator) {
+			if strings.HasPrefix(item, "-") {
+				column, err := p.column(strings.TrimPrefix(item, "-"))
+				if err != nil {
+					return nil, nil, err
+				}
+				orders = append(orders, opt.Desc(column))
+				continue
+			}
+
+			column, err := p.column(strings.TrimPrefix(item, "+"))
+			if err != nil {
+				return nil, nil, err
+			}
+			orders = append(orders, opt.Asc(column))
+		}
+		opts = append(opts, opt.OrderBy(orders...))
+	}
+
+	page, err := intParam(values, PageParam, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	pageSize, err := intParam(values, PageSizeParam, p.pager.PageSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pgr := pager.NewPager(page, &pager.Options{PageSize: pageSize, MaxPageSize: p.pager.MaxPageSize})
+	opts = append(opts, opt.Paging(pgr.GetPage(), pgr.GetPageSize()))
+
+	return opts, pgr, nil
+}
+
+func (p *Parser) column(param string) (string, error) {
+	column, ok := p.columns[param]
+	if !ok {
+		return "", badRequest(fmt.Sprintf("column %s is not allowed", param))
+	}
+	return column, nil
+}
+
+func condition(column, op, val string) (opt.FnOpt, error) {
+	switch op {
+	case OpEq:
+		return opt.Eq(column, val), nil
+	case OpNeq:
+		return opt.Neq(column, val), nil
+	case OpGt:
+		return opt.Gt(column, val), nil
+	case OpGe:
+		return opt.Ge(column, val), nil
+	case OpLt:
+		return opt.Lt(column, val), nil
+	case OpLe:
+		return opt.Le(column, val), nil
+	case OpIn:
+		return opt.In(column, strings.Split(val, ListSeparator)), nil
+	case OpContains:
+		return opt.IContains(column, val), nil
+	case OpPrefix:
+		return opt.IPrefix(column, val), nil
+	case OpSuffix:
+		return opt.ISuffix(column, val), nil
+	case OpNull:
+		isNull, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, badRequest(fmt.Sprintf("invalid value %q of %s operator", val, op))
+		}
+		if isNull {
+			return opt.IsNull(column), nil
+		}
+		return opt.NotNull(column), nil
+	}
+	return nil, badRequest(fmt.Sprintf("unknown filter operator %s", op))
+}
+
+func intParam(values url.Values, name string, def int32) (int32, error) {
+	val := values.Get(name)
+	if val == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseInt(val, 10, 32)
+	if err != nil {
+		return 0, badRequest(fmt.Sprintf("invalid %s parameter %q", name, val))
+	}
+	return int32(i), nil
+}
+
+func badRequest(msg string) pkgerr.Error {
+	return pkgerr.NewBadRequestError(fmt.Errorf("httpfilter: %s", msg)).WithMessage(msg)
+}
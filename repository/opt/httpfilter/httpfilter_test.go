@@ -0,0 +1,70 @@
+package httpfilter
+
+import (
+	"net/url"
+	"testing"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/alexandr-kononykhin-vay/postgres/pager"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/filter"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/opt"
+	"github.com/alexandr-kononykhin-vay/postgres/repository/order"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParser_Parse(t *testing.T) {
+	parser := New("name", "id", "created").WithColumn("login", "user_login")
+
+	t.Run("Filter, sort and paging", func(t *testing.T) {
+		values, err := url.ParseQuery("filter[name][eq]=abc&filter[id][in]=1,2&filter[login]=root&sort=-created,name&page=2&per_page=50")
+		assert.NoError(t, err)
+
+		opts, pgr, err := parser.Parse(values)
+		assert.NoError(t, err)
+
+		o := opt.New(opts...)
+		assert.Equal(t, filter.Filter{
+			filter.In{"id": []interface{}{"1", "2"}},
+			filter.Eq{"user_login": "root"},
+			filter.Eq{"name": "abc"},
+		}, o.Filter)
+		assert.Equal(t, order.Order{order.Desc("created"), order.Asc("name")}, o.Orders)
+		assert.Equal(t, int32(2), o.Page)
+		assert.Equal(t, int32(50), o.PageSize)
+		assert.Equal(t, int32(50), pgr.GetOffset())
+	})
+
+	t.Run("Default paging", func(t *testing.T) {
+		opts, pgr, err := New().WithPagerOptions(pager.NewOptions().WithPageSize(20).WithMaxPageSize(30)).
+			Parse(url.Values{PageSizeParam: {"100"}})
+		assert.NoError(t, err)
+
+		o := opt.New(opts...)
+		assert.Equal(t, int32(1), pgr.GetPage())
+		assert.Equal(t, int32(30), pgr.GetPageSize())
+		assert.Equal(t, int32(30), o.PageSize)
+	})
+
+	t.Run("Null operator", func(t *testing.T) {
+		opts, _, err := parser.Parse(url.Values{"filter[created][null]": {"false"}})
+		assert.NoError(t, err)
+		assert.Equal(t, filter.Filter{filter.NotNull("created")}, opt.New(opts...).Filter)
+	})
+
+	for name, query := range map[string]string{
+		"Column is not allowed":      "filter[inn][eq]=1",
+		"Sort column is not allowed": "sort=-inn",
+		"Unknown operator":           "filter[name][like]=1",
+		"Invalid page":               "page=first",
+		"Invalid null value":         "filter[name][null]=yes",
+	} {
+		t.Run(name, func(t *testing.T) {
+			values, err := url.ParseQuery(query)
+			assert.NoError(t, err)
+
+			_, _, err = parser.Parse(values)
+			assert.True(t, pkgerr.IsBadRequest(err))
+		})
+	}
+}
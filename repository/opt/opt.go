@@ -3,23 +3,47 @@ package opt
 import (
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/alexandr-kononykhin-vay/postgres/pager"
 	"github.com/alexandr-kononykhin-vay/postgres/repository"
 	"github.com/alexandr-kononykhin-vay/postgres/repository/filter"
 	"github.com/alexandr-kononykhin-vay/postgres/repository/order"
 
+	"github.com/go-pg/pg/v10"
 	"github.com/go-pg/pg/v10/orm"
 )
 
 // Opt is options for database requests
 type Opt struct {
-	Page      int32
-	PageSize  int32
-	SortBy    string
-	SortOrder string
-	Filter    filter.Filter
-	Fn        []repository.QueryApply
+	Page       int32
+	PageSize   int32
+	SortBy     string
+	SortOrder  string
+	Orders     order.Order
+	Distinct   bool
+	DistinctOn []string
+	Columns    []string
+	ColumnExpr []filter.Raw
+	Joins      []JoinOpt
+	Filter     filter.Filter
+	Group      []string
+	Having     filter.Filter
+	Relations  []RelationOpt
+	Fn         []repository.QueryApply
+	Timeout    time.Duration
+}
+
+// RelationOpt is a model relation to be loaded with its own options
+type RelationOpt struct {
+	Name string
+	Opts []FnOpt
+}
+
+// JoinOpt is a JOIN statement with additional conditions appended to ON statement
+type JoinOpt struct {
+	Join filter.Raw
+	On   filter.Filter
 }
 
 // FnOpt is a function that modifies options
@@ -44,13 +68,60 @@ func (o *Opt) Apply() repository.QueryApply {
 			return query, nil
 		}
 
+		query, _ = o.ApplyColumns()(query)
+		query, _ = o.ApplyJoins()(query)
 		query, _ = o.ApplyFilter()(query)
+		query, _ = o.ApplyGroup()(query)
+		query, _ = o.ApplyRelations()(query)
 		query, _ = o.ApplyFn()(query)
 		query, _ = o.ApplyPaging()(query)
 		return query, nil
 	}
 }
 
+// ApplyColumns returns a function that builds request only with DISTINCT and SELECT list
+func (o *Opt) ApplyColumns() repository.QueryApply {
+	return func(query *orm.Query) (*orm.Query, error) {
+		if o == nil {
+			return query, nil
+		}
+
+		if o.IsDistinct() {
+			query = query.Distinct()
+			for _, column := range o.DistinctOn {
+				query = query.DistinctOn("?", pg.Ident(column))
+			}
+		}
+
+		if o.IsColumns() {
+			query = query.Column(o.Columns...)
+			for _, expr := range o.ColumnExpr {
+				query = query.ColumnExpr(expr.Condition(), expr.Params()...)
+			}
+		}
+
+		return query, nil
+	}
+}
+
+// ApplyJoins returns a function that builds request only with JOIN statements
+func (o *Opt) ApplyJoins() repository.QueryApply {
+	return func(query *orm.Query) (*orm.Query, error) {
+		if o == nil {
+			return query, nil
+		}
+
+		for _, join := range o.Joins {
+			query = query.Join(join.Join.Condition(), join.Join.Params()...)
+			for _, cond := range join.On {
+				query = query.JoinOn(cond.Condition(), cond.Params()...)
+			}
+		}
+
+		return query, nil
+	}
+}
+
 // ApplyFilter returns a function that builds request only with WHERE statements
 func (o *Opt) ApplyFilter() repository.QueryApply {
 	return func(query *orm.Query) (*orm.Query, error) {
@@ -66,6 +137,43 @@ func (o *Opt) ApplyFilter() repository.QueryApply {
 	}
 }
 
+// ApplyGroup returns a function that builds request only with GROUP BY, HAVING statements
+func (o *Opt) ApplyGroup() repository.QueryApply {
+	return func(query *orm.Query) (*orm.Query, error) {
+		if o == nil {
+			return query, nil
+		}
+
+		if o.IsGroup() {
+			query = query.Group(o.Group...)
+			for _, cond := range o.Having {
+				query = query.Having(cond.Condition(), cond.Params()...)
+			}
+		}
+
+		return query, nil
+	}
+}
+
+// ApplyRelations returns a function that builds request only with relations to be loaded
+func (o *Opt) ApplyRelations() repository.QueryApply {
+	return func(query *orm.Query) (*orm.Query, error) {
+		if o == nil {
+			return query, nil
+		}
+
+		for _, rel := range o.Relations {
+			if len(rel.Opts) == 0 {
+				query = query.Relation(rel.Name)
+				continue
+			}
+			query = query.Relation(rel.Name, Apply(rel.Opts...))
+		}
+
+		return query, nil
+	}
+}
+
 // ApplyPaging returns a function that builds request only with ORDER BY, LIMIT ... OFFSET statements
 func (o *Opt) ApplyPaging() repository.QueryApply {
 	return func(query *orm.Query) (*orm.Query, error) {
@@ -78,7 +186,7 @@ func (o *Opt) ApplyPaging() repository.QueryApply {
 		}
 
 		if o.IsSorting() {
-			query = query.Apply(order.Order{order.Expr(o.SortBy, o.SortOrder)}.Apply)
+			query = query.Apply(o.order().Apply)
 		}
 
 		return query, nil
@@ -134,7 +242,30 @@ func (o *Opt) IsPaging() bool {
 
 // IsSorting responds whether sorting options set
 func (o *Opt) IsSorting() bool {
-	return o.SortOrder != "" && o.SortBy != ""
+	return o.SortOrder != "" && o.SortBy != "" || len(o.Orders) > 0
+}
+
+// order returns all sorting expressions, SortBy goes first
+func (o *Opt) order() order.Order {
+	if o.SortOrder == "" || o.SortBy == "" {
+		return o.Orders
+	}
+	return append(order.Order{order.Expr(o.SortBy, o.SortOrder)}, o.Orders...)
+}
+
+// IsColumns responds whether SELECT list options set
+func (o *Opt) IsColumns() bool {
+	return len(o.Columns) > 0 || len(o.ColumnExpr) > 0
+}
+
+// IsDistinct responds whether distinct options set
+func (o *Opt) IsDistinct() bool {
+	return o.Distinct || len(o.DistinctOn) > 0
+}
+
+// IsGroup responds whether grouping options set
+func (o *Opt) IsGroup() bool {
+	return len(o.Group) > 0
 }
 
 // IsFilter responds whether filter options set
@@ -149,6 +280,70 @@ func Fn(queryFn ...repository.QueryApply) FnOpt {
 	}
 }
 
+// Timeout limits duration of the query, DAO sets `statement_timeout` locally within transaction
+// or cancels the query by context deadline otherwise
+func Timeout(d time.Duration) FnOpt {
+	return func(opt *Opt) {
+		opt.Timeout = d
+	}
+}
+
+// Columns adds columns to SELECT list
+func Columns(columns ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.Columns = append(opt.Columns, columns...)
+	}
+}
+
+// ColumnExpr adds expression to SELECT list, e.g. `count(*) AS cnt`
+func ColumnExpr(expr string, params ...interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.ColumnExpr = append(opt.ColumnExpr, filter.Raw{Query: expr, QueryParams: params})
+	}
+}
+
+// Relation adds model relation declared in struct tags to be loaded,
+// optional opts are applied to the relation query (to JOIN ON statement for has-one and belongs-to relations)
+func Relation(name string, optFn ...FnOpt) FnOpt {
+	return func(opt *Opt) {
+		opt.Relations = append(opt.Relations, RelationOpt{Name: name, Opts: optFn})
+	}
+}
+
+// Distinct adds DISTINCT statement
+func Distinct() FnOpt {
+	return func(opt *Opt) {
+		opt.Distinct = true
+	}
+}
+
+// DistinctOn adds DISTINCT ON (columns) statement, query must be ordered by the same columns first
+func DistinctOn(columns ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.DistinctOn = append(opt.DistinctOn, columns...)
+	}
+}
+
+// Join adds JOIN statement, e.g. `JOIN accounts AS a ON a.id = agent.account_id`.
+// Columns of joined tables can be referenced in conditions with table alias, e.g. Eq("a.state", val)
+func Join(join string, params ...interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.Joins = append(opt.Joins, JoinOpt{Join: filter.Raw{Query: join, QueryParams: params}})
+	}
+}
+
+// JoinOn adds set of conditions to ON statement of the last Join, the Join must not contain ON statement itself
+func JoinOn(optFn ...FnOpt) FnOpt {
+	return func(opt *Opt) {
+		if len(opt.Joins) == 0 {
+			panic("JoinOn requires preceding Join")
+		}
+		o := New(optFn...)
+		last := &opt.Joins[len(opt.Joins)-1]
+		last.On = append(last.On, o.Filter...)
+	}
+}
+
 // Page sets page option
 func Page(page int32) FnOpt {
 	return func(opt *Opt) {
@@ -176,47 +371,82 @@ func Paging(page, size int32) FnOpt {
 	}
 }
 
-// Asc sets ascending order options
+// Asc sets ascending order by column, replaces order of Asc, Desc and Order, use OrderBy to sort by several columns
 func Asc(column string) FnOpt {
+	return sortBy(column, order.DirAsc)
+}
+
+// AscNullsFirst sets ascending order by column with NULL on top
+func AscNullsFirst(column string) FnOpt {
+	return sortBy(column, order.DirAscNullsFirst)
+}
+
+// AscNullsLast sets ascending order by column with NULL at the end
+func AscNullsLast(column string) FnOpt {
+	return sortBy(column, order.DirAscNullsLast)
+}
+
+// Desc sets descending order by column, replaces order of Asc, Desc and Order, use OrderBy to sort by several columns
+func Desc(column string) FnOpt {
+	return sortBy(column, order.DirDesc)
+}
+
+// DescNullsFirst sets descending order by column with NULL on top
+func DescNullsFirst(column string) FnOpt {
+	return sortBy(column, order.DirDescNullsFirst)
+}
+
+// DescNullsLast sets descending order by column with NULL at the end
+func DescNullsLast(column string) FnOpt {
+	return sortBy(column, order.DirDescNullsLast)
+}
+
+// OrderExpr adds order by expression with direction, e.g. OrderExpr("lower(?) DESC", pg.Ident("name")),
+// it is applied after order set by Asc, Desc and Order
+func OrderExpr(expr string, params ...interface{}) FnOpt {
 	return func(opt *Opt) {
-		opt.SortBy = column
-		opt.SortOrder = order.DirAsc
+		opt.Orders = append(opt.Orders, order.Raw{Query: expr, QueryParams: params})
 	}
 }
 
-// Desc sets descending order options
-func Desc(column string) FnOpt {
+// OrderBy adds orders applied in the given order, e.g. OrderBy(Asc("name"), DescNullsLast("deleted")).
+// Unlike Asc, Desc and Order orders of several OrderBy accumulate, they are applied after order set by them
+func OrderBy(optFn ...FnOpt) FnOpt {
 	return func(opt *Opt) {
-		opt.SortBy = column
-		opt.SortOrder = order.DirDesc
+		for _, fn := range optFn {
+			opt.Orders = append(opt.Orders, New(fn).order()...)
+		}
 	}
 }
 
-// Order options
+// Order sets order by column with direction, e.g. `name DESC NULLS LAST`, replaces order of Asc, Desc and Order
 func Order(columnAndDirection string) FnOpt {
 	return func(opt *Opt) {
 		arr := strings.SplitN(columnAndDirection, " ", 2)
-		opt.SortBy = arr[0]
-		if len(arr) == 1 {
-			opt.SortOrder = order.DirAsc
-		} else {
-			switch strings.ToUpper(strings.TrimSpace(arr[1])) {
-			case "ASC":
-				opt.SortOrder = order.DirAsc
-			case "ASC NULLS FIRST":
-				opt.SortOrder = order.DirAscNullsFirst
-			case "ASC NULLS LAST":
-				opt.SortOrder = order.DirAscNullsLast
-			case "DESC":
-				opt.SortOrder = order.DirDesc
-			case "DESC NULLS FIRST":
-				opt.SortOrder = order.DirDescNullsFirst
-			case "DESC NULLS LAST":
-				opt.SortOrder = order.DirDescNullsLast
-			default:
-				panic("Unknown order rule: " + arr[1])
-			}
+		dir := order.DirAsc
+		if len(arr) > 1 {
+			dir = strings.ToUpper(strings.TrimSpace(arr[1]))
 		}
+
+		if order.Expr(arr[0], dir) == nil {
+			panic("Unknown order rule: " + arr[1])
+		}
+		opt.SortBy = arr[0]
+		opt.SortOrder = dir
+	}
+}
+
+func sortBy(column, dir string) FnOpt {
+	return func(opt *Opt) {
+		opt.SortBy = column
+		opt.SortOrder = dir
+	}
+}
+
+// TextRank sets order by full text search rank, most relevant records go first
+func TextRank(column, query, language string) FnOpt {
+	return func(opt *Opt) {
+		opt.Orders = append(opt.Orders, order.TextRank{Column: column, Query: query, Language: language})
 	}
 }
 
@@ -305,6 +535,44 @@ func In(column string, vals interface{}) FnOpt {
 	}
 }
 
+// NotIn sets condition for NOT IN operation
+func NotIn(column string, vals interface{}) FnOpt {
+	return func(opt *Opt) {
+		if reflect.TypeOf(vals).Kind() != reflect.Slice {
+			vals = []interface{}{vals}
+		}
+
+		in := []interface{}{}
+		v := reflect.ValueOf(vals)
+		for i := 0; i < v.Len(); i++ {
+			in = append(in, v.Index(i).Interface())
+		}
+
+		opt.Filter = append(opt.Filter, filter.NotIn{column: in})
+	}
+}
+
+// ArrayContains builds a condition with `column @> vals` statement for array column, vals must be a slice
+func ArrayContains(column string, vals interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.ArrayContains{column: vals})
+	}
+}
+
+// ArrayOverlaps builds a condition with `column && vals` statement for array column, vals must be a slice
+func ArrayOverlaps(column string, vals interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.ArrayOverlaps{column: vals})
+	}
+}
+
+// AnyEq builds a condition with `val = ANY(column)` statement for array column
+func AnyEq(column string, val interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.AnyEq{column: val})
+	}
+}
+
 // Contains builds a condition with `LIKE %val%` statement
 func Contains(column string, val string) FnOpt {
 	return func(opt *Opt) {
@@ -312,6 +580,34 @@ func Contains(column string, val string) FnOpt {
 	}
 }
 
+// IEq builds a case insensitive condition with `LOWER(column) = LOWER(val)` statement
+func IEq(column string, val string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.IEq{column: val})
+	}
+}
+
+// IContains builds a case insensitive condition with `ILIKE %val%` statement, wildcards in val are escaped
+func IContains(column string, val string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.IContains{column: val})
+	}
+}
+
+// IPrefix builds a case insensitive condition with `ILIKE val%` statement, wildcards in val are escaped
+func IPrefix(column string, val string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.IPrefix{column: val})
+	}
+}
+
+// ISuffix builds a case insensitive condition with `ILIKE %val` statement, wildcards in val are escaped
+func ISuffix(column string, val string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.ISuffix{column: val})
+	}
+}
+
 // Match builds a condition with match statement
 func Match(column string, expr string) FnOpt {
 	return func(opt *Opt) {
@@ -319,6 +615,14 @@ func Match(column string, expr string) FnOpt {
 	}
 }
 
+// TextSearch builds a full text search condition with `to_tsvector(language, column) @@ plainto_tsquery(language, query)`
+// statement, default text search configuration is used for empty language
+func TextSearch(column, query, language string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.TextSearch{Column: column, Query: query, Language: language})
+	}
+}
+
 // Starts builds a condition with `LIKE val%` statement
 func Starts(column string, val string) FnOpt {
 	return func(opt *Opt) {
@@ -365,6 +669,82 @@ func JsonContainsValue(column string, val string, path ...string) FnOpt {
 	}
 }
 
+// JsonExists builds a condition with `path.to.value IS NOT NULL` statement, true for existing keys with null value too
+func JsonExists(column string, path ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.JsonExists{
+			Column: column,
+			Path:   path,
+		})
+	}
+}
+
+// JsonGt builds a condition with `path.to.value::numeric > val` statement
+func JsonGt(column string, val interface{}, path ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.JsonGt{
+			Column: column,
+			Path:   path,
+			Value:  val,
+		})
+	}
+}
+
+// JsonLt builds a condition with `path.to.value::numeric < val` statement
+func JsonLt(column string, val interface{}, path ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.JsonLt{
+			Column: column,
+			Path:   path,
+			Value:  val,
+		})
+	}
+}
+
+// Where adds raw condition, e.g. Where("balance > commission * ?", factor)
+func Where(condition string, params ...interface{}) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.Raw{Query: condition, QueryParams: params})
+	}
+}
+
+// WhereOr adds raw condition joined with the previous condition with OR statement
+func WhereOr(condition string, params ...interface{}) FnOpt {
+	return func(opt *Opt) {
+		raw := filter.Raw{Query: condition, QueryParams: params}
+		if len(opt.Filter) == 0 {
+			opt.Filter = append(opt.Filter, raw)
+			return
+		}
+		last := len(opt.Filter) - 1
+		opt.Filter[last] = filter.Or{opt.Filter[last], raw}
+	}
+}
+
+// InSubquery builds a condition with `column IN (SELECT ...)` statement, subquery is built from model and opts,
+// opts must select the only column, e.g. InSubquery("id", &Contract{}, Columns("agent_id"), Eq("state", "active"))
+func InSubquery(column string, model interface{}, optFn ...FnOpt) FnOpt {
+	return func(opt *Opt) {
+		opt.Filter = append(opt.Filter, filter.InSubquery{
+			Column: column,
+			Query:  orm.NewQuery(nil, model).Apply(Apply(optFn...)),
+		})
+	}
+}
+
+// ExistsSubquery builds a condition with `EXISTS (SELECT ...)` statement, subquery is built from model and opts.
+// Correlated subquery may reference outer table by its alias, e.g. Where("contract.agent_id = agent.id")
+func ExistsSubquery(model interface{}, optFn ...FnOpt) FnOpt {
+	return func(opt *Opt) {
+		o := New(optFn...)
+		q := orm.NewQuery(nil, model).Apply(o.Apply())
+		if !o.IsColumns() {
+			q = q.ColumnExpr("1")
+		}
+		opt.Filter = append(opt.Filter, filter.ExistsSubquery{Query: q})
+	}
+}
+
 // Or adds set of conditions joined with OR statement
 func Or(optFn ...FnOpt) FnOpt {
 	return func(opt *Opt) {
@@ -381,6 +761,21 @@ func And(optFn ...FnOpt) FnOpt {
 	}
 }
 
+// GroupBy adds columns to GROUP BY statement
+func GroupBy(columns ...string) FnOpt {
+	return func(opt *Opt) {
+		opt.Group = append(opt.Group, columns...)
+	}
+}
+
+// Having adds set of conditions to HAVING statement, it is applied only with GroupBy
+func Having(optFn ...FnOpt) FnOpt {
+	return func(opt *Opt) {
+		o := New(optFn...)
+		opt.Having = append(opt.Having, o.Filter...)
+	}
+}
+
 // NotNull adds `IS NOT NULL` condition
 func NotNull(column string) FnOpt {
 	return func(opt *Opt) {
@@ -395,10 +790,14 @@ func IsNull(column string) FnOpt {
 	}
 }
 
-// Not adds `NOT` condition
+// Not adds `NOT` condition negating set of conditions joined with AND statement,
+// nested Or and And groups are negated as a whole, e.g. `NOT ((a) OR (b))`. Empty set is skipped
 func Not(optFn ...FnOpt) FnOpt {
 	return func(opt *Opt) {
 		o := New(optFn...)
+		if !o.IsFilter() {
+			return
+		}
 		opt.Filter = append(opt.Filter, filter.Not(o.Filter))
 	}
 }
@@ -0,0 +1,126 @@
+package opt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FilterTag is the struct tag describing column and operator of a filter field, e.g. `filter:"name,ilike"`
+const FilterTag = "filter"
+
+// Operators of filter struct tag, eq is used if operator is omitted
+const (
+	TagEq       = "eq"
+	TagNeq      = "neq"
+	TagGt       = "gt"
+	TagGe       = "ge"
+	TagLt       = "lt"
+	TagLe       = "le"
+	TagIn       = "in"
+	TagNotIn    = "nin"
+	TagIEq      = "ieq"
+	TagILike    = "ilike"
+	TagPrefix   = "prefix"
+	TagSuffix   = "suffix"
+	TagNull     = "null"
+	TagArrayHas = "array_contains"
+	TagOverlaps = "overlaps"
+)
+
+// FromStruct builds options from struct fields annotated with filter tag, e.g.
+//
+//	type AgentFilter struct {
+//		Name    *string `filter:"name,ilike"`
+//		IDs     []int64 `filter:"id,in"`
+//		Deleted *bool   `filter:"deleted,null"`
+//	}
+//
+// Nil pointers, empty slices and zero values are skipped, so use pointer to filter by zero value.
+// Fields without tag or tagged with "-" are ignored, embedded structs are walked recursively.
+// Panics if f is not a struct or pointer to struct, or tag has unknown operator
+func FromStruct(f interface{}) FnOpt {
+	v := reflect.Indirect(reflect.ValueOf(f))
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() != reflect.Struct {
+		panic("FromStruct expects struct, got " + v.Kind().String())
+	}
+
+	var optFn []FnOpt
+	optFn = appendStructOpts(optFn, v)
+	return func(opt *Opt) {
+		for _, fn := range optFn {
+			fn(opt)
+		}
+	}
+}
+
+func appendStructOpts(optFn []FnOpt, v reflect.Value) []FnOpt {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup(FilterTag)
+		fv := v.Field(i)
+
+		if !ok && sf.Anonymous {
+			if fv = reflect.Indirect(fv); fv.Kind() == reflect.Struct {
+				optFn = appendStructOpts(optFn, fv)
+			}
+			continue
+		}
+		if !ok || tag == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if fv.IsZero() || (fv.Kind() == reflect.Slice && fv.Len() == 0) {
+			continue
+		}
+
+		column, op := tag, TagEq
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			column, op = tag[:i], strings.TrimSpace(tag[i+1:])
+		}
+		optFn = append(optFn, structOpt(column, op, reflect.Indirect(fv).Interface()))
+	}
+	return optFn
+}
+
+func structOpt(column, op string, val interface{}) FnOpt {
+	switch op {
+	case TagEq:
+		return Eq(column, val)
+	case TagNeq:
+		return Neq(column, val)
+	case TagGt:
+		return Gt(column, val)
+	case TagGe:
+		return Ge(column, val)
+	case TagLt:
+		return Lt(column, val)
+	case TagLe:
+		return Le(column, val)
+	case TagIn:
+		return In(column, val)
+	case TagNotIn:
+		return NotIn(column, val)
+	case TagIEq:
+		return IEq(column, fmt.Sprint(val))
+	case TagILike:
+		return IContains(column, fmt.Sprint(val))
+	case TagPrefix:
+		return IPrefix(column, fmt.Sprint(val))
+	case TagSuffix:
+		return ISuffix(column, fmt.Sprint(val))
+	case TagNull:
+		if isNull, ok := val.(bool); ok && !isNull {
+			return NotNull(column)
+		}
+		return IsNull(column)
+	case TagArrayHas:
+		return ArrayContains(column, val)
+	case TagOverlaps:
+		return ArrayOverlaps(column, val)
+	}
+	panic("Unknown filter operator: " + op)
+}
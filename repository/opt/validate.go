@@ -0,0 +1,87 @@
+package opt
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/go-pg/pg/v10/types"
+)
+
+// Validate calls Validate for each FnOpt in a chain
+func Validate(model interface{}, optFn ...FnOpt) error {
+	return New(optFn...).Validate(model)
+}
+
+// Validate checks that every column referenced in options exists in the model table and returns BadRequest error
+// with the first unknown column. Columns qualified with alias of another table (e.g. joined one) and raw
+// expressions are not checked
+func (o *Opt) Validate(model interface{}) error {
+	if o == nil {
+		return nil
+	}
+
+	typ := reflect.TypeOf(model)
+	for typ != nil && (typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return pkgerr.NewBadRequestError(errors.New("model must be struct, pointer to struct or slice of structs"))
+	}
+
+	t := orm.GetTable(typ)
+	for _, column := range o.columns() {
+		name := column
+		if i := strings.LastIndexByte(column, '.'); i >= 0 {
+			alias := column[:i]
+			if alias != t.ModelName && alias != strings.Trim(string(t.SQLName), `"`) {
+				continue
+			}
+			name = column[i+1:]
+		}
+
+		if name != "*" && !t.HasField(name) {
+			msg := fmt.Sprintf("unknown column %s of table %s", column, t.SQLName)
+			return pkgerr.NewBadRequestError(errors.New(msg)).WithMessage(msg)
+		}
+	}
+
+	return nil
+}
+
+// columns returns columns referenced in options, conditions and orders refer columns with pg.Ident params
+func (o *Opt) columns() []string {
+	columns := make([]string, 0, len(o.Columns)+len(o.Filter))
+	columns = append(columns, o.Columns...)
+	columns = append(columns, o.DistinctOn...)
+	columns = append(columns, o.Group...)
+	if o.SortBy != "" {
+		columns = append(columns, o.SortBy)
+	}
+
+	var params []interface{}
+	for _, cond := range o.Filter {
+		params = append(params, cond.Params()...)
+	}
+	for _, cond := range o.Having {
+		params = append(params, cond.Params()...)
+	}
+	for _, expr := range o.Orders {
+		params = append(params, expr.Params()...)
+	}
+	for _, join := range o.Joins {
+		for _, cond := range join.On {
+			params = append(params, cond.Params()...)
+		}
+	}
+
+	for _, param := range params {
+		if ident, ok := param.(types.Ident); ok {
+			columns = append(columns, string(ident))
+		}
+	}
+	return columns
+}
@@ -26,6 +26,20 @@ type DescNullsFirst string
 // DescNullsLast sort in descending order with NULL at the end
 type DescNullsLast string
 
+// Raw sort by expression, direction is a part of expression
+type Raw struct {
+	Query       string
+	QueryParams []interface{}
+}
+
+// TextRank sort by full text search rank in descending order,
+// default text search configuration is used for empty Language
+type TextRank struct {
+	Column   string
+	Query    string
+	Language string
+}
+
 // Expression provide query expression
 func (e Asc) Expression() string {
 	return "? ASC"
@@ -97,3 +111,37 @@ func (e DescNullsLast) Params() []interface{} {
 		pg.Ident(string(e)),
 	}
 }
+
+// Expression provide query expression
+func (e Raw) Expression() string {
+	return e.Query
+}
+
+// Params provide query params
+func (e Raw) Params() []interface{} {
+	return e.QueryParams
+}
+
+// Expression provide query expression
+func (e TextRank) Expression() string {
+	if e.Language == "" {
+		return "ts_rank(to_tsvector(?), plainto_tsquery(?)) DESC"
+	}
+	return "ts_rank(to_tsvector(?, ?), plainto_tsquery(?, ?)) DESC"
+}
+
+// Params provide query params
+func (e TextRank) Params() []interface{} {
+	if e.Language == "" {
+		return []interface{}{
+			pg.Ident(e.Column),
+			e.Query,
+		}
+	}
+	return []interface{}{
+		e.Language,
+		pg.Ident(e.Column),
+		e.Language,
+		e.Query,
+	}
+}
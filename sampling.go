@@ -0,0 +1,84 @@
+package database
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxRateWindows is the number of fingerprints tracked by rate limiter before expired windows are swept
+const maxRateWindows = 10000
+
+// WithLogSampling makes logger write only rate fraction of queries, e.g. 0.01 logs every hundredth query on average.
+// Failed queries are always logged
+func WithLogSampling(rate float64) LoggerOption {
+	return func(l *dbLogger) {
+		l.sampleRate = rate
+	}
+}
+
+// WithLogRateLimit makes logger write at most limit queries of the same fingerprint (see QueryFingerprint)
+// per interval, the number of queries suppressed since the last written one is logged in suppressed field.
+// Failed queries are always logged
+func WithLogRateLimit(limit int, interval time.Duration) LoggerOption {
+	return func(l *dbLogger) {
+		l.rateLimiter = &rateLimiter{limit: limit, interval: interval, windows: make(map[string]*rateWindow)}
+	}
+}
+
+// sampled reports whether query is logged according to the sampling rate
+func (d *dbLogger) sampled() bool {
+	return d.sampleRate >= 1 || rand.Float64() < d.sampleRate
+}
+
+// rateLimiter limits the number of logged queries per fingerprint
+type rateLimiter struct {
+	limit    int
+	interval time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// allow reports whether query of fingerprint is logged at now and the number of queries suppressed before it
+func (l *rateLimiter) allow(fingerprint string, now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.windows[fingerprint]
+	if !ok || now.Sub(w.start) >= l.interval {
+		if !ok && len(l.windows) >= maxRateWindows {
+			l.sweep(now)
+		}
+		suppressed := 0
+		if ok {
+			suppressed = w.suppressed
+		}
+		l.windows[fingerprint] = &rateWindow{start: now, count: 1}
+		return true, suppressed
+	}
+
+	if w.count >= l.limit {
+		w.suppressed++
+		return false, 0
+	}
+	w.count++
+	suppressed := w.suppressed
+	w.suppressed = 0
+	return true, suppressed
+}
+
+// sweep removes expired windows without suppressed queries
+func (l *rateLimiter) sweep(now time.Time) {
+	for fingerprint, w := range l.windows {
+		if now.Sub(w.start) >= l.interval && w.suppressed == 0 {
+			delete(l.windows, fingerprint)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBLogger_Sampled(t *testing.T) {
+	assert.True(t, newDBLogger(nil, 0).sampled())
+	assert.True(t, newDBLogger(nil, 0, WithLogSampling(1)).sampled())
+	assert.False(t, newDBLogger(nil, 0, WithLogSampling(0)).sampled())
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newDBLogger(nil, 0, WithLogRateLimit(2, time.Minute)).rateLimiter
+	now := time.Now()
+
+	for i, expected := range []bool{true, true, false, false} {
+		ok, suppressed := l.allow("a", now.Add(time.Duration(i)*time.Second))
+		assert.Equal(t, expected, ok)
+		assert.Zero(t, suppressed)
+	}
+	ok, _ := l.allow("b", now)
+	assert.True(t, ok)
+
+	ok, suppressed := l.allow("a", now.Add(time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 2, suppressed)
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// searchPathKey is the context key of search_path override, distinct type keeps it apart from keys of other
+// context values
+type searchPathKey struct{}
+
+// WithSearchPath sets search_path of connections to the primary and replicas to comma separated schemas,
+// e.g. "billing,public", so models of the schemas are not qualified in tags. It is set on connect, so connections
+// of handles passed to NewDbClient or NewDbClientWithReplicas opened before the client is created keep their
+// search_path
+func WithSearchPath(path string) Option {
+	path = quoteSearchPath(path)
+	// configured is the config of the primary changed by Connect, so it isn't changed again by apply
+	var configured *pg.Options
+	return Option{
+		configure: func(cfg *pg.Options) {
+			configured = cfg
+			addOnConnect(cfg, "SELECT set_config('search_path', ?, false)", path)
+		},
+		apply: func(w *dbWrapper) *dbWrapper {
+			for _, db := range w.dbs() {
+				if db.Options() != configured {
+					addOnConnect(db.Options(), "SELECT set_config('search_path', ?, false)", path)
+				}
+			}
+			return w
+		},
+	}
+}
+
+// ContextWithSearchPath returns context overriding search_path with comma separated schemas for queries of
+// the context. Transactions started by RunInTx (and DAO.WithTX) set it for the transaction, queries outside
+// of transaction run within implicit one setting it, on the primary or on a replica, COPY is not affected
+func ContextWithSearchPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, searchPathKey{}, path)
+}
+
+// SearchPathFromContext returns search_path stored in context with ContextWithSearchPath
+func SearchPathFromContext(ctx context.Context) string {
+	path, _ := ctx.Value(searchPathKey{}).(string)
+	return path
+}
+
+// setSearchPath sets search_path of ctx for the transaction only, so it does not leak to other users
+// of the pooled connection
+func setSearchPath(ctx context.Context, tx *pg.Tx) error {
+	path := SearchPathFromContext(ctx)
+	if path == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT set_config('search_path', ?, true)", quoteSearchPath(path))
+	return err
+}
+
+// inSearchPath runs fn with db, if ctx overrides search_path with ContextWithSearchPath, fn runs within transaction
+// of db setting it, so it does not leak to other users of the pooled connection
+func inSearchPath(ctx context.Context, db *pg.DB, fn func(db orm.DB) (orm.Result, error)) (orm.Result, error) {
+	if SearchPathFromContext(ctx) == "" {
+		return fn(db)
+	}
+
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// rollback of not committed transaction
+	defer func() { _ = tx.Close() }()
+
+	if err := setSearchPath(ctx, tx); err != nil {
+		return nil, err
+	}
+	res, err := fn(tx)
+	if err != nil {
+		return nil, err
+	}
+	return res, tx.CommitContext(ctx)
+}
+
+// quoteSearchPath quotes schemas of comma separated path, so names are not folded to lower case
+func quoteSearchPath(path string) string {
+	schemas := strings.Split(path, ",")
+	for i, schema := range schemas {
+		schema = strings.TrimSpace(schema)
+		schema = strings.TrimSuffix(strings.TrimPrefix(schema, `"`), `"`)
+		schemas[i] = `"` + strings.ReplaceAll(schema, `"`, `""`) + `"`
+	}
+	return strings.Join(schemas, ", ")
+}
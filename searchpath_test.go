@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteSearchPath(t *testing.T) {
+	assert.Equal(t, `"billing", "public"`, quoteSearchPath("billing, public"))
+	assert.Equal(t, `"$user", "Billing"`, quoteSearchPath(`"$user",Billing`))
+	assert.Equal(t, `"a""b"`, quoteSearchPath(`a"b`))
+}
+
+func TestConnect_WithSearchPath(t *testing.T) {
+	cfg := &pg.Options{Addr: "localhost:1"}
+	client := Connect("test", cfg, WithSearchPath("billing,public"))
+	defer client.Close()
+
+	// the default OnConnect setting application name is kept
+	assert.NotNil(t, cfg.OnConnect)
+	assert.Equal(t, "test", cfg.ApplicationName)
+}
+
+func TestNewDbClientWithReplicas_WithSearchPath(t *testing.T) {
+	primary := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	replica := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	client := NewDbClientWithReplicas(primary, []*pg.DB{replica}, WithSearchPath("billing"))
+	defer client.Close()
+
+	assert.NotNil(t, primary.Options().OnConnect)
+	assert.NotNil(t, replica.Options().OnConnect)
+}
+
+func TestContextWithSearchPath(t *testing.T) {
+	ctx := ContextWithSearchPath(context.Background(), "billing")
+	assert.Equal(t, "billing", SearchPathFromContext(ctx))
+	assert.Empty(t, SearchPathFromContext(WithPrimary(context.Background())))
+}
@@ -0,0 +1,55 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+)
+
+// FanOut calls fn for every shard concurrently with ctx routing queries to the shard (see WithShard),
+// errors of the shards are joined
+func (r *Router) FanOut(ctx context.Context, fn func(ctx context.Context, name string) error) error {
+	return r.each(func(i int, _ db.Client) error {
+		return fn(WithShard(ctx, r.names[i]), r.names[i])
+	})
+}
+
+// FindList selects records of all the shards concurrently with find into receiver, pointer to slice, e.g. with
+// DAO.FindList of DAO on top of the router, and merges them sorted by less if it is not nil. Limit and offset
+// of find are applied to every shard, so the merged list has to be truncated to get the page of all the shards
+func (r *Router) FindList(ctx context.Context, receiver interface{},
+	find func(ctx context.Context, receiver interface{}) error, less func(a, b interface{}) bool) error {
+	rv := reflect.ValueOf(receiver)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("shard: receiver must be pointer to slice")
+	}
+	sliceType := rv.Elem().Type()
+
+	parts := make([]reflect.Value, len(r.names))
+	err := r.FanOut(ctx, func(ctx context.Context, name string) error {
+		part := reflect.New(sliceType)
+		if err := find(ctx, part.Interface()); err != nil {
+			return err
+		}
+		parts[sort.SearchStrings(r.names, name)] = part.Elem()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	for _, part := range parts {
+		merged = reflect.AppendSlice(merged, part)
+	}
+	if less != nil {
+		sort.SliceStable(merged.Interface(), func(i, j int) bool {
+			return less(merged.Index(i).Interface(), merged.Index(j).Interface())
+		})
+	}
+	rv.Elem().Set(merged)
+	return nil
+}
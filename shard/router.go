@@ -0,0 +1,501 @@
+// Package shard routes queries of the Client interface to one of several databases by shard key carried in context
+// or extracted from the model, so DAO works on top of sharded databases as on top of a single one
+package shard
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+var (
+	// ErrNoShardKey is returned for query which shard isn't determined by context or model
+	ErrNoShardKey = errors.New("shard: no shard key in context or model")
+	// ErrCrossShard is returned for query of models of several shards or of another shard than its transaction
+	ErrCrossShard = errors.New("shard: query spans several shards")
+)
+
+type ctxKey int
+
+const (
+	keyCtxKey ctxKey = iota
+	shardCtxKey
+	txShardCtxKey
+)
+
+// WithKey returns context routing queries, which models don't hold shard key, to the shard of key
+func WithKey(ctx context.Context, key interface{}) context.Context {
+	return context.WithValue(ctx, keyCtxKey, key)
+}
+
+// KeyFromContext returns shard key stored in context with WithKey
+func KeyFromContext(ctx context.Context) (interface{}, bool) {
+	key := ctx.Value(keyCtxKey)
+	return key, key != nil
+}
+
+// WithShard returns context routing queries to the shard of name regardless of shard keys, e.g. for maintenance
+func WithShard(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, shardCtxKey, name)
+}
+
+// Router is a Client routing queries to shards. Shard of the query is determined by WithShard of context, by key
+// of strategy column of the model (all the models of bulk query must be of the same shard) or by WithKey of context,
+// in that order. Transaction of RunInTx is started on the shard of context, queries within it run on that shard
+// and fail with ErrCrossShard if they are determined to be of another one
+type Router struct {
+	ctx      context.Context
+	shards   map[string]db.Client
+	names    []string
+	strategy Strategy
+}
+
+var _ db.Client = (*Router)(nil)
+var _ orm.DB = (*Router)(nil)
+
+// New returns router of shards keyed by name, strategy maps shard keys to the names. It panics if there are no shards
+func New(shards map[string]db.Client, strategy Strategy) *Router {
+	if len(shards) == 0 {
+		panic("shard: no shards")
+	}
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &Router{shards: shards, names: names, strategy: strategy}
+}
+
+// Names returns sorted names of the shards
+func (r *Router) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Shard returns client of the shard of name, nil if there is no such shard
+func (r *Router) Shard(name string) db.Client {
+	return r.shards[name]
+}
+
+// route returns client of the shard of query bound to ctx
+func (r *Router) route(ctx context.Context, query interface{}) (db.Client, error) {
+	name, err := r.resolve(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	client, ok := r.shards[name]
+	if !ok {
+		return nil, fmt.Errorf("shard: unknown shard '%s'", name)
+	}
+	return client.WithContext(ctx), nil
+}
+
+// resolve returns name of the shard of query, queries within transaction are pinned to its shard
+func (r *Router) resolve(ctx context.Context, query interface{}) (string, error) {
+	name, err := r.keyShard(ctx, query)
+	txName, inTx := ctx.Value(txShardCtxKey).(string)
+	if !inTx {
+		return name, err
+	}
+
+	switch {
+	case err == ErrNoShardKey:
+		return txName, nil
+	case err != nil:
+		return "", err
+	case name != txName:
+		return "", ErrCrossShard
+	}
+	return txName, nil
+}
+
+// keyShard returns name of the shard of WithShard, model of query or WithKey
+func (r *Router) keyShard(ctx context.Context, query interface{}) (string, error) {
+	if name, ok := ctx.Value(shardCtxKey).(string); ok {
+		return name, nil
+	}
+	if name, found, err := r.modelShard(query); err != nil || found {
+		return name, err
+	}
+	if key, ok := KeyFromContext(ctx); ok {
+		return r.strategy.Shard(key)
+	}
+	return "", ErrNoShardKey
+}
+
+// modelShard returns name of the shard of non-zero keys of models of query built with Model
+func (r *Router) modelShard(query interface{}) (name string, found bool, err error) {
+	cmd, ok := query.(orm.QueryCommand)
+	if !ok || cmd.Query() == nil {
+		return "", false, nil
+	}
+	model := cmd.Query().TableModel()
+	if model == nil || model.IsNil() {
+		return "", false, nil
+	}
+	field, ok := model.Table().FieldsMap[r.strategy.Column]
+	if !ok {
+		return "", false, nil
+	}
+
+	for _, strct := range structs(model.Value()) {
+		if field.HasZeroValue(strct) {
+			continue
+		}
+		shard, err := r.strategy.Shard(field.Value(strct).Interface())
+		if err != nil {
+			return "", false, err
+		}
+		if found && shard != name {
+			return "", false, ErrCrossShard
+		}
+		name, found = shard, true
+	}
+	return name, found, nil
+}
+
+// structs returns struct of v or structs of slice v
+func structs(v reflect.Value) []reflect.Value {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{v}
+	case reflect.Slice:
+		res := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if elem := reflect.Indirect(v.Index(i)); elem.Kind() == reflect.Struct {
+				res = append(res, elem)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// each calls fn for every shard concurrently, errors are joined
+func (r *Router) each(fn func(i int, client db.Client) error) error {
+	errs := make([]error, len(r.names))
+	var wg sync.WaitGroup
+	for i, name := range r.names {
+		wg.Add(1)
+		go func(i int, client db.Client) {
+			defer wg.Done()
+			errs[i] = fn(i, client)
+		}(i, r.shards[name])
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Db returns the primary of the shard of context the router is bound to, nil if the shard isn't determined
+func (r *Router) Db() *pg.DB {
+	client, err := r.route(r.Context(), nil)
+	if err != nil {
+		return nil
+	}
+	return client.Db()
+}
+
+// SQLDB returns database/sql handle of the primary of the shard of context the router is bound to
+func (r *Router) SQLDB() (*sql.DB, error) {
+	client, err := r.route(r.Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.SQLDB()
+}
+
+// Tx returns transaction of the context the router is bound to with WithContext
+func (r *Router) Tx() *pg.Tx {
+	return db.FromContext(r.Context())
+}
+
+// RunInTx executes fn within transaction of the shard of ctx, see db.Client.RunInTx
+func (r *Router) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if db.InTx(ctx) {
+		return fn(ctx)
+	}
+	name, err := r.keyShard(ctx, nil)
+	if err != nil {
+		return err
+	}
+	client, ok := r.shards[name]
+	if !ok {
+		return fmt.Errorf("shard: unknown shard '%s'", name)
+	}
+	return client.RunInTx(ctx, func(ctx context.Context) error {
+		return fn(context.WithValue(ctx, txShardCtxKey, name))
+	})
+}
+
+// Context returns context the router is bound to with WithContext
+func (r *Router) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of the router bound to ctx
+func (r *Router) WithContext(ctx context.Context) db.Client {
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+// Close closes all the shards
+func (r *Router) Close() error {
+	var errs []error
+	for _, name := range r.names {
+		errs = append(errs, r.shards[name].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown shuts down all the shards concurrently
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.each(func(_ int, client db.Client) error {
+		return client.Shutdown(ctx)
+	})
+}
+
+// HealthReport returns the primary of the first shard with unhealthy primary, or of the first shard if all
+// are healthy, so Healthy reports readiness of all the shards. Replicas of all the shards are returned
+func (r *Router) HealthReport() db.HealthReport {
+	var report db.HealthReport
+	for i, name := range r.names {
+		shard := r.shards[name].HealthReport()
+		if i == 0 || report.Primary.Healthy && !shard.Primary.Healthy {
+			report.Primary = shard.Primary
+		}
+		report.Replicas = append(report.Replicas, shard.Replicas...)
+	}
+	return report
+}
+
+// HealthCheck checks all the shards concurrently, the report is healthy if all the shards are. The primary and
+// migrations are the ones of the first unhealthy shard, or of the first shard if all are healthy
+func (r *Router) HealthCheck(ctx context.Context, opts db.HealthOpts) db.HealthCheckReport {
+	reports := make([]db.HealthCheckReport, len(r.names))
+	_ = r.each(func(i int, client db.Client) error {
+		reports[i] = client.HealthCheck(ctx, opts)
+		return nil
+	})
+
+	report := reports[0]
+	report.Replicas = nil
+	report.Replication = nil
+	var replicationErrs []error
+	for _, shard := range reports {
+		if report.Healthy && !shard.Healthy {
+			report.Healthy, report.Primary, report.Migrations = false, shard.Primary, shard.Migrations
+		}
+		report.Replicas = append(report.Replicas, shard.Replicas...)
+		report.Replication = append(report.Replication, shard.Replication...)
+		replicationErrs = append(replicationErrs, shard.ReplicationError)
+	}
+	report.ReplicationError = errors.Join(replicationErrs...)
+	return report
+}
+
+// Stats returns stats of all the shards, errors of the shards are joined
+func (r *Router) Stats(ctx context.Context) (db.Stats, error) {
+	shards := make([]db.Stats, len(r.names))
+	err := r.each(func(i int, client db.Client) (err error) {
+		shards[i], err = client.Stats(ctx)
+		return err
+	})
+
+	var stats db.Stats
+	for _, shard := range shards {
+		stats.Pools = append(stats.Pools, shard.Pools...)
+		stats.TopQueries = append(stats.TopQueries, shard.TopQueries...)
+	}
+	return stats, err
+}
+
+// ActiveQueries returns active queries of all the shards, errors of the shards are joined
+func (r *Router) ActiveQueries(ctx context.Context) ([]db.ActiveQuery, error) {
+	shards := make([][]db.ActiveQuery, len(r.names))
+	err := r.each(func(i int, client db.Client) (err error) {
+		shards[i], err = client.ActiveQueries(ctx)
+		return err
+	})
+
+	var active []db.ActiveQuery
+	for _, shard := range shards {
+		active = append(active, shard...)
+	}
+	return active, err
+}
+
+// Model returns query routed to the shard when it is executed
+func (r *Router) Model(model ...interface{}) *orm.Query {
+	q := orm.NewQuery(r, model...)
+	if r.ctx != nil {
+		q = q.Context(r.ctx)
+	}
+	return q
+}
+
+// ModelContext ...
+func (r *Router) ModelContext(c context.Context, model ...interface{}) *orm.Query {
+	return orm.NewQuery(r, model...).Context(c)
+}
+
+// Select ...
+func (r *Router) Select(model interface{}) error {
+	return r.Model(model).WherePK().Select()
+}
+
+// Insert ...
+func (r *Router) Insert(model ...interface{}) error {
+	_, err := r.Model(model...).Insert()
+	return err
+}
+
+// Update ...
+func (r *Router) Update(model interface{}) error {
+	_, err := r.Model(model).WherePK().Update()
+	return err
+}
+
+// Delete ...
+func (r *Router) Delete(model interface{}) error {
+	_, err := r.Model(model).WherePK().Delete()
+	return err
+}
+
+// ForceDelete ...
+func (r *Router) ForceDelete(model interface{}) error {
+	_, err := r.Model(model).WherePK().ForceDelete()
+	return err
+}
+
+// Exec ...
+func (r *Router) Exec(query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.Exec(query, params...)
+}
+
+// ExecOne ...
+func (r *Router) ExecOne(query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.ExecOne(query, params...)
+}
+
+// Query ...
+func (r *Router) Query(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.Query(model, query, params...)
+}
+
+// QueryOne ...
+func (r *Router) QueryOne(model, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.QueryOne(model, query, params...)
+}
+
+// ExecContext ...
+func (r *Router) ExecContext(c context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(c, query)
+	if err != nil {
+		return nil, err
+	}
+	if cdb, ok := client.(orm.DB); ok {
+		return cdb.ExecContext(c, query, params...)
+	}
+	return client.Exec(query, params...)
+}
+
+// ExecOneContext ...
+func (r *Router) ExecOneContext(c context.Context, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(c, query)
+	if err != nil {
+		return nil, err
+	}
+	if cdb, ok := client.(orm.DB); ok {
+		return cdb.ExecOneContext(c, query, params...)
+	}
+	return client.ExecOne(query, params...)
+}
+
+// QueryContext ...
+func (r *Router) QueryContext(c context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(c, query)
+	if err != nil {
+		return nil, err
+	}
+	if cdb, ok := client.(orm.DB); ok {
+		return cdb.QueryContext(c, model, query, params...)
+	}
+	return client.Query(model, query, params...)
+}
+
+// QueryOneContext ...
+func (r *Router) QueryOneContext(c context.Context, model, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(c, query)
+	if err != nil {
+		return nil, err
+	}
+	if cdb, ok := client.(orm.DB); ok {
+		return cdb.QueryOneContext(c, model, query, params...)
+	}
+	return client.QueryOne(model, query, params...)
+}
+
+// CopyFrom copies data to the shard of context the router is bound to
+func (r *Router) CopyFrom(rd io.Reader, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.CopyFrom(rd, query, params...)
+}
+
+// CopyTo copies data from the shard of context the router is bound to
+func (r *Router) CopyTo(w io.Writer, query interface{}, params ...interface{}) (orm.Result, error) {
+	client, err := r.route(r.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return client.CopyTo(w, query, params...)
+}
+
+// FormatQuery formats query with the formatter of the first shard, formatting doesn't depend on the shard
+func (r *Router) FormatQuery(b []byte, query string, params ...interface{}) []byte {
+	return r.shards[r.names[0]].FormatQuery(b, query, params...)
+}
+
+// Formatter returns the formatter of the first shard, formatting doesn't depend on the shard. Default formatter
+// is returned if the shard client provides none, e.g. wrapped client without go-pg handle
+func (r *Router) Formatter() orm.QueryFormatter {
+	client := r.shards[r.names[0]]
+	if cdb, ok := client.(orm.DB); ok {
+		return cdb.Formatter()
+	}
+	if pgdb := client.Db(); pgdb != nil {
+		return pgdb.Formatter()
+	}
+	return orm.NewFormatter()
+}
@@ -0,0 +1,153 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	db "github.com/alexandr-kononykhin-vay/postgres"
+	"github.com/alexandr-kononykhin-vay/postgres/pgxclient"
+	"github.com/go-pg/pg/v10"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type agent struct {
+	tableName struct{} `pg:"agents"` //nolint
+	ID        int64    `pg:"id,pk"`
+	AgentID   int64    `pg:"agent_id"`
+}
+
+// countHook counts queries of the shard
+type countHook struct {
+	queries int
+}
+
+func (h *countHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	h.queries++
+	return ctx, nil
+}
+
+func (h *countHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
+
+// newRouter returns router of unreachable shards "0" and "1", queries fail but are counted by hooks
+func newRouter(t *testing.T) (*Router, map[string]*countHook) {
+	hooks := map[string]*countHook{}
+	shards := map[string]db.Client{}
+	for name, addr := range map[string]string{"0": "127.0.0.1:1", "1": "127.0.0.1:2"} {
+		conn := pg.Connect(&pg.Options{Addr: addr})
+		hooks[name] = &countHook{}
+		conn.AddQueryHook(hooks[name])
+		shards[name] = db.NewDbClient(conn)
+	}
+	router := New(shards, ByModulo("agent_id", 2))
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+	return router, hooks
+}
+
+func TestRouter_Route(t *testing.T) {
+	router, hooks := newRouter(t)
+	ctx := context.Background()
+
+	_ = router.Insert(&agent{AgentID: 3})
+	assert.Equal(t, 0, hooks["0"].queries)
+	assert.Equal(t, 1, hooks["1"].queries)
+
+	_ = router.WithContext(WithKey(ctx, 4)).Model(&agent{}).Where("id = 1").Select()
+	assert.Equal(t, 1, hooks["0"].queries)
+
+	_, _ = router.WithContext(WithShard(ctx, "1")).Exec("SELECT 1")
+	assert.Equal(t, 2, hooks["1"].queries)
+
+	err := router.Insert(&[]agent{{AgentID: 1}, {AgentID: 2}})
+	assert.ErrorIs(t, err, ErrCrossShard)
+	err = router.Model(&agent{}).Where("id = 1").Select()
+	assert.ErrorIs(t, err, ErrNoShardKey)
+	_, err = router.Exec("SELECT 1")
+	assert.ErrorIs(t, err, ErrNoShardKey)
+	_, err = router.WithContext(WithShard(ctx, "2")).Exec("SELECT 1")
+	assert.Error(t, err)
+	assert.Nil(t, router.Db())
+	assert.Equal(t, []string{"0", "1"}, router.Names())
+}
+
+func TestRouter_Resolve(t *testing.T) {
+	router, _ := newRouter(t)
+	txCtx := context.WithValue(WithKey(context.Background(), 1), txShardCtxKey, "1")
+
+	name, err := router.resolve(txCtx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1", name)
+
+	_, err = router.resolve(WithShard(txCtx, "0"), nil)
+	assert.ErrorIs(t, err, ErrCrossShard)
+
+	name, err = router.resolve(context.WithValue(context.Background(), txShardCtxKey, "0"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "0", name)
+}
+
+func TestRouter_FindList(t *testing.T) {
+	router, _ := newRouter(t)
+
+	var agents []agent
+	err := router.FindList(context.Background(), &agents, func(ctx context.Context, receiver interface{}) error {
+		name, err := router.resolve(ctx, nil)
+		if err != nil {
+			return err
+		}
+		list := receiver.(*[]agent)
+		if name == "0" {
+			*list = []agent{{ID: 2}, {ID: 4}}
+		} else {
+			*list = []agent{{ID: 1}, {ID: 3}}
+		}
+		return nil
+	}, func(a, b interface{}) bool {
+		return a.(agent).ID < b.(agent).ID
+	})
+	require.NoError(t, err)
+	require.Len(t, agents, 4)
+	for i, a := range agents {
+		assert.Equal(t, int64(i+1), a.ID)
+	}
+
+	failure := errors.New("failure")
+	err = router.FindList(context.Background(), &agents, func(context.Context, interface{}) error {
+		return failure
+	}, nil)
+	assert.ErrorIs(t, err, failure)
+	assert.Error(t, router.FindList(context.Background(), agents, nil, nil))
+}
+
+func TestRouter_Formatter(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://user@127.0.0.1:1/db?connect_timeout=1")
+	require.NoError(t, err)
+	// wrapped client is not orm.DB and has no go-pg handle
+	router := New(map[string]db.Client{"0": struct{ db.Client }{pgxclient.New(pool)}}, ByModulo("agent_id", 1))
+	defer router.Close()
+
+	assert.Equal(t, "SELECT 'a'", string(router.Formatter().FormatQuery(nil, "SELECT ?", "a")))
+}
+
+func TestByModulo(t *testing.T) {
+	strategy := ByModulo("agent_id", 3)
+	for key, expected := range map[interface{}]string{4: "1", int64(-1): "2", uint8(5): "2"} {
+		name, err := strategy.Shard(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, name)
+	}
+
+	first, err := strategy.Shard("6f1c8a34-6b8e-4d5e-9d1a-2f1f5b1c7e90")
+	require.NoError(t, err)
+	second, _ := strategy.Shard("6f1c8a34-6b8e-4d5e-9d1a-2f1f5b1c7e90")
+	assert.Equal(t, first, second)
+
+	_, err = strategy.Shard(1.5)
+	assert.Error(t, err)
+}
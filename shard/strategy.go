@@ -0,0 +1,53 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+)
+
+// Strategy maps shard key to name of the shard
+type Strategy struct {
+	// Column is the column of models holding shard key
+	Column string
+	// Shard returns name of the shard of key
+	Shard func(key interface{}) (string, error)
+}
+
+// ByModulo maps key of column to one of n shards named "0" to "n-1" by key modulo n. Integer keys are mapped
+// by their value, string and fmt.Stringer keys (e.g. UUID) by FNV-1a hash of the string
+func ByModulo(column string, n int) Strategy {
+	return Strategy{
+		Column: column,
+		Shard: func(key interface{}) (string, error) {
+			if n < 1 {
+				return "", fmt.Errorf("shard: modulo %d is not positive", n)
+			}
+			v := reflect.Indirect(reflect.ValueOf(key))
+			switch v.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return strconv.FormatInt((v.Int()%int64(n)+int64(n))%int64(n), 10), nil
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return strconv.FormatUint(v.Uint()%uint64(n), 10), nil
+			case reflect.String:
+				return strconv.FormatUint(uint64(hash(v.String()))%uint64(n), 10), nil
+			}
+			if s, ok := key.(fmt.Stringer); ok {
+				return strconv.FormatUint(uint64(hash(s.String()))%uint64(n), 10), nil
+			}
+			return "", fmt.Errorf("shard: key of type %T is not supported by modulo", key)
+		},
+	}
+}
+
+// ByFunc maps key of column with fn
+func ByFunc(column string, fn func(key interface{}) (string, error)) Strategy {
+	return Strategy{Column: column, Shard: fn}
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
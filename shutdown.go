@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// ErrShutdown is returned instead of running the query or transaction started after Shutdown
+var ErrShutdown = errors.New("pg: client is shut down")
+
+// inflightQueryKey is the Stash key marking query counted by drain, distinct type keeps it apart from keys of other hooks
+type inflightQueryKey struct{}
+
+// Drain counts in-flight queries and transactions of client, it rejects new ones after shutdown starts.
+// Queries of transactions started before are let through, so the transactions complete. It implements Shutdown
+// of clients of other drivers, e.g. pgxclient
+type Drain struct {
+	inflight atomic.Int64
+	closing  atomic.Bool
+	// idle is signaled when the last in-flight query or transaction is done during shutdown
+	idle chan struct{}
+}
+
+// NewDrain creates Drain accepting queries and transactions
+func NewDrain() *Drain {
+	return &Drain{idle: make(chan struct{}, 1)}
+}
+
+// drain is a query hook tracking queries of go-pg handles with Drain
+type drain struct {
+	*Drain
+	// hooks are registered by WithOnShutdown
+	hooks []func(ctx context.Context)
+}
+
+func newDrain() *drain {
+	return &drain{Drain: NewDrain()}
+}
+
+// WithOnShutdown registers fn called by Shutdown after new queries are rejected and before in-flight ones are waited
+// for, e.g. to stop listeners and workers holding connections
+func WithOnShutdown(fn func(ctx context.Context)) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		w.drain.hooks = append(w.drain.hooks, fn)
+		return w
+	})
+}
+
+// Shutdown rejects new queries and transactions with ErrShutdown, calls hooks of WithOnShutdown, waits for in-flight
+// queries and transactions until ctx is done and closes the client. ctx error is returned if they are not done
+func (w *dbWrapper) Shutdown(ctx context.Context) error {
+	w.drain.Close()
+
+	for _, hook := range w.drain.hooks {
+		hook(ctx)
+	}
+
+	err := w.drain.Wait(ctx)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close makes Acquire reject queries and transactions started afterwards
+func (d *Drain) Close() {
+	d.closing.Store(true)
+}
+
+// Acquire counts started query or transaction, it reports false if it is rejected by shutdown.
+// Queries within transaction (inTx) are not rejected
+func (d *Drain) Acquire(inTx bool) bool {
+	d.inflight.Add(1)
+	if d.closing.Load() && !inTx {
+		d.Release()
+		return false
+	}
+	return true
+}
+
+// Release counts done query or transaction
+func (d *Drain) Release() {
+	if d.inflight.Add(-1) == 0 && d.closing.Load() {
+		select {
+		case d.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Wait waits until there are no in-flight queries and transactions or ctx is done
+func (d *Drain) Wait(ctx context.Context) error {
+	for d.inflight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-d.idle:
+		}
+	}
+	return nil
+}
+
+func (d *drain) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	_, inTx := event.DB.(*pg.Tx)
+	if !d.Acquire(inTx) {
+		return ctx, ErrShutdown
+	}
+	if event.Stash == nil {
+		event.Stash = make(map[interface{}]interface{})
+	}
+	event.Stash[inflightQueryKey{}] = true
+	return ctx, nil
+}
+
+func (d *drain) AfterQuery(_ context.Context, event *pg.QueryEvent) error {
+	// the hook is called for query rejected by itself too
+	if event.Stash[inflightQueryKey{}] == true {
+		d.Release()
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDbWrapper_Shutdown(t *testing.T) {
+	var hookCalled bool
+	client := NewDbClient(pg.Connect(&pg.Options{Addr: "localhost:1"}), WithOnShutdown(func(ctx context.Context) {
+		hookCalled = true
+	}))
+	w := client.(*dbWrapper)
+
+	require.True(t, w.drain.Acquire(false))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// queries of in-flight transaction are let through
+		assert.True(t, w.drain.Acquire(true))
+		w.drain.Release()
+		w.drain.Release()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Shutdown(ctx))
+	assert.True(t, hookCalled)
+
+	_, err := client.Exec("SELECT 1")
+	assert.ErrorIs(t, err, ErrShutdown)
+	err = client.RunInTx(context.Background(), func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrShutdown)
+}
+
+func TestDbWrapper_ShutdownTimeout(t *testing.T) {
+	client := NewDbClient(pg.Connect(&pg.Options{Addr: "localhost:1"}))
+	w := client.(*dbWrapper)
+	require.True(t, w.drain.Acquire(false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestDrain_RejectedQueryIsNotCounted(t *testing.T) {
+	d := newDrain()
+	d.closing.Store(true)
+
+	event := &pg.QueryEvent{DB: &pg.DB{}}
+	_, err := d.BeforeQuery(context.Background(), event)
+	assert.ErrorIs(t, err, ErrShutdown)
+	require.NoError(t, d.AfterQuery(context.Background(), event))
+	assert.Zero(t, d.inflight.Load())
+}
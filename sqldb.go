@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/lib/pq"
+)
+
+// sslRequestCode is the code of SSLRequest message of Postgres protocol
+const sslRequestCode = 80877103
+
+// sqlDB is database/sql handle of the primary created by SQLDB on first use
+type sqlDB struct {
+	once sync.Once
+	db   *sql.DB
+}
+
+// SQLDB returns database/sql handle of the primary for libraries requiring it, e.g. sqlc generated code.
+// Connections of the handle are opened with the address, dialer, TLS config, user, password, database and
+// application name of the primary, credentials of WithCredentials are shared. Pool of the handle is limited
+// by pool options of the primary, but connections are not shared with it. OnConnect of the primary isn't run.
+// The handle is created on first call and is closed by Close of the client, ErrShutdown is returned after it
+func (w *dbWrapper) SQLDB() (*sql.DB, error) {
+	w.sql.once.Do(func() {
+		opts := w.primary().Options()
+		w.sql.db = sql.OpenDB(sqlConnector{primary: w.primary})
+		w.sql.db.SetMaxOpenConns(opts.PoolSize)
+		w.sql.db.SetMaxIdleConns(opts.PoolSize)
+		w.sql.db.SetConnMaxLifetime(opts.MaxConnAge)
+		w.sql.db.SetConnMaxIdleTime(opts.IdleTimeout)
+	})
+	if w.sql.db == nil {
+		return nil, ErrShutdown
+	}
+	return w.sql.db, nil
+}
+
+// close closes the handle if it is created, it isn't created after
+func (s *sqlDB) close() error {
+	var err error
+	s.once.Do(func() {})
+	if s.db != nil {
+		err = s.db.Close()
+	}
+	return err
+}
+
+// sqlConnector opens lib/pq connections with options of the current handle of the primary
+type sqlConnector struct {
+	primary func() *pg.DB
+}
+
+func (c sqlConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	opts := c.primary().Options()
+	return pq.DialOpen(sqlDialer{ctx: ctx, opts: opts}, sqlDSN(opts))
+}
+
+func (c sqlConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// sqlDSN returns lib/pq DSN of opts, TLS is negotiated by sqlDialer, so lib/pq doesn't request it
+func sqlDSN(opts *pg.Options) string {
+	params := map[string]string{
+		"user":             opts.User,
+		"password":         opts.Password,
+		"dbname":           opts.Database,
+		"application_name": opts.ApplicationName,
+		"sslmode":          "disable",
+	}
+	if opts.DialTimeout > 0 {
+		params["connect_timeout"] = fmt.Sprint(int((opts.DialTimeout + time.Second - 1) / time.Second))
+	}
+
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[k])
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", k, v))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// sqlDialer dials the primary with the dialer of opts and negotiates TLS with TLS config of opts
+type sqlDialer struct {
+	ctx  context.Context
+	opts *pg.Options
+}
+
+func (d sqlDialer) Dial(string, string) (net.Conn, error) {
+	return d.dial(d.ctx)
+}
+
+func (d sqlDialer) DialTimeout(_, _ string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+	return d.dial(ctx)
+}
+
+// dial dials address of opts within ctx of Connect, network and address of lib/pq DSN are ignored
+func (d sqlDialer) dial(ctx context.Context) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if d.opts.Dialer != nil {
+		conn, err = d.opts.Dialer(ctx, d.opts.Network, d.opts.Addr)
+	} else {
+		conn, err = (&net.Dialer{Timeout: d.opts.DialTimeout}).DialContext(ctx, d.opts.Network, d.opts.Addr)
+	}
+	if err != nil || d.opts.TLSConfig == nil {
+		return conn, err
+	}
+
+	tlsConn, err := negotiateTLS(ctx, conn, d.opts.TLSConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// negotiateTLS sends SSLRequest and makes TLS handshake if the server accepts it
+func negotiateTLS(ctx context.Context, conn net.Conn, cfg *tls.Config) (net.Conn, error) {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if response[0] != 'S' {
+		return nil, errors.New("pg: SSL is not enabled on the server")
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
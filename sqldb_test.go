@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDbWrapper_SQLDB(t *testing.T) {
+	client := NewDbClient(pg.Connect(&pg.Options{Addr: "127.0.0.1:1", PoolSize: 3}))
+
+	sqlDB, err := client.SQLDB()
+	require.NoError(t, err)
+	same, _ := client.WithContext(context.Background()).SQLDB()
+	assert.Same(t, sqlDB, same)
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Error(t, sqlDB.PingContext(ctx))
+
+	require.NoError(t, client.Close())
+	assert.Error(t, sqlDB.PingContext(ctx))
+
+	// the handle isn't created after close
+	client = NewDbClient(pg.Connect(&pg.Options{Addr: "127.0.0.1:1"}))
+	require.NoError(t, client.Close())
+	_, err = client.SQLDB()
+	assert.ErrorIs(t, err, ErrShutdown)
+}
+
+func TestSQLDSN(t *testing.T) {
+	dsn := sqlDSN(&pg.Options{User: "user", Password: `p'a\ss`, Database: "db", DialTimeout: 1500 * time.Millisecond})
+	assert.Equal(t, `connect_timeout='2' dbname='db' password='p\'a\\ss' sslmode='disable' user='user'`, dsn)
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// pgStatStatementsExecTimeVersion is the server version pg_stat_statements renamed total_time to total_exec_time in
+const pgStatStatementsExecTimeVersion = 130000
+
+// Stats is a state of the client for debugging endpoints
+type Stats struct {
+	// Pools are stats of connection pools of the primary followed by replicas
+	Pools []NodeStats
+	// TopQueries are queries of the database taking the most total time, see WithTopQueries
+	TopQueries []QueryStats
+}
+
+// NodeStats are stats of connection pool of the primary or replica
+type NodeStats struct {
+	Addr string
+	pg.PoolStats
+}
+
+// QueryStats are stats of normalized query from pg_stat_statements
+type QueryStats struct {
+	Query     string
+	Calls     int64
+	Rows      int64
+	TotalTime time.Duration
+	MeanTime  time.Duration
+}
+
+// ActiveQuery is a backend of the application from pg_stat_activity
+type ActiveQuery struct {
+	// Addr is address of the primary or replica the backend runs on
+	Addr          string
+	PID           int
+	State         string
+	Query         string
+	QueryStart    time.Time
+	Duration      time.Duration
+	WaitEventType string
+	WaitEvent     string
+	ClientAddr    string
+}
+
+// WithTopQueries makes Stats return top queries of the database taking the most total time from pg_stat_statements
+// of the primary, the extension has to be installed
+func WithTopQueries(top int) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		w.topQueries = top
+		return w
+	})
+}
+
+// Stats returns stats of connection pools and top queries of pg_stat_statements if WithTopQueries is enabled.
+// Error of reading pg_stat_statements is returned with the pool stats
+func (w *dbWrapper) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	for _, db := range w.dbs() {
+		node := NodeStats{Addr: db.Options().Addr}
+		if poolStats := db.PoolStats(); poolStats != nil {
+			node.PoolStats = *poolStats
+		}
+		stats.Pools = append(stats.Pools, node)
+	}
+
+	if w.topQueries <= 0 {
+		return stats, nil
+	}
+	var err error
+	stats.TopQueries, err = topQueries(ctx, w.primary(), w.topQueries)
+	return stats, err
+}
+
+// ActiveQueries returns backends of the primary and replicas with application name of the client from
+// pg_stat_activity, except the ones reading it
+func (w *dbWrapper) ActiveQueries(ctx context.Context) ([]ActiveQuery, error) {
+	var active []ActiveQuery
+	for _, db := range w.dbs() {
+		queries, err := QueryActiveQueries(ctx, db, db.Options().Addr)
+		if err != nil {
+			return nil, err
+		}
+		active = append(active, queries...)
+	}
+	return active, nil
+}
+
+// QueryActiveQueries reads backends with application name of the connection of db from pg_stat_activity,
+// except the one reading it, addr is the address of the database reported in ActiveQuery
+func QueryActiveQueries(ctx context.Context, db orm.DB, addr string) ([]ActiveQuery, error) {
+	var rows []struct {
+		PID           int
+		State         string
+		Query         string
+		QueryStart    time.Time
+		Duration      float64
+		WaitEventType string
+		WaitEvent     string
+		ClientAddr    string
+	}
+	_, err := db.QueryContext(ctx, &rows, `SELECT pid, COALESCE(state, '') AS state, query, query_start,
+		COALESCE(EXTRACT(EPOCH FROM now() - query_start), 0) AS duration,
+		COALESCE(wait_event_type, '') AS wait_event_type, COALESCE(wait_event, '') AS wait_event,
+		COALESCE(host(client_addr), '') AS client_addr
+		FROM pg_stat_activity
+		WHERE application_name = current_setting('application_name') AND pid <> pg_backend_pid()
+		ORDER BY query_start`)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]ActiveQuery, 0, len(rows))
+	for _, r := range rows {
+		active = append(active, ActiveQuery{
+			Addr:          addr,
+			PID:           r.PID,
+			State:         r.State,
+			Query:         r.Query,
+			QueryStart:    r.QueryStart,
+			Duration:      time.Duration(r.Duration * float64(time.Second)),
+			WaitEventType: r.WaitEventType,
+			WaitEvent:     r.WaitEvent,
+			ClientAddr:    r.ClientAddr,
+		})
+	}
+	return active, nil
+}
+
+// topQueries reads top queries of the current database from pg_stat_statements
+func topQueries(ctx context.Context, db *pg.DB, top int) ([]QueryStats, error) {
+	var version int
+	if _, err := db.QueryOneContext(ctx, pg.Scan(&version), "SHOW server_version_num"); err != nil {
+		return nil, err
+	}
+	totalTime, meanTime := "total_time", "mean_time"
+	if version >= pgStatStatementsExecTimeVersion {
+		totalTime, meanTime = "total_exec_time", "mean_exec_time"
+	}
+
+	var rows []struct {
+		Query     string
+		Calls     int64
+		Rows      int64
+		TotalTime float64
+		MeanTime  float64
+	}
+	_, err := db.QueryContext(ctx, &rows, `SELECT query, calls, rows, ? AS total_time, ? AS mean_time
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+		ORDER BY 4 DESC LIMIT ?`, pg.Ident(totalTime), pg.Ident(meanTime), top)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]QueryStats, 0, len(rows))
+	for _, r := range rows {
+		// times of pg_stat_statements are in milliseconds
+		stats = append(stats, QueryStats{
+			Query:     r.Query,
+			Calls:     r.Calls,
+			Rows:      r.Rows,
+			TotalTime: time.Duration(r.TotalTime * float64(time.Millisecond)),
+			MeanTime:  time.Duration(r.MeanTime * float64(time.Millisecond)),
+		})
+	}
+	return stats, nil
+}
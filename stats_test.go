@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDbWrapper_Stats(t *testing.T) {
+	unreachable := func(addr string) *pg.DB {
+		return pg.Connect(&pg.Options{Addr: addr})
+	}
+
+	client := NewDbClientWithReplicas(unreachable("127.0.0.1:1"), []*pg.DB{unreachable("127.0.0.1:2")})
+	defer client.Close()
+
+	stats, err := client.Stats(context.Background())
+	require.NoError(t, err)
+	require.Len(t, stats.Pools, 2)
+	assert.Equal(t, "127.0.0.1:1", stats.Pools[0].Addr)
+	assert.Equal(t, "127.0.0.1:2", stats.Pools[1].Addr)
+	assert.Empty(t, stats.TopQueries)
+
+	_, err = client.ActiveQueries(context.Background())
+	assert.Error(t, err)
+
+	client = NewDbClient(unreachable("127.0.0.1:1"), WithTopQueries(10))
+	defer client.Close()
+	stats, err = client.Stats(context.Background())
+	assert.Error(t, err)
+	assert.Len(t, stats.Pools, 1)
+}
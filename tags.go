@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	orm "github.com/go-pg/pg/v10/orm"
+)
+
+// queryTagsKey is the context key of query tags, distinct type keeps it apart from keys of other context values
+type queryTagsKey struct{}
+
+// tagValueEscaper percent-encodes characters breaking the comment or treated as query params by go-pg formatter
+var tagValueEscaper = strings.NewReplacer("%", "%25", "?", "%3F", "'", "%27", "*", "%2A", "\n", "%0A", "\r", "%0D")
+
+// WithQueryTags returns context which queries are tagged with SQLCommenter-style comment, e.g.
+// `/*endpoint='GET /agents'*/`, for correlation in pg_stat_statements and slow query logs.
+// Tags of the outer context are kept unless overridden
+func WithQueryTags(ctx context.Context, tags map[string]string) context.Context {
+	prev := QueryTagsFromContext(ctx)
+	merged := make(map[string]string, len(prev)+len(tags))
+	for k, v := range prev {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, queryTagsKey{}, merged)
+}
+
+// QueryTagsFromContext returns tags stored in context with WithQueryTags
+func QueryTagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(queryTagsKey{}).(map[string]string)
+	return tags
+}
+
+// taggedCommand appends comment to the query built with Model
+type taggedCommand struct {
+	orm.QueryCommand
+	comment string
+}
+
+func (q *taggedCommand) AppendQuery(fmter orm.QueryFormatter, b []byte) ([]byte, error) {
+	b, err := q.QueryCommand.AppendQuery(fmter, b)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(b, ' '), q.comment...), nil
+}
+
+// tagQuery returns query with comment of ctx tags, queries of other types than string and QueryCommand
+// are returned as is
+func tagQuery(ctx context.Context, query interface{}) interface{} {
+	if ctx == nil {
+		return query
+	}
+	comment := tagsComment(QueryTagsFromContext(ctx))
+	if comment == "" {
+		return query
+	}
+
+	switch q := query.(type) {
+	case orm.QueryCommand:
+		return &taggedCommand{QueryCommand: q, comment: comment}
+	case string:
+		trimmed := strings.TrimRight(q, " \t\r\n")
+		if strings.HasSuffix(trimmed, ";") {
+			return strings.TrimSuffix(trimmed, ";") + " " + comment + ";"
+		}
+		return trimmed + " " + comment
+	}
+	return query
+}
+
+// tagsComment formats tags sorted by key as SQL comment
+func tagsComment(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", tagValueEscaper.Replace(k), tagValueEscaper.Replace(tags[k])))
+	}
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
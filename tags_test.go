@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTags(t *testing.T) {
+	ctx := WithQueryTags(context.Background(), map[string]string{"endpoint": "GET /agents?id=1", "app": "api"})
+	ctx = WithQueryTags(ctx, map[string]string{"app": "worker's"})
+	assert.Equal(t, map[string]string{"endpoint": "GET /agents?id=1", "app": "worker's"}, QueryTagsFromContext(ctx))
+	assert.Equal(t, QueryTagsFromContext(ctx), QueryTagsFromContext(WithPrimary(ctx)))
+
+	comment := `/*app='worker%27s',endpoint='GET /agents%3Fid=1'*/`
+	assert.Equal(t, "SELECT 1 "+comment, tagQuery(ctx, "SELECT 1 \n"))
+	assert.Equal(t, "SELECT 1 "+comment+";", tagQuery(ctx, "SELECT 1;"))
+	assert.Equal(t, "SELECT 1", tagQuery(context.Background(), "SELECT 1"))
+
+	q := tagQuery(ctx, orm.NewSelectQuery(orm.NewQuery(nil, &replicaModel{}).Where("id = ?", 1)))
+	cmd, ok := q.(orm.QueryCommand)
+	assert.True(t, ok)
+	assert.Equal(t, orm.SelectOp, cmd.Operation())
+
+	b, err := cmd.AppendQuery(orm.NewFormatter(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `SELECT "replica_model"."id" FROM "replica_model" AS "replica_model" WHERE (id = 1) `+comment, string(b))
+}
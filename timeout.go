@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// queryTimeoutCancelKey is the Stash key of cancel func of query timeout, distinct type keeps it apart from keys of other hooks
+type queryTimeoutCancelKey struct{}
+
+// WithDefaultQueryTimeout limits queries of the primary and replicas by timeout unless context of the query already
+// has deadline, so query of a forgotten context.Background() can't hold connection forever. Go-pg cancels the query
+// on the server when the deadline is exceeded
+func WithDefaultQueryTimeout(timeout time.Duration) Option {
+	return option(func(w *dbWrapper) *dbWrapper {
+		for _, db := range w.dbs() {
+			db.AddQueryHook(queryTimeout{timeout: timeout})
+		}
+		return w
+	})
+}
+
+// queryTimeout is a query hook setting deadline to context of the query without one
+type queryTimeout struct {
+	timeout time.Duration
+}
+
+func (h queryTimeout) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	if event.Stash == nil {
+		event.Stash = make(map[interface{}]interface{})
+	}
+	event.Stash[queryTimeoutCancelKey{}] = cancel
+	return ctx, nil
+}
+
+func (h queryTimeout) AfterQuery(_ context.Context, event *pg.QueryEvent) error {
+	if cancel, ok := event.Stash[queryTimeoutCancelKey{}].(context.CancelFunc); ok {
+		cancel()
+	}
+	return nil
+}
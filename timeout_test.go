@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+// deadlineHook records deadline of the query context
+type deadlineHook struct {
+	deadline time.Time
+	ok       bool
+	ctx      context.Context
+}
+
+func (h *deadlineHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	h.deadline, h.ok = ctx.Deadline()
+	h.ctx = ctx
+	return ctx, nil
+}
+
+func (h *deadlineHook) AfterQuery(context.Context, *pg.QueryEvent) error {
+	return nil
+}
+
+func TestWithDefaultQueryTimeout(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	client := NewDbClient(conn, WithDefaultQueryTimeout(time.Minute))
+	defer client.Close()
+	hook := &deadlineHook{}
+	conn.AddQueryHook(hook)
+
+	_, _ = client.Exec("SELECT 1")
+	assert.True(t, hook.ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), hook.deadline, 5*time.Second)
+	// the context is canceled when the query is done
+	assert.ErrorIs(t, hook.ctx.Err(), context.Canceled)
+
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	_, _ = client.Db().ExecContext(ctx, "SELECT 1")
+	assert.True(t, hook.ok)
+	assert.Equal(t, deadline, hook.deadline)
+}
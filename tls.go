@@ -0,0 +1,138 @@
+package database
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	pg "github.com/go-pg/pg/v10"
+)
+
+// DSN parameters of certificates parsed by ConnectWithDSN, named as the ones of libpq
+const (
+	SSLRootCertParam = "sslrootcert"
+	SSLCertParam     = "sslcert"
+	SSLKeyParam      = "sslkey"
+)
+
+var tlsParams = []string{SSLRootCertParam, SSLCertParam, SSLKeyParam}
+
+// TLSFiles are paths of PEM encoded certificates
+type TLSFiles struct {
+	// RootCert is CA bundle the server certificate is verified with, system roots are used if empty
+	RootCert string
+	// Cert and Key are client certificate and its key, client certificate is not sent if empty
+	Cert string
+	Key  string
+}
+
+// NewTLSConfig returns TLS config of sslmode: verify-full verifies the server certificate and its host name
+// serverName, verify-ca verifies the server certificate only, allow, prefer and require don't verify it
+// and disable returns nil config
+func NewTLSConfig(sslmode, serverName string, files TLSFiles) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch sslmode {
+	case "disable":
+		return nil, nil
+	case "allow", "prefer", "require":
+		cfg.InsecureSkipVerify = true //nolint
+	case "verify-ca":
+		// host name isn't verified, so the chain is verified by VerifyPeerCertificate
+		cfg.InsecureSkipVerify = true //nolint
+		cfg.VerifyPeerCertificate = verifyChain(cfg)
+	case "verify-full":
+		cfg.ServerName = serverName
+	default:
+		return nil, fmt.Errorf("sslmode '%s' is not supported", sslmode)
+	}
+
+	if files.RootCert != "" {
+		pem, err := os.ReadFile(files.RootCert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", files.RootCert)
+		}
+	}
+	if files.Cert != "" || files.Key != "" {
+		cert, err := tls.LoadX509KeyPair(files.Cert, files.Key)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// WithTLS sets TLS config of connections to the primary, it is applied by Connect and ConnectWithDSN. Server name
+// of the config verifying the server certificate is set to the host of the primary if empty
+func WithTLS(cfg *tls.Config) Option {
+	return Option{name: "WithTLS", configure: func(opts *pg.Options) {
+		opts.TLSConfig = withServerName(cfg.Clone(), opts.Addr)
+	}}
+}
+
+// configureTLS sets TLS config of sslmode and certificate params of DSN to cfg. pg.ParseURL sets config
+// without server name, which fails verify-full handshake, and doesn't support verify-ca and certificate files
+func configureTLS(cfg *pg.Options, dsn string, params url.Values) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return err
+	}
+	sslmode := u.Query().Get("sslmode")
+	if len(params) == 0 && sslmode != "verify-full" && sslmode != "verify-ca" {
+		return nil
+	}
+	if sslmode == "" {
+		return errors.New("sslmode is required with certificate parameters")
+	}
+
+	host, _, _ := net.SplitHostPort(cfg.Addr)
+	cfg.TLSConfig, err = NewTLSConfig(sslmode, host, TLSFiles{
+		RootCert: params.Get(SSLRootCertParam),
+		Cert:     params.Get(SSLCertParam),
+		Key:      params.Get(SSLKeyParam),
+	})
+	return err
+}
+
+// withServerName sets server name of cfg verifying the server certificate to host of addr
+func withServerName(cfg *tls.Config, addr string) *tls.Config {
+	if cfg == nil || cfg.InsecureSkipVerify || cfg.ServerName != "" {
+		return cfg
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		cfg.ServerName = host
+	}
+	return cfg
+}
+
+// verifyChain returns VerifyPeerCertificate verifying the server certificate chain with roots of cfg
+func verifyChain(cfg *tls.Config) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+		certs := make([]*x509.Certificate, 0, len(rawCerts))
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+
+		opts := x509.VerifyOptions{Roots: cfg.RootCAs, Intermediates: x509.NewCertPool()}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
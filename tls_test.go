@@ -0,0 +1,96 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pg "github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	certFile, keyFile, der := writeTestCert(t)
+
+	cfg, err := NewTLSConfig("verify-full", "db.local", TLSFiles{RootCert: certFile, Cert: certFile, Key: keyFile})
+	require.NoError(t, err)
+	assert.Equal(t, "db.local", cfg.ServerName)
+	assert.False(t, cfg.InsecureSkipVerify)
+	assert.NotNil(t, cfg.RootCAs)
+	assert.Len(t, cfg.Certificates, 1)
+
+	cfg, err = NewTLSConfig("verify-ca", "db.local", TLSFiles{RootCert: certFile})
+	require.NoError(t, err)
+	assert.True(t, cfg.InsecureSkipVerify)
+	assert.NoError(t, cfg.VerifyPeerCertificate([][]byte{der}, nil))
+
+	cfg, err = NewTLSConfig("verify-ca", "db.local", TLSFiles{})
+	require.NoError(t, err)
+	assert.Error(t, cfg.VerifyPeerCertificate([][]byte{der}, nil))
+
+	cfg, err = NewTLSConfig("disable", "", TLSFiles{})
+	require.NoError(t, err)
+	assert.Nil(t, cfg)
+
+	_, err = NewTLSConfig("unknown", "", TLSFiles{})
+	assert.Error(t, err)
+	_, err = NewTLSConfig("verify-full", "", TLSFiles{RootCert: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestConfigureTLS(t *testing.T) {
+	cfg, err := pg.ParseURL("postgres://user@db.local:5432/db?sslmode=verify-full")
+	require.NoError(t, err)
+	require.NoError(t, configureTLS(cfg, "postgres://user@db.local:5432/db?sslmode=verify-full", url.Values{}))
+	assert.Equal(t, "db.local", cfg.TLSConfig.ServerName)
+
+	cfg, err = pg.ParseURL("postgres://user@db.local:5432/db")
+	require.NoError(t, err)
+	err = configureTLS(cfg, "postgres://user@db.local:5432/db", url.Values{SSLRootCertParam: {"ca.pem"}})
+	assert.Error(t, err)
+}
+
+func TestConnect_WithTLS(t *testing.T) {
+	client := Connect("test", &pg.Options{Addr: "db.local:5432"}, WithTLS(&tls.Config{}))
+	defer client.Close()
+
+	assert.Equal(t, "db.local", client.Db().Options().TLSConfig.ServerName)
+}
+
+// writeTestCert writes self-signed certificate and its key into temp dir
+func writeTestCert(t *testing.T) (string, string, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db.local"},
+		DNSNames:              []string{"db.local"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, der
+}
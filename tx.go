@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// FromContext returns transaction stored in context by RunInTx, nil if there is no transaction
+func FromContext(ctx context.Context) *pg.Tx {
+	tx, ok := ctx.Value(&TxKey).(*pg.Tx)
+	if !ok {
+		return nil
+	}
+	return tx
+}
+
+// InTx reports whether ctx contains transaction of RunInTx, either of go-pg or of another backend,
+// e.g. pgxclient, which transaction isn't returned by FromContext
+func InTx(ctx context.Context) bool {
+	return ctx.Value(&TxKey) != nil
+}
+
+// afterCommitKey is the context key of callbacks registered with AfterCommit
+type afterCommitKey struct{}
+
+// afterCommit is the list of callbacks of the transaction
+type afterCommit struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+// AfterCommit registers fn to be called after the transaction of ctx started by RunInTx is committed, fn is not
+// called if the transaction is rolled back. Callbacks are called in order of registration. fn is called immediately
+// if ctx has no transaction of RunInTx, e.g. to remove cached records changed either within transaction or without it
+func AfterCommit(ctx context.Context, fn func()) {
+	callbacks, ok := ctx.Value(afterCommitKey{}).(*afterCommit)
+	if !ok {
+		fn()
+		return
+	}
+	callbacks.mu.Lock()
+	callbacks.fns = append(callbacks.fns, fn)
+	callbacks.mu.Unlock()
+}
+
+// ContextWithAfterCommit returns ctx of a new transaction collecting AfterCommit callbacks and function calling them,
+// it is called by implementations of Client.RunInTx after commit
+func ContextWithAfterCommit(ctx context.Context) (context.Context, func()) {
+	callbacks := &afterCommit{}
+	return context.WithValue(ctx, afterCommitKey{}, callbacks), func() {
+		callbacks.mu.Lock()
+		fns := callbacks.fns
+		callbacks.fns = nil
+		callbacks.mu.Unlock()
+		for _, fn := range fns {
+			fn()
+		}
+	}
+}
+
+// RunInTx executes fn within transaction, the transaction is stored in context passed to fn only, so clients bound
+// to the context with WithContext run queries within it. The transaction is rolled back if fn returns an error,
+// panics or ctx is done, otherwise it is committed. Failed rollback is logged with the logger of ctx
+// (see ContextWithLogger) or the one of WithLogger. search_path of ContextWithSearchPath is set for the transaction.
+// Callbacks of AfterCommit are called after commit. If ctx already contains transaction, fn joins it
+func (w *dbWrapper) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if FromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	if !w.drain.Acquire(false) {
+		return ErrShutdown
+	}
+	defer w.drain.Release()
+
+	tx, err := w.primary().BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := setSearchPath(ctx, tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	txCtx, committed := ContextWithAfterCommit(context.WithValue(ctx, &TxKey, tx))
+	if err := fn(txCtx); err != nil || ctx.Err() != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			LogRollbackError(ctx, w.logger, rollbackErr)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed()
+	return nil
+}
+
+// LogRollbackError logs failed rollback of transaction with the logger of ctx, fallback or standard logger
+func LogRollbackError(ctx context.Context, fallback Logger, err error) {
+	logger := LoggerFromContext(ctx, fallback)
+	if logger == nil {
+		log.Println(fmt.Sprintf("failed to rollback transaction: %s", err.Error()))
+		return
+	}
+	logger.Error("failed to rollback transaction", "error", err)
+}
@@ -0,0 +1,50 @@
+//go:build integration
+// +build integration
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbWrapper_RunInTx(t *testing.T) {
+	conn := pg.Connect(&cfg)
+	defer conn.Close()
+	client := NewDbClient(conn)
+
+	_, err := client.Exec("CREATE TABLE IF NOT EXISTS tx_test (id INT PRIMARY KEY)")
+	assert.Nil(t, err)
+	defer client.Exec("DROP TABLE tx_test")
+
+	count := func() (n int) {
+		_, err := client.QueryOne(pg.Scan(&n), "SELECT count(*) FROM tx_test")
+		assert.Nil(t, err)
+		return n
+	}
+
+	err = client.RunInTx(context.Background(), func(ctx context.Context) error {
+		assert.NotNil(t, FromContext(ctx))
+		_, err := client.WithContext(ctx).Exec("INSERT INTO tx_test VALUES (1)")
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count())
+
+	errRollback := errors.New("rollback")
+	err = client.RunInTx(context.Background(), func(ctx context.Context) error {
+		return client.RunInTx(ctx, func(nested context.Context) error {
+			assert.Equal(t, FromContext(ctx), FromContext(nested))
+			if _, err := client.WithContext(nested).Exec("INSERT INTO tx_test VALUES (2)"); err != nil {
+				return err
+			}
+			return errRollback
+		})
+	})
+	assert.Equal(t, errRollback, err)
+	assert.Equal(t, 1, count())
+}
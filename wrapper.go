@@ -3,7 +3,9 @@ package database
 import (
 	"context"
 	"io"
+	"strings"
 
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
 	pg "github.com/go-pg/pg/v10"
 	orm "github.com/go-pg/pg/v10/orm"
 )
@@ -13,50 +15,57 @@ type dbWrapper struct {
 	conn *pg.DB
 	tx   *pg.Tx
 
-	wrappedProcessor func(ctx context.Context, processor func() (orm.Result, error), query string, model interface{}) (orm.Result, error)
+	replicas *replicaPool
+	health   *healthChecker
+
+	middleware  []Middleware
+	queryErrors bool
+	logger      Logger
+	credentials *credentialsRefresher
+	drain       *drain
+	// topQueries is the number of queries of pg_stat_statements returned by Stats
+	topQueries int
+	sql        *sqlDB
 }
 
+// NewDbClient creates client of conn, options configuring connection (e.g. WithPool) are ignored with a warning,
+// connect with Connect or ConnectWithDSN to apply them
 func NewDbClient(conn *pg.DB, options ...Option) Client {
-	dbc := &dbWrapper{conn: conn}
-	for _, o := range options {
-		dbc = o(dbc)
-	}
+	w := newDbClient(conn, options)
+	w.warnConnectOptions(options)
+	return w
+}
 
-	return dbc
+func newDbClient(conn *pg.DB, options []Option) *dbWrapper {
+	dbc := &dbWrapper{conn: conn, drain: newDrain(), sql: &sqlDB{}}
+	conn.AddQueryHook(dbc.drain)
+	return applyOptions(dbc, options)
 }
 
 func (w *dbWrapper) Db() *pg.DB {
+	return w.primary()
+}
+
+// primary returns the primary, its handle is replaced on refresh of credentials of WithCredentials
+func (w *dbWrapper) primary() *pg.DB {
+	if w.credentials != nil {
+		return w.credentials.db()
+	}
 	return w.conn
 }
 
-// DEPRECATED. Use Db().Begin()
+// Tx returns transaction of the context the client is bound to with WithContext
 func (w *dbWrapper) Tx() *pg.Tx {
 	return w.tx
 }
 
-// DEPRECATED. Use Db().Begin()
-func (w *dbWrapper) StartTx() (*pg.Tx, error) {
-	tx, err := w.conn.Begin()
-	if err != nil {
-		return nil, err
+// queryContext returns context queries of Exec and Query run with: context the client is bound to with WithContext
+// or Context
+func (w *dbWrapper) queryContext() context.Context {
+	if w.ctx != nil {
+		return w.ctx
 	}
-
-	w.tx = tx
-	return tx, nil
-}
-
-// DEPRECATED. Use Db().Begin() with pg.Tx.Commit()
-func (w *dbWrapper) Commit() error {
-	err := w.tx.Commit()
-	w.tx = nil
-	return err
-}
-
-// DEPRECATED. Use Db().Begin() with pg.Tx.Rollback()
-func (w *dbWrapper) Rollback() error {
-	err := w.tx.Rollback()
-	w.tx = nil
-	return err
+	return w.Context()
 }
 
 // Context ...
@@ -64,78 +73,80 @@ func (w *dbWrapper) Context() context.Context {
 	if w.tx != nil {
 		return w.tx.Context()
 	}
-	return w.conn.Context()
+	return w.primary().Context()
 }
 
-// WithContext ...
+// WithContext returns a shallow copy of the client bound to ctx, so the client is safe for concurrent use.
+// The copy runs queries within transaction of ctx started by RunInTx, if any
 func (w *dbWrapper) WithContext(ctx context.Context) Client {
-	w.ctx = ctx
-	w.tx = getTxFromContext(ctx)
-	return w
+	c := *w
+	c.ctx = ctx
+	c.tx = FromContext(ctx)
+	return &c
 }
 
-// Close ...
+// Close stops health checks and closes the primary, replicas and database/sql handle of SQLDB
 func (w *dbWrapper) Close() error {
-	return w.conn.Close()
+	if w.health != nil {
+		w.health.close()
+	}
+	if w.credentials != nil {
+		w.credentials.close()
+	}
+
+	err := w.sql.close()
+	for _, db := range w.dbs() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// dbs returns the primary followed by replicas
+func (w *dbWrapper) dbs() []*pg.DB {
+	dbs := []*pg.DB{w.primary()}
+	if w.replicas != nil {
+		dbs = append(dbs, w.replicas.dbs...)
+	}
+	return dbs
 }
 
 // Model ...
 func (w *dbWrapper) Model(model ...interface{}) *orm.Query {
-	return orm.NewQuery(w, model...).Context(w.ctx)
+	q := orm.NewQuery(w, model...)
+	if w.ctx != nil {
+		q = q.Context(w.ctx)
+	}
+	return q
 }
 
 // Select ...
 func (w *dbWrapper) Select(model interface{}) error {
-	if w.tx != nil {
-		return w.tx.Model(model).WherePK().Select()
-	}
-	return w.conn.Model(model).WherePK().Select()
+	return w.Model(model).WherePK().Select()
 }
 
 // Insert ...
 func (w *dbWrapper) Insert(model ...interface{}) (err error) {
-	if w.tx != nil {
-		_, err = w.tx.Model(model...).Insert()
-	} else {
-		_, err = w.conn.Model(model...).Insert()
-	}
+	_, err = w.Model(model...).Insert()
 	return err
 }
 
 // Update ...
 func (w *dbWrapper) Update(model interface{}) (err error) {
-	if w.tx != nil {
-		_, err = w.tx.Model(model).WherePK().Update()
-	} else {
-		_, err = w.conn.Model(model).WherePK().Update()
-	}
+	_, err = w.Model(model).WherePK().Update()
 	return err
 }
 
 // Delete ...
 func (w *dbWrapper) Delete(model interface{}) (err error) {
-	if w.tx != nil {
-		_, err = w.tx.Model(model).WherePK().Delete()
-	} else {
-		_, err = w.conn.Model(model).WherePK().Delete()
-	}
+	_, err = w.Model(model).WherePK().Delete()
 	return err
 }
 
 // Exec ...
 func (w *dbWrapper) Exec(query interface{}, params ...interface{}) (orm.Result, error) {
-	processor := func() (orm.Result, error) {
-		if w.tx != nil {
-			return w.tx.Exec(query, params...)
-		}
-		return w.conn.Exec(query, params...)
-	}
-
-	if w.wrappedProcessor == nil {
-		return processor()
-	}
-
-	return w.wrappedProcessor(w.conn.Context(), processor, w.queryString(query), nil)
+	return w.ExecContext(w.queryContext(), query, params...)
 }
 
 // ExecOne ...
@@ -153,18 +164,7 @@ func (w *dbWrapper) ExecOne(query interface{}, params ...interface{}) (orm.Resul
 
 // Query ...
 func (w *dbWrapper) Query(model, query interface{}, params ...interface{}) (orm.Result, error) {
-	processor := func() (orm.Result, error) {
-		if w.tx != nil {
-			return w.tx.Query(model, query, params...)
-		}
-		return w.conn.Query(model, query, params...)
-	}
-
-	if w.wrappedProcessor == nil {
-		return processor()
-	}
-
-	return w.wrappedProcessor(w.conn.Context(), processor, w.queryString(query), model)
+	return w.QueryContext(w.queryContext(), model, query, params...)
 }
 
 // QueryOne ...
@@ -185,7 +185,7 @@ func (w *dbWrapper) CopyFrom(r io.Reader, query interface{}, params ...interface
 	if w.tx != nil {
 		return w.tx.CopyFrom(r, query, params...)
 	}
-	return w.conn.CopyFrom(r, query, params...)
+	return w.primary().CopyFrom(r, query, params...)
 }
 
 // CopyTo ...
@@ -193,7 +193,7 @@ func (w *dbWrapper) CopyTo(iw io.Writer, query interface{}, params ...interface{
 	if w.tx != nil {
 		return w.tx.CopyTo(iw, query, params...)
 	}
-	return w.conn.CopyTo(iw, query, params...)
+	return w.primary().CopyTo(iw, query, params...)
 }
 
 // FormatQuery ...
@@ -201,7 +201,7 @@ func (w *dbWrapper) FormatQuery(b []byte, query string, params ...interface{}) [
 	if w.tx != nil {
 		return w.tx.Formatter().FormatQuery(b, query, params...)
 	}
-	return w.conn.Formatter().FormatQuery(b, query, params...)
+	return w.primary().Formatter().FormatQuery(b, query, params...)
 }
 
 func (w *dbWrapper) assertOneRow(affected int) error {
@@ -214,6 +214,38 @@ func (w *dbWrapper) assertOneRow(affected int) error {
 	return nil
 }
 
+// queryError wraps err of failed query with pkgerr.QueryError if the client is created with WithQueryErrors,
+// pg.ErrNoRows and pg.ErrMultiRows are returned as is, so they can be compared, as well as errors checked by
+// go-pg ORM to retry the query (see ormRetried)
+func (w *dbWrapper) queryError(err error, query, model interface{}) error {
+	if err == nil || !w.queryErrors || err == pg.ErrNoRows || err == pg.ErrMultiRows || ormRetried(err, query) {
+		return err
+	}
+	var table string
+	if m, ok := model.(orm.TableModel); ok && m.Table() != nil {
+		table = string(m.Table().SQLName)
+	}
+	return pkgerr.NewQueryError(err, w.queryString(query), table)
+}
+
+// ormRetried reports whether err of query is checked by go-pg ORM to retry the query, the check asserts concrete type
+// of go-pg error, so the error can't be wrapped: integrity violation and "attempted to delete invisible tuple" of
+// insert retried by Query.SelectOrInsert and errors of Query.CountEstimate creating its function on demand.
+// Integrity violations still describe the table and the constraint (see pkgerr.AsConstraint)
+func ormRetried(err error, query interface{}) bool {
+	pgErr, ok := err.(pg.Error)
+	if !ok {
+		return false
+	}
+	switch typed := query.(type) {
+	case *orm.InsertQuery:
+		return pgErr.IntegrityViolation() || pgErr.Field('C') == "55000"
+	case string:
+		return strings.Contains(typed, "_go_pg_count_estimate_v2")
+	}
+	return false
+}
+
 func (w *dbWrapper) queryString(query interface{}) string {
 	switch typed := query.(type) {
 	case orm.QueryAppender:
@@ -228,52 +260,70 @@ func (w *dbWrapper) queryString(query interface{}) string {
 
 // ForceDelete ...
 func (w *dbWrapper) ForceDelete(values interface{}) (err error) {
-	if w.tx != nil {
-		_, err = w.tx.Model(values).WherePK().ForceDelete()
-	} else {
-		_, err = w.conn.Model(values).WherePK().ForceDelete()
-	}
+	_, err = w.Model(values).WherePK().ForceDelete()
 	return err
 }
 
-// ModelContext ...
+// ModelContext returns query run by the client with c, so it is intercepted by middleware, tagged and routed
+// to replicas as queries of Model are
 func (w *dbWrapper) ModelContext(c context.Context, model ...interface{}) *orm.Query {
-	if w.tx != nil {
-		return w.tx.ModelContext(c, model...)
-	}
-	return w.conn.ModelContext(c, model...)
+	return orm.NewQuery(w, model...).Context(c)
 }
 
 // ExecContext ...
 func (w *dbWrapper) ExecContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
-	if w.tx != nil {
-		return w.tx.ExecContext(c, query, params...)
-	}
-	return w.conn.ExecContext(c, query, params...)
+	res, err := w.process(c, query, nil, func(c context.Context) (orm.Result, error) {
+		tagged := tagQuery(c, query)
+		if w.tx != nil {
+			return w.tx.ExecContext(c, tagged, params...)
+		}
+		return inSearchPath(c, w.primary(), func(db orm.DB) (orm.Result, error) {
+			return db.ExecContext(c, tagged, params...)
+		})
+	})
+	return res, w.queryError(err, query, nil)
 }
 
 // ExecOneContext ...
 func (w *dbWrapper) ExecOneContext(c context.Context, query interface{}, params ...interface{}) (pg.Result, error) {
-	if w.tx != nil {
-		return w.tx.ExecOneContext(c, query, params...)
-	}
-	return w.conn.ExecOneContext(c, query, params...)
+	res, err := w.process(c, query, nil, func(c context.Context) (orm.Result, error) {
+		tagged := tagQuery(c, query)
+		if w.tx != nil {
+			return w.tx.ExecOneContext(c, tagged, params...)
+		}
+		return inSearchPath(c, w.primary(), func(db orm.DB) (orm.Result, error) {
+			return db.ExecOneContext(c, tagged, params...)
+		})
+	})
+	return res, w.queryError(err, query, nil)
 }
 
 // QueryContext ...
 func (w *dbWrapper) QueryContext(c context.Context, model, query interface{}, params ...interface{}) (pg.Result, error) {
-	if w.tx != nil {
-		return w.tx.QueryContext(c, model, query, params...)
-	}
-	return w.conn.QueryContext(c, model, query, params...)
+	res, err := w.process(c, query, model, func(c context.Context) (orm.Result, error) {
+		tagged := tagQuery(c, query)
+		if w.tx != nil {
+			return w.tx.QueryContext(c, model, tagged, params...)
+		}
+		return inSearchPath(c, w.readDB(c, query), func(db orm.DB) (orm.Result, error) {
+			return db.QueryContext(c, model, tagged, params...)
+		})
+	})
+	return res, w.queryError(err, query, model)
 }
 
 // QueryOneContext ...
 func (w *dbWrapper) QueryOneContext(c context.Context, model, query interface{}, params ...interface{}) (pg.Result, error) {
-	if w.tx != nil {
-		return w.tx.QueryOneContext(c, model, query, params...)
-	}
-	return w.conn.QueryOneContext(c, model, query, params...)
+	res, err := w.process(c, query, model, func(c context.Context) (orm.Result, error) {
+		tagged := tagQuery(c, query)
+		if w.tx != nil {
+			return w.tx.QueryOneContext(c, model, tagged, params...)
+		}
+		return inSearchPath(c, w.readDB(c, query), func(db orm.DB) (orm.Result, error) {
+			return db.QueryOneContext(c, model, tagged, params...)
+		})
+	})
+	return res, w.queryError(err, query, model)
 }
 
 // Formatter ...
@@ -281,13 +331,5 @@ func (w *dbWrapper) Formatter() orm.QueryFormatter {
 	if w.tx != nil {
 		return w.tx.Formatter()
 	}
-	return w.conn.Formatter()
-}
-
-func getTxFromContext(ctx context.Context) *pg.Tx {
-	tx, ok := ctx.Value(&TxKey).(*pg.Tx)
-	if !ok {
-		return nil
-	}
-	return tx
+	return w.primary().Formatter()
 }
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	pkgerr "github.com/alexandr-kononykhin-vay/postgres/errors"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbWrapper_WithContext(t *testing.T) {
+	conn := pg.Connect(&pg.Options{})
+	defer conn.Close()
+	client := NewDbClient(conn)
+
+	tx := &pg.Tx{}
+	txCtx := context.WithValue(context.Background(), &TxKey, tx)
+
+	c := client.WithContext(txCtx)
+	assert.Equal(t, tx, c.Tx())
+	assert.Nil(t, client.Tx())
+	assert.Nil(t, c.WithContext(context.Background()).Tx())
+	assert.Equal(t, tx, FromContext(txCtx))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				assert.Equal(t, tx, client.WithContext(txCtx).Tx())
+			} else {
+				assert.Nil(t, client.WithContext(context.Background()).Tx())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDbWrapper_WithQueryErrors(t *testing.T) {
+	conn := pg.Connect(&pg.Options{Addr: "localhost:1"})
+	defer conn.Close()
+	client := NewDbClient(conn, WithQueryErrors())
+
+	_, err := client.Exec(`SELECT * FROM "user" WHERE "email" = 'a@b.c' AND "id" = 42`)
+	var qe *pkgerr.QueryError
+	assert.True(t, errors.As(pkgerr.Convert(context.Background(), err), &qe))
+	assert.Equal(t, "SELECT", qe.Operation)
+	assert.Equal(t, `SELECT * FROM "user" WHERE "email" = ? AND "id" = ?`, qe.Query)
+
+	_, err = NewDbClient(conn).Exec(`SELECT 1`)
+	assert.False(t, errors.As(err, &qe))
+}
+
+type pgError map[byte]string
+
+func (e pgError) Error() string {
+	return e['M']
+}
+
+func (e pgError) Field(field byte) string {
+	return e[field]
+}
+
+func (e pgError) IntegrityViolation() bool {
+	return e['C'][:2] == "23"
+}
+
+func TestOrmRetried(t *testing.T) {
+	insert := orm.NewInsertQuery(orm.NewQuery(nil))
+	assert.True(t, ormRetried(pgError{'C': "23505"}, insert))
+	assert.True(t, ormRetried(pgError{'C': "55000"}, insert))
+	assert.False(t, ormRetried(pgError{'C': "42P01"}, insert))
+	assert.False(t, ormRetried(errors.New("23505"), insert))
+	assert.False(t, ormRetried(pgError{'C': "23505"}, `INSERT INTO "user" VALUES (1)`))
+	assert.True(t, ormRetried(pgError{'C': "42883"}, "SELECT _go_pg_count_estimate_v2(?, ?)"))
+}
+
+func TestAfterCommit(t *testing.T) {
+	var calls []string
+	AfterCommit(context.Background(), func() { calls = append(calls, "immediate") })
+	assert.Equal(t, []string{"immediate"}, calls)
+
+	ctx, committed := ContextWithAfterCommit(context.Background())
+	AfterCommit(ctx, func() { calls = append(calls, "first") })
+	AfterCommit(ctx, func() { calls = append(calls, "second") })
+	assert.Len(t, calls, 1)
+	committed()
+	assert.Equal(t, []string{"immediate", "first", "second"}, calls)
+}